@@ -0,0 +1,320 @@
+// Package analysis finds mistakes in state machine definitions which are hard
+// to see by eye, without running the machine.
+//
+// Guards and choice conditions are assumed to be able to pass as well as
+// fail, so a transition is considered possible as long as its from state is
+// reachable, and no earlier unguarded transition of the event matches the
+// state. Submachines and choice branches are analyzed recursively.
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// Kind is the kind of problem reported by a Finding.
+type Kind string
+
+const (
+	// UnreachableState is a state which no sequence of events leads to from
+	// the initial state.
+	UnreachableState Kind = "unreachable-state"
+
+	// DeadEvent is an event which has no transition from any reachable state.
+	DeadEvent Kind = "dead-event"
+
+	// SinkState is a reachable state, not final, which has no
+	// transitions to another state, and doesn't exit to the supermachine.
+	SinkState Kind = "sink-state"
+
+	// Nondeterminism is a transition (or choice) which is never taken from a
+	// state, because an earlier unguarded transition of the same event
+	// matches the state first.
+	Nondeterminism Kind = "nondeterminism"
+
+	// MissingExitState is an ExitToState target which isn't a state of the
+	// supermachine.
+	MissingExitState Kind = "missing-exit-state"
+)
+
+// Finding describes a problem found in a definition.
+type Finding struct {
+	Kind Kind
+
+	// Path locates the submachine by the states it runs in, separated by
+	// "/", e.g. `running/processing`. Parallel submachines are qualified by
+	// their ID, or index, e.g. `running[video]`. Path is empty for the root
+	// machine.
+	Path string
+
+	// State and Event are set when the finding concerns them.
+	State string
+	Event string
+
+	Message string
+}
+
+func (f *Finding) String() string {
+	if f.Path == "" {
+		return fmt.Sprintf("%s: %s", f.Kind, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", f.Kind, f.Path, f.Message)
+}
+
+// Analyze reports the problems found in def and its submachines, ordered by
+// machine, then by kind.
+//
+// The finalStates, along with the FinalStates of the definitions, are
+// expected to have no transitions out of them, and aren't reported as sinks.
+// They are named by their path, e.g. `done`, or `running/success` for a
+// state of the submachine of running.
+func Analyze(def *statemachine.MachineDef, finalStates ...string) []*Finding {
+	a := &analyzer{finalStates: map[string]bool{}}
+	for _, state := range finalStates {
+		a.finalStates[state] = true
+	}
+	a.machine("", def, nil)
+	return a.findings
+}
+
+type analyzer struct {
+	finalStates map[string]bool
+	findings    []*Finding
+}
+
+func (a *analyzer) report(kind Kind, path, state, event, format string, args ...interface{}) {
+	a.findings = append(a.findings, &Finding{
+		Kind:    kind,
+		Path:    path,
+		State:   state,
+		Event:   event,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (a *analyzer) machine(path string, def *statemachine.MachineDef, supermachineDef *statemachine.MachineDef) {
+	states := def.KnownStates()
+	events := sortedEvents(def)
+
+	// edges lists the states each state has transitions to.
+	edges := map[string][]string{}
+	for _, event := range events {
+		for _, state := range states {
+			edges[state] = append(edges[state], targets(def.Events[event], state)...)
+		}
+	}
+	for _, state := range states {
+		edges[state] = append(edges[state], targets(&statemachine.EventDef{Transitions: def.Always}, state)...)
+	}
+	for _, state := range sortedSubmachineStates(def) {
+		for _, submachineDef := range def.Submachines[state] {
+			for _, callbackDef := range submachineDef.AfterCallbacks {
+				if callbackDef.ExitToState != "" {
+					edges[state] = append(edges[state], callbackDef.ExitToState)
+				}
+			}
+		}
+	}
+
+	reachable := map[string]bool{}
+	queue := []string{def.InitialState}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		if reachable[state] {
+			continue
+		}
+		reachable[state] = true
+		queue = append(queue, edges[state]...)
+	}
+
+	for _, state := range states {
+		if !reachable[state] {
+			a.report(UnreachableState, path, state, "",
+				"state '%s' is unreachable from initial state '%s'", state, def.InitialState)
+		}
+	}
+
+	for _, event := range events {
+		if !canFire(def.Events[event], states, reachable) {
+			a.report(DeadEvent, path, "", event,
+				"event '%s' has no transition from any reachable state", event)
+		}
+	}
+
+	for _, state := range states {
+		if !reachable[state] || def.IsFinalState(state) || a.finalStates[joinPath(path, state)] {
+			continue
+		}
+		isSink := !exitsToSupermachine(def, state)
+		for _, to := range edges[state] {
+			if to != state {
+				isSink = false
+			}
+		}
+		if isSink {
+			a.report(SinkState, path, state, "",
+				"state '%s' has no transitions to another state, and is not final", state)
+		}
+	}
+
+	for _, event := range events {
+		a.nondeterminism(path, event, def.Events[event], states)
+	}
+
+	for _, callbackLists := range [][]*statemachine.TransitionCallbackDef{def.BeforeCallbacks, def.AroundCallbacks, def.AfterCallbacks} {
+		for _, callbackDef := range callbackLists {
+			if callbackDef.ExitToState == "" {
+				continue
+			}
+			if supermachineDef == nil {
+				a.report(MissingExitState, path, callbackDef.ExitToState, "",
+					"exit to state '%s' is not possible from the root machine", callbackDef.ExitToState)
+			} else if !contains(supermachineDef.KnownStates(), callbackDef.ExitToState) {
+				a.report(MissingExitState, path, callbackDef.ExitToState, "",
+					"exit to state '%s' is not a state of the supermachine", callbackDef.ExitToState)
+			}
+		}
+	}
+
+	for _, state := range sortedSubmachineStates(def) {
+		submachineDefs := def.Submachines[state]
+		for i, submachineDef := range submachineDefs {
+			submachinePath := joinPath(path, state)
+			if len(submachineDefs) > 1 {
+				id := submachineDef.ID
+				if id == "" {
+					id = strconv.Itoa(i)
+				}
+				submachinePath += "[" + id + "]"
+			}
+			a.machine(submachinePath, submachineDef, def)
+		}
+	}
+}
+
+// canFire reports whether eventDef has a transition from a reachable state.
+func canFire(eventDef *statemachine.EventDef, states []string, reachable map[string]bool) bool {
+	for _, state := range states {
+		if reachable[state] && len(targets(eventDef, state)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// targets returns the states which eventDef may transition to from state.
+// Transitions after the first unguarded one which matches the state are
+// never taken, and aren't included.
+func targets(eventDef *statemachine.EventDef, state string) []string {
+	if eventDef == nil {
+		return nil
+	}
+
+	var states []string
+	for _, transitionDef := range eventDef.Transitions {
+		if !transitionDef.Matches(state) {
+			continue
+		}
+		states = append(states, transitionDef.To)
+		if !transitionDef.IsGuarded() {
+			return states
+		}
+	}
+
+	if choiceDef := eventDef.Choice; choiceDef != nil {
+		states = append(states, targets(choiceDef.Branch(true), state)...)
+		states = append(states, targets(choiceDef.Branch(false), state)...)
+	}
+	return states
+}
+
+// nondeterminism reports the transitions of eventDef, and of its choice
+// branches, which are shadowed by an earlier unguarded transition.
+func (a *analyzer) nondeterminism(path, event string, eventDef *statemachine.EventDef, states []string) {
+	if eventDef == nil {
+		return
+	}
+
+	for _, state := range states {
+		var first int
+		shadowed := false
+		for i, transitionDef := range eventDef.Transitions {
+			if !transitionDef.Matches(state) {
+				continue
+			}
+			if shadowed {
+				a.report(Nondeterminism, path, state, event,
+					"transition %d on '%s' from '%s' to '%s' is never taken, transition %d to '%s' matches first",
+					i, event, state, transitionDef.To, first, eventDef.Transitions[first].To)
+				continue
+			}
+			if !transitionDef.IsGuarded() {
+				first = i
+				shadowed = true
+			}
+		}
+
+		if shadowed && eventDef.Choice != nil && len(targets(&statemachine.EventDef{Choice: eventDef.Choice}, state)) > 0 {
+			a.report(Nondeterminism, path, state, event,
+				"choice on '%s' from '%s' is never made, transition %d to '%s' matches first",
+				event, state, first, eventDef.Transitions[first].To)
+		}
+	}
+
+	if choiceDef := eventDef.Choice; choiceDef != nil {
+		a.nondeterminism(path, event, choiceDef.OnTrue, states)
+		a.nondeterminism(path, event, choiceDef.OnFalse, states)
+	}
+}
+
+// exitsToSupermachine reports whether transitions to state exit the machine,
+// by way of an after callback with an ExitToState.
+func exitsToSupermachine(def *statemachine.MachineDef, state string) bool {
+	for _, callbackDef := range def.AfterCallbacks {
+		if callbackDef.ExitToState == "" || contains(callbackDef.ExceptTo, state) {
+			continue
+		}
+		if len(callbackDef.To) == 0 || contains(callbackDef.To, state) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedEvents(def *statemachine.MachineDef) []string {
+	events := make([]string, 0, len(def.Events))
+	for event := range def.Events {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return events
+}
+
+func sortedSubmachineStates(def *statemachine.MachineDef) []string {
+	states := make([]string, 0, len(def.Submachines))
+	for state := range def.Submachines {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+func joinPath(path, state string) string {
+	if path == "" {
+		return state
+	}
+	return path + "/" + state
+}
+
+func contains(states []string, state string) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
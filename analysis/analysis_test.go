@@ -0,0 +1,73 @@
+package analysis_test
+
+import (
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/analysis"
+)
+
+func TestAnalyze_JoinIsAGuard(t *testing.T) {
+	machineDef, err := statemachine.LoadHCL("release.hcl", []byte(`
+		states        = ["draft", "released", "held"]
+		initial_state = "draft"
+		final_states  = ["released", "held"]
+
+		event "submit" {
+		  transition {
+		    from = ["draft"]
+		    to   = "releasing"
+		  }
+		}
+
+		event "release" {
+		  transition {
+		    from = ["releasing"]
+		    to   = "released"
+		    join = { review = "approved", build = "passed" }
+		  }
+
+		  transition {
+		    from = ["releasing"]
+		    to   = "held"
+		  }
+		}
+
+		submachine "releasing" {
+		  id            = "review"
+		  states        = ["pending", "approved"]
+		  initial_state = "pending"
+		  final_states  = ["approved"]
+
+		  event "approve" {
+		    transition {
+		      from = ["pending"]
+		      to   = "approved"
+		    }
+		  }
+		}
+
+		submachine "releasing" {
+		  id            = "build"
+		  states        = ["running", "passed"]
+		  initial_state = "running"
+		  final_states  = ["passed"]
+
+		  event "pass" {
+		    transition {
+		      from = ["running"]
+		      to   = "passed"
+		    }
+		  }
+		}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the joined transition doesn't shadow the one to held, which is
+	// reachable.
+	if findings := analysis.Analyze(machineDef); len(findings) > 0 {
+		t.Errorf("got findings %v, want none", findings)
+	}
+}
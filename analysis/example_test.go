@@ -0,0 +1,74 @@
+package analysis_test
+
+import (
+	"fmt"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/analysis"
+)
+
+func ExampleAnalyze() {
+	machineDef, err := statemachine.LoadHCL("process.hcl", []byte(`
+		states        = ["stopped", "starting", "running", "crashed", "archived"]
+		initial_state = "stopped"
+
+		event "start" {
+		  transition {
+		    from = ["stopped"]
+		    to   = "starting"
+		  }
+		}
+
+		event "tick" {
+		  transition {
+		    from = ["starting"]
+		    to   = "running"
+		  }
+
+		  transition {
+		    from = ["starting"]
+		    to   = "crashed"
+		    if   = [has-crashed]
+		  }
+		}
+
+		event "unarchive" {
+		  transition {
+		    from = ["archived"]
+		    to   = "stopped"
+		  }
+		}
+
+		submachine "running" {
+		  states        = ["serving", "draining", "drained"]
+		  initial_state = "serving"
+
+		  event "drain" {
+		    transition {
+		      from = ["serving"]
+		      to   = "draining"
+		    }
+		  }
+
+		  after_transition {
+		    to            = ["draining"]
+		    exit_to_state = "stopped"
+		  }
+		}
+	`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, finding := range analysis.Analyze(machineDef) {
+		fmt.Println(finding)
+	}
+
+	// Output:
+	// unreachable-state: state 'crashed' is unreachable from initial state 'stopped'
+	// unreachable-state: state 'archived' is unreachable from initial state 'stopped'
+	// dead-event: event 'unarchive' has no transition from any reachable state
+	// nondeterminism: transition 1 on 'tick' from 'starting' to 'crashed' is never taken, transition 0 to 'running' matches first
+	// unreachable-state: running: state 'drained' is unreachable from initial state 'serving'
+}
@@ -1,13 +1,19 @@
 package statemachine
 
-// ChoiceCondition may accept Transition object as input, and it must
-// return a bool type.
+// ChoiceCondition may accept any of Machine, Transition, Event and
+// context.Context as input, along with payloads of the event passed to
+// Machine.FireContext, by their exact types. It must return a bool type.
 //
 // Valid ChoiceCondition types:
 //
-//  bool
+//  *bool
 // 	func() bool
 // 	func(transition statemachine.Transition) bool
+// 	func(machine statemachine.Machine, event statemachine.Event) bool
+// 	func(ctx context.Context, order *Order) bool
+//
+// The Transition of a choice condition has the state the event is fired
+// from, but not the state to transition to, which is yet to be chosen.
 type ChoiceCondition interface{}
 
 // ChoiceBuilder provides the ability to define the conditions and result
@@ -4,19 +4,40 @@ import (
 	"reflect"
 
 	"github.com/Gurpartap/statemachine-go/internal/dynafunc"
+	"github.com/Gurpartap/statemachine-go/internal/expr"
 )
 
+// ChoiceConditionDef is a condition func, either set directly or referred
+// to by its RegisteredFunc name, or a guard expression (see Expr).
 type ChoiceConditionDef struct {
-	Label          string          `json:",omitempty" hcl:"label" hcle:"omitempty"`
-	RegisteredFunc string          `json:",omitempty" hcl:"registered_func" hcle:"omitempty"`
-	Condition      ChoiceCondition `json:"-" hcle:"omit"`
+	Label          string          `json:",omitempty"`
+	RegisteredFunc string          `json:",omitempty"`
+	Condition      ChoiceCondition `json:"-"`
+	Expr           string          `json:",omitempty"`
+
+	program *expr.Program
 }
 
 type ChoiceDef struct {
-	Condition   *ChoiceConditionDef `json:",omitempty" hcl:"condition" hcle:"omitempty"`
-	UnlessGuard *TransitionGuardDef `json:",omitempty" hcl:"unless_condition" hcle:"omitempty"`
-	OnTrue      *EventDef           `json:",omitempty" hcl:"on_true" hcle:"omitempty"`
-	OnFalse     *EventDef           `json:",omitempty" hcl:"on_false" hcle:"omitempty"`
+	Condition   *ChoiceConditionDef `json:",omitempty"`
+	UnlessGuard *TransitionGuardDef `json:",omitempty"`
+	OnTrue      *EventDef           `json:",omitempty"`
+	OnFalse     *EventDef           `json:",omitempty"`
+}
+
+// Branch returns the branch of the choice which is taken when its condition
+// is value, or nil if there is none. A branch with a choice of its own only
+// makes that choice, so it is returned with the choice alone, as the machine
+// evaluates it.
+func (def *ChoiceDef) Branch(value bool) *EventDef {
+	branch := def.OnFalse
+	if value {
+		branch = def.OnTrue
+	}
+	if branch != nil && branch.Choice != nil {
+		return &EventDef{Choice: branch.Choice}
+	}
+	return branch
 }
 
 func (def *ChoiceDef) SetLabel(label string) {
@@ -24,11 +45,16 @@ func (def *ChoiceDef) SetLabel(label string) {
 }
 
 func (def *ChoiceDef) SetCondition(condition ChoiceCondition) {
+	if guardDef, ok := condition.(*TransitionGuardDef); ok && guardDef.Expr != "" && !guardDef.IsCombined() {
+		def.Condition = &ChoiceConditionDef{Label: guardDef.Label, Expr: guardDef.Expr, program: guardDef.program}
+		return
+	}
+	assertGuardKind(condition)
 	def.Condition = &ChoiceConditionDef{Condition: condition}
 }
 
 func (def *ChoiceDef) SetUnlessGuard(guard TransitionGuard) {
-	def.UnlessGuard = &TransitionGuardDef{Guard: guard}
+	def.UnlessGuard = newTransitionGuardDef(guard)
 }
 
 func (def *ChoiceDef) SetOnTrue(eventBuilderFn func(eventBuilder EventBuilder)) {
@@ -49,18 +75,29 @@ func (def *ChoiceDef) SetOnFalse(eventBuilderFn func(eventBuilder EventBuilder))
 	def.OnFalse = e.def
 }
 
-func execChoice(condition ChoiceCondition, args map[reflect.Type]interface{}) bool {
+// exec evaluates the condition with args.
+func (def *ChoiceConditionDef) exec(args map[reflect.Type]interface{}) (bool, error) {
+	if def.Expr != "" {
+		return execExpr(def.Expr, def.program, args)
+	}
+	return execChoice(def.Condition, args)
+}
+
+func execChoice(condition ChoiceCondition, args map[reflect.Type]interface{}) (bool, error) {
 	switch reflect.TypeOf(condition).Kind() {
 	case reflect.Func:
+		if err := assertGuardArgs(condition, args); err != nil {
+			return false, err
+		}
 		fn := dynafunc.NewDynamicFunc(condition, args)
 		if err := fn.Call(); err != nil {
 			panic(err)
 		}
 		// condition func must return a bool
-		return fn.Out[0].Bool()
+		return fn.Out[0].Bool(), nil
 	case reflect.Ptr:
 		if reflect.ValueOf(condition).Elem().Kind() == reflect.Bool {
-			return reflect.ValueOf(condition).Elem().Bool()
+			return reflect.ValueOf(condition).Elem().Bool(), nil
 		}
 		fallthrough
 	default:
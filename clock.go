@@ -0,0 +1,59 @@
+package statemachine
+
+import (
+	"time"
+)
+
+// Clock tells the time to a machine, and schedules its timed events and
+// delayed sends (see Machine.SendAfter). Machines use the system clock,
+// unless another one is set with Machine.SetClock, e.g. a fake clock which
+// tests advance by hand.
+type Clock interface {
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine, or at least not from within
+	// AfterFunc, once d has passed.
+	AfterFunc(d time.Duration, f func()) ClockTimer
+}
+
+// ClockTimer is a func scheduled by Clock.AfterFunc.
+type ClockTimer interface {
+	// Stop cancels the call of the func, and reports whether it did, as
+	// opposed to the func having been called already.
+	Stop() bool
+}
+
+// systemClock implements Clock with the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return time.AfterFunc(d, f)
+}
+
+// SetClock implements Machine.
+func (m *machineImpl) SetClock(clock Clock) {
+	m.sendMutex.Lock()
+	defer m.sendMutex.Unlock()
+
+	m.clock = clock
+}
+
+// getClock returns the clock of the machine, which submachines inherit from
+// their supermachine.
+func (m *machineImpl) getClock() Clock {
+	m.sendMutex.Lock()
+	clock := m.clock
+	m.sendMutex.Unlock()
+
+	switch {
+	case clock != nil:
+		return clock
+	case m.supermachine != nil:
+		return m.supermachine.getClock()
+	}
+	return systemClock{}
+}
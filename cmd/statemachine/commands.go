@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/analysis"
+	"github.com/Gurpartap/statemachine-go/diagram"
+	"github.com/Gurpartap/statemachine-go/statemachinetest"
+)
+
+func runValidate(args []string) error {
+	flags, parse := newFlagSet("validate")
+	strict := flags.Bool("strict", false, "reject unknown fields in json definitions")
+	filename, err := parse(args)
+	if err != nil {
+		return err
+	}
+
+	read := readDef
+	if *strict {
+		read = readDefStrict
+	}
+
+	if _, err := read(filename); err != nil {
+		switch errs := err.(type) {
+		case statemachine.ValidationErrors:
+			for _, err := range errs {
+				fmt.Fprintf(os.Stdout, "%s: %s\n", filename, err)
+			}
+			return fmt.Errorf("%d problem(s) found", len(errs))
+		case hcl.Diagnostics:
+			for _, diag := range errs {
+				fmt.Fprintf(os.Stdout, "%s\n", diag)
+			}
+			return fmt.Errorf("%d problem(s) found", len(errs))
+		}
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "%s: ok\n", filename)
+	return nil
+}
+
+// stateList collects repeated string flags.
+type stateList []string
+
+func (l *stateList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stateList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func runAnalyze(args []string) error {
+	flags, parse := newFlagSet("analyze")
+	var finalStates stateList
+	flags.Var(&finalStates, "final", "state path which is expected to be a sink, e.g. running/success (repeatable)")
+	filename, err := parse(args)
+	if err != nil {
+		return err
+	}
+
+	def, err := readDef(filename)
+	if err != nil {
+		return err
+	}
+
+	findings := analysis.Analyze(def, finalStates...)
+	for _, finding := range findings {
+		fmt.Fprintf(os.Stdout, "%s: %s\n", filename, finding)
+	}
+	if len(findings) > 0 {
+		return fmt.Errorf("%d problem(s) found", len(findings))
+	}
+
+	fmt.Fprintf(os.Stdout, "%s: ok\n", filename)
+	return nil
+}
+
+func runRender(args []string) error {
+	flags, parse := newFlagSet("render")
+	format := flags.String("format", "dot", "diagram format: dot, mermaid, or plantuml")
+	filename, err := parse(args)
+	if err != nil {
+		return err
+	}
+
+	def, err := readDef(filename)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "dot":
+		return diagram.DOT(os.Stdout, def)
+	case "mermaid":
+		return diagram.Mermaid(os.Stdout, def)
+	case "plantuml":
+		return diagram.PlantUML(os.Stdout, def)
+	default:
+		return fmt.Errorf("unsupported diagram format '%s'", *format)
+	}
+}
+
+func runConvert(args []string) error {
+	flags, parse := newFlagSet("convert")
+	to := flags.String("to", "", "output format: json, hcl, yaml or scxml")
+	filename, err := parse(args)
+	if err != nil {
+		return err
+	}
+
+	def, err := readDef(filename)
+	if err != nil {
+		return err
+	}
+
+	b, err := encodeDef(def, *to)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(b)
+	return err
+}
+
+func runTestgen(args []string) error {
+	flags, parse := newFlagSet("testgen")
+	format := flags.String("format", "json", "output format: json or go")
+	pkg := flags.String("package", "main_test", "package of the generated go file")
+	name := flags.String("name", "sequences", "name of the generated go table")
+	filename, err := parse(args)
+	if err != nil {
+		return err
+	}
+
+	def, err := readDef(filename)
+	if err != nil {
+		return err
+	}
+
+	suite, err := statemachinetest.Generate(def)
+	if err != nil {
+		return err
+	}
+	for _, key := range suite.Uncovered {
+		fmt.Fprintf(os.Stderr, "%s: %s: transition not covered\n", filename, key)
+	}
+
+	switch *format {
+	case "json":
+		return statemachinetest.WriteJSON(os.Stdout, suite)
+	case "go":
+		return statemachinetest.WriteGoTable(os.Stdout, *pkg, *name, suite)
+	default:
+		return fmt.Errorf("unsupported output format '%s'", *format)
+	}
+}
+
+func runSchema(args []string) error {
+	flags := flag.NewFlagSet("statemachine schema", flag.ExitOnError)
+	output := flags.String("o", "", "write the schema to file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments")
+	}
+
+	b, err := statemachine.JSONSchema()
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		return ioutil.WriteFile(*output, b, 0644)
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
+
+func runCoverage(args []string) error {
+	flags := flag.NewFlagSet("statemachine coverage", flag.ExitOnError)
+	output := flags.String("o", "", "write the merged profile to file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("expected at least one profile")
+	}
+
+	coverage := statemachine.NewCoverage()
+	for _, filename := range flags.Args() {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		profile, err := statemachine.ReadCoverageProfile(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+		coverage.Merge(profile)
+	}
+
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		if err := coverage.WriteProfile(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	return coverage.Report(os.Stdout)
+}
+
+// guardValues collects repeated `-guard name=bool` flags.
+type guardValues map[string]bool
+
+func (g guardValues) String() string {
+	var pairs []string
+	for name, value := range g {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", name, value))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (g guardValues) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected name=bool, got '%s'", s)
+	}
+	value, err := strconv.ParseBool(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid value for guard '%s': %s", parts[0], err)
+	}
+	g[parts[0]] = value
+	return nil
+}
+
+func runSimulate(args []string) error {
+	flags, parse := newFlagSet("simulate")
+	eventsFile := flags.String("events", "", "read events from file instead of stdin")
+	guards := guardValues{}
+	flags.Var(guards, "guard", "stub the result of a registered guard func, as name=bool (repeatable)")
+	filename, err := parse(args)
+	if err != nil {
+		return err
+	}
+
+	def, err := readDef(filename)
+	if err != nil {
+		return err
+	}
+
+	stubRegisteredFuncs(def, guards)
+	disableTimedEvents(def)
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(def)
+
+	var events io.Reader = os.Stdin
+	if *eventsFile != "" {
+		f, err := os.Open(*eventsFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		events = f
+	}
+
+	printStateMap(machine)
+
+	scanner := bufio.NewScanner(events)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		simulateEvent(machine, line)
+	}
+	return scanner.Err()
+}
+
+// simulateEvent fires an event line of the form `event`, or
+// `submachine-id/.../event` for events of active submachines.
+func simulateEvent(machine statemachine.Machine, line string) {
+	path := strings.Split(line, "/")
+	event := path[len(path)-1]
+
+	target := machine
+	if len(path) > 1 {
+		submachine, err := machine.Submachine(path[:len(path)-1]...)
+		if err != nil {
+			fmt.Printf("%s: %s\n", line, err)
+			return
+		}
+		target = submachine
+	}
+
+	from := target.GetState()
+	if err := target.Fire(event); err != nil {
+		fmt.Printf("%s: %s (%s)\n", line, err, from)
+		return
+	}
+	fmt.Printf("%s: %s -> %s\n", line, from, target.GetState())
+	printStateMap(machine)
+}
+
+func printStateMap(machine statemachine.Machine) {
+	b, _ := json.Marshal(machine.GetStateMap())
+	fmt.Printf("  %s\n", b)
+}
+
+// stubRegisteredFuncs registers no-op funcs for every callback, assign
+// action and transition action referenced by the definition, and funcs
+// returning the stubbed value (default false) for every guard and choice
+// condition. Invoked services are stubbed by funcs which run until their
+// state is exited, so that only the events read by the command move the
+// machine.
+func stubRegisteredFuncs(def *statemachine.MachineDef, guards guardValues) {
+	registerGuard := func(name string) {
+		if name == "" {
+			return
+		}
+		value := guards[name]
+		statemachine.RegisterFunc(name, func() bool { return value })
+	}
+	registerGuards := func(guardDef *statemachine.TransitionGuardDef) {
+		for _, leafDef := range guardDef.Leaves() {
+			registerGuard(leafDef.RegisteredFunc)
+		}
+	}
+
+	var stubEvent func(eventDef *statemachine.EventDef)
+	stubEvent = func(eventDef *statemachine.EventDef) {
+		if eventDef == nil {
+			return
+		}
+		for _, transitionDef := range eventDef.Transitions {
+			for _, guardDef := range transitionDef.IfGuards {
+				registerGuards(guardDef)
+			}
+			for _, guardDef := range transitionDef.UnlessGuards {
+				registerGuards(guardDef)
+			}
+			for _, assignDef := range transitionDef.Assigns {
+				if assignDef.RegisteredFunc != "" {
+					statemachine.RegisterFunc(assignDef.RegisteredFunc, func() {})
+				}
+			}
+			for _, funcDef := range transitionDef.Do {
+				if funcDef.RegisteredFunc != "" {
+					statemachine.RegisterFunc(funcDef.RegisteredFunc, func() {})
+				}
+			}
+		}
+		if eventDef.Choice != nil {
+			if eventDef.Choice.Condition != nil {
+				registerGuard(eventDef.Choice.Condition.RegisteredFunc)
+			}
+			if eventDef.Choice.UnlessGuard != nil {
+				registerGuards(eventDef.Choice.UnlessGuard)
+			}
+			stubEvent(eventDef.Choice.OnTrue)
+			stubEvent(eventDef.Choice.OnFalse)
+		}
+	}
+
+	for _, eventDef := range def.Events {
+		stubEvent(eventDef)
+	}
+	stubEvent(&statemachine.EventDef{Transitions: def.Always})
+
+	for _, invokeDef := range def.Invokes {
+		if invokeDef.RegisteredFunc != "" {
+			statemachine.RegisterFunc(invokeDef.RegisteredFunc, func(ctx context.Context, send func(statemachine.Message)) error {
+				<-ctx.Done()
+				return nil
+			})
+		}
+	}
+
+	stubCallbacks := func(callbackDefs []*statemachine.TransitionCallbackDef, fn interface{}) {
+		for _, callbackDef := range callbackDefs {
+			for _, funcDef := range callbackDef.Do {
+				if funcDef.RegisteredFunc != "" {
+					statemachine.RegisterFunc(funcDef.RegisteredFunc, fn)
+				}
+			}
+		}
+	}
+	stubCallbacks(def.BeforeCallbacks, func() {})
+	stubCallbacks(def.AroundCallbacks, func(next func()) { next() })
+	stubCallbacks(def.AfterCallbacks, func() {})
+
+	stubEventCallbacks := func(callbackDefs []*statemachine.EventCallbackDef, fn interface{}) {
+		for _, callbackDef := range callbackDefs {
+			for _, funcDef := range callbackDef.Do {
+				if funcDef.RegisteredFunc != "" {
+					statemachine.RegisterFunc(funcDef.RegisteredFunc, fn)
+				}
+			}
+		}
+	}
+	stubEventCallbacks(def.BeforeEventCallbacks, func() {})
+	stubEventCallbacks(def.AfterEventCallbacks, func() {})
+	stubEventCallbacks(def.FailureCallbacks, func(err error) {})
+
+	for _, submachineDefs := range def.Submachines {
+		for _, submachineDef := range submachineDefs {
+			stubRegisteredFuncs(submachineDef, guards)
+		}
+	}
+}
+
+// disableTimedEvents stops timed events from firing on their own, so that
+// the simulation only depends on the events it is fed.
+func disableTimedEvents(def *statemachine.MachineDef) {
+	for _, eventDef := range def.Events {
+		eventDef.TimedEvery = 0
+	}
+	for _, submachineDefs := range def.Submachines {
+		for _, submachineDef := range submachineDefs {
+			disableTimedEvents(submachineDef)
+		}
+	}
+}
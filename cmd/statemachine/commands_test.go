@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunValidate_UnknownYAMLKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statemachine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "process.yaml")
+	doc := `
+states: [stopped, running]
+initial_state: stopped
+after_transition:
+  - to: [running]
+    exit_into: stopped
+`
+	if err := ioutil.WriteFile(filename, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{filename}, {"-strict", filename}} {
+		err := runValidate(args)
+		if err == nil || !strings.Contains(err.Error(), "field exit_into not found") {
+			t.Errorf("validate %v: got error %v, want unknown field exit_into", args, err)
+		}
+	}
+}
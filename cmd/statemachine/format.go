@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/scxml"
+)
+
+// formatOf infers the definition format from the file extension.
+func formatOf(filename string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".json":
+		return "json", nil
+	case ".hcl":
+		return "hcl", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".scxml":
+		return "scxml", nil
+	default:
+		return "", fmt.Errorf("unsupported definition file extension '%s'", ext)
+	}
+}
+
+// readDef decodes and validates the definition file.
+func readDef(filename string) (*statemachine.MachineDef, error) {
+	format, err := formatOf(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "hcl":
+		return statemachine.LoadHCL(filename, b)
+	case "yaml":
+		return statemachine.LoadYAML(b)
+	case "scxml":
+		def, warnings, err := scxml.Import(bytes.NewReader(b))
+		printWarnings(filename, warnings)
+		return def, err
+	default:
+		return statemachine.LoadJSON(b)
+	}
+}
+
+// readDefStrict is like readDef, but rejects unknown fields in JSON
+// definitions. HCL and YAML definitions always reject them, and SCXML
+// definitions only warn about the elements and attributes they leave out.
+func readDefStrict(filename string) (*statemachine.MachineDef, error) {
+	if format, _ := formatOf(filename); format == "json" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		return statemachine.LoadJSONStrict(b)
+	}
+	return readDef(filename)
+}
+
+// encodeDef encodes the definition in the given format.
+func encodeDef(def *statemachine.MachineDef, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(def, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case "hcl":
+		var buf bytes.Buffer
+		if err := statemachine.WriteHCL(&buf, def); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "yaml":
+		return statemachine.MarshalYAML(def)
+	case "scxml":
+		var buf bytes.Buffer
+		warnings, err := scxml.Export(&buf, def)
+		printWarnings("scxml", warnings)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported format '%s'", format)
+	}
+}
+
+// printWarnings reports the parts of a definition which were left out when
+// translating it from or to SCXML.
+func printWarnings(prefix string, warnings []scxml.Warning) {
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", prefix, warning)
+	}
+}
@@ -0,0 +1,119 @@
+// Command statemachine validates, analyzes, renders, simulates, and converts
+// state machine definitions written in JSON, HCL, YAML or SCXML, generates
+// test sequences for them, and reports the transition coverage recorded by
+// tests.
+//
+// Usage:
+//
+//	statemachine validate [-strict] <file>
+//	statemachine analyze [-final state ...] <file>
+//	statemachine render [-format dot|mermaid|plantuml] <file>
+//	statemachine simulate [-events <file>] [-guard name=bool ...] <file>
+//	statemachine convert -to json|hcl|yaml|scxml <file>
+//	statemachine testgen [-format json|go] [-package name] [-name name] <file>
+//	statemachine schema [-o <file>]
+//	statemachine coverage [-o <file>] <profile> ...
+//
+// The format of a definition file is inferred from its extension.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []*command{
+	{
+		name:  "validate",
+		usage: "validate [-strict] <file>\n\tLint the definition and report every problem found. With -strict,\n\tunknown fields in JSON definitions are reported too.",
+		run:   runValidate,
+	},
+	{
+		name:  "analyze",
+		usage: "analyze [-final state ...] <file>\n\tReport unreachable states, dead events, sink states which aren't\n\tfinal, transitions which are never taken, and missing exit states.",
+		run:   runAnalyze,
+	},
+	{
+		name:  "render",
+		usage: "render [-format dot|mermaid|plantuml] <file>\n\tWrite the definition as a state diagram.",
+		run:   runRender,
+	},
+	{
+		name:  "simulate",
+		usage: "simulate [-events <file>] [-guard name=bool ...] <file>\n\tFire events read from stdin (or a file), one per line, and print\n\teach transition along with the resulting state map. Timed events\n\tonly fire when listed.",
+		run:   runSimulate,
+	},
+	{
+		name:  "convert",
+		usage: "convert -to json|hcl|yaml|scxml <file>\n\tTranslate the definition to another format.",
+		run:   runConvert,
+	},
+	{
+		name:  "testgen",
+		usage: "testgen [-format json|go] [-package name] [-name name] <file>\n\tGenerate event sequences which take every transition, with the\n\tguard results and state map expected at each step.",
+		run:   runTestgen,
+	},
+	{
+		name:  "schema",
+		usage: "schema [-o <file>]\n\tWrite the JSON Schema for JSON definitions.",
+		run:   runSchema,
+	},
+	{
+		name:  "coverage",
+		usage: "coverage [-o <file>] <profile> ...\n\tMerge transition coverage profiles written by tests, and report the\n\ttransitions, guard outcomes and choice branches never exercised.",
+		run:   runCoverage,
+	},
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == flag.Arg(0) {
+			if err := cmd.run(flag.Args()[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "statemachine %s: %s\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "statemachine: unknown command '%s'\n", flag.Arg(0))
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of statemachine:\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  statemachine %s\n\n", cmd.usage)
+	}
+}
+
+// newFlagSet returns a flag set for the subcommand, along with a func which
+// parses args and returns the single definition file arg.
+func newFlagSet(name string) (*flag.FlagSet, func(args []string) (string, error)) {
+	flags := flag.NewFlagSet("statemachine "+name, flag.ExitOnError)
+	return flags, func(args []string) (string, error) {
+		if err := flags.Parse(args); err != nil {
+			return "", err
+		}
+		if flags.NArg() != 1 {
+			return "", fmt.Errorf("expected exactly one definition file")
+		}
+		return flags.Arg(0), nil
+	}
+}
@@ -0,0 +1,372 @@
+package statemachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/Gurpartap/statemachine-go/internal/dynafunc"
+	"github.com/Gurpartap/statemachine-go/internal/expr"
+)
+
+// ContextAssign updates the extended state of a machine (see
+// MachineBuilder.Context) when a transition is taken. It accepts the
+// context, as a pointer to its struct type or as a map[string]interface{},
+// along with any of Machine, Transition, Event and context.Context, and
+// payloads of the event, by their exact types. It may return an error, which
+// fails the event.
+//
+// Valid ContextAssign types:
+//
+//	func(c *ProcessContext)
+//	func(c *ProcessContext, order *Order) error
+//	func(vars map[string]interface{}, transition statemachine.Transition)
+type ContextAssign interface{}
+
+// ContextAssignDef is an assign func, either set directly or referred to by
+// its RegisteredFunc name, or an expression (see Expr) whose value is
+// assigned to the context variable Var.
+type ContextAssignDef struct {
+	Label          string        `json:",omitempty"`
+	RegisteredFunc string        `json:",omitempty"`
+	Assign         ContextAssign `json:"-"`
+	Var            string        `json:",omitempty"`
+	Expr           string        `json:",omitempty"`
+
+	program *expr.Program
+}
+
+// AssignExpr returns an assign action which sets the context variable name
+// to the value of the expression src, such as `ctx.retries + 1`. It panics
+// if src is not a valid expression.
+func AssignExpr(name string, src string) *ContextAssignDef {
+	program, err := expr.Parse(src)
+	if err != nil {
+		panic(fmt.Sprintf("invalid assign expression '%s': %s", src, err))
+	}
+	return &ContextAssignDef{Var: name, Expr: src, program: program}
+}
+
+// newContextAssignDef returns the definition of assign, which is either a
+// ContextAssign func, the name of a registered func, or a
+// *ContextAssignDef.
+func newContextAssignDef(assign ContextAssign) *ContextAssignDef {
+	switch assign := assign.(type) {
+	case *ContextAssignDef:
+		return assign
+	case string:
+		return &ContextAssignDef{RegisteredFunc: assign}
+	}
+	assertAssignKind(assign)
+	return &ContextAssignDef{Assign: assign}
+}
+
+func assertAssignKind(assign ContextAssign) {
+	t := reflect.TypeOf(assign)
+	if t == nil || t.Kind() != reflect.Func {
+		panic("assign must be a compatible func")
+	}
+
+	seen := make(map[reflect.Type]struct{})
+	for i := 0; i < t.NumIn(); i++ {
+		argType := t.In(i)
+		if _, ok := seen[argType]; ok {
+			panic(fmt.Sprintf("duplicate argument with type '%s' in assign func", argType))
+		}
+		seen[argType] = struct{}{}
+
+		if _, ok := guardArgs[reflect.PtrTo(argType)]; ok {
+			continue
+		}
+		switch argType.Kind() {
+		case reflect.Interface, reflect.Func:
+			panic(fmt.Sprintf("unexpected argument with type '%s' in assign func", argType))
+		}
+	}
+	switch {
+	case t.NumOut() == 0:
+	case t.NumOut() == 1 && t.Out(0) == reflect.TypeOf(new(error)).Elem():
+	default:
+		panic("assign func must return nothing or an error")
+	}
+}
+
+// exec updates context, the draft of the machine's next context, with args.
+func (def *ContextAssignDef) exec(context interface{}, args map[reflect.Type]interface{}) error {
+	if def.Assign != nil {
+		if err := assertGuardArgs(def.Assign, args); err != nil {
+			return err
+		}
+		fn := dynafunc.NewDynamicFunc(def.Assign, args)
+		if err := fn.Call(); err != nil {
+			panic(err)
+		}
+		if len(fn.Out) == 1 && !fn.Out[0].IsNil() {
+			return fn.Out[0].Interface().(error)
+		}
+		return nil
+	}
+
+	program := def.program
+	if program == nil {
+		var err error
+		if program, err = expr.Parse(def.Expr); err != nil {
+			return fmt.Errorf("assign expression '%s': %s", def.Expr, err)
+		}
+	}
+	value, err := program.Eval(func(path []string) (interface{}, error) {
+		return exprValue(path, args)
+	})
+	if err != nil {
+		return fmt.Errorf("assign expression '%s': %w", def.Expr, err)
+	}
+	return setContextVar(context, def.Var, value)
+}
+
+// assertContextArgs returns an error if the callback fn takes a context of
+// another type than the context of def.
+func (def *MachineDef) assertContextArgs(fn interface{}) error {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func {
+		return nil
+	}
+	contextType := reflect.TypeOf(copyContext(def.Context))
+	for i := 0; i < t.NumIn(); i++ {
+		argType := t.In(i)
+		if !isContextType(argType) || argType == contextType {
+			continue
+		}
+		if contextType == nil {
+			return fmt.Errorf("func takes a context of type '%s', but the machine has no context", argType)
+		}
+		return fmt.Errorf("func takes a context of type '%s', but the machine's context is a '%s'", argType, contextType)
+	}
+	return nil
+}
+
+// contextArg is the context of the machine, as passed to guard and assign
+// expressions.
+type contextArg struct {
+	value interface{}
+}
+
+var contextArgType = reflect.TypeOf(contextArg{})
+
+// isContextValue reports whether value may be the context of a machine.
+func isContextValue(value interface{}) bool {
+	t := reflect.TypeOf(value)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t != nil && (t.Kind() == reflect.Struct || t == reflect.TypeOf(map[string]interface{}(nil)))
+}
+
+// isContextType reports whether args of type t are taken for the context of
+// the machine.
+func isContextType(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct || t == reflect.TypeOf(map[string]interface{}(nil))
+}
+
+// copyContext returns a deep copy of the context value, as a pointer to its
+// struct type, or as a map. The maps, slices and pointers within it are
+// copied too, so that snapshots and assign actions never share them with
+// the context of the machine. Unexported fields, channels and funcs are
+// shared.
+func copyContext(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Kind() == reflect.Map:
+		return copyValue(v).Interface()
+	case v.Kind() == reflect.Ptr && v.IsNil():
+		return reflect.New(v.Type().Elem()).Interface()
+	case v.Kind() == reflect.Ptr:
+		v = v.Elem()
+	}
+	c := reflect.New(v.Type())
+	c.Elem().Set(copyValue(v))
+	return c.Interface()
+}
+
+// copyValue returns a copy of v which shares no maps, slices or pointers
+// with it, but for those in unexported fields.
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValue(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < c.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return c
+	}
+	return v
+}
+
+// convertContext returns a copy of value with the type of the context like,
+// converting it through JSON if its type is another one.
+func convertContext(value, like interface{}) (interface{}, error) {
+	if like == nil {
+		return nil, fmt.Errorf("machine has no context")
+	}
+	like = copyContext(like)
+	if c := copyContext(value); reflect.TypeOf(c) == reflect.TypeOf(like) {
+		return c, nil
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := like.(map[string]interface{}); ok {
+		vars := map[string]interface{}{}
+		err = json.Unmarshal(b, &vars)
+		return vars, err
+	}
+	c := reflect.New(reflect.TypeOf(like).Elem()).Interface()
+	err = json.Unmarshal(b, c)
+	return c, err
+}
+
+// contextVarType returns the type of the context variable name, in
+// expressions.
+func contextVarType(context interface{}, name string) (expr.Type, bool) {
+	if vars, ok := context.(map[string]interface{}); ok {
+		value, ok := vars[name]
+		if !ok {
+			return expr.Any, false
+		}
+		if value == nil {
+			return expr.Any, true
+		}
+		return exprKindType(reflect.TypeOf(value)), true
+	}
+
+	v := reflect.ValueOf(context)
+	if v.Kind() == reflect.Ptr {
+		v = reflect.New(v.Type().Elem()).Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return expr.Any, false
+	}
+	field := structField(v, name)
+	if !field.IsValid() {
+		return expr.Any, false
+	}
+	return exprKindType(field.Type()), true
+}
+
+func exprKindType(t reflect.Type) expr.Type {
+	switch t.Kind() {
+	case reflect.Bool:
+		return expr.Bool
+	case reflect.String:
+		return expr.String
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return expr.Number
+	}
+	return expr.Any
+}
+
+// setContextVar sets the context variable name to value, which is the
+// result of an expression.
+func setContextVar(context interface{}, name string, value interface{}) error {
+	if vars, ok := context.(map[string]interface{}); ok {
+		if _, ok := vars[name]; !ok {
+			return fmt.Errorf("unknown context variable '%s'", name)
+		}
+		vars[name] = value
+		return nil
+	}
+
+	v := reflect.ValueOf(context)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("machine has no context")
+	}
+	field := structField(v.Elem(), name)
+	if !field.IsValid() {
+		return fmt.Errorf("unknown context variable '%s'", name)
+	}
+
+	mismatch := fmt.Errorf("can't assign %v to context variable '%s' of type %s", value, name, field.Type())
+	switch value := value.(type) {
+	case nil:
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	case float64:
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if value != math.Trunc(value) {
+				return mismatch
+			}
+			field.SetInt(int64(value))
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if value != math.Trunc(value) || value < 0 {
+				return mismatch
+			}
+			field.SetUint(uint64(value))
+			return nil
+		case reflect.Float32, reflect.Float64:
+			field.SetFloat(value)
+			return nil
+		}
+	}
+
+	v = reflect.ValueOf(value)
+	switch {
+	case field.Kind() == reflect.Interface && v.Type().Implements(field.Type()):
+		field.Set(v)
+	case field.Kind() == v.Kind() && v.Type().ConvertibleTo(field.Type()):
+		field.Set(v.Convert(field.Type()))
+	default:
+		return mismatch
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package statemachine_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+type ProcessContext struct {
+	Restarts  int  `json:"restarts"`
+	AutoStart bool `json:"auto_start"`
+}
+
+func ExampleMachineBuilder_Context() {
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("stopped", "running")
+		m.InitialState("stopped")
+		m.Context(ProcessContext{AutoStart: true})
+
+		m.Event("start", func(e statemachine.EventBuilder) {
+			e.Transition().From("stopped").To("running").
+				If(func(c *ProcessContext) bool { return c.AutoStart }).
+				AndUnless(statemachine.Expr("ctx.restarts >= 2")).
+				Assign(statemachine.AssignExpr("restarts", "ctx.restarts + 1"))
+		})
+
+		m.Event("stop", func(e statemachine.EventBuilder) {
+			e.Transition().From("running").To("stopped").
+				Assign(func(c *ProcessContext, reason string) error {
+					if reason == "" {
+						return errors.New("no reason")
+					}
+					c.AutoStart = reason != "manual"
+					return nil
+				})
+		})
+
+		m.BeforeTransition().Any().Do(func(t statemachine.Transition, c *ProcessContext) {
+			fmt.Printf("before %s -> %s: %+v\n", t.From(), t.To(), *c)
+		})
+		m.AfterTransition().Any().Do(func(t statemachine.Transition, c *ProcessContext) {
+			fmt.Printf("after %s -> %s: %+v\n", t.From(), t.To(), *c)
+		})
+	})
+
+	fmt.Println(machine.Fire("start"))
+	fmt.Println(machine.FireContext(context.Background(), "stop", ""))
+	fmt.Println(machine.FireContext(context.Background(), "stop", "crash"))
+	fmt.Println(machine.Fire("start"))
+	fmt.Println(machine.FireContext(context.Background(), "stop", "crash"))
+	fmt.Printf("%v %s %+v\n", machine.Fire("start"), machine.GetState(), *machine.GetContext().(*ProcessContext))
+
+	// Output:
+	// before stopped -> running: {Restarts:0 AutoStart:true}
+	// after stopped -> running: {Restarts:1 AutoStart:true}
+	// <nil>
+	// no reason
+	// before running -> stopped: {Restarts:1 AutoStart:true}
+	// after running -> stopped: {Restarts:1 AutoStart:true}
+	// <nil>
+	// before stopped -> running: {Restarts:1 AutoStart:true}
+	// after stopped -> running: {Restarts:2 AutoStart:true}
+	// <nil>
+	// before running -> stopped: {Restarts:2 AutoStart:true}
+	// after running -> stopped: {Restarts:2 AutoStart:true}
+	// <nil>
+	// no matching transition stopped {Restarts:2 AutoStart:true}
+}
+
+func ExampleAssignExpr() {
+	machineDef, err := statemachine.LoadHCL("counter.hcl", []byte(`
+		states        = ["idle"]
+		initial_state = "idle"
+		context       = { count = 0, last = "" }
+
+		event "add" {
+		  transition {
+		    to     = "idle"
+		    unless = "ctx.count >= 2"
+		    assign = [
+		      { var = "count", expr = "ctx.count + 1" },
+		      { var = "last", expr = "payload.name" },
+		    ]
+		  }
+		}
+	`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+
+	for _, name := range []string{"a", "b", "c"} {
+		err := machine.FireContext(context.Background(), "add", map[string]string{"name": name})
+		fmt.Println(err, machine.GetContext())
+	}
+
+	_, err = statemachine.LoadHCL("counter.hcl", []byte(`
+		states        = ["idle"]
+		initial_state = "idle"
+		context       = { count = 0 }
+
+		event "add" {
+		  transition {
+		    to     = "idle"
+		    assign = [{ var = "count", expr = "'one'" }, { var = "total", expr = "1" }]
+		  }
+		}
+	`))
+	fmt.Println(err)
+
+	// Output:
+	// <nil> map[count:1 last:a]
+	// <nil> map[count:2 last:b]
+	// no matching transition map[count:2 last:b]
+	// event.add.transitions[0].assign[0].expr: expression is a string, but context variable 'count' is a number
+	// event.add.transitions[0].assign[1].expr: unknown context variable 'total'
+}
+
+func ExampleSnapshot() {
+	build := func(m statemachine.MachineBuilder) {
+		m.States("stopped", "running")
+		m.InitialState("stopped")
+		m.Context(&ProcessContext{})
+
+		m.Event("start", func(e statemachine.EventBuilder) {
+			e.Transition().From("stopped").To("running").
+				Assign(statemachine.AssignExpr("restarts", "ctx.restarts + 1"))
+		})
+	}
+
+	machine := statemachine.BuildNewMachine(build)
+	_ = machine.Fire("start")
+
+	b, _ := json.Marshal(machine.Snapshot())
+	fmt.Println(string(b))
+
+	var snapshot statemachine.Snapshot
+	_ = json.Unmarshal(b, &snapshot)
+
+	restored := statemachine.BuildNewMachine(build)
+	fmt.Println(restored.Restore(&snapshot))
+	fmt.Printf("%s %+v\n", restored.GetState(), *restored.GetContext().(*ProcessContext))
+
+	// Output:
+	// {"State":"running","Context":{"restarts":1,"auto_start":false}}
+	// <nil>
+	// running {Restarts:1 AutoStart:false}
+}
+
+func TestContext_SharesNoNestedValues(t *testing.T) {
+	type JobContext struct {
+		Tags   []string       `json:"tags"`
+		Limits map[string]int `json:"limits"`
+	}
+
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("pending", "running")
+		m.InitialState("pending")
+		m.Context(JobContext{Tags: []string{"new"}, Limits: map[string]int{"cpu": 1}})
+
+		m.Event("run", func(e statemachine.EventBuilder) {
+			e.Transition().From("pending").To("running").Assign(func(c *JobContext) {
+				c.Tags[0] = "started"
+				c.Limits["cpu"] = 2
+			})
+		})
+	})
+
+	snapshot := machine.Snapshot()
+	got := machine.GetContext().(*JobContext)
+	got.Tags[0] = "changed"
+	got.Limits["memory"] = 1
+
+	if err := machine.Fire("run"); err != nil {
+		t.Fatal(err)
+	}
+
+	// neither the snapshot, nor the copy which was changed, is changed by the
+	// assign action, and the copy doesn't change the context.
+	if want := (&JobContext{Tags: []string{"new"}, Limits: map[string]int{"cpu": 1}}); !reflect.DeepEqual(snapshot.Context, want) {
+		t.Errorf("got snapshot context %+v, want %+v", snapshot.Context, want)
+	}
+	if want := (&JobContext{Tags: []string{"started"}, Limits: map[string]int{"cpu": 2}}); !reflect.DeepEqual(machine.GetContext(), want) {
+		t.Errorf("got context %+v, want %+v", machine.GetContext(), want)
+	}
+}
@@ -0,0 +1,29 @@
+package statemachine
+
+// DeferBuilder provides the ability to define the states which defer an
+// event.
+type DeferBuilder interface {
+	In(states ...string) DeferBuilder
+}
+
+// newDeferBuilder returns a DeferBuilder, which defers event in the states
+// of def.
+func newDeferBuilder(def *MachineDef, event string) DeferBuilder {
+	return &deferBuilder{
+		def:   def,
+		event: event,
+	}
+}
+
+// deferBuilder implements DeferBuilder.
+type deferBuilder struct {
+	def   *MachineDef
+	event string
+}
+
+var _ DeferBuilder = (*deferBuilder)(nil)
+
+func (d *deferBuilder) In(states ...string) DeferBuilder {
+	d.def.SetDeferred(d.event, states...)
+	return d
+}
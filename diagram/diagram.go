@@ -0,0 +1,224 @@
+// Package diagram renders state machine definitions as DOT (Graphviz),
+// Mermaid, or PlantUML state diagrams.
+//
+// Edges are labeled in the form `event [ guards ] / actions`, where guards,
+// callbacks and transition actions are named by their Label, falling back to
+// their RegisteredFunc name, and the callbacks and actions are listed in the
+// order they run in. Guards are joined by &&, and guard expressions and
+// combined guards are parenthesized. The regions a transition joins are
+// listed among its guards as `in region/state`, and those it forks into are
+// listed last as `enter region/state`. Eventless transitions are labeled
+// without an event, i.e. by their guards and actions only. Submachines are
+// rendered as nested (composite) states, and parallel submachines of the
+// same state as concurrent regions. Final states lead to the end
+// pseudostate, or are drawn as double circles in DOT.
+package diagram
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+type graph struct {
+	id           string
+	states       []string
+	initialState string
+	finalStates  []string
+	edges        []*edge
+	submachines  map[string][]*graph
+}
+
+type edge struct {
+	from  string
+	to    string
+	label string
+}
+
+func newGraph(def *statemachine.MachineDef) *graph {
+	g := &graph{
+		id:           def.ID,
+		states:       def.KnownStates(),
+		initialState: def.InitialState,
+		finalStates:  def.FinalStates,
+		submachines:  map[string][]*graph{},
+	}
+
+	events := make([]string, 0, len(def.Events))
+	for event := range def.Events {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	for _, event := range events {
+		g.addEventEdges(def, event, def.Events[event], nil)
+	}
+	g.addEventEdges(def, "", &statemachine.EventDef{Transitions: def.Always}, nil)
+
+	for state, submachineDefs := range def.Submachines {
+		for _, submachineDef := range submachineDefs {
+			g.submachines[state] = append(g.submachines[state], newGraph(submachineDef))
+		}
+	}
+
+	return g
+}
+
+func (g *graph) isFinal(state string) bool {
+	for _, s := range g.finalStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *graph) addEventEdges(def *statemachine.MachineDef, event string, eventDef *statemachine.EventDef, choiceGuards []string) {
+	if eventDef == nil {
+		return
+	}
+
+	for _, transitionDef := range eventDef.Transitions {
+		guards := append([]string{}, choiceGuards...)
+		for _, guardDef := range transitionDef.IfGuards {
+			guards = append(guards, guardName(guardDef))
+		}
+		for _, guardDef := range transitionDef.UnlessGuards {
+			guards = append(guards, "!"+guardName(guardDef))
+		}
+		for _, region := range sortedRegions(transitionDef.Join) {
+			guards = append(guards, "in "+region+"/"+transitionDef.Join[region])
+		}
+
+		for _, from := range g.fromStates(transitionDef) {
+			g.edges = append(g.edges, &edge{
+				from:  from,
+				to:    transitionDef.To,
+				label: strings.TrimPrefix(edgeLabel(def, event, guards, transitionDef.Do, from, transitionDef.To)+forkLabel(transitionDef.Fork), " "),
+			})
+		}
+	}
+
+	if eventDef.Choice == nil {
+		return
+	}
+
+	condition := "choice"
+	if eventDef.Choice.Condition != nil {
+		condition = firstNonEmpty(eventDef.Choice.Condition.Label, eventDef.Choice.Condition.RegisteredFunc, condition)
+	}
+	guards := append([]string{}, choiceGuards...)
+	if eventDef.Choice.UnlessGuard != nil {
+		guards = append(guards, "!"+guardName(eventDef.Choice.UnlessGuard))
+	}
+	g.addEventEdges(def, event, eventDef.Choice.OnTrue, append(append([]string{}, guards...), condition))
+	g.addEventEdges(def, event, eventDef.Choice.OnFalse, append(append([]string{}, guards...), "!"+condition))
+}
+
+func (g *graph) fromStates(transitionDef *statemachine.TransitionDef) []string {
+	var states []string
+	for _, state := range g.states {
+		if transitionDef.Matches(state) {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// guardName names the guard by its label, registered func name, or else
+// its expression, or the expression of the guards it combines, which is
+// parenthesized so that it may be negated and joined with other guards.
+func guardName(guardDef *statemachine.TransitionGuardDef) string {
+	name := guardDef.String()
+	if guardDef.Label != "" || simpleGuardName.MatchString(name) {
+		return name
+	}
+	return "(" + name + ")"
+}
+
+// simpleGuardName matches the guard names which need no parentheses, such
+// as func names and context paths.
+var simpleGuardName = regexp.MustCompile(`^[\w.-]+$`)
+
+func edgeLabel(def *statemachine.MachineDef, event string, guards []string, actions []*statemachine.TransitionCallbackFuncDef, from, to string) string {
+	label := event
+	if len(guards) > 0 {
+		label += " [ " + strings.Join(guards, " && ") + " ]"
+	}
+
+	addFuncs := func(funcDefs []*statemachine.TransitionCallbackFuncDef) {
+		for _, funcDef := range funcDefs {
+			if name := firstNonEmpty(funcDef.Label, funcDef.RegisteredFunc); name != "" {
+				label += " / " + name
+			}
+		}
+	}
+	addCallbacks := func(callbacks []*statemachine.TransitionCallbackDef) {
+		for _, callbackDef := range callbacks {
+			if callbackDef.Matches(from, to) {
+				addFuncs(callbackDef.Do)
+			}
+		}
+	}
+
+	// Funcs are listed in the order they run in.
+	addCallbacks(def.BeforeCallbacks)
+	addCallbacks(def.AroundCallbacks)
+	addFuncs(actions)
+	addCallbacks(def.AfterCallbacks)
+
+	return label
+}
+
+// forkLabel lists the region states which a transition forks into.
+func forkLabel(fork map[string]string) string {
+	var label string
+	for _, region := range sortedRegions(fork) {
+		label += " / enter " + region + "/" + fork[region]
+	}
+	return label
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func sortedKeys(submachines map[string][]*graph) []string {
+	keys := make([]string, 0, len(submachines))
+	for key := range submachines {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printer writes formatted lines, remembering the first write error.
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) printf(indent int, format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, strings.Repeat("  ", indent)+format+"\n", args...)
+}
+
+func sortedRegions(regions map[string]string) []string {
+	keys := make([]string, 0, len(regions))
+	for key := range regions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,35 @@
+package diagram_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/diagram"
+)
+
+func TestMermaid_Golden(t *testing.T) {
+	b, err := ioutil.ReadFile("../testdata/cognizant.hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := statemachine.LoadHCL("cognizant.hcl", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	if err := diagram.Mermaid(&got, def); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("testdata/cognizant.mmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unless guard of restart is an expression, which is negated as a
+	// whole.
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("got diagram:\n%s\nwant testdata/cognizant.mmd:\n%s", got.Bytes(), want)
+	}
+}
@@ -0,0 +1,55 @@
+package diagram
+
+import (
+	"io"
+	"strings"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// DOT writes the definition as a Graphviz digraph.
+func DOT(w io.Writer, def *statemachine.MachineDef) error {
+	p := &printer{w: w}
+	p.printf(0, "digraph fsm {")
+	p.printf(1, "rankdir = LR;")
+	p.printf(1, "node [shape = circle];")
+	writeDOTGraph(p, 1, newGraph(def), "")
+	p.printf(0, "}")
+	return p.err
+}
+
+func writeDOTGraph(p *printer, indent int, g *graph, prefix string) {
+	node := func(state string) string {
+		return quote(prefix + state)
+	}
+
+	p.printf(indent, "%s [shape = point, width = 0.2];", node("initial"))
+	p.printf(indent, "%s -> %s;", node("initial"), node(g.initialState))
+
+	for _, state := range g.states {
+		if g.isFinal(state) {
+			p.printf(indent, "%s [label = %s, shape = doublecircle];", node(state), quote(state))
+		} else {
+			p.printf(indent, "%s [label = %s];", node(state), quote(state))
+		}
+	}
+
+	for _, e := range g.edges {
+		p.printf(indent, "%s -> %s [label = %s];", node(e.from), node(e.to), quote(e.label))
+	}
+
+	for _, state := range sortedKeys(g.submachines) {
+		for i, submachine := range g.submachines[state] {
+			subprefix := prefix + state + "/" + submachineName(submachine, i) + "/"
+			p.printf(indent, "subgraph %s {", quote("cluster_"+strings.TrimSuffix(subprefix, "/")))
+			p.printf(indent+1, "label = %s;", quote(state+" "+submachineName(submachine, i)))
+			writeDOTGraph(p, indent+1, submachine, subprefix)
+			p.printf(indent, "}")
+			p.printf(indent, "%s -> %s [style = dashed, arrowhead = none];", node(state), quote(subprefix+"initial"))
+		}
+	}
+}
+
+func quote(s string) string {
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,65 @@
+package diagram_test
+
+import (
+	"os"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/diagram"
+)
+
+func ExampleMermaid() {
+	machineDef := &statemachine.MachineDef{
+		States:       []string{"locked", "unlocked", "retired"},
+		InitialState: "locked",
+		FinalStates:  []string{"retired"},
+		Events: map[string]*statemachine.EventDef{
+			"coin": {
+				Transitions: []*statemachine.TransitionDef{
+					{
+						From: []string{"locked"},
+						To:   "unlocked",
+						Do:   []*statemachine.TransitionCallbackFuncDef{{RegisteredFunc: "count-coin"}},
+					},
+				},
+			},
+			"retire": {
+				Transitions: []*statemachine.TransitionDef{{From: []string{"locked"}, To: "retired"}},
+			},
+			"push": {
+				Transitions: []*statemachine.TransitionDef{
+					{
+						From: []string{"unlocked"},
+						To:   "locked",
+						IfGuards: []*statemachine.TransitionGuardDef{
+							{RegisteredFunc: "is-clear"},
+							statemachine.Any("is-timed-out", statemachine.Not("is-blocked")),
+						},
+					},
+				},
+			},
+		},
+		Always: []*statemachine.TransitionDef{
+			{
+				From:     []string{"unlocked"},
+				To:       "locked",
+				IfGuards: []*statemachine.TransitionGuardDef{{RegisteredFunc: "is-expired"}},
+			},
+		},
+		AfterCallbacks: []*statemachine.TransitionCallbackDef{
+			{
+				To: []string{"unlocked"},
+				Do: []*statemachine.TransitionCallbackFuncDef{{Label: "showGo()"}},
+			},
+		},
+	}
+
+	_ = diagram.Mermaid(os.Stdout, machineDef)
+
+	// Output: stateDiagram-v2
+	//   [*] --> locked
+	//   locked --> unlocked : coin / count-coin / showGo()
+	//   unlocked --> locked : push [ is-clear && (is-timed-out || !is-blocked) ]
+	//   locked --> retired : retire
+	//   unlocked --> locked : [ is-expired ]
+	//   retired --> [*]
+}
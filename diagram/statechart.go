@@ -0,0 +1,82 @@
+package diagram
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// Mermaid writes the definition as a Mermaid stateDiagram-v2.
+func Mermaid(w io.Writer, def *statemachine.MachineDef) error {
+	p := &printer{w: w}
+	p.printf(0, "stateDiagram-v2")
+	writeStatechart(p, 1, newGraph(def), "")
+	return p.err
+}
+
+// PlantUML writes the definition as a PlantUML state diagram.
+func PlantUML(w io.Writer, def *statemachine.MachineDef) error {
+	p := &printer{w: w}
+	p.printf(0, "@startuml")
+	writeStatechart(p, 0, newGraph(def), "")
+	p.printf(0, "@enduml")
+	return p.err
+}
+
+var invalidIDChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// writeStatechart writes the common subset of the Mermaid and PlantUML
+// state diagram syntaxes. States of submachines are prefixed with their
+// path to keep them unique, and aliased back to their own names.
+func writeStatechart(p *printer, indent int, g *graph, prefix string) {
+	id := func(state string) string {
+		return invalidIDChars.ReplaceAllString(prefix+state, "_")
+	}
+
+	for _, state := range g.states {
+		if _, ok := g.submachines[state]; ok {
+			continue
+		}
+		if id(state) != state {
+			p.printf(indent, "state \"%s\" as %s", state, id(state))
+		}
+	}
+
+	p.printf(indent, "[*] --> %s", id(g.initialState))
+
+	for _, e := range g.edges {
+		if e.label == "" {
+			p.printf(indent, "%s --> %s", id(e.from), id(e.to))
+			continue
+		}
+		p.printf(indent, "%s --> %s : %s", id(e.from), id(e.to), e.label)
+	}
+
+	for _, state := range g.finalStates {
+		p.printf(indent, "%s --> [*]", id(state))
+	}
+
+	for _, state := range sortedKeys(g.submachines) {
+		if id(state) != state {
+			p.printf(indent, "state \"%s\" as %s {", state, id(state))
+		} else {
+			p.printf(indent, "state %s {", state)
+		}
+		for i, submachine := range g.submachines[state] {
+			if i > 0 {
+				p.printf(indent+1, "--")
+			}
+			writeStatechart(p, indent+1, submachine, prefix+state+"_"+submachineName(submachine, i)+"_")
+		}
+		p.printf(indent, "}")
+	}
+}
+
+func submachineName(g *graph, i int) string {
+	if g.id != "" {
+		return g.id
+	}
+	return "region" + strconv.Itoa(i)
+}
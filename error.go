@@ -7,3 +7,6 @@ import (
 var ErrNoMatchingTransition = errors.New("no matching transition")
 var ErrTransitionNotAllowed = errors.New("transition not allowed")
 var ErrStateTypeNotSupported = errors.New("state type not supported")
+var ErrNoPath = errors.New("no path to target state")
+var ErrMissingPayload = errors.New("missing payload")
+var ErrAlwaysLoop = errors.New("eventless transitions did not settle")
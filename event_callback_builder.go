@@ -8,6 +8,18 @@ package statemachine
 //
 // 	func(err error)
 // 	func(transition eventmachine.Transition, err error)
+//
+// BeforeEvent callbacks may accept Machine, Event and context.Context, and
+// may return an error to veto the event:
+//
+// 	func(event statemachine.Event) error
+//
+// AfterEvent callbacks may accept Machine, Event, Transition and
+// context.Context:
+//
+// 	func(event statemachine.Event, transition statemachine.Transition)
+//
+// Any of them may also accept the context of the machine.
 type EventCallbackFunc interface{}
 
 // EventCallbackBuilder provides the ability to define the `on` event(s)
@@ -1,21 +1,22 @@
 package statemachine
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 )
 
 type EventCallbackFuncDef struct {
-	RegisteredFunc string            `json:",omitempty" hcl:"registered_func" hcle:"omitempty"`
-	Func           EventCallbackFunc `json:"-" hcle:"omit"`
+	RegisteredFunc string            `json:",omitempty"`
+	Func           EventCallbackFunc `json:"-"`
 }
 
 type EventCallbackDef struct {
-	On       []string                `json:",omitempty" hcl:"on" hcle:"omitempty"`
-	ExceptOn []string                `json:",omitempty" hcl:"except_on" hcle:"omitempty"`
-	Do       []*EventCallbackFuncDef `json:",omitempty" hcl:"do" hcle:"omitempty"`
+	On       []string                `json:",omitempty"`
+	ExceptOn []string                `json:",omitempty"`
+	Do       []*EventCallbackFuncDef `json:",omitempty"`
 
-	validateFor string `json:"-" hcle:"omit"`
+	validateFor string `json:"-"`
 }
 
 func (s *EventCallbackDef) MatchesEvent(event string) bool {
@@ -59,7 +60,12 @@ func (s *EventCallbackDef) assertCallbackKind(callbackFunc EventCallbackFunc) {
 	t := reflect.TypeOf(callbackFunc)
 	switch t.Kind() {
 	case reflect.Func:
-		if t.NumOut() != 0 {
+		switch {
+		case t.NumOut() == 0:
+		case s.validateFor == "BeforeEvent" && t.NumOut() == 1 && t.Out(0) == reflect.TypeOf(new(error)).Elem():
+		case s.validateFor == "BeforeEvent":
+			panic("BeforeEvent callback func must return nothing or an error")
+		default:
 			panic("callback func must not return anything")
 		}
 
@@ -67,6 +73,15 @@ func (s *EventCallbackDef) assertCallbackKind(callbackFunc EventCallbackFunc) {
 		requiredArgs := make(map[reflect.Type]struct{})
 
 		switch s.validateFor {
+		case "BeforeEvent":
+			optionalArgs[reflect.TypeOf(new(Machine))] = struct{}{}
+			optionalArgs[reflect.TypeOf(new(Event))] = struct{}{}
+			optionalArgs[reflect.TypeOf(new(context.Context))] = struct{}{}
+		case "AfterEvent":
+			optionalArgs[reflect.TypeOf(new(Machine))] = struct{}{}
+			optionalArgs[reflect.TypeOf(new(Event))] = struct{}{}
+			optionalArgs[reflect.TypeOf(new(Transition))] = struct{}{}
+			optionalArgs[reflect.TypeOf(new(context.Context))] = struct{}{}
 		case "AfterFailure":
 			optionalArgs[reflect.TypeOf(new(Event))] = struct{}{}
 			requiredArgs[reflect.TypeOf(new(error))] = struct{}{}
@@ -78,6 +93,11 @@ func (s *EventCallbackDef) assertCallbackKind(callbackFunc EventCallbackFunc) {
 			if _, ok := optionalArgs[reflect.PtrTo(argType)]; ok {
 				continue
 			}
+			// the context of the machine, whose type is checked along with
+			// the definition.
+			if isContextType(argType) {
+				continue
+			}
 			if _, ok := requiredArgs[reflect.PtrTo(argType)]; ok {
 				continue
 			}
@@ -6,9 +6,9 @@ import (
 
 type EventDef struct {
 	// Name        string
-	TimedEvery  time.Duration    `json:",omitempty" hcl:"timed_every" hcle:"omitempty"`
-	Choice      *ChoiceDef       `json:",omitempty" hcl:"choice" hcle:"omitempty"`
-	Transitions []*TransitionDef `json:",omitempty" hcl:"transitions" hcle:"omitempty"`
+	TimedEvery  time.Duration    `json:",omitempty"`
+	Choice      *ChoiceDef       `json:",omitempty"`
+	Transitions []*TransitionDef `json:",omitempty"`
 }
 
 func (def *EventDef) SetEvery(duration time.Duration) {
@@ -22,3 +22,20 @@ func (def *EventDef) SetChoice(choiceDef *ChoiceDef) {
 func (def *EventDef) AddTransition(transitionDef *TransitionDef) {
 	def.Transitions = append(def.Transitions, transitionDef)
 }
+
+// hasTransitionFrom reports whether the event, or a branch of its choice, has
+// a transition from state.
+func (def *EventDef) hasTransitionFrom(state string) bool {
+	if def == nil {
+		return false
+	}
+	for _, transitionDef := range def.Transitions {
+		if transitionDef.Matches(state) {
+			return true
+		}
+	}
+	if def.Choice != nil {
+		return def.Choice.OnTrue.hasTransitionFrom(state) || def.Choice.OnFalse.hasTransitionFrom(state)
+	}
+	return false
+}
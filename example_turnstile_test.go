@@ -8,7 +8,7 @@ type Process struct {
 	statemachine.Machine
 }
 
-func ExampleTurnstile() {
+func Example_turnstile() {
 	turnstile := &Process{}
 	turnstile.Machine = statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
 		m.InitialState("locked")
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"io/ioutil"
 
-	"github.com/hashicorp/hcl"
-
 	"github.com/Gurpartap/statemachine-go"
 )
 
@@ -16,8 +14,7 @@ func main() {
 		panic(err)
 	}
 
-	def := &statemachine.MachineDef{}
-	err = hcl.Decode(def, string(b))
+	def, err := statemachine.LoadHCL("examples/hcl/process.hcl", b)
 	if err != nil {
 		panic(err)
 	}
@@ -3,306 +3,228 @@ states = ["unmonitored", "stopped", "starting", "stopping", "restarting"]
 initial_state = "unmonitored"
 
 event "monitor" {
-  transitions = [
-    {
-      from = ["unmonitored"]
-      to   = "stopped"
-    }
-  ]
+  transition {
+    from = ["unmonitored"]
+    to   = "stopped"
+  }
 }
 
 event "restart" {
-  transitions = [
-    {
-      from = ["running", "stopped"]
-      to   = "restarting"
-    }
-  ]
+  transition {
+    from = ["running", "stopped"]
+    to   = "restarting"
+  }
 }
 
 event "start" {
-  transitions = [
-    {
-      from = ["unmonitored", "stopped"]
-      to   = "starting"
-    }
-  ]
+  transition {
+    from = ["unmonitored", "stopped"]
+    to   = "starting"
+  }
 }
 
 event "stop" {
-  transitions = [
-    {
-      from = ["running"]
-      to   = "stopping"
-    }
-  ]
+  transition {
+    from = ["running"]
+    to   = "stopping"
+  }
 }
 
 event "tick" {
-  transitions = [
-    {
-      from     = ["starting"]
-      to       = "running"
-      if_guard = {
-        registered_func = "is-process-running"
-      }
-    },
-    {
-      from         = ["starting"]
-      to           = "stopped"
-      unless_guard = {
-        registered_func = "is-process-running"
-      }
-    },
-    {
-      from         = ["running"]
-      to           = "stopped"
-      unless_guard = {
-        registered_func = "is-process-running"
-      }
-    },
-    {
-      from     = ["stopping"]
-      to       = "running"
-      if_guard = {
-        registered_func = "is-process-running"
-      }
-    },
-    {
-      from         = ["stopping"]
-      to           = "stopped"
-      unless_guard = {
-        registered_func = "is-process-running"
-      }
-    },
-    {
-      from     = ["stopped"]
-      to       = "running"
-      if_guard = {
-        registered_func = "is-process-running"
-      }
-    },
-    {
-      from         = ["stopped"]
-      to           = "starting"
-      if_guard     = {
-        registered_func = "is-autostart-on"
-      }
-      unless_guard = {
-        registered_func = "is-process-running"
-      }
-    },
-    {
-      from     = ["restarting"]
-      to       = "running"
-      if_guard = {
-        registered_func = "is-process-running"
-      }
-    },
-    {
-      from         = ["restarting"]
-      to           = "stopped"
-      unless_guard = {
-        registered_func = "is-process-running"
-      }
-    }
-  ]
+  transition {
+    from = ["starting"]
+    to   = "running"
+    if   = [is-process-running]
+  }
+
+  transition {
+    from   = ["starting"]
+    to     = "stopped"
+    unless = [is-process-running]
+  }
+
+  transition {
+    from   = ["running"]
+    to     = "stopped"
+    unless = [is-process-running]
+  }
+
+  transition {
+    from = ["stopping"]
+    to   = "running"
+    if   = [is-process-running]
+  }
+
+  transition {
+    from   = ["stopping"]
+    to     = "stopped"
+    unless = [is-process-running]
+  }
+
+  transition {
+    from = ["stopped"]
+    to   = "running"
+    if   = [is-process-running]
+  }
+
+  transition {
+    from   = ["stopped"]
+    to     = "starting"
+    if     = [{ func = is-autostart-on, label = "shouldAutoStart" }]
+    unless = ["${is-process-running}"]
+  }
+
+  transition {
+    from = ["restarting"]
+    to   = "running"
+    if   = [is-process-running]
+  }
+
+  transition {
+    from   = ["restarting"]
+    to     = "stopped"
+    unless = [is-process-running]
+  }
 }
 
 event "unmonitor" {
-  transitions = [
-    {
-      from = []
-      to   = "unmonitored"
-    }
-  ]
+  transition {
+    to = "unmonitored"
+  }
 }
 
-submachine running {
+submachine "running" {
   states = ["pending", "success", "failure"]
 
   initial_state = "pending"
 
   event "process" {
-    transitions = [
-      {
-        from = ["pending"]
-        to   = "processing"
-      }
-    ]
+    transition {
+      from = ["pending"]
+      to   = "processing"
+    }
   }
 
   event "succeed" {
-    transitions = [
-      {
-        from = ["processing"]
-        to   = "success"
-      }
-    ]
+    transition {
+      from = ["processing"]
+      to   = "success"
+    }
   }
 
   event "fail" {
-    transitions = [
-      {
-        from = ["processing"]
-        to   = "failure"
-      }
-    ]
+    transition {
+      from = ["processing"]
+      to   = "failure"
+    }
   }
 
-  submachine processing {
-    states = ["loading", "subsubprocessing"]
+  submachine "processing" {
+    states = ["loading", "subsubprocessing", "done"]
 
     initial_state = "loading"
 
     event "subsubprocess" {
-      transitions = [
-        {
-          from = ["loading"]
-          to   = "subsubprocessing"
-        }
-      ]
+      transition {
+        from = ["loading"]
+        to   = "subsubprocessing"
+      }
     }
 
     event "to_done" {
-      transitions = [
-        {
-          from = ["subsubprocessing"]
-          to   = "done"
-        }
-      ]
-    }
-
-    around_callbacks = [
-      {
-        do = {
-          registered_func = "subsub-around-callback-1"
-        }
-      }
-    ]
-
-    after_callbacks = [
-      {
-        to = ["subsubprocessing"]
-        do = {
-          registered_func = "subsub-after-callback-1"
-        }
-      },
-      {
-        to        = ["done"]
-        exit_into = "success"
-      }
-    ]
-
-    failure_callbacks = [
-      {
-        do = {
-          registered_func = "subsub-failure-callback-1"
-        }
-      }
-    ]
-  }
-  around_callbacks = [
-    {
-      do = {
-        registered_func = "sub-around-callback-1"
+      transition {
+        from = ["subsubprocessing"]
+        to   = "done"
       }
     }
-  ]
-
-  after_callbacks = [
-    {
-      to = ["processing"]
 
-      do = {
-        registered_func = "sub-after-callback-1"
-      }
-    },
-    {
-      to        = ["success"]
-      exit_into = "stopped"
-    },
-    {
-      to        = ["failure"]
-      exit_into = "retrying"
+    around_transition {
+      do = [subsub-around-callback-1]
     }
-  ]
 
-  failure_callbacks = [
-    {
-      do = {
-        registered_func = "sub-failure-callback-1"
-      }
+    after_transition {
+      to = ["subsubprocessing"]
+      do = [subsub-after-callback-1]
     }
-  ]
-}
 
-before_callbacks = [
-  {
-    to = ["starting"]
-    do = {
-      registered_func = "before-callback-1"
-    }
-  },
-  {
-    to = ["stopping"]
-    do = {
-      registered_func = "before-callback-2"
+    after_transition {
+      to            = ["done"]
+      exit_to_state = "success"
     }
-  },
-  {
-    to = ["restarting"]
-    do = {
-      registered_func = "before-callback-3"
-    }
-  },
-  {
-    to = ["unmonitored"]
-    do = {
-      registered_func = "before-callback-4"
+
+    after_failure {
+      do = [subsub-failure-callback-1]
     }
   }
-]
 
-around_callbacks = [
-  {
-    do = {
-      registered_func = "around-callback-"
-    }
+  around_transition {
+    do = [sub-around-callback-1]
   }
-]
 
-after_callbacks = [
-  {
-    to = ["starting"]
-    do = {
-      registered_func = "after-callback-1"
-    }
-  },
-  {
-    to = ["stopping"]
-    do = {
-      registered_func = "after-callback-2"
-    }
-  },
-  {
-    to = ["restarting"]
-    do = {
-      registered_func = "after-callback-3"
-    }
-  },
-  {
-    to = ["running"]
-    do = {
-      registered_func = "after-callback-4"
-    }
+  after_transition {
+    to = ["processing"]
+    do = [sub-after-callback-1]
   }
-]
 
-failure_callbacks = [
-  {
-    do = {
-      registered_func = "failure-callback"
-    }
+  after_transition {
+    to            = ["success"]
+    exit_to_state = "stopped"
   }
-]
+
+  after_transition {
+    to            = ["failure"]
+    exit_to_state = "restarting"
+  }
+
+  after_failure {
+    do = [sub-failure-callback-1]
+  }
+}
+
+before_transition {
+  to = ["starting"]
+  do = [before-callback-1]
+}
+
+before_transition {
+  to = ["stopping"]
+  do = [before-callback-2]
+}
+
+before_transition {
+  to = ["restarting"]
+  do = [before-callback-3]
+}
+
+before_transition {
+  to = ["unmonitored"]
+  do = [before-callback-4]
+}
+
+around_transition {
+  do = [around-callback-1]
+}
+
+after_transition {
+  to = ["starting"]
+  do = [after-callback-1]
+}
+
+after_transition {
+  to = ["stopping"]
+  do = [after-callback-2]
+}
+
+after_transition {
+  to = ["restarting"]
+  do = [after-callback-3]
+}
+
+after_transition {
+  to = ["running"]
+  do = [after-callback-4]
+}
+
+after_failure {
+  do = [failure-callback]
+}
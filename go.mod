@@ -1,3 +1,10 @@
 module github.com/Gurpartap/statemachine-go
 
 go 1.13
+
+require (
+	github.com/hashicorp/hcl/v2 v2.8.2
+	github.com/stretchr/testify v1.6.1 // indirect
+	github.com/zclconf/go-cty v1.2.0
+	gopkg.in/yaml.v3 v3.0.1
+)
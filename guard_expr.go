@@ -0,0 +1,230 @@
+package statemachine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/Gurpartap/statemachine-go/internal/expr"
+)
+
+// Expr returns a guard which evaluates the expression src, such as
+// `ctx.retries < 3 && payload.force`. It panics if src is not a valid
+// expression.
+//
+// Expressions read the variables of the machine's context (see
+// MachineBuilder.Context) as `ctx.<name>`, and the payload of the event
+// passed to Machine.FireContext as `payload`, or its fields and map keys as
+// `payload.<name>`. Fields are matched by name, by json tag, or by name
+// regardless of case. With more than one payload, the first one with the
+// field is read. Expressions combine numbers, strings, true, false and null
+// with the operators
+//
+//	|| && == != < <= > >= + - * / % !
+//
+// and parentheses, and have no side effects. Expressions are type-checked
+// against the context when the definition is validated, and a guard whose
+// expression reads a payload field which the event was not fired with fails
+// with ErrMissingPayload.
+func Expr(src string) *TransitionGuardDef {
+	program, err := compileExpr(src, anyExprType)
+	if err != nil {
+		panic(fmt.Sprintf("invalid guard expression '%s': %s", src, err))
+	}
+	return &TransitionGuardDef{Expr: src, program: program}
+}
+
+// payloadArgs are the payloads of an event, as passed to guard expressions.
+type payloadArgs []interface{}
+
+var payloadArgsType = reflect.TypeOf(payloadArgs(nil))
+
+// funcNamePattern matches the strings which are taken for registered func
+// names, rather than expressions, where a guard may be either.
+var funcNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.:-]*$`)
+
+func isFuncName(s string) bool {
+	return funcNamePattern.MatchString(s)
+}
+
+// compileExpr parses and type-checks a guard expression, given the types of
+// the variables it reads.
+func compileExpr(src string, typeOf func(path []string) (expr.Type, error)) (*expr.Program, error) {
+	program, err := expr.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := program.Check(typeOf)
+	if err != nil {
+		return nil, err
+	}
+	if t != expr.Bool && t != expr.Any {
+		return nil, fmt.Errorf("expression is a %s, not a bool", t)
+	}
+	return program, nil
+}
+
+// compileAssign parses and type-checks the expression of an assign action,
+// whose value is assigned to the context variable name.
+func (def *MachineDef) compileAssign(name, src string) (*expr.Program, error) {
+	if def.Context == nil {
+		return nil, errors.New("machine has no context")
+	}
+	varType, ok := contextVarType(def.Context, name)
+	if !ok {
+		return nil, fmt.Errorf("unknown context variable '%s'", name)
+	}
+
+	program, err := expr.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	t, err := program.Check(def.exprType)
+	if err != nil {
+		return nil, err
+	}
+	if t != varType && t != expr.Any && varType != expr.Any && t != expr.Null {
+		return nil, fmt.Errorf("expression is a %s, but context variable '%s' is a %s", t, name, varType)
+	}
+	return program, nil
+}
+
+// anyExprType types the variables of expressions which are compiled
+// without a definition.
+func anyExprType(path []string) (expr.Type, error) {
+	switch path[0] {
+	case "ctx", "payload":
+		return expr.Any, nil
+	}
+	return expr.Any, fmt.Errorf("unknown variable '%s', expected ctx or payload", path[0])
+}
+
+// exprType types the variables of expressions by the context of the
+// definition. Payloads are typed when the expression is evaluated.
+func (def *MachineDef) exprType(path []string) (expr.Type, error) {
+	if path[0] != "ctx" {
+		return anyExprType(path)
+	}
+	if def.Context == nil {
+		return expr.Any, errors.New("machine has no context")
+	}
+	if len(path) == 1 {
+		return expr.Any, nil
+	}
+	t, ok := contextVarType(def.Context, path[1])
+	if !ok {
+		return expr.Any, fmt.Errorf("unknown context variable '%s'", path[1])
+	}
+	if len(path) > 2 {
+		return expr.Any, nil
+	}
+	return t, nil
+}
+
+// execExpr evaluates the guard expression src with args. program is src
+// compiled, if it already is.
+func execExpr(src string, program *expr.Program, args map[reflect.Type]interface{}) (bool, error) {
+	if program == nil {
+		var err error
+		if program, err = compileExpr(src, anyExprType); err != nil {
+			return false, fmt.Errorf("guard expression '%s': %s", src, err)
+		}
+	}
+
+	value, err := program.Eval(func(path []string) (interface{}, error) {
+		return exprValue(path, args)
+	})
+	if err != nil {
+		return false, fmt.Errorf("guard expression '%s': %w", src, err)
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("guard expression '%s' is not a bool", src)
+	}
+	return result, nil
+}
+
+func exprValue(path []string, args map[reflect.Type]interface{}) (interface{}, error) {
+	switch path[0] {
+	case "ctx":
+		context, _ := args[contextArgType].(contextArg)
+		if context.value == nil {
+			return nil, errors.New("machine has no context")
+		}
+		if value, ok := lookupPath(context.value, path[1:]); ok {
+			return value, nil
+		}
+		return nil, fmt.Errorf("unknown context variable '%s'", strings.Join(path[1:], "."))
+
+	case "payload":
+		payloads, _ := args[payloadArgsType].(payloadArgs)
+		for _, payload := range payloads {
+			if value, ok := lookupPath(payload, path[1:]); ok {
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf("%w with '%s'", ErrMissingPayload, strings.Join(path, "."))
+	}
+	return nil, fmt.Errorf("unknown variable '%s'", path[0])
+}
+
+// lookupPath returns the value of the field or map key at path in value.
+func lookupPath(value interface{}, path []string) (interface{}, bool) {
+	v := reflect.ValueOf(value)
+	for _, name := range path {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil, false
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			v = v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		case reflect.Struct:
+			v = structField(v, name)
+		default:
+			return nil, false
+		}
+		if !v.IsValid() {
+			return nil, false
+		}
+	}
+	if !v.IsValid() {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+// structField returns the exported field of v with the name, json tag name,
+// or name regardless of case, in that order of preference.
+func structField(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	match := -1
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		switch {
+		case field.Name == name:
+			return v.Field(i)
+		case tag == name:
+			match = i
+		case match == -1 && strings.EqualFold(field.Name, name):
+			match = i
+		}
+	}
+	if match == -1 {
+		return reflect.Value{}
+	}
+	return v.Field(match)
+}
@@ -0,0 +1,98 @@
+package statemachine_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+type Order struct {
+	Amount  float64 `json:"amount"`
+	Express bool
+	Labels  map[string]string
+}
+
+func ExampleExpr() {
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("pending", "review", "approved")
+		m.InitialState("pending")
+
+		m.Event("submit", func(e statemachine.EventBuilder) {
+			e.Transition().From("pending").To("approved").
+				If(statemachine.Expr("payload.amount < 100 || payload.express && payload.labels.tier == 'gold'"))
+			e.Transition().From("pending").To("review")
+		})
+	})
+
+	order := &Order{Amount: 250, Express: true, Labels: map[string]string{"tier": "gold"}}
+	fmt.Println(machine.FireContext(context.Background(), "submit", order), machine.GetState())
+
+	machine.SetCurrentState("pending")
+	order.Labels["tier"] = "silver"
+	fmt.Println(machine.FireContext(context.Background(), "submit", order), machine.GetState())
+
+	machine.SetCurrentState("pending")
+	err := machine.Fire("submit")
+	fmt.Println(errors.Is(err, statemachine.ErrMissingPayload), machine.GetState())
+
+	// Output:
+	// <nil> approved
+	// <nil> review
+	// true pending
+}
+
+func ExampleExpr_hcl() {
+	machineDef, err := statemachine.LoadHCL("order.hcl", []byte(`
+		states        = ["pending", "approved", "rejected"]
+		initial_state = "pending"
+
+		event "review" {
+		  choice {
+		    condition = "payload.amount <= 1000"
+
+		    on_true {
+		      transition {
+		        to     = "approved"
+		        unless = [{ expr = "payload.flagged", label = "isFlagged" }]
+		      }
+		    }
+
+		    on_false {
+		      transition {
+		        to = "rejected"
+		      }
+		    }
+		  }
+		}
+	`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+
+	payload := map[string]interface{}{"amount": 120, "flagged": false}
+	fmt.Println(machine.FireContext(context.Background(), "review", payload), machine.GetState())
+
+	_, err = statemachine.LoadHCL("order.hcl", []byte(`
+		states        = ["pending", "approved"]
+		initial_state = "pending"
+
+		event "review" {
+		  transition {
+		    to = "approved"
+		    if = ["payload.amount > 1000 && 'yes'", "retries < 3"]
+		  }
+		}
+	`))
+	fmt.Println(err)
+
+	// Output:
+	// <nil> approved
+	// event.review.transitions[0].if_guard[0].expr: col 23: operator && does not accept bool and string
+	// event.review.transitions[0].if_guard[1].expr: col 1: unknown variable 'retries', expected ctx or payload
+}
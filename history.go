@@ -0,0 +1,93 @@
+package statemachine
+
+// History selects how a transition to a state with submachines restores the
+// states they were in when the machine last left it (see
+// TransitionToBuilder.WithHistory).
+type History string
+
+const (
+	// Shallow history restores the last active state of each submachine,
+	// whose own submachines start over from their initial states.
+	Shallow History = "shallow"
+
+	// Deep history restores the last active states of the submachines, and
+	// of their submachines, all the way down.
+	Deep History = "deep"
+)
+
+func (history History) isValid() bool {
+	return history == Shallow || history == Deep
+}
+
+// recordHistory remembers the states of the submachines of the current
+// state, which the machine is about to leave.
+func (m *machineImpl) recordHistory() {
+	submachines := m.submachines[m.currentState]
+	if len(submachines) == 0 {
+		return
+	}
+
+	configuration := map[string]*Snapshot{}
+	for _, submachine := range submachines {
+		configuration[submachine.def.ID] = submachine.configuration()
+	}
+	if m.history == nil {
+		m.history = map[string]map[string]*Snapshot{}
+	}
+	m.history[m.currentState] = configuration
+}
+
+// configuration returns the states of the machine and of its active
+// submachines, without their context.
+func (m *machineImpl) configuration() *Snapshot {
+	snapshot := &Snapshot{State: m.currentState}
+	for _, submachine := range m.submachines[m.currentState] {
+		if snapshot.Submachines == nil {
+			snapshot.Submachines = map[string]*Snapshot{}
+		}
+		snapshot.Submachines[submachine.def.ID] = submachine.configuration()
+	}
+	return snapshot
+}
+
+// restoreHistory sets the submachines of state, which the machine has just
+// entered, to the states recorded when it last left the state, if it did.
+// Recorded states which the submachines don't know of, e.g. those of a
+// restored snapshot of an older definition, are left at their initial state.
+func (m *machineImpl) restoreHistory(state string, history History) {
+	for _, submachine := range m.submachines[state] {
+		if configuration, ok := m.history[state][submachine.def.ID]; ok {
+			submachine.restoreConfiguration(configuration, history)
+		}
+	}
+}
+
+func (m *machineImpl) restoreConfiguration(configuration *Snapshot, history History) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.setCurrentState(configuration.State); err != nil || history != Deep {
+		return
+	}
+	for id, submachineConfiguration := range configuration.Submachines {
+		if submachine := m.activeSubmachine(id); submachine != nil {
+			submachine.restoreConfiguration(submachineConfiguration, history)
+		}
+	}
+}
+
+// copyHistory returns a copy of history, which shares no maps with it. The
+// recorded configurations aren't changed once recorded, and are shared.
+func copyHistory(history map[string]map[string]*Snapshot) map[string]map[string]*Snapshot {
+	if len(history) == 0 {
+		return nil
+	}
+	historyCopy := make(map[string]map[string]*Snapshot, len(history))
+	for state, configuration := range history {
+		historyCopy[state] = make(map[string]*Snapshot, len(configuration))
+		for id, snapshot := range configuration {
+			historyCopy[state][id] = snapshot
+		}
+	}
+	return historyCopy
+}
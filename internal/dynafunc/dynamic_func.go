@@ -49,6 +49,11 @@ func (f *DynamicFunc) Call() error {
 
 		// fmt.Println(t, "=>", object)
 
+		if object == nil {
+			// e.g. a nil error.
+			in[i] = reflect.Zero(t)
+			continue
+		}
 		in[i] = reflect.ValueOf(object)
 	}
 
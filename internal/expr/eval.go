@@ -0,0 +1,267 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+func check(n node, typeOf func(path []string) (Type, error)) (Type, error) {
+	switch n := n.(type) {
+	case *litNode:
+		return typeOfValue(n.value), nil
+
+	case *pathNode:
+		t, err := typeOf(n.path)
+		if err != nil {
+			return Any, &Error{Col: n.col(), Msg: err.Error()}
+		}
+		return t, nil
+
+	case *unaryNode:
+		x, err := check(n.x, typeOf)
+		if err != nil {
+			return Any, err
+		}
+		want := Number
+		if n.op == "!" {
+			want = Bool
+		}
+		if x != Any && x != want {
+			return Any, &Error{Col: n.col(), Msg: fmt.Sprintf("operator %s needs a %s, got %s", n.op, want, x)}
+		}
+		return want, nil
+
+	case *binaryNode:
+		x, err := check(n.x, typeOf)
+		if err != nil {
+			return Any, err
+		}
+		y, err := check(n.y, typeOf)
+		if err != nil {
+			return Any, err
+		}
+		mismatch := &Error{Col: n.col(), Msg: fmt.Sprintf("operator %s does not accept %s and %s", n.op, x, y)}
+
+		switch n.op {
+		case "&&", "||":
+			if !is(x, Bool) || !is(y, Bool) {
+				return Any, mismatch
+			}
+			return Bool, nil
+
+		case "==", "!=":
+			if x != Any && y != Any && x != Null && y != Null && x != y {
+				return Any, mismatch
+			}
+			return Bool, nil
+
+		case "<", "<=", ">", ">=":
+			if !(is(x, Number) && is(y, Number) || is(x, String) && is(y, String)) {
+				return Any, mismatch
+			}
+			return Bool, nil
+
+		case "+":
+			switch {
+			case is(x, Number) && is(y, Number) && (x == Number || y == Number):
+				return Number, nil
+			case is(x, String) && is(y, String) && (x == String || y == String):
+				return String, nil
+			case x == Any && y == Any:
+				return Any, nil
+			}
+			return Any, mismatch
+
+		default:
+			if !is(x, Number) || !is(y, Number) {
+				return Any, mismatch
+			}
+			return Number, nil
+		}
+	}
+	panic("unknown node")
+}
+
+// is reports whether a value of type t may have type want.
+func is(t, want Type) bool {
+	return t == want || t == Any
+}
+
+func typeOfValue(value interface{}) Type {
+	switch value.(type) {
+	case nil:
+		return Null
+	case bool:
+		return Bool
+	case float64:
+		return Number
+	case string:
+		return String
+	}
+	return Any
+}
+
+func eval(n node, valueOf func(path []string) (interface{}, error)) (interface{}, error) {
+	switch n := n.(type) {
+	case *litNode:
+		return n.value, nil
+
+	case *pathNode:
+		value, err := valueOf(n.path)
+		if err != nil {
+			return nil, err
+		}
+		return normalize(value), nil
+
+	case *unaryNode:
+		x, err := eval(n.x, valueOf)
+		if err != nil {
+			return nil, err
+		}
+		switch x := x.(type) {
+		case bool:
+			if n.op == "!" {
+				return !x, nil
+			}
+		case float64:
+			if n.op == "-" {
+				return -x, nil
+			}
+		}
+		return nil, fmt.Errorf("operator %s does not accept %s", n.op, typeOfValue(x))
+
+	case *binaryNode:
+		x, err := eval(n.x, valueOf)
+		if err != nil {
+			return nil, err
+		}
+
+		// && and || only evaluate their right operand when needed.
+		if n.op == "&&" || n.op == "||" {
+			xb, ok := x.(bool)
+			if !ok {
+				return nil, fmt.Errorf("operator %s does not accept %s", n.op, typeOfValue(x))
+			}
+			if xb == (n.op == "||") {
+				return xb, nil
+			}
+			y, err := eval(n.y, valueOf)
+			if err != nil {
+				return nil, err
+			}
+			yb, ok := y.(bool)
+			if !ok {
+				return nil, fmt.Errorf("operator %s does not accept %s", n.op, typeOfValue(y))
+			}
+			return yb, nil
+		}
+
+		y, err := eval(n.y, valueOf)
+		if err != nil {
+			return nil, err
+		}
+		return evalBinary(n.op, x, y)
+	}
+	panic("unknown node")
+}
+
+func evalBinary(op string, x, y interface{}) (interface{}, error) {
+	switch op {
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	}
+
+	mismatch := fmt.Errorf("operator %s does not accept %s and %s", op, typeOfValue(x), typeOfValue(y))
+
+	if xs, ok := x.(string); ok {
+		ys, ok := y.(string)
+		if !ok {
+			return nil, mismatch
+		}
+		switch op {
+		case "<":
+			return xs < ys, nil
+		case "<=":
+			return xs <= ys, nil
+		case ">":
+			return xs > ys, nil
+		case ">=":
+			return xs >= ys, nil
+		case "+":
+			return xs + ys, nil
+		}
+		return nil, mismatch
+	}
+
+	xn, ok := x.(float64)
+	if !ok {
+		return nil, mismatch
+	}
+	yn, ok := y.(float64)
+	if !ok {
+		return nil, mismatch
+	}
+	switch op {
+	case "<":
+		return xn < yn, nil
+	case "<=":
+		return xn <= yn, nil
+	case ">":
+		return xn > yn, nil
+	case ">=":
+		return xn >= yn, nil
+	case "+":
+		return xn + yn, nil
+	case "-":
+		return xn - yn, nil
+	case "*":
+		return xn * yn, nil
+	case "/", "%":
+		if yn == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if op == "%" {
+			return math.Mod(xn, yn), nil
+		}
+		return xn / yn, nil
+	}
+	return nil, mismatch
+}
+
+func equal(x, y interface{}) bool {
+	if x == nil || y == nil {
+		return x == nil && y == nil
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// normalize converts numbers to float64, and dereferences pointers to
+// values of the basic types.
+func normalize(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return value
+}
@@ -0,0 +1,154 @@
+// Package expr implements the guard expression language of state machine
+// definitions.
+//
+// An expression combines literals (numbers, strings in single or double
+// quotes, true, false and null) and paths (such as `ctx.retries` or
+// `payload.order.amount`) with the operators, by increasing precedence:
+//
+//	||
+//	&&
+//	== !=
+//	< <= > >=
+//	+ -
+//	* / %
+//	! -(unary)
+//
+// along with parentheses. There are no function calls, assignments or any
+// other operations with side effects, and paths only read values which the
+// caller resolves.
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is the static type of an expression. Any is the type of values which
+// are only known when the expression is evaluated.
+type Type int
+
+const (
+	Any Type = iota
+	Bool
+	Number
+	String
+	Null
+)
+
+func (t Type) String() string {
+	switch t {
+	case Bool:
+		return "bool"
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Null:
+		return "null"
+	}
+	return "any"
+}
+
+// Error is a syntax or type error in an expression, at a column of its
+// source.
+type Error struct {
+	Col int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("col %d: %s", e.Col, e.Msg)
+}
+
+// Program is a parsed expression.
+type Program struct {
+	src  string
+	root node
+}
+
+// Parse parses the expression in src.
+func Parse(src string) (*Program, error) {
+	p := &parser{lexer: &lexer{src: src}}
+	p.next()
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.unexpected()
+	}
+	return &Program{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (p *Program) String() string {
+	return p.src
+}
+
+// Paths returns the paths which the expression reads, in order.
+func (p *Program) Paths() [][]string {
+	var paths [][]string
+	var walk func(n node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case *pathNode:
+			paths = append(paths, n.path)
+		case *unaryNode:
+			walk(n.x)
+		case *binaryNode:
+			walk(n.x)
+			walk(n.y)
+		}
+	}
+	walk(p.root)
+	return paths
+}
+
+// Check returns the type of the expression, given the types of the paths it
+// reads, or an error if its operands have types which its operators don't
+// accept.
+func (p *Program) Check(typeOf func(path []string) (Type, error)) (Type, error) {
+	return check(p.root, typeOf)
+}
+
+// Eval evaluates the expression, given the values of the paths it reads.
+// Values are bools, numbers of any kind, strings, or nil. Numbers are
+// returned as float64.
+func (p *Program) Eval(valueOf func(path []string) (interface{}, error)) (interface{}, error) {
+	return eval(p.root, valueOf)
+}
+
+type node interface {
+	col() int
+}
+
+type litNode struct {
+	pos   int
+	value interface{}
+}
+
+type pathNode struct {
+	pos  int
+	path []string
+}
+
+type unaryNode struct {
+	pos int
+	op  string
+	x   node
+}
+
+type binaryNode struct {
+	pos  int
+	op   string
+	x, y node
+}
+
+func (n *litNode) col() int    { return n.pos + 1 }
+func (n *pathNode) col() int   { return n.pos + 1 }
+func (n *unaryNode) col() int  { return n.pos + 1 }
+func (n *binaryNode) col() int { return n.pos + 1 }
+
+func (n *pathNode) String() string {
+	return strings.Join(n.path, ".")
+}
@@ -0,0 +1,166 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+)
+
+var vars = map[string]interface{}{
+	"ctx.retries":    2,
+	"ctx.name":       "api",
+	"payload.force":  true,
+	"payload.amount": 12.5,
+	"payload.none":   nil,
+}
+
+func valueOf(path []string) (interface{}, error) {
+	key := (&pathNode{path: path}).String()
+	value, ok := vars[key]
+	if !ok {
+		return nil, errors.New("unknown " + key)
+	}
+	return value, nil
+}
+
+func typeOf(path []string) (Type, error) {
+	return Any, nil
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{"true", true},
+		{"ctx.retries < 3 && payload.force", true},
+		{"ctx.retries >= 3 || !payload.force", false},
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3", float64(9)},
+		{"-ctx.retries % 2", float64(0)},
+		{"payload.amount / 5 > 2", true},
+		{`ctx.name + "-" + 'v1'`, "api-v1"},
+		{`"a\"b" != 'a"b'`, false},
+		{"ctx.name < 'b' && ctx.name >= 'api'", true},
+		{"payload.none == null", true},
+		{"payload.none != ctx.name", true},
+		{"false && ctx.unknown", false},
+		{"true || ctx.unknown", true},
+	}
+
+	for _, test := range tests {
+		program, err := Parse(test.src)
+		if err != nil {
+			t.Errorf("%s: %s", test.src, err)
+			continue
+		}
+		if _, err := program.Check(typeOf); err != nil {
+			t.Errorf("%s: %s", test.src, err)
+			continue
+		}
+		got, err := program.Eval(valueOf)
+		if err != nil {
+			t.Errorf("%s: %s", test.src, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s = %v, want %v", test.src, got, test.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"ctx.retries / 0 > 1", "division by zero"},
+		{"ctx.name && true", "operator && does not accept string"},
+		{"ctx.retries < ctx.name", "operator < does not accept number and string"},
+		{"!ctx.retries", "operator ! does not accept number"},
+		{"ctx.unknown", "unknown ctx.unknown"},
+	}
+
+	for _, test := range tests {
+		program, err := Parse(test.src)
+		if err != nil {
+			t.Errorf("%s: %s", test.src, err)
+			continue
+		}
+		if _, err := program.Eval(valueOf); err == nil || err.Error() != test.err {
+			t.Errorf("%s: got error %v, want %s", test.src, err, test.err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"", "col 1: unexpected end of expression"},
+		{"ctx.retries <", "col 14: unexpected end of expression"},
+		{"ctx.retries < 3)", "col 16: unexpected ')'"},
+		{"(ctx.retries", "col 13: unexpected end of expression"},
+		{"ctx.", "col 5: unexpected end of expression"},
+		{"ctx.retries = 3", "col 13: unexpected character '='"},
+		{"len(ctx.name)", "col 4: unexpected '('"},
+		{"'open", "col 1: unterminated string"},
+		{"1.2.3", "col 1: invalid number '1.2.3'"},
+	}
+
+	for _, test := range tests {
+		if _, err := Parse(test.src); err == nil || err.Error() != test.err {
+			t.Errorf("%q: got error %v, want %s", test.src, err, test.err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	typeOf := func(path []string) (Type, error) {
+		switch path[0] {
+		case "n":
+			return Number, nil
+		case "s":
+			return String, nil
+		case "x":
+			return Any, nil
+		}
+		return Any, errors.New("unknown variable")
+	}
+
+	tests := []struct {
+		src  string
+		want Type
+		err  string
+	}{
+		{src: "n < 3 && x", want: Bool},
+		{src: "x + 1", want: Number},
+		{src: "s + x", want: String},
+		{src: "x + x", want: Any},
+		{src: "-n * 2", want: Number},
+		{src: "s == null", want: Bool},
+		{src: "n < s", err: "col 3: operator < does not accept number and string"},
+		{src: "n && x", err: "col 3: operator && does not accept number and any"},
+		{src: "!s", err: "col 1: operator ! needs a bool, got string"},
+		{src: "s == 1", err: "col 3: operator == does not accept string and number"},
+		{src: "n + s", err: "col 3: operator + does not accept number and string"},
+		{src: "y.z", err: "col 1: unknown variable"},
+	}
+
+	for _, test := range tests {
+		program, err := Parse(test.src)
+		if err != nil {
+			t.Errorf("%s: %s", test.src, err)
+			continue
+		}
+		got, err := program.Check(typeOf)
+		switch {
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%s: got error %v, want %s", test.src, err, test.err)
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %s", test.src, err)
+		case test.err == "" && got != test.want:
+			t.Errorf("%s: got type %s, want %s", test.src, got, test.want)
+		}
+	}
+}
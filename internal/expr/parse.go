@@ -0,0 +1,242 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind  tokKind
+	pos   int
+	text  string
+	value interface{}
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "."}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && strings.ContainsRune(" \t\r\n", rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos == len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case isLetter(c):
+		for l.pos < len(l.src) && (isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokIdent, pos: start, text: l.src[start:l.pos]}, nil
+
+	case isDigit(c):
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		text := l.src[start:l.pos]
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return token{}, &Error{Col: start + 1, Msg: fmt.Sprintf("invalid number '%s'", text)}
+		}
+		return token{kind: tokNumber, pos: start, text: text, value: value}, nil
+
+	case c == '"' || c == '\'':
+		var b strings.Builder
+		for l.pos++; l.pos < len(l.src); l.pos++ {
+			switch ch := l.src[l.pos]; {
+			case ch == c:
+				l.pos++
+				return token{kind: tokString, pos: start, text: l.src[start:l.pos], value: b.String()}, nil
+			case ch == '\\' && l.pos+1 < len(l.src):
+				l.pos++
+				switch esc := l.src[l.pos]; esc {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '\\', '"', '\'':
+					b.WriteByte(esc)
+				default:
+					return token{}, &Error{Col: l.pos, Msg: fmt.Sprintf("invalid escape '\\%c'", esc)}
+				}
+			default:
+				b.WriteByte(ch)
+			}
+		}
+		return token{}, &Error{Col: start + 1, Msg: "unterminated string"}
+	}
+
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, pos: start, text: op}, nil
+		}
+	}
+	return token{}, &Error{Col: start + 1, Msg: fmt.Sprintf("unexpected character '%c'", c)}
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type parser struct {
+	lexer *lexer
+	tok   token
+	err   error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lexer.next()
+}
+
+func (p *parser) is(op string) bool {
+	return p.err == nil && p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *parser) unexpected() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.tok.kind == tokEOF {
+		return &Error{Col: p.tok.pos + 1, Msg: "unexpected end of expression"}
+	}
+	return &Error{Col: p.tok.pos + 1, Msg: fmt.Sprintf("unexpected '%s'", p.tok.text)}
+}
+
+// binary parses operands separated by any of ops, which associate to the
+// left.
+func (p *parser) binary(operand func() (node, error), ops ...string) (node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		for _, o := range ops {
+			if p.is(o) {
+				op = o
+			}
+		}
+		if op == "" {
+			return x, p.err
+		}
+		pos := p.tok.pos
+		p.next()
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryNode{pos: pos, op: op, x: x, y: y}
+	}
+}
+
+func (p *parser) or() (node, error) {
+	return p.binary(p.and, "||")
+}
+
+func (p *parser) and() (node, error) {
+	return p.binary(p.equality, "&&")
+}
+
+func (p *parser) equality() (node, error) {
+	return p.binary(p.comparison, "==", "!=")
+}
+
+func (p *parser) comparison() (node, error) {
+	return p.binary(p.additive, "<", "<=", ">", ">=")
+}
+
+func (p *parser) additive() (node, error) {
+	return p.binary(p.multiplicative, "+", "-")
+}
+
+func (p *parser) multiplicative() (node, error) {
+	return p.binary(p.unary, "*", "/", "%")
+}
+
+func (p *parser) unary() (node, error) {
+	if p.is("!") || p.is("-") {
+		pos, op := p.tok.pos, p.tok.text
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{pos: pos, op: op, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber, tokString:
+		p.next()
+		return &litNode{pos: tok.pos, value: tok.value}, nil
+
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return &litNode{pos: tok.pos, value: true}, nil
+		case "false":
+			return &litNode{pos: tok.pos, value: false}, nil
+		case "null":
+			return &litNode{pos: tok.pos, value: nil}, nil
+		}
+		n := &pathNode{pos: tok.pos, path: []string{tok.text}}
+		for p.is(".") {
+			p.next()
+			if p.err != nil || p.tok.kind != tokIdent {
+				return nil, p.unexpected()
+			}
+			n.path = append(n.path, p.tok.text)
+			p.next()
+		}
+		return n, p.err
+
+	case tokOp:
+		if tok.text == "(" {
+			p.next()
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if !p.is(")") {
+				return nil, p.unexpected()
+			}
+			p.next()
+			return x, p.err
+		}
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,27 @@
+package statemachine
+
+// InvokeBuilder provides the ability to name a service invoked by a state.
+type InvokeBuilder interface {
+	// ID names the service, and so its completion events. It defaults to
+	// the name of the state.
+	ID(id string) InvokeBuilder
+}
+
+// newInvokeBuilder returns an InvokeBuilder for def.
+func newInvokeBuilder(def *InvokeDef) InvokeBuilder {
+	return &invokeBuilder{
+		def: def,
+	}
+}
+
+// invokeBuilder implements InvokeBuilder.
+type invokeBuilder struct {
+	def *InvokeDef
+}
+
+var _ InvokeBuilder = (*invokeBuilder)(nil)
+
+func (i *invokeBuilder) ID(id string) InvokeBuilder {
+	i.def.ID = id
+	return i
+}
@@ -0,0 +1,38 @@
+package statemachine
+
+import (
+	"context"
+	"fmt"
+)
+
+// InvokeFunc is a service invoked by a state (see MachineBuilder.Invoke).
+// It is called in its own goroutine when the state is entered, and ctx is
+// cancelled when the state is exited. send sends messages to the machine
+// for as long as the state is active.
+type InvokeFunc func(ctx context.Context, send func(Message)) error
+
+// InvokeDef is a service invoked by State, either set directly or referred
+// to by its RegisteredFunc name. ID names the completion events of the
+// service (see InvokeDoneEvent and InvokeErrorEvent).
+type InvokeDef struct {
+	ID             string
+	State          string
+	RegisteredFunc string     `json:",omitempty"`
+	Func           InvokeFunc `json:"-"`
+}
+
+func (def *MachineDef) AddInvoke(invokeDef *InvokeDef) {
+	def.Invokes = append(def.Invokes, invokeDef)
+}
+
+// assertInvokeKind returns fn as an InvokeFunc, or panics if it doesn't
+// have its signature.
+func assertInvokeKind(fn interface{}) InvokeFunc {
+	switch fn := fn.(type) {
+	case InvokeFunc:
+		return fn
+	case func(ctx context.Context, send func(Message)) error:
+		return fn
+	}
+	panic(fmt.Sprintf("invoke func must be of type 'func(context.Context, func(statemachine.Message)) error', got '%T'", fn))
+}
@@ -1,5 +1,10 @@
 package statemachine
 
+import (
+	"context"
+	"time"
+)
+
 // Machine provides a public interface to the state machine implementation.
 // It provides methods to build and access features of the state machine.
 type Machine interface {
@@ -14,12 +19,78 @@ type Machine interface {
 
 	Submachine(idPath ...string) (Machine, error)
 
+	// Done returns a channel which is closed once the machine enters one of
+	// its final states (see MachineBuilder.FinalStates).
+	Done() <-chan struct{}
+
+	// GetContext returns a copy of the context of the machine (see
+	// MachineBuilder.Context), as a pointer to its struct type or as a
+	// map[string]interface{}, or nil if it has none. The context is only
+	// changed by the assign actions of transitions.
+	GetContext() interface{}
+
+	// Snapshot returns the state and context of the machine and of its
+	// active submachines, which may be persisted, e.g. as JSON, and passed
+	// to Restore.
+	Snapshot() *Snapshot
+
+	// Restore sets the state and context of the machine and of its
+	// submachines to those of snapshot, without running the callbacks of
+	// entering them. The eventless transitions which the restored states
+	// take (see MachineBuilder.Always), and the completion events of
+	// submachines restored into final states (see DoneEvent), then run
+	// along with their callbacks, as they do after SetCurrentState.
+	Restore(snapshot *Snapshot) error
+
+	// AvailableEvents returns the events which have a transition from the
+	// current state, whether or not their guards allow it, in order. Events
+	// of active submachines follow, qualified by the submachine ID path, e.g.
+	// `process-id/succeed`.
+	AvailableEvents() []string
+
 	Fire(event string) error
 
+	// FireContext fires event like Fire, and passes ctx and payload to the
+	// guards and choice conditions of the event which accept them. A payload
+	// is passed to args of its exact type, and to args of type error if it's
+	// an error. ErrMissingPayload is returned if a guard evaluated by the
+	// event accepts a payload which was not given.
+	FireContext(ctx context.Context, event string, payload ...interface{}) error
+
+	// DriveTo fires the events planned by MachineDef.PlanPath, one by one,
+	// until the machine is in the target state path. If a guard rejects an
+	// event, the state defers it, or it leads to another state than
+	// planned, the path is replanned without that step. The events it fires
+	// are never deferred.
+	DriveTo(ctx context.Context, target string) error
+
+	// Broadcast fires event on each active submachine of the current state
+	// which defines it, in the order the submachines are defined, each
+	// before its own submachines. It returns the first error, qualified by
+	// the submachine ID, after delivering the event to all of them.
+	Broadcast(event string) error
+
+	// Deferred returns the events which are queued by the states that
+	// defer them (see MachineBuilder.Defer), in the order they were fired.
+	Deferred() []DeferredEvent
+
 	Send(signal Message) error
 
+	// SendAfter sends event to the machine once delay has passed on its
+	// clock, and returns an ID which cancels it. Like Send, it may be called
+	// from callbacks. Pending sends are included in snapshots, with the
+	// time they have left.
+	SendAfter(delay time.Duration, event TriggerEvent) string
+
+	// Cancel cancels the pending send with the ID returned by SendAfter, and
+	// reports whether it was still pending.
+	Cancel(id string) bool
+
+	// SetClock sets the clock which drives the timed events and delayed
+	// sends of the machine and its submachines (see Clock).
+	SetClock(clock Clock)
+
 	// TODO: ctx.ForceShutdownSubmachines(true), etc.
-	// FireContext(, event string) error
 }
 
 var _ Machine = (*machineImpl)(nil)
@@ -0,0 +1,87 @@
+package statemachine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// MaxAlwaysSteps is the number of eventless transitions which a machine
+// takes in a row, after the transition of an event or after a state is set,
+// before it gives up on them settling, and fails with ErrAlwaysLoop.
+const MaxAlwaysSteps = 100
+
+// settle takes the eventless transitions of the machine, which match its
+// current state and whose guards allow them, until none does. args are those
+// of the event which triggered the transition, and are passed to the guards
+// and actions of the eventless transitions.
+func (m *machineImpl) settle(args map[reflect.Type]interface{}) error {
+	for step := 0; len(m.def.Always) != 0 && !m.isExited(); step++ {
+		m.setContextArgs(args, copyContext(m.getContext()))
+		transition, err := m.matchTransition(m.def.Always, m.currentState, args)
+		if errors.Is(err, ErrNoMatchingTransition) || errors.Is(err, ErrTransitionNotAllowed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if step == MaxAlwaysSteps {
+			return ErrAlwaysLoop
+		}
+
+		nextContext, err := m.assign(transition, args)
+		if err != nil {
+			return err
+		}
+		if err := m.applyTransition(transition, nextContext, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settleEntered settles the submachines of the state which the machine was
+// set to, innermost first, and then the machine itself. No event triggered
+// the state, so the guards and actions get no payload.
+func (m *machineImpl) settleEntered() error {
+	args := m.entryArgs()
+	if err := m.settleSubmachines(args); err != nil {
+		return err
+	}
+	return m.settle(args)
+}
+
+// entryArgs returns the args of a state entry which no event triggered.
+func (m *machineImpl) entryArgs() map[reflect.Type]interface{} {
+	args := make(map[reflect.Type]interface{})
+	args[reflect.TypeOf(new(Machine))] = m
+	args[reflect.TypeOf(new(context.Context))] = context.Background()
+	args[payloadArgsType] = payloadArgs(nil)
+	return args
+}
+
+// settleSubmachines settles the submachines of the current state, which the
+// machine has just entered, innermost first. Each is passed a copy of args,
+// with itself as the Machine.
+func (m *machineImpl) settleSubmachines(args map[reflect.Type]interface{}) error {
+	submachines := append([]*machineImpl(nil), m.submachines[m.currentState]...)
+	for _, submachine := range submachines {
+		if submachine.isExited() {
+			continue
+		}
+		submachineArgs := make(map[reflect.Type]interface{}, len(args))
+		for argType, arg := range args {
+			submachineArgs[argType] = arg
+		}
+		submachineArgs[reflect.TypeOf(new(Machine))] = submachine
+
+		if err := submachine.settleSubmachines(submachineArgs); err != nil {
+			return fmt.Errorf("submachine '%s': %w", submachine.def.ID, err)
+		}
+		if err := submachine.settle(submachineArgs); err != nil {
+			return fmt.Errorf("submachine '%s': %w", submachine.def.ID, err)
+		}
+	}
+	return nil
+}
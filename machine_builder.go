@@ -28,14 +28,57 @@ type MachineBuilder interface {
 	// Initial state must be defined for every state machine.
 	InitialState(state string)
 
+	// FinalStates marks states as final. A machine which enters a final
+	// state is done (see Machine.Done). Once the submachines of a state are
+	// all in final states, their supermachine fires the completion event of
+	// the state (see DoneEvent), if it defines one.
+	FinalStates(states ...string)
+
+	// Context declares the extended state of the machine, with its initial
+	// value: a struct, a pointer to one, or a map[string]interface{}. Each
+	// machine owns a copy of it, which guards and callbacks may accept as a
+	// pointer to the struct type, or as the map, and which is only updated
+	// by the assign actions of transitions (see TransitionToBuilder.Assign).
+	Context(initial interface{})
+
 	Submachine(state string, submachineBuilderFn func(submachineBuilder MachineBuilder))
 
 	// Event provides the ability to define possible transitions for an event.
 	Event(name string, eventBuilderFn ...func(eventBuilder EventBuilder)) EventBuilder
 
+	// Always adds an eventless transition, which the machine takes without
+	// an event, as soon as it matches the current state and its guards
+	// allow it. Eventless transitions are evaluated in order after each
+	// transition, and after a state is entered without one, until none of
+	// them is taken (see MaxAlwaysSteps).
+	Always() TransitionBuilder
+
+	// Defer defers event in the states given to DeferBuilder.In. An event
+	// which is fired in one of them, and which has no transition from it,
+	// is queued instead of failing (see Machine.Deferred). Queued events are
+	// fired again, in order, once the machine is in a state which doesn't
+	// defer them.
+	Defer(event string) DeferBuilder
+
+	// Invoke invokes fn in its own goroutine whenever state is entered, and
+	// cancels its ctx when the state is exited. Once fn returns, unless the
+	// state was exited, the machine fires InvokeDoneEvent, or
+	// InvokeErrorEvent with the error as its payload, if it defines them.
+	Invoke(state string, fn InvokeFunc) InvokeBuilder
+
 	BeforeTransition() TransitionCallbackBuilder
 	AroundTransition() TransitionCallbackBuilder
 	AfterTransition() TransitionCallbackBuilder
+
+	// BeforeEvent adds callbacks which run when a matching event is fired,
+	// before its transition is looked up. A callback which returns an error
+	// vetoes the event, which then fails with that error.
+	BeforeEvent() EventCallbackBuilder
+
+	// AfterEvent adds callbacks which run once a matching event has
+	// transitioned the machine, after the after transition callbacks.
+	AfterEvent() EventCallbackBuilder
+
 	AfterFailure() EventCallbackBuilder
 }
 
@@ -66,6 +109,17 @@ func (m *machineBuilder) InitialState(state string) {
 	m.def.SetInitialState(state)
 }
 
+func (m *machineBuilder) FinalStates(states ...string) {
+	m.def.SetFinalStates(states...)
+}
+
+func (m *machineBuilder) Context(initial interface{}) {
+	if !isContextValue(initial) {
+		panic("context must be a struct, a pointer to one, or a map[string]interface{}")
+	}
+	m.def.SetContext(initial)
+}
+
 func (m *machineBuilder) Submachine(state string, submachineBuilderFn func(submachineBuilder MachineBuilder)) {
 	submachineBuilder := &machineBuilder{def: NewMachineDef()}
 	submachineBuilderFn(submachineBuilder)
@@ -84,6 +138,22 @@ func (m *machineBuilder) Event(name string, eventBuilderFuncs ...func(eventBuild
 	return eventBuilder
 }
 
+func (m *machineBuilder) Always() TransitionBuilder {
+	transitionDef := &TransitionDef{}
+	m.def.AddAlways(transitionDef)
+	return newTransitionBuilder(transitionDef)
+}
+
+func (m *machineBuilder) Defer(event string) DeferBuilder {
+	return newDeferBuilder(m.def, event)
+}
+
+func (m *machineBuilder) Invoke(state string, fn InvokeFunc) InvokeBuilder {
+	invokeDef := &InvokeDef{ID: state, State: state, Func: fn}
+	m.def.AddInvoke(invokeDef)
+	return newInvokeBuilder(invokeDef)
+}
+
 func (m *machineBuilder) BeforeTransition() TransitionCallbackBuilder {
 	transitionCallbackDef := &TransitionCallbackDef{validateFor: "BeforeTransition"}
 	m.def.AddBeforeCallback(transitionCallbackDef)
@@ -102,6 +172,18 @@ func (m *machineBuilder) AfterTransition() TransitionCallbackBuilder {
 	return newTransitionCallbackBuilder(transitionCallbackDef)
 }
 
+func (m *machineBuilder) BeforeEvent() EventCallbackBuilder {
+	eventCallbackDef := &EventCallbackDef{validateFor: "BeforeEvent"}
+	m.def.AddBeforeEventCallback(eventCallbackDef)
+	return newEventCallbackBuilder(eventCallbackDef)
+}
+
+func (m *machineBuilder) AfterEvent() EventCallbackBuilder {
+	eventCallbackDef := &EventCallbackDef{validateFor: "AfterEvent"}
+	m.def.AddAfterEventCallback(eventCallbackDef)
+	return newEventCallbackBuilder(eventCallbackDef)
+}
+
 func (m *machineBuilder) AfterFailure() EventCallbackBuilder {
 	transitionCallbackDef := &EventCallbackDef{validateFor: "AfterFailure"}
 	m.def.AddFailureCallback(transitionCallbackDef)
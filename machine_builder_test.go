@@ -1,6 +1,8 @@
 package statemachine_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/Gurpartap/statemachine-go"
@@ -111,7 +113,7 @@ func ExampleMachineDef() {
 	// unmonitored
 }
 
-func ExampleMachineBuilder_State() {
+func ExampleMachineBuilder_States() {
 	p := &ExampleProcess{}
 
 	p.Machine = statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
@@ -212,3 +214,222 @@ func ExampleMachineBuilder_BeforeTransition() {
 	fmt.Println(p.Machine.GetState())
 	// Output: unmonitored
 }
+
+func ExampleMachineBuilder_BeforeEvent() {
+	quota := 1
+
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("stopped", "running")
+		m.InitialState("stopped")
+
+		m.Event("start", func(e statemachine.EventBuilder) {
+			e.Transition().From("stopped").To("running")
+		})
+		m.Event("stop", func(e statemachine.EventBuilder) {
+			e.Transition().From("running").To("stopped")
+		})
+
+		m.BeforeEvent().On("start").Do(func(event statemachine.Event) error {
+			if quota == 0 {
+				return fmt.Errorf("no quota left to %s", event.Event())
+			}
+			quota--
+			return nil
+		})
+		m.AfterEvent().OnAnyEvent().Do(func(event statemachine.Event, transition statemachine.Transition) {
+			fmt.Printf("%s: %s -> %s\n", event.Event(), transition.From(), transition.To())
+		})
+		m.AfterFailure().OnAnyEvent().Do(func(event statemachine.Event, err error) {
+			fmt.Printf("%s failed: %s\n", event.Event(), err)
+		})
+	})
+
+	fmt.Println(machine.Fire("start"))
+	fmt.Println(machine.Fire("stop"))
+	fmt.Println(machine.Fire("start"))
+	fmt.Println(machine.GetState())
+
+	// Output:
+	// start: stopped -> running
+	// <nil>
+	// stop: running -> stopped
+	// <nil>
+	// start failed: no quota left to start
+	// no quota left to start
+	// stopped
+}
+
+func ExampleMachineBuilder_FinalStates() {
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("pending", "deployed")
+		m.InitialState("pending")
+		m.FinalStates("deployed")
+
+		for _, id := range []string{"build", "test"} {
+			m.Submachine("checking", func(sm statemachine.MachineBuilder) {
+				sm.ID(id)
+				sm.States("running", "passed")
+				sm.InitialState("running")
+				sm.FinalStates("passed")
+
+				sm.Event("pass", func(e statemachine.EventBuilder) {
+					e.Transition().From("running").To("passed")
+				})
+			})
+		}
+
+		m.Event("check", func(e statemachine.EventBuilder) {
+			e.Transition().From("pending").To("checking")
+		})
+		m.Event(statemachine.DoneEvent("checking"), func(e statemachine.EventBuilder) {
+			e.Transition().From("checking").To("deployed")
+		})
+	})
+
+	_ = machine.Fire("check")
+	build, _ := machine.Submachine("build")
+	test, _ := machine.Submachine("test")
+
+	_ = build.Fire("pass")
+	fmt.Println(machine.GetState())
+
+	_ = test.Fire("pass")
+	fmt.Println(machine.GetState())
+
+	<-machine.Done()
+	fmt.Println("done")
+	fmt.Println(test.Fire("pass"))
+
+	// Output:
+	// checking
+	// deployed
+	// done
+	// submachine not active
+}
+
+func ExampleMachineBuilder_Always() {
+	amount := 0
+
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("draft", "checking", "approved", "review")
+		m.InitialState("draft")
+
+		m.Event("submit", func(e statemachine.EventBuilder) {
+			e.Transition().From("draft").To("checking")
+		})
+		m.Event("reopen", func(e statemachine.EventBuilder) {
+			e.Transition().From("approved", "review").To("draft")
+		})
+
+		// checking is a routing state, which the machine leaves right away.
+		m.Always().From("checking").To("approved").If(func() bool { return amount <= 100 })
+		m.Always().From("checking").To("review")
+
+		m.AfterTransition().Any().Do(func(t statemachine.Transition) {
+			fmt.Printf("%s -> %s\n", t.From(), t.To())
+		})
+	})
+
+	amount = 50
+	_ = machine.Fire("submit")
+	_ = machine.Fire("reopen")
+
+	amount = 500
+	_ = machine.Fire("submit")
+	fmt.Println(machine.GetState())
+
+	pingPong := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("idle", "ping", "pong")
+		m.InitialState("idle")
+
+		m.Event("start", func(e statemachine.EventBuilder) {
+			e.Transition().From("idle").To("ping")
+		})
+		m.Always().From("ping").To("pong")
+		m.Always().From("pong").To("ping")
+	})
+	fmt.Println(pingPong.Fire("start"))
+
+	// Output:
+	// draft -> checking
+	// checking -> approved
+	// approved -> draft
+	// draft -> checking
+	// checking -> review
+	// review
+	// eventless transitions did not settle
+}
+
+func ExampleMachineBuilder_Defer() {
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("stopped", "starting", "running", "stopping")
+		m.InitialState("stopped")
+
+		m.Event("start", func(e statemachine.EventBuilder) {
+			e.Transition().From("stopped").To("starting")
+		})
+		m.Event("started", func(e statemachine.EventBuilder) {
+			e.Transition().From("starting").To("running")
+		})
+		m.Event("stop", func(e statemachine.EventBuilder) {
+			e.Transition().From("running").To("stopping")
+		})
+
+		// stopping a process which is still starting waits for it to run.
+		m.Defer("stop").In("starting")
+	})
+
+	_ = machine.Fire("start")
+	fmt.Println(machine.Fire("stop"))
+	fmt.Println(machine.GetState(), machine.Deferred())
+
+	snapshot, _ := json.Marshal(machine.Snapshot())
+	fmt.Println(string(snapshot))
+
+	_ = machine.Fire("started")
+	fmt.Println(machine.GetState(), machine.Deferred())
+
+	// Output:
+	// <nil>
+	// starting [{stop []}]
+	// {"State":"starting","Deferred":[{"Event":"stop"}]}
+	// stopping []
+}
+
+func ExampleMachineBuilder_Invoke() {
+	running := make(chan struct{})
+	watched := make(chan error)
+
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("starting", "running", "stopped", "failed")
+		m.InitialState("starting")
+
+		// spawn the process when starting, and watch it while it's running.
+		m.Invoke("starting", func(ctx context.Context, send func(statemachine.Message)) error {
+			return nil
+		}).ID("spawn")
+		m.Invoke("running", func(ctx context.Context, send func(statemachine.Message)) error {
+			<-ctx.Done()
+			watched <- ctx.Err()
+			return nil
+		}).ID("watch")
+
+		m.Event(statemachine.InvokeDoneEvent("spawn"), func(e statemachine.EventBuilder) {
+			e.Transition().From("starting").To("running")
+		})
+		m.Event(statemachine.InvokeErrorEvent("spawn"), func(e statemachine.EventBuilder) {
+			e.Transition().From("starting").To("failed")
+		})
+		m.Event("stop", func(e statemachine.EventBuilder) {
+			e.Transition().From("running").To("stopped")
+		})
+
+		m.AfterTransition().To("running").Do(func() { close(running) })
+	})
+
+	<-running
+	_ = machine.Fire("stop")
+	fmt.Println(machine.GetState(), <-watched)
+
+	// Output: stopped context canceled
+}
@@ -0,0 +1,465 @@
+package statemachine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Coverage records which transitions, guard outcomes and choice branches of
+// tracked definitions are exercised by the machines running them. It is
+// meant for tests, e.g. to write a profile when TestMain exits:
+//
+//	func TestMain(m *testing.M) {
+//		coverage := statemachine.NewCoverage()
+//		coverage.Track("process", processDef)
+//		code := m.Run()
+//		coverage.Stop()
+//		if err := coverage.WriteProfileFile("statemachine.cover.json"); err != nil {
+//			log.Fatal(err)
+//		}
+//		os.Exit(code)
+//	}
+//
+// Profiles of several runs are merged with Merge, and the uncovered parts are
+// listed by Report.
+type Coverage struct {
+	mutex sync.Mutex
+
+	// Machines holds the coverage of each tracked definition by the name it
+	// was tracked with.
+	Machines map[string]*MachineCoverage
+
+	transitions map[*TransitionDef][]*TransitionCoverage
+	choices     map[*ChoiceDef][]*ChoiceCoverage
+}
+
+// MachineCoverage holds the coverage of a definition and its submachines,
+// by the validation path of each transition and choice, e.g.
+// `event.tick.transitions[0]`, `always[0]`, or
+// `submachine.running[0].event.tick.choice`.
+type MachineCoverage struct {
+	Transitions map[string]*TransitionCoverage `json:",omitempty"`
+	Choices     map[string]*ChoiceCoverage     `json:",omitempty"`
+}
+
+// TransitionCoverage counts how often a transition was taken, and how often
+// its guards allowed or rejected it.
+type TransitionCoverage struct {
+	From       []string `json:",omitempty"`
+	ExceptFrom []string `json:",omitempty"`
+	To         string
+	Guarded    bool `json:",omitempty"`
+
+	Taken    int
+	Allowed  int `json:",omitempty"`
+	Rejected int `json:",omitempty"`
+}
+
+// ChoiceCoverage counts how often each branch of a choice was made, and how
+// often its unless guard rejected the choice.
+type ChoiceCoverage struct {
+	HasUnlessGuard bool `json:",omitempty"`
+
+	OnTrue   int
+	OnFalse  int
+	Rejected int `json:",omitempty"`
+}
+
+var coverageRecorders = struct {
+	sync.RWMutex
+	coverages []*Coverage
+}{}
+
+// NewCoverage returns an empty Coverage, which doesn't record anything until
+// definitions are tracked.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		Machines:    map[string]*MachineCoverage{},
+		transitions: map[*TransitionDef][]*TransitionCoverage{},
+		choices:     map[*ChoiceDef][]*ChoiceCoverage{},
+	}
+}
+
+// Track starts recording the coverage of def, and of its submachines, under
+// name. Counts already held for name, e.g. from a merged profile, are kept.
+func (c *Coverage) Track(name string, def *MachineDef) {
+	c.mutex.Lock()
+	machineCoverage, ok := c.Machines[name]
+	if !ok {
+		machineCoverage = &MachineCoverage{}
+		c.Machines[name] = machineCoverage
+	}
+	c.trackMachine(machineCoverage, "", def)
+	c.mutex.Unlock()
+
+	coverageRecorders.Lock()
+	defer coverageRecorders.Unlock()
+
+	for _, coverage := range coverageRecorders.coverages {
+		if coverage == c {
+			return
+		}
+	}
+	coverageRecorders.coverages = append(coverageRecorders.coverages, c)
+}
+
+// Stop stops recording coverage.
+func (c *Coverage) Stop() {
+	coverageRecorders.Lock()
+	defer coverageRecorders.Unlock()
+
+	for i, coverage := range coverageRecorders.coverages {
+		if coverage == c {
+			coverageRecorders.coverages = append(coverageRecorders.coverages[:i], coverageRecorders.coverages[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *Coverage) trackMachine(machineCoverage *MachineCoverage, path string, def *MachineDef) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	for _, event := range sortedEventNames(def.Events) {
+		c.trackEvent(machineCoverage, join("event."+event), def.Events[event])
+	}
+	for i, transitionDef := range def.Always {
+		c.trackTransition(machineCoverage, join(fmt.Sprintf("always[%d]", i)), transitionDef)
+	}
+
+	for _, state := range sortedSubmachineStates(def.Submachines) {
+		for i, submachineDef := range def.Submachines[state] {
+			c.trackMachine(machineCoverage, join(fmt.Sprintf("submachine.%s[%d]", state, i)), submachineDef)
+		}
+	}
+}
+
+func (c *Coverage) trackTransition(machineCoverage *MachineCoverage, key string, transitionDef *TransitionDef) {
+	if machineCoverage.Transitions == nil {
+		machineCoverage.Transitions = map[string]*TransitionCoverage{}
+	}
+	transitionCoverage, ok := machineCoverage.Transitions[key]
+	if !ok {
+		transitionCoverage = &TransitionCoverage{}
+		machineCoverage.Transitions[key] = transitionCoverage
+	}
+	transitionCoverage.From = transitionDef.From
+	transitionCoverage.ExceptFrom = transitionDef.ExceptFrom
+	transitionCoverage.To = transitionDef.To
+	transitionCoverage.Guarded = len(transitionDef.IfGuards) > 0 || len(transitionDef.UnlessGuards) > 0 || len(transitionDef.Join) > 0
+	if !containsTransitionCoverage(c.transitions[transitionDef], transitionCoverage) {
+		c.transitions[transitionDef] = append(c.transitions[transitionDef], transitionCoverage)
+	}
+}
+
+func (c *Coverage) trackEvent(machineCoverage *MachineCoverage, path string, eventDef *EventDef) {
+	if eventDef == nil {
+		return
+	}
+
+	for i, transitionDef := range eventDef.Transitions {
+		c.trackTransition(machineCoverage, fmt.Sprintf("%s.transitions[%d]", path, i), transitionDef)
+	}
+
+	choiceDef := eventDef.Choice
+	if choiceDef == nil {
+		return
+	}
+	if machineCoverage.Choices == nil {
+		machineCoverage.Choices = map[string]*ChoiceCoverage{}
+	}
+	key := path + ".choice"
+	choiceCoverage, ok := machineCoverage.Choices[key]
+	if !ok {
+		choiceCoverage = &ChoiceCoverage{}
+		machineCoverage.Choices[key] = choiceCoverage
+	}
+	choiceCoverage.HasUnlessGuard = choiceDef.UnlessGuard != nil
+	if !containsChoiceCoverage(c.choices[choiceDef], choiceCoverage) {
+		c.choices[choiceDef] = append(c.choices[choiceDef], choiceCoverage)
+	}
+
+	c.trackEvent(machineCoverage, key+".on_true", choiceDef.OnTrue)
+	c.trackEvent(machineCoverage, key+".on_false", choiceDef.OnFalse)
+}
+
+func containsTransitionCoverage(coverages []*TransitionCoverage, coverage *TransitionCoverage) bool {
+	for _, c := range coverages {
+		if c == coverage {
+			return true
+		}
+	}
+	return false
+}
+
+func containsChoiceCoverage(coverages []*ChoiceCoverage, coverage *ChoiceCoverage) bool {
+	for _, c := range coverages {
+		if c == coverage {
+			return true
+		}
+	}
+	return false
+}
+
+// recordTransition updates the coverage of transitionDef in every Coverage
+// which tracks it.
+func recordTransition(transitionDef *TransitionDef, update func(transitionCoverage *TransitionCoverage)) {
+	coverageRecorders.RLock()
+	defer coverageRecorders.RUnlock()
+
+	for _, c := range coverageRecorders.coverages {
+		c.mutex.Lock()
+		for _, transitionCoverage := range c.transitions[transitionDef] {
+			update(transitionCoverage)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// recordChoice updates the coverage of choiceDef in every Coverage which
+// tracks it.
+func recordChoice(choiceDef *ChoiceDef, update func(choiceCoverage *ChoiceCoverage)) {
+	coverageRecorders.RLock()
+	defer coverageRecorders.RUnlock()
+
+	for _, c := range coverageRecorders.coverages {
+		c.mutex.Lock()
+		for _, choiceCoverage := range c.choices[choiceDef] {
+			update(choiceCoverage)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// Merge adds the counts of other to c. Transitions and choices which are only
+// in other are added as well.
+func (c *Coverage) Merge(other *Coverage) {
+	if c == other {
+		return
+	}
+
+	other.mutex.Lock()
+	defer other.mutex.Unlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for name, otherMachine := range other.Machines {
+		machineCoverage, ok := c.Machines[name]
+		if !ok {
+			machineCoverage = &MachineCoverage{}
+			c.Machines[name] = machineCoverage
+		}
+
+		for key, otherTransition := range otherMachine.Transitions {
+			if machineCoverage.Transitions == nil {
+				machineCoverage.Transitions = map[string]*TransitionCoverage{}
+			}
+			transitionCoverage, ok := machineCoverage.Transitions[key]
+			if !ok {
+				transitionCoverage = &TransitionCoverage{
+					From:       otherTransition.From,
+					ExceptFrom: otherTransition.ExceptFrom,
+					To:         otherTransition.To,
+					Guarded:    otherTransition.Guarded,
+				}
+				machineCoverage.Transitions[key] = transitionCoverage
+			}
+			transitionCoverage.Taken += otherTransition.Taken
+			transitionCoverage.Allowed += otherTransition.Allowed
+			transitionCoverage.Rejected += otherTransition.Rejected
+		}
+
+		for key, otherChoice := range otherMachine.Choices {
+			if machineCoverage.Choices == nil {
+				machineCoverage.Choices = map[string]*ChoiceCoverage{}
+			}
+			choiceCoverage, ok := machineCoverage.Choices[key]
+			if !ok {
+				choiceCoverage = &ChoiceCoverage{HasUnlessGuard: otherChoice.HasUnlessGuard}
+				machineCoverage.Choices[key] = choiceCoverage
+			}
+			choiceCoverage.OnTrue += otherChoice.OnTrue
+			choiceCoverage.OnFalse += otherChoice.OnFalse
+			choiceCoverage.Rejected += otherChoice.Rejected
+		}
+	}
+}
+
+// WriteProfile writes the coverage to w as a JSON profile, which is read
+// back with ReadCoverageProfile.
+func (c *Coverage) WriteProfile(w io.Writer) error {
+	c.mutex.Lock()
+	b, err := json.MarshalIndent(c.Machines, "", "  ")
+	c.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteProfileFile writes the coverage to the profile file, merged with the
+// profile already in the file, if any. This accumulates the coverage of
+// several test runs, or test packages, in a single file.
+func (c *Coverage) WriteProfileFile(filename string) error {
+	merged := NewCoverage()
+	if b, err := ioutil.ReadFile(filename); err == nil {
+		existing, err := ReadCoverageProfile(bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+		merged.Merge(existing)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	merged.Merge(c)
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := merged.WriteProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadCoverageProfile reads a profile written by WriteProfile. The returned
+// Coverage doesn't record anything until definitions are tracked with it.
+func ReadCoverageProfile(r io.Reader) (*Coverage, error) {
+	c := NewCoverage()
+	if err := json.NewDecoder(r).Decode(&c.Machines); err != nil {
+		return nil, err
+	}
+	if c.Machines == nil {
+		c.Machines = map[string]*MachineCoverage{}
+	}
+	return c, nil
+}
+
+// Report writes a summary of the coverage of each tracked definition to w,
+// followed by the transitions which were never taken, the guards which never
+// allowed or never rejected their transitions, and the choice branches which
+// were never made.
+func (c *Coverage) Report(w io.Writer) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	names := make([]string, 0, len(c.Machines))
+	for name := range c.Machines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		machineCoverage := c.Machines[name]
+
+		var covered, total int
+		var uncovered []string
+		check := func(count int, format string, args ...interface{}) {
+			total++
+			if count > 0 {
+				covered++
+			} else {
+				uncovered = append(uncovered, fmt.Sprintf(format, args...))
+			}
+		}
+
+		keys := make([]string, 0, len(machineCoverage.Transitions)+len(machineCoverage.Choices))
+		for key := range machineCoverage.Transitions {
+			keys = append(keys, key)
+		}
+		for key := range machineCoverage.Choices {
+			keys = append(keys, key)
+		}
+		sortCoverageKeys(keys)
+
+		for _, key := range keys {
+			if transitionCoverage, ok := machineCoverage.Transitions[key]; ok {
+				check(transitionCoverage.Taken, "%s: %s never taken", key, transitionCoverage)
+				if transitionCoverage.Guarded {
+					check(transitionCoverage.Allowed, "%s: guards never allowed %s", key, transitionCoverage)
+					check(transitionCoverage.Rejected, "%s: guards never rejected %s", key, transitionCoverage)
+				}
+				continue
+			}
+
+			choiceCoverage := machineCoverage.Choices[key]
+			check(choiceCoverage.OnTrue, "%s: on_true never chosen", key)
+			check(choiceCoverage.OnFalse, "%s: on_false never chosen", key)
+			if choiceCoverage.HasUnlessGuard {
+				check(choiceCoverage.Rejected, "%s: unless guard never rejected", key)
+			}
+		}
+
+		percent := 100.0
+		if total > 0 {
+			percent = float64(covered) * 100 / float64(total)
+		}
+		if _, err := fmt.Fprintf(w, "%s: %d of %d covered (%.1f%%)\n", name, covered, total, percent); err != nil {
+			return err
+		}
+		for _, line := range uncovered {
+			if _, err := fmt.Fprintf(w, "  %s\n", line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *TransitionCoverage) String() string {
+	from := "any"
+	if len(c.From) > 0 {
+		from = strings.Join(c.From, ", ")
+	}
+	if len(c.ExceptFrom) > 0 {
+		from += " except " + strings.Join(c.ExceptFrom, ", ")
+	}
+	return fmt.Sprintf("[%s] -> %s", from, c.To)
+}
+
+// sortCoverageKeys orders keys by their path, with indexes compared as
+// numbers, so that `transitions[2]` comes before `transitions[10]`.
+func sortCoverageKeys(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		return coverageKeyLess(keys[i], keys[j])
+	})
+}
+
+func coverageKeyLess(a, b string) bool {
+	for a != "" && b != "" {
+		ai, bi := strings.IndexByte(a, '['), strings.IndexByte(b, '[')
+		if ai < 0 || bi < 0 || a[:ai] != b[:bi] {
+			return a < b
+		}
+		a, b = a[ai+1:], b[bi+1:]
+
+		aj, bj := strings.IndexByte(a, ']'), strings.IndexByte(b, ']')
+		if aj < 0 || bj < 0 {
+			return a < b
+		}
+		if aj != bj {
+			return aj < bj
+		}
+		if a[:aj] != b[:bj] {
+			return a[:aj] < b[:bj]
+		}
+		a, b = a[aj+1:], b[bj+1:]
+	}
+	return a < b
+}
@@ -0,0 +1,160 @@
+package statemachine_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+var coverageHCL = []byte(`
+	states        = ["stopped", "starting", "running", "restarting"]
+	initial_state = "stopped"
+
+	event "start" {
+	  transition {
+	    from = ["stopped"]
+	    to   = "starting"
+	  }
+	}
+
+	event "tick" {
+	  transition {
+	    from = ["starting"]
+	    to   = "running"
+	    if   = [is-healthy]
+	  }
+
+	  transition {
+	    from = ["starting"]
+	    to   = "restarting"
+	  }
+
+	  transition {
+	    from = ["restarting"]
+	    to   = "running"
+	  }
+	}
+
+	event "stop" {
+	  choice {
+	    condition = is-graceful
+
+	    on_true {
+	      transition {
+	        to = "stopped"
+	      }
+	    }
+
+	    on_false {
+	      transition {
+	        to = "stopped"
+	      }
+	    }
+	  }
+	}
+`)
+
+func ExampleCoverage() {
+	healthy, graceful := true, true
+	statemachine.RegisterFunc("is-healthy", func() bool { return healthy })
+	statemachine.RegisterFunc("is-graceful", func() bool { return graceful })
+
+	machineDef, err := statemachine.LoadHCL("process.hcl", coverageHCL)
+	if err != nil {
+		panic(err)
+	}
+
+	coverage := statemachine.NewCoverage()
+	coverage.Track("process", machineDef)
+	defer coverage.Stop()
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+	machine.Fire("start")
+	machine.Fire("tick")
+	machine.Fire("stop")
+
+	coverage.Report(os.Stdout)
+
+	// Output:
+	// process: 5 of 10 covered (50.0%)
+	//   event.stop.choice: on_false never chosen
+	//   event.stop.choice.on_false.transitions[0]: [any] -> stopped never taken
+	//   event.tick.transitions[0]: guards never rejected [starting] -> running
+	//   event.tick.transitions[1]: [starting] -> restarting never taken
+	//   event.tick.transitions[2]: [restarting] -> running never taken
+}
+
+func TestCoverage_MergeProfiles(t *testing.T) {
+	healthy, graceful := false, false
+	statemachine.RegisterFunc("is-healthy", func() bool { return healthy })
+	statemachine.RegisterFunc("is-graceful", func() bool { return graceful })
+
+	machineDef, err := statemachine.LoadHCL("process.hcl", coverageHCL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "statemachine-coverage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	profile := filepath.Join(dir, "cover.json")
+
+	run := func(events ...string) {
+		coverage := statemachine.NewCoverage()
+		coverage.Track("process", machineDef)
+		machine := statemachine.NewMachine()
+		machine.SetMachineDef(machineDef)
+		for _, event := range events {
+			machine.Fire(event)
+		}
+		coverage.Stop()
+
+		if err := coverage.WriteProfileFile(profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("start", "tick", "tick", "stop")
+	healthy, graceful = true, true
+	run("start", "tick", "stop")
+
+	f, err := os.Open(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	merged, err := statemachine.ReadCoverageProfile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report bytes.Buffer
+	if err := merged.Report(&report); err != nil {
+		t.Fatal(err)
+	}
+	if want := "process: 10 of 10 covered (100.0%)\n"; report.String() != want {
+		t.Errorf("got report:\n%s\nwant:\n%s", report.String(), want)
+	}
+
+	tick := merged.Machines["process"].Transitions["event.tick.transitions[0]"]
+	if tick.Taken != 1 || tick.Allowed != 1 || tick.Rejected != 1 {
+		t.Errorf("got %+v, want 1 taken, 1 allowed and 1 rejected", tick)
+	}
+
+	// merging a coverage which recorded nothing doesn't change the counts.
+	before := new(bytes.Buffer)
+	merged.WriteProfile(before)
+	merged.Merge(statemachine.NewCoverage())
+	after := new(bytes.Buffer)
+	merged.WriteProfile(after)
+	if before.String() != after.String() {
+		t.Errorf("got profile:\n%s\nwant:\n%s", after, before)
+	}
+}
@@ -1,17 +1,43 @@
 package statemachine
 
+import (
+	"sort"
+)
+
 type MachineDef struct {
-	ID           string                   `json:"id,omitempty" hcl:"id" hcle:"omitempty"`
-	States       []string                 `hcl:"states"`
-	InitialState string                   `hcl:"initial_state"`
-	Events       map[string]*EventDef     `json:",omitempty" hcl:"event" hcle:"omitempty"`
-	Submachines  map[string][]*MachineDef `json:",omitempty" hcl:"submachine" hcle:"omitempty"`
+	ID           string `json:"id,omitempty"`
+	States       []string
+	InitialState string
+	FinalStates  []string                 `json:",omitempty"`
+	Events       map[string]*EventDef     `json:",omitempty"`
+	Submachines  map[string][]*MachineDef `json:",omitempty"`
+
+	// Always are the eventless transitions of the machine, which are taken
+	// as soon as they match the current state and their guards allow them.
+	Always []*TransitionDef `json:",omitempty"`
+
+	// Deferred lists the states which defer each event, by event.
+	Deferred map[string][]string `json:",omitempty"`
+
+	// Invokes are the services invoked by the states of the machine, for as
+	// long as they are active.
+	Invokes []*InvokeDef `json:",omitempty"`
+
+	// Context is the initial extended state of machines running the
+	// definition: a struct, a pointer to one, or a map[string]interface{}.
+	Context interface{} `json:",omitempty"`
 
-	BeforeCallbacks []*TransitionCallbackDef `json:",omitempty" hcl:"before_callbacks" hcle:"omitempty"`
-	AroundCallbacks []*TransitionCallbackDef `json:",omitempty" hcl:"around_callbacks" hcle:"omitempty"`
-	AfterCallbacks  []*TransitionCallbackDef `json:",omitempty" hcl:"after_callbacks" hcle:"omitempty"`
+	BeforeCallbacks []*TransitionCallbackDef `json:",omitempty"`
+	AroundCallbacks []*TransitionCallbackDef `json:",omitempty"`
+	AfterCallbacks  []*TransitionCallbackDef `json:",omitempty"`
 
-	FailureCallbacks []*EventCallbackDef `json:",omitempty" hcl:"failure_callbacks" hcle:"omitempty"`
+	BeforeEventCallbacks []*EventCallbackDef `json:",omitempty"`
+	AfterEventCallbacks  []*EventCallbackDef `json:",omitempty"`
+	FailureCallbacks     []*EventCallbackDef `json:",omitempty"`
+
+	// resolved is set once the registered funcs of the definition have
+	// been resolved for a machine (see resolveOnce).
+	resolved bool
 }
 
 func NewMachineDef() *MachineDef {
@@ -33,6 +59,25 @@ func (def *MachineDef) SetInitialState(state string) {
 	def.InitialState = state
 }
 
+func (def *MachineDef) SetFinalStates(states ...string) {
+	def.FinalStates = append(def.FinalStates, states...)
+}
+
+// IsFinalState reports whether state is one of the final states of the
+// definition.
+func (def *MachineDef) IsFinalState(state string) bool {
+	for _, s := range def.FinalStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (def *MachineDef) SetContext(initial interface{}) {
+	def.Context = initial
+}
+
 func (def *MachineDef) SetSubmachine(state string, submachine *MachineDef) {
 	def.Submachines[state] = append(def.Submachines[state], submachine)
 }
@@ -41,6 +86,27 @@ func (def *MachineDef) AddEvent(event string, eventDef *EventDef) {
 	def.Events[event] = eventDef
 }
 
+func (def *MachineDef) AddAlways(transitionDef *TransitionDef) {
+	def.Always = append(def.Always, transitionDef)
+}
+
+func (def *MachineDef) SetDeferred(event string, states ...string) {
+	if def.Deferred == nil {
+		def.Deferred = map[string][]string{}
+	}
+	def.Deferred[event] = append(def.Deferred[event], states...)
+}
+
+// IsDeferred reports whether event is deferred in state.
+func (def *MachineDef) IsDeferred(event string, state string) bool {
+	for _, s := range def.Deferred[event] {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
 func (def *MachineDef) AddBeforeCallback(CallbackDef *TransitionCallbackDef) {
 	def.BeforeCallbacks = append(def.BeforeCallbacks, CallbackDef)
 }
@@ -53,6 +119,50 @@ func (def *MachineDef) AddAfterCallback(CallbackDef *TransitionCallbackDef) {
 	def.AfterCallbacks = append(def.AfterCallbacks, CallbackDef)
 }
 
+func (def *MachineDef) AddBeforeEventCallback(CallbackDef *EventCallbackDef) {
+	def.BeforeEventCallbacks = append(def.BeforeEventCallbacks, CallbackDef)
+}
+
+func (def *MachineDef) AddAfterEventCallback(CallbackDef *EventCallbackDef) {
+	def.AfterEventCallbacks = append(def.AfterEventCallbacks, CallbackDef)
+}
+
 func (def *MachineDef) AddFailureCallback(CallbackDef *EventCallbackDef) {
 	def.FailureCallbacks = append(def.FailureCallbacks, CallbackDef)
 }
+
+func sortedEventNames(events map[string]*EventDef) []string {
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedDeferredEvents(deferred map[string][]string) []string {
+	events := make([]string, 0, len(deferred))
+	for event := range deferred {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return events
+}
+
+func sortedSubmachineStates(submachines map[string][]*MachineDef) []string {
+	states := make([]string, 0, len(submachines))
+	for state := range submachines {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+func sortedRegions(regions map[string]string) []string {
+	ids := make([]string, 0, len(regions))
+	for id := range regions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
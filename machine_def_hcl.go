@@ -0,0 +1,1129 @@
+package statemachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// LoadHCL decodes a MachineDef from HCL (HCL2 native syntax) source and
+// validates it. filename is only used to report the source positions of
+// decode errors, which are returned as hcl.Diagnostics.
+//
+// Events, transitions, choices, eventless transitions, deferred events,
+// invoked services, submachines and callbacks are declared as blocks:
+//
+//	states        = ["unmonitored", "stopped", "starting", "running"]
+//	initial_state = "unmonitored"
+//	final_states  = ["stopped"]
+//	context       = { skip_ticks = 0 }
+//
+//	event "tick" {
+//	  timed_every = "1s"
+//
+//	  transition {
+//	    from   = ["stopped"]
+//	    to     = "starting"
+//	    if     = [should-auto-start]
+//	    unless = ["${is-process-running}"]
+//	    assign = [{ var = "skip_ticks", expr = "ctx.skip_ticks + 1" }]
+//	  }
+//	}
+//
+//	always {
+//	  from = ["starting"]
+//	  to   = "running"
+//	  if   = [is-process-running]
+//	}
+//
+//	defer "stop" {
+//	  in = ["starting"]
+//	}
+//
+//	invoke "starting" {
+//	  id  = "process"
+//	  src = spawn-process
+//	}
+//
+//	submachine "running" {
+//	  id            = "health"
+//	  initial_state = "pending"
+//	  // ...
+//	}
+//
+//	after_transition {
+//	  to = ["starting"]
+//	  do = [{ func = start-process, label = "start()" }]
+//	}
+//
+// Guards, choice conditions, callbacks and invoked services refer to
+// registered funcs (see RegisterFunc) by name, either as a bare reference,
+// as a `${...}` interpolation, or as a quoted string. An object with `func`
+// and `label` keys may be used to label the reference. Funcs are resolved
+// when the definition is set on a machine.
+//
+// Guards may be combined by calls to all, any and not, as in
+// `if = [all(is-running, not(is-paused))]`. Guards and choice conditions may
+// also be expressions (see Expr), given as quoted strings which aren't func
+// names, as in `if = "ctx.retries < 3 && payload.force"`, or as objects
+// with an `expr` key, as in `{ expr = "payload.force" }`.
+//
+// The context is an object of its initial values, which is decoded as a
+// map[string]interface{}. Assign actions are func references, or objects
+// with `var` and `expr` keys (see AssignExpr). The actions of a transition
+// are listed by `do`, as for callbacks.
+func LoadHCL(filename string, src []byte) (*MachineDef, error) {
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	d := &hclDecoder{}
+	def := d.decodeMachine(file.Body)
+	if d.diags.HasErrors() {
+		return nil, d.diags
+	}
+
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+var hclMachineSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "id"},
+		{Name: "states"},
+		{Name: "initial_state"},
+		{Name: "final_states"},
+		{Name: "context"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "event", LabelNames: []string{"name"}},
+		{Type: "submachine", LabelNames: []string{"state"}},
+		{Type: "always"},
+		{Type: "defer", LabelNames: []string{"event"}},
+		{Type: "invoke", LabelNames: []string{"state"}},
+		{Type: "before_transition"},
+		{Type: "around_transition"},
+		{Type: "after_transition"},
+		{Type: "before_event"},
+		{Type: "after_event"},
+		{Type: "after_failure"},
+	},
+}
+
+var hclEventSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "timed_every"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "transition"},
+		{Type: "choice"},
+	},
+}
+
+var hclChoiceBranchSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "transition"},
+		{Type: "choice"},
+	},
+}
+
+var hclChoiceSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "condition", Required: true},
+		{Name: "unless"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "on_true"},
+		{Type: "on_false"},
+	},
+}
+
+var hclTransitionSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "from"},
+		{Name: "except_from"},
+		{Name: "to", Required: true},
+		{Name: "history"},
+		{Name: "fork"},
+		{Name: "join"},
+		{Name: "if"},
+		{Name: "unless"},
+		{Name: "assign"},
+		{Name: "do"},
+	},
+}
+
+var hclDeferSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "in", Required: true},
+	},
+}
+
+var hclInvokeSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "id"},
+		{Name: "src"},
+	},
+}
+
+var hclTransitionCallbackSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "from"},
+		{Name: "except_from"},
+		{Name: "to"},
+		{Name: "except_to"},
+		{Name: "do"},
+		{Name: "exit_to_state"},
+	},
+}
+
+var hclEventCallbackSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "on"},
+		{Name: "except_on"},
+		{Name: "do"},
+	},
+}
+
+type hclDecoder struct {
+	diags hcl.Diagnostics
+}
+
+func (d *hclDecoder) content(body hcl.Body, schema *hcl.BodySchema) *hcl.BodyContent {
+	content, diags := body.Content(schema)
+	d.diags = append(d.diags, diags...)
+	return content
+}
+
+func (d *hclDecoder) decodeMachine(body hcl.Body) *MachineDef {
+	def := NewMachineDef()
+	content := d.content(body, hclMachineSchema)
+
+	def.ID = d.string(content.Attributes["id"])
+	def.States = d.strings(content.Attributes["states"])
+	def.InitialState = d.string(content.Attributes["initial_state"])
+	def.FinalStates = d.strings(content.Attributes["final_states"])
+	if attr, ok := content.Attributes["context"]; ok {
+		def.Context = d.context(attr)
+	}
+
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "event":
+			event := block.Labels[0]
+			if _, ok := def.Events[event]; ok {
+				d.diags = append(d.diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate event",
+					Detail:   fmt.Sprintf("Event '%s' is already defined.", event),
+					Subject:  block.LabelRanges[0].Ptr(),
+				})
+				continue
+			}
+			def.AddEvent(event, d.decodeEvent(block.Body, hclEventSchema))
+		case "submachine":
+			def.SetSubmachine(block.Labels[0], d.decodeMachine(block.Body))
+		case "always":
+			def.AddAlways(d.decodeTransition(block.Body))
+		case "defer":
+			content := d.content(block.Body, hclDeferSchema)
+			def.SetDeferred(block.Labels[0], d.strings(content.Attributes["in"])...)
+		case "invoke":
+			def.AddInvoke(d.decodeInvoke(block.Labels[0], block.Body))
+		case "before_transition":
+			def.AddBeforeCallback(d.decodeTransitionCallback(block.Body))
+		case "around_transition":
+			def.AddAroundCallback(d.decodeTransitionCallback(block.Body))
+		case "after_transition":
+			def.AddAfterCallback(d.decodeTransitionCallback(block.Body))
+		case "before_event":
+			def.AddBeforeEventCallback(d.decodeEventCallback(block.Body))
+		case "after_event":
+			def.AddAfterEventCallback(d.decodeEventCallback(block.Body))
+		case "after_failure":
+			def.AddFailureCallback(d.decodeEventCallback(block.Body))
+		}
+	}
+
+	return def
+}
+
+func (d *hclDecoder) decodeEvent(body hcl.Body, schema *hcl.BodySchema) *EventDef {
+	def := &EventDef{}
+	content := d.content(body, schema)
+
+	if attr, ok := content.Attributes["timed_every"]; ok {
+		if s := d.string(attr); s != "" {
+			duration, err := time.ParseDuration(s)
+			if err != nil {
+				d.diags = append(d.diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid duration",
+					Detail:   err.Error(),
+					Subject:  attr.Expr.Range().Ptr(),
+				})
+			}
+			def.SetEvery(duration)
+		}
+	}
+
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "transition":
+			def.AddTransition(d.decodeTransition(block.Body))
+		case "choice":
+			if def.Choice != nil {
+				d.diags = append(d.diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate choice",
+					Detail:   "Only one choice block is allowed per event.",
+					Subject:  block.DefRange.Ptr(),
+				})
+				continue
+			}
+			def.SetChoice(d.decodeChoice(block.Body))
+		}
+	}
+
+	return def
+}
+
+func (d *hclDecoder) decodeChoice(body hcl.Body) *ChoiceDef {
+	def := &ChoiceDef{}
+	content := d.content(body, hclChoiceSchema)
+
+	if attr, ok := content.Attributes["condition"]; ok {
+		for _, guardDef := range d.guardDefs(attr) {
+			if guardDef.IsCombined() {
+				d.diags = append(d.diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid choice condition",
+					Detail:   "A choice condition is a single func reference or expression, which can't be combined by all, any or not.",
+					Subject:  attr.Expr.Range().Ptr(),
+				})
+				continue
+			}
+			def.Condition = &ChoiceConditionDef{RegisteredFunc: guardDef.RegisteredFunc, Expr: guardDef.Expr, Label: guardDef.Label}
+		}
+	}
+	if attr, ok := content.Attributes["unless"]; ok {
+		for _, guardDef := range d.guardDefs(attr) {
+			def.UnlessGuard = guardDef
+		}
+	}
+
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "on_true":
+			def.OnTrue = d.decodeEvent(block.Body, hclChoiceBranchSchema)
+		case "on_false":
+			def.OnFalse = d.decodeEvent(block.Body, hclChoiceBranchSchema)
+		}
+	}
+
+	return def
+}
+
+func (d *hclDecoder) decodeTransition(body hcl.Body) *TransitionDef {
+	def := &TransitionDef{}
+	content := d.content(body, hclTransitionSchema)
+
+	def.From = d.strings(content.Attributes["from"])
+	def.ExceptFrom = d.strings(content.Attributes["except_from"])
+	def.To = d.string(content.Attributes["to"])
+	def.History = History(d.string(content.Attributes["history"]))
+	def.Fork = d.stringMap(content.Attributes["fork"])
+	def.Join = d.stringMap(content.Attributes["join"])
+
+	def.IfGuards = d.guardDefs(content.Attributes["if"])
+	def.UnlessGuards = d.guardDefs(content.Attributes["unless"])
+	def.Assigns = d.assignDefs(content.Attributes["assign"])
+
+	for _, ref := range d.funcRefs(content.Attributes["do"]) {
+		def.Do = append(def.Do, &TransitionCallbackFuncDef{RegisteredFunc: ref.name, Label: ref.label})
+	}
+
+	return def
+}
+
+func (d *hclDecoder) decodeInvoke(state string, body hcl.Body) *InvokeDef {
+	def := &InvokeDef{ID: state, State: state}
+	content := d.content(body, hclInvokeSchema)
+
+	if attr, ok := content.Attributes["id"]; ok {
+		def.ID = d.string(attr)
+	}
+	for _, ref := range d.funcRefs(content.Attributes["src"]) {
+		def.RegisteredFunc = ref.name
+	}
+
+	return def
+}
+
+func (d *hclDecoder) decodeTransitionCallback(body hcl.Body) *TransitionCallbackDef {
+	def := &TransitionCallbackDef{}
+	content := d.content(body, hclTransitionCallbackSchema)
+
+	def.From = d.strings(content.Attributes["from"])
+	def.ExceptFrom = d.strings(content.Attributes["except_from"])
+	def.To = d.strings(content.Attributes["to"])
+	def.ExceptTo = d.strings(content.Attributes["except_to"])
+	def.ExitToState = d.string(content.Attributes["exit_to_state"])
+
+	for _, ref := range d.funcRefs(content.Attributes["do"]) {
+		def.Do = append(def.Do, &TransitionCallbackFuncDef{RegisteredFunc: ref.name, Label: ref.label})
+	}
+
+	return def
+}
+
+func (d *hclDecoder) decodeEventCallback(body hcl.Body) *EventCallbackDef {
+	def := &EventCallbackDef{}
+	content := d.content(body, hclEventCallbackSchema)
+
+	def.On = d.strings(content.Attributes["on"])
+	def.ExceptOn = d.strings(content.Attributes["except_on"])
+
+	for _, ref := range d.funcRefs(content.Attributes["do"]) {
+		def.Do = append(def.Do, &EventCallbackFuncDef{RegisteredFunc: ref.name})
+	}
+
+	return def
+}
+
+func (d *hclDecoder) value(attr *hcl.Attribute, ty cty.Type, target interface{}) {
+	if attr == nil {
+		return
+	}
+	val, diags := attr.Expr.Value(nil)
+	d.diags = append(d.diags, diags...)
+	if diags.HasErrors() {
+		return
+	}
+	val, err := convert.Convert(val, ty)
+	if err == nil {
+		err = gocty.FromCtyValue(val, target)
+	}
+	if err != nil {
+		d.diags = append(d.diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Incorrect attribute value type",
+			Detail:   fmt.Sprintf("Inappropriate value for attribute '%s': %s is required.", attr.Name, ty.FriendlyName()),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+}
+
+// context decodes an object of the initial values of context variables,
+// through JSON, as LoadJSON would.
+func (d *hclDecoder) context(attr *hcl.Attribute) map[string]interface{} {
+	val, diags := attr.Expr.Value(nil)
+	d.diags = append(d.diags, diags...)
+	if diags.HasErrors() {
+		return nil
+	}
+
+	var context map[string]interface{}
+	b, err := ctyjson.Marshal(val, val.Type())
+	if err == nil && val.Type().IsObjectType() {
+		err = json.Unmarshal(b, &context)
+	}
+	if err != nil || context == nil {
+		d.diags = append(d.diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Incorrect attribute value type",
+			Detail:   fmt.Sprintf("Inappropriate value for attribute '%s': object is required.", attr.Name),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+		return nil
+	}
+	return context
+}
+
+func (d *hclDecoder) string(attr *hcl.Attribute) string {
+	var s string
+	d.value(attr, cty.String, &s)
+	return s
+}
+
+func (d *hclDecoder) strings(attr *hcl.Attribute) []string {
+	var s []string
+	d.value(attr, cty.List(cty.String), &s)
+	return s
+}
+
+func (d *hclDecoder) stringMap(attr *hcl.Attribute) map[string]string {
+	var m map[string]string
+	d.value(attr, cty.Map(cty.String), &m)
+	return m
+}
+
+// hclFuncRef is a reference to a registered func, along with its label.
+type hclFuncRef struct {
+	name  string
+	label string
+}
+
+// funcRefs decodes either a single func reference, or a tuple of them.
+func (d *hclDecoder) funcRefs(attr *hcl.Attribute) []hclFuncRef {
+	var refs []hclFuncRef
+	for _, expr := range hclExprs(attr) {
+		if ref, ok := d.funcRef(expr); ok {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// guardDefs decodes either a single guard, or a tuple of them.
+func (d *hclDecoder) guardDefs(attr *hcl.Attribute) []*TransitionGuardDef {
+	var guardDefs []*TransitionGuardDef
+	for _, expr := range hclExprs(attr) {
+		if guardDef, ok := d.guardDef(expr); ok {
+			guardDefs = append(guardDefs, guardDef)
+		}
+	}
+	return guardDefs
+}
+
+// assignDefs decodes either a single assign action, or a tuple of them.
+func (d *hclDecoder) assignDefs(attr *hcl.Attribute) []*ContextAssignDef {
+	var assignDefs []*ContextAssignDef
+	for _, expr := range hclExprs(attr) {
+		if assignDef, ok := d.assignDef(expr); ok {
+			assignDefs = append(assignDefs, assignDef)
+		}
+	}
+	return assignDefs
+}
+
+// assignDef decodes a func reference, or an object with var and expr keys,
+// as in { var = "retries", expr = "ctx.retries + 1" }.
+func (d *hclDecoder) assignDef(expr hclsyntax.Expression) (*ContextAssignDef, bool) {
+	object, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok || !hclObjectHasKey(object, "var") && !hclObjectHasKey(object, "expr") {
+		ref, ok := d.funcRef(expr)
+		return &ContextAssignDef{RegisteredFunc: ref.name, Label: ref.label}, ok
+	}
+
+	def := &ContextAssignDef{}
+	for _, item := range object.Items {
+		key, diags := item.KeyExpr.Value(nil)
+		val, valDiags := item.ValueExpr.Value(nil)
+		if diags.HasErrors() || valDiags.HasErrors() || key.Type() != cty.String || val.Type() != cty.String {
+			d.invalidAssign(item.ValueExpr)
+			return nil, false
+		}
+		switch key.AsString() {
+		case "var":
+			def.Var = val.AsString()
+		case "expr":
+			def.Expr = val.AsString()
+		case "label":
+			def.Label = val.AsString()
+		default:
+			d.invalidAssign(item.KeyExpr)
+			return nil, false
+		}
+	}
+	return def, true
+}
+
+func (d *hclDecoder) invalidAssign(expr hclsyntax.Expression) {
+	d.diags = append(d.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid assign action",
+		Detail:   `An assign action must be a func reference, or an object with string var, expr and label keys, as in { var = "retries", expr = "ctx.retries + 1" }.`,
+		Subject:  expr.Range().Ptr(),
+	})
+}
+
+// hclObjectHasKey reports whether the object has an item with the key.
+func hclObjectHasKey(object *hclsyntax.ObjectConsExpr, key string) bool {
+	for _, item := range object.Items {
+		if val, diags := item.KeyExpr.Value(nil); !diags.HasErrors() && val.Type() == cty.String && val.AsString() == key {
+			return true
+		}
+	}
+	return false
+}
+
+// hclExprs returns the items of the attribute's tuple, or else its single
+// expression.
+func hclExprs(attr *hcl.Attribute) []hclsyntax.Expression {
+	if attr == nil {
+		return nil
+	}
+
+	switch expr := attr.Expr.(type) {
+	case *hclsyntax.TupleConsExpr:
+		return expr.Exprs
+	case hclsyntax.Expression:
+		return []hclsyntax.Expression{expr}
+	}
+	return nil
+}
+
+// guardDef decodes a func reference, a guard expression, or guards combined
+// by a call to all, any or not, as in all(is-running, not(is-paused)).
+// Quoted strings which aren't func names are expressions, as are the values
+// of objects with an expr key, as in { expr = "payload.force" }. Combined
+// guards and expressions may be labeled as func references are, as in
+// { func = any(a, b), label = "ab" }.
+func (d *hclDecoder) guardDef(expr hclsyntax.Expression) (*TransitionGuardDef, bool) {
+	switch expr := expr.(type) {
+	case *hclsyntax.FunctionCallExpr:
+		var args []*TransitionGuardDef
+		for _, arg := range expr.Args {
+			argDef, ok := d.guardDef(arg)
+			if !ok {
+				return nil, false
+			}
+			args = append(args, argDef)
+		}
+
+		def := &TransitionGuardDef{}
+		switch {
+		case expr.Name == "all" && len(args) > 0:
+			def.All = args
+		case expr.Name == "any" && len(args) > 0:
+			def.Any = args
+		case expr.Name == "not" && len(args) == 1:
+			def.Not = args[0]
+		default:
+			d.diags = append(d.diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid guard expression",
+				Detail:   "Guards are combined by calls to all and any, with one or more guards, or to not, with a single guard.",
+				Subject:  expr.Range().Ptr(),
+			})
+			return nil, false
+		}
+		return def, true
+
+	case *hclsyntax.ObjectConsExpr:
+		var def *TransitionGuardDef
+		var label string
+		for _, item := range expr.Items {
+			key, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() || key.Type() != cty.String {
+				d.invalidFuncRef(expr)
+				return nil, false
+			}
+			switch key.AsString() {
+			case "func":
+				var ok bool
+				if def, ok = d.guardDef(item.ValueExpr); !ok {
+					return nil, false
+				}
+			case "expr":
+				val, diags := item.ValueExpr.Value(nil)
+				if diags.HasErrors() || val.Type() != cty.String {
+					d.invalidFuncRef(item.ValueExpr)
+					return nil, false
+				}
+				def = &TransitionGuardDef{Expr: val.AsString()}
+			case "label":
+				val, diags := item.ValueExpr.Value(nil)
+				if diags.HasErrors() || val.Type() != cty.String {
+					d.invalidFuncRef(item.ValueExpr)
+					return nil, false
+				}
+				label = val.AsString()
+			default:
+				d.invalidFuncRef(item.KeyExpr)
+				return nil, false
+			}
+		}
+		if def == nil {
+			d.invalidFuncRef(expr)
+			return nil, false
+		}
+		def.Label = label
+		return def, true
+	}
+
+	if src, ok := hclStringLiteral(expr); ok && !isFuncName(src) {
+		return &TransitionGuardDef{Expr: src}, true
+	}
+
+	ref, ok := d.funcRef(expr)
+	return &TransitionGuardDef{RegisteredFunc: ref.name, Label: ref.label}, ok
+}
+
+// hclStringLiteral returns the value of a quoted string without
+// interpolations.
+func hclStringLiteral(expr hclsyntax.Expression) (string, bool) {
+	switch expr := expr.(type) {
+	case *hclsyntax.TemplateExpr:
+		if !expr.IsStringLiteral() {
+			return "", false
+		}
+		val, _ := expr.Value(nil)
+		return val.AsString(), true
+	case *hclsyntax.LiteralValueExpr:
+		if expr.Val.Type() != cty.String {
+			return "", false
+		}
+		return expr.Val.AsString(), true
+	}
+	return "", false
+}
+
+func (d *hclDecoder) funcRef(expr hclsyntax.Expression) (ref hclFuncRef, ok bool) {
+	switch expr := expr.(type) {
+	case *hclsyntax.ScopeTraversalExpr:
+		names := []string{expr.Traversal.RootName()}
+		for _, step := range expr.Traversal[1:] {
+			attr, isAttr := step.(hcl.TraverseAttr)
+			if !isAttr {
+				return d.invalidFuncRef(expr)
+			}
+			names = append(names, attr.Name)
+		}
+		return hclFuncRef{name: strings.Join(names, ".")}, true
+
+	case *hclsyntax.TemplateWrapExpr:
+		return d.funcRef(expr.Wrapped)
+
+	case *hclsyntax.TemplateExpr:
+		if !expr.IsStringLiteral() {
+			return d.invalidFuncRef(expr)
+		}
+		val, _ := expr.Value(nil)
+		return hclFuncRef{name: val.AsString()}, true
+
+	case *hclsyntax.LiteralValueExpr:
+		if expr.Val.Type() != cty.String {
+			return d.invalidFuncRef(expr)
+		}
+		return hclFuncRef{name: expr.Val.AsString()}, true
+
+	case *hclsyntax.ObjectConsExpr:
+		for _, item := range expr.Items {
+			key, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() || key.Type() != cty.String {
+				return d.invalidFuncRef(expr)
+			}
+			switch key.AsString() {
+			case "func":
+				funcRef, funcOK := d.funcRef(item.ValueExpr)
+				if !funcOK {
+					return
+				}
+				ref.name = funcRef.name
+			case "label":
+				val, diags := item.ValueExpr.Value(nil)
+				if diags.HasErrors() || val.Type() != cty.String {
+					return d.invalidFuncRef(item.ValueExpr)
+				}
+				ref.label = val.AsString()
+			default:
+				return d.invalidFuncRef(item.KeyExpr)
+			}
+		}
+		if ref.name == "" {
+			return d.invalidFuncRef(expr)
+		}
+		return ref, true
+	}
+
+	return d.invalidFuncRef(expr)
+}
+
+func (d *hclDecoder) invalidFuncRef(expr hclsyntax.Expression) (hclFuncRef, bool) {
+	d.diags = append(d.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid func reference",
+		Detail:   `A registered func must be referenced by name, as in is-running, "${is-running}", or { func = is-running, label = "isRunning" }.`,
+		Subject:  expr.Range().Ptr(),
+	})
+	return hclFuncRef{}, false
+}
+
+// WriteHCL writes the definition as HCL, in the syntax read by LoadHCL.
+// Guards, conditions, assign actions, callbacks and invoked services are
+// written by their RegisteredFunc names, or as expressions. An error is
+// returned for funcs which have no RegisteredFunc name. A context which
+// doesn't encode as a JSON object is omitted.
+func WriteHCL(w io.Writer, def *MachineDef) error {
+	if err := def.assertRegisteredNames(); err != nil {
+		return err
+	}
+
+	f := hclwrite.NewEmptyFile()
+	writeHCLMachine(f.Body(), def)
+	_, err := w.Write(hclwrite.Format(f.Bytes()))
+	return err
+}
+
+func writeHCLMachine(body *hclwrite.Body, def *MachineDef) {
+	if def.ID != "" {
+		body.SetAttributeValue("id", cty.StringVal(def.ID))
+	}
+	body.SetAttributeValue("states", hclStringList(def.States))
+	body.SetAttributeValue("initial_state", cty.StringVal(def.InitialState))
+	if len(def.FinalStates) > 0 {
+		body.SetAttributeValue("final_states", hclStringList(def.FinalStates))
+	}
+	if context, ok := hclContextValue(def.Context); ok {
+		body.SetAttributeValue("context", context)
+	}
+
+	for _, event := range sortedEventNames(def.Events) {
+		body.AppendNewline()
+		writeHCLEvent(body.AppendNewBlock("event", []string{event}).Body(), def.Events[event])
+	}
+
+	for _, transitionDef := range def.Always {
+		body.AppendNewline()
+		writeHCLTransition(body.AppendNewBlock("always", nil).Body(), transitionDef)
+	}
+
+	for _, event := range sortedDeferredEvents(def.Deferred) {
+		body.AppendNewline()
+		body.AppendNewBlock("defer", []string{event}).Body().SetAttributeValue("in", hclStringList(def.Deferred[event]))
+	}
+
+	for _, invokeDef := range def.Invokes {
+		body.AppendNewline()
+		block := body.AppendNewBlock("invoke", []string{invokeDef.State}).Body()
+		if invokeDef.ID != invokeDef.State {
+			block.SetAttributeValue("id", cty.StringVal(invokeDef.ID))
+		}
+		setHCLFuncRefs(block, "src", []hclFuncRef{{name: invokeDef.RegisteredFunc}}, false)
+	}
+
+	for _, state := range sortedSubmachineStates(def.Submachines) {
+		for _, submachineDef := range def.Submachines[state] {
+			body.AppendNewline()
+			writeHCLMachine(body.AppendNewBlock("submachine", []string{state}).Body(), submachineDef)
+		}
+	}
+
+	callbackBlocks := []struct {
+		blockType string
+		callbacks []*TransitionCallbackDef
+	}{
+		{"before_transition", def.BeforeCallbacks},
+		{"around_transition", def.AroundCallbacks},
+		{"after_transition", def.AfterCallbacks},
+	}
+	for _, callbackBlock := range callbackBlocks {
+		for _, callbackDef := range callbackBlock.callbacks {
+			body.AppendNewline()
+			writeHCLTransitionCallback(body.AppendNewBlock(callbackBlock.blockType, nil).Body(), callbackDef)
+		}
+	}
+
+	eventCallbackBlocks := []struct {
+		blockType string
+		callbacks []*EventCallbackDef
+	}{
+		{"before_event", def.BeforeEventCallbacks},
+		{"after_event", def.AfterEventCallbacks},
+		{"after_failure", def.FailureCallbacks},
+	}
+	for _, callbackBlock := range eventCallbackBlocks {
+		for _, callbackDef := range callbackBlock.callbacks {
+			body.AppendNewline()
+			block := body.AppendNewBlock(callbackBlock.blockType, nil).Body()
+			setHCLStrings(block, "on", callbackDef.On)
+			setHCLStrings(block, "except_on", callbackDef.ExceptOn)
+			var refs []hclFuncRef
+			for _, funcDef := range callbackDef.Do {
+				refs = append(refs, hclFuncRef{name: funcDef.RegisteredFunc})
+			}
+			setHCLFuncRefs(block, "do", refs, true)
+		}
+	}
+}
+
+func writeHCLEvent(body *hclwrite.Body, def *EventDef) {
+	if def.TimedEvery > 0 {
+		body.SetAttributeValue("timed_every", cty.StringVal(def.TimedEvery.String()))
+	}
+
+	for i, transitionDef := range def.Transitions {
+		if i > 0 {
+			body.AppendNewline()
+		}
+		writeHCLTransition(body.AppendNewBlock("transition", nil).Body(), transitionDef)
+	}
+
+	if def.Choice == nil {
+		return
+	}
+
+	if len(def.Transitions) > 0 {
+		body.AppendNewline()
+	}
+	block := body.AppendNewBlock("choice", nil).Body()
+	if condition := def.Choice.Condition; condition != nil {
+		guardDef := &TransitionGuardDef{RegisteredFunc: condition.RegisteredFunc, Expr: condition.Expr, Label: condition.Label}
+		setHCLTokens(block, "condition", hclGuardTokens([]*TransitionGuardDef{guardDef}), false)
+	}
+	if def.Choice.UnlessGuard != nil {
+		setHCLTokens(block, "unless", hclGuardTokens([]*TransitionGuardDef{def.Choice.UnlessGuard}), false)
+	}
+	if def.Choice.OnTrue != nil {
+		block.AppendNewline()
+		writeHCLEvent(block.AppendNewBlock("on_true", nil).Body(), def.Choice.OnTrue)
+	}
+	if def.Choice.OnFalse != nil {
+		block.AppendNewline()
+		writeHCLEvent(block.AppendNewBlock("on_false", nil).Body(), def.Choice.OnFalse)
+	}
+}
+
+func writeHCLTransition(block *hclwrite.Body, transitionDef *TransitionDef) {
+	setHCLStrings(block, "from", transitionDef.From)
+	setHCLStrings(block, "except_from", transitionDef.ExceptFrom)
+	block.SetAttributeValue("to", cty.StringVal(transitionDef.To))
+	if transitionDef.History != "" {
+		block.SetAttributeValue("history", cty.StringVal(string(transitionDef.History)))
+	}
+	setHCLStringMap(block, "fork", transitionDef.Fork)
+	setHCLStringMap(block, "join", transitionDef.Join)
+	setHCLTokens(block, "if", hclGuardTokens(transitionDef.IfGuards), true)
+	setHCLTokens(block, "unless", hclGuardTokens(transitionDef.UnlessGuards), true)
+	setHCLTokens(block, "assign", hclAssignTokens(transitionDef.Assigns), true)
+
+	var refs []hclFuncRef
+	for _, funcDef := range transitionDef.Do {
+		refs = append(refs, hclFuncRef{name: funcDef.RegisteredFunc, label: funcDef.Label})
+	}
+	setHCLFuncRefs(block, "do", refs, true)
+}
+
+func writeHCLTransitionCallback(body *hclwrite.Body, def *TransitionCallbackDef) {
+	setHCLStrings(body, "from", def.From)
+	setHCLStrings(body, "except_from", def.ExceptFrom)
+	setHCLStrings(body, "to", def.To)
+	setHCLStrings(body, "except_to", def.ExceptTo)
+
+	var refs []hclFuncRef
+	for _, funcDef := range def.Do {
+		refs = append(refs, hclFuncRef{name: funcDef.RegisteredFunc, label: funcDef.Label})
+	}
+	setHCLFuncRefs(body, "do", refs, true)
+
+	if def.ExitToState != "" {
+		body.SetAttributeValue("exit_to_state", cty.StringVal(def.ExitToState))
+	}
+}
+
+// hclGuardTokens returns the tokens of the guards. Guards which refer to
+// funcs without a registered func name are omitted.
+func hclGuardTokens(guardDefs []*TransitionGuardDef) []hclwrite.Tokens {
+	var items []hclwrite.Tokens
+	for _, guardDef := range guardDefs {
+		if tokens, ok := hclGuardDefTokens(guardDef); ok {
+			items = append(items, tokens)
+		}
+	}
+	return items
+}
+
+func hclGuardDefTokens(guardDef *TransitionGuardDef) (hclwrite.Tokens, bool) {
+	if guardDef.Expr != "" && !guardDef.IsCombined() {
+		return hclExprTokens(guardDef.Expr, guardDef.Label), true
+	}
+	if !guardDef.IsCombined() {
+		if guardDef.RegisteredFunc == "" {
+			return nil, false
+		}
+		return hclFuncRefTokens(hclFuncRef{name: guardDef.RegisteredFunc, label: guardDef.Label}), true
+	}
+
+	name := "all"
+	switch {
+	case len(guardDef.Any) != 0:
+		name = "any"
+	case guardDef.Not != nil:
+		name = "not"
+	}
+
+	tokens := hclwrite.Tokens{
+		{Type: hclsyntax.TokenIdent, Bytes: []byte(name)},
+		{Type: hclsyntax.TokenOParen, Bytes: []byte("(")},
+	}
+	for i, childDef := range guardDef.children() {
+		childTokens, ok := hclGuardDefTokens(childDef)
+		if !ok {
+			return nil, false
+		}
+		if i > 0 {
+			tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")})
+		}
+		tokens = append(tokens, childTokens...)
+	}
+	tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCParen, Bytes: []byte(")")})
+	return hclLabeledTokens(tokens, guardDef.Label), true
+}
+
+// hclContextValue returns the context as an object value, through JSON.
+func hclContextValue(context interface{}) (cty.Value, bool) {
+	if context == nil {
+		return cty.NilVal, false
+	}
+	b, err := json.Marshal(context)
+	if err != nil {
+		return cty.NilVal, false
+	}
+	ty, err := ctyjson.ImpliedType(b)
+	if err != nil || !ty.IsObjectType() {
+		return cty.NilVal, false
+	}
+	val, err := ctyjson.Unmarshal(b, ty)
+	return val, err == nil
+}
+
+// hclAssignTokens returns the tokens of the assign actions. Actions which
+// refer to funcs without a registered func name are omitted.
+func hclAssignTokens(assignDefs []*ContextAssignDef) []hclwrite.Tokens {
+	var items []hclwrite.Tokens
+	for _, assignDef := range assignDefs {
+		if assignDef.Expr == "" {
+			if assignDef.RegisteredFunc != "" {
+				items = append(items, hclFuncRefTokens(hclFuncRef{name: assignDef.RegisteredFunc, label: assignDef.Label}))
+			}
+			continue
+		}
+
+		tokens := hclObjectTokens("var", hclwrite.TokensForValue(cty.StringVal(assignDef.Var)), "")
+		expr := hclObjectTokens("expr", hclwrite.TokensForValue(cty.StringVal(assignDef.Expr)), assignDef.Label)
+		tokens = append(tokens[:len(tokens)-1], &hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")})
+		items = append(items, append(tokens, expr[1:]...))
+	}
+	return items
+}
+
+func hclStringList(values []string) cty.Value {
+	if len(values) == 0 {
+		return cty.ListValEmpty(cty.String)
+	}
+	vals := make([]cty.Value, 0, len(values))
+	for _, value := range values {
+		vals = append(vals, cty.StringVal(value))
+	}
+	return cty.ListVal(vals)
+}
+
+func setHCLStrings(body *hclwrite.Body, name string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	body.SetAttributeValue(name, hclStringList(values))
+}
+
+func setHCLStringMap(body *hclwrite.Body, name string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	m := make(map[string]cty.Value, len(values))
+	for key, value := range values {
+		m[key] = cty.StringVal(value)
+	}
+	body.SetAttributeValue(name, cty.MapVal(m))
+}
+
+// setHCLFuncRefs sets the attribute to the func references, as a tuple if
+// asList is set. References without a registered func name are omitted.
+func setHCLFuncRefs(body *hclwrite.Body, name string, refs []hclFuncRef, asList bool) {
+	var items []hclwrite.Tokens
+	for _, ref := range refs {
+		if ref.name != "" {
+			items = append(items, hclFuncRefTokens(ref))
+		}
+	}
+	setHCLTokens(body, name, items, asList)
+}
+
+// setHCLTokens sets the attribute to the items, as a tuple if asList is set.
+func setHCLTokens(body *hclwrite.Body, name string, items []hclwrite.Tokens, asList bool) {
+	if len(items) == 0 {
+		return
+	}
+
+	if !asList {
+		body.SetAttributeRaw(name, items[0])
+		return
+	}
+
+	tokens := hclwrite.Tokens{{Type: hclsyntax.TokenOBrack, Bytes: []byte("[")}}
+	for i, item := range items {
+		if i > 0 {
+			tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")})
+		}
+		tokens = append(tokens, item...)
+	}
+	tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCBrack, Bytes: []byte("]")})
+	body.SetAttributeRaw(name, tokens)
+}
+
+func hclFuncRefTokens(ref hclFuncRef) hclwrite.Tokens {
+	var tokens hclwrite.Tokens
+	switch {
+	case !hclsyntax.ValidIdentifier(ref.name), ref.name == "true", ref.name == "false", ref.name == "null":
+		tokens = hclwrite.TokensForValue(cty.StringVal(ref.name))
+	default:
+		tokens = hclwrite.Tokens{{Type: hclsyntax.TokenIdent, Bytes: []byte(ref.name)}}
+	}
+
+	return hclLabeledTokens(tokens, ref.label)
+}
+
+// hclExprTokens returns the tokens of a guard expression, as a quoted
+// string, or in an object with an expr key if it could be taken for a func
+// name.
+func hclExprTokens(src, label string) hclwrite.Tokens {
+	tokens := hclwrite.TokensForValue(cty.StringVal(src))
+	if isFuncName(src) {
+		return hclObjectTokens("expr", tokens, label)
+	}
+	return hclLabeledTokens(tokens, label)
+}
+
+// hclLabeledTokens wraps the tokens of a func reference in an object with
+// the label, if any.
+func hclLabeledTokens(tokens hclwrite.Tokens, label string) hclwrite.Tokens {
+	if label == "" {
+		return tokens
+	}
+	return hclObjectTokens("func", tokens, label)
+}
+
+// hclObjectTokens returns an object with the tokens as the value of key,
+// along with the label, if any.
+func hclObjectTokens(key string, tokens hclwrite.Tokens, label string) hclwrite.Tokens {
+	object := hclwrite.Tokens{
+		{Type: hclsyntax.TokenOBrace, Bytes: []byte("{")},
+		{Type: hclsyntax.TokenIdent, Bytes: []byte(key)},
+		{Type: hclsyntax.TokenEqual, Bytes: []byte("=")},
+	}
+	object = append(object, tokens...)
+	if label != "" {
+		object = append(object,
+			&hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")},
+			&hclwrite.Token{Type: hclsyntax.TokenIdent, Bytes: []byte("label")},
+			&hclwrite.Token{Type: hclsyntax.TokenEqual, Bytes: []byte("=")},
+		)
+		object = append(object, hclwrite.TokensForValue(cty.StringVal(label))...)
+	}
+	object = append(object, &hclwrite.Token{Type: hclsyntax.TokenCBrace, Bytes: []byte("}")})
+	return object
+}
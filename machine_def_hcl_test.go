@@ -0,0 +1,174 @@
+package statemachine_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+func ExampleLoadHCL() {
+	p := &ExampleProcess{}
+
+	statemachine.RegisterFunc("is-process-running", p.GetIsProcessRunning)
+	statemachine.RegisterFunc("log-transition", func(t statemachine.Transition) {
+		fmt.Printf("%s -> %s\n", t.From(), t.To())
+	})
+
+	machineDef, err := statemachine.LoadHCL("process.hcl", []byte(`
+		states        = ["unmonitored", "stopped", "starting", "running"]
+		initial_state = "unmonitored"
+
+		event "monitor" {
+		  transition {
+		    from = ["unmonitored"]
+		    to   = "stopped"
+		  }
+		}
+
+		event "tick" {
+		  transition {
+		    from = ["stopped"]
+		    to   = "running"
+		    if   = ["${is-process-running}"]
+		  }
+		}
+
+		after_transition {
+		  do = [log-transition]
+		}
+	`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	p.Machine = statemachine.NewMachine()
+	p.Machine.SetMachineDef(machineDef)
+
+	_ = p.Machine.Fire("monitor")
+	if err := p.Machine.Fire("tick"); err != nil {
+		fmt.Println(err)
+	}
+
+	p.IsProcessRunning = true
+	_ = p.Machine.Fire("tick")
+
+	_, err = statemachine.LoadHCL("process.hcl", []byte(`
+		initial_state = "unmonitored"
+		exit_into     = "stopped"
+	`))
+	fmt.Println(err)
+
+	// Output: unmonitored -> stopped
+	// no matching transition
+	// stopped -> running
+	// process.hcl:3,3-12: Unsupported argument; An argument named "exit_into" is not expected here.
+}
+
+func ExampleWriteHCL() {
+	machineDef := &statemachine.MachineDef{
+		States:       []string{"locked", "unlocked"},
+		InitialState: "locked",
+		Events: map[string]*statemachine.EventDef{
+			"coin": {
+				Transitions: []*statemachine.TransitionDef{{From: []string{"locked"}, To: "unlocked"}},
+			},
+			"push": {
+				Transitions: []*statemachine.TransitionDef{
+					{
+						From:     []string{"unlocked"},
+						To:       "locked",
+						IfGuards: []*statemachine.TransitionGuardDef{{RegisteredFunc: "is-clear", Label: "isClear"}},
+					},
+				},
+			},
+		},
+		AfterCallbacks: []*statemachine.TransitionCallbackDef{
+			{
+				To: []string{"unlocked"},
+				Do: []*statemachine.TransitionCallbackFuncDef{{RegisteredFunc: "show-go"}},
+			},
+		},
+	}
+
+	_ = statemachine.WriteHCL(os.Stdout, machineDef)
+
+	// Output: states        = ["locked", "unlocked"]
+	// initial_state = "locked"
+	//
+	// event "coin" {
+	//   transition {
+	//     from = ["locked"]
+	//     to   = "unlocked"
+	//   }
+	// }
+	//
+	// event "push" {
+	//   transition {
+	//     from = ["unlocked"]
+	//     to   = "locked"
+	//     if   = [{ func = is-clear, label = "isClear" }]
+	//   }
+	// }
+	//
+	// after_transition {
+	//   to = ["unlocked"]
+	//   do = [show-go]
+	// }
+}
+
+func TestWriteHCL_UnregisteredFuncs(t *testing.T) {
+	newDef := func(transitionDef *statemachine.TransitionDef, callbackDef *statemachine.TransitionCallbackDef) *statemachine.MachineDef {
+		transitionDef.From = []string{"locked"}
+		transitionDef.To = "unlocked"
+		machineDef := &statemachine.MachineDef{
+			States:       []string{"locked", "unlocked"},
+			InitialState: "locked",
+			Events: map[string]*statemachine.EventDef{
+				"coin": {Transitions: []*statemachine.TransitionDef{transitionDef}},
+			},
+		}
+		if callbackDef != nil {
+			machineDef.AfterCallbacks = []*statemachine.TransitionCallbackDef{callbackDef}
+		}
+		return machineDef
+	}
+	isPaid := func() bool { return true }
+	count := func() {}
+
+	tests := []struct {
+		def  *statemachine.MachineDef
+		want string
+	}{
+		{
+			newDef(&statemachine.TransitionDef{IfGuards: []*statemachine.TransitionGuardDef{{Guard: isPaid}}}, nil),
+			"event 'coin': if guard: func has no registered name",
+		},
+		{
+			newDef(&statemachine.TransitionDef{UnlessGuards: []*statemachine.TransitionGuardDef{
+				statemachine.Not(isPaid),
+			}}, nil),
+			"event 'coin': unless guard: func has no registered name",
+		},
+		{
+			newDef(&statemachine.TransitionDef{Do: []*statemachine.TransitionCallbackFuncDef{{Func: count}}}, nil),
+			"event 'coin': action: func has no registered name",
+		},
+		{
+			newDef(&statemachine.TransitionDef{}, &statemachine.TransitionCallbackDef{
+				Do: []*statemachine.TransitionCallbackFuncDef{{Func: count}},
+			}),
+			"AfterTransition callback: func has no registered name",
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := statemachine.WriteHCL(&buf, test.def)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("got error %v, want %s", err, test.want)
+		}
+	}
+}
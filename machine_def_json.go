@@ -0,0 +1,103 @@
+package statemachine
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// LoadJSON decodes a JSON encoded MachineDef and validates it.
+//
+// Guards, conditions and callbacks are referred to by their RegisteredFunc
+// names, which are resolved when the definition is set on a machine.
+func LoadJSON(data []byte) (*MachineDef, error) {
+	def := NewMachineDef()
+	if err := json.Unmarshal(data, def); err != nil {
+		return nil, err
+	}
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// LoadJSONStrict is like LoadJSON, but rejects fields which aren't part of
+// the definition types, such as misspelled keys. Unlike LoadJSON, field names
+// must match exactly. Unknown fields are reported as ValidationErrors, with
+// paths to the offending keys, e.g. `Events.tick.Transitions[0].Fromm`.
+func LoadJSONStrict(data []byte) (*MachineDef, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var errs ValidationErrors
+	checkJSONFields("", doc, reflect.TypeOf(MachineDef{}), &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return LoadJSON(data)
+}
+
+// checkJSONFields walks the decoded JSON value against type t, and records
+// the keys which aren't fields of the struct types. Values of the wrong type
+// are left to json.Unmarshal to report.
+func checkJSONFields(path string, value interface{}, t reflect.Type, errs *ValidationErrors) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := map[string]reflect.Type{}
+		for _, field := range jsonFields(t) {
+			fields[field.Name] = field.Type
+		}
+		for _, key := range sortedJSONKeys(obj) {
+			fieldType, ok := fields[key]
+			if !ok {
+				*errs = append(*errs, &ValidationError{Path: join(key), Message: "unknown field '" + key + "'"})
+				continue
+			}
+			checkJSONFields(join(key), obj[key], fieldType, errs)
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			checkJSONFields(path+"["+strconv.Itoa(i)+"]", item, t.Elem(), errs)
+		}
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, key := range sortedJSONKeys(obj) {
+			checkJSONFields(join(key), obj[key], t.Elem(), errs)
+		}
+	}
+}
+
+func sortedJSONKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,307 @@
+package statemachine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PlanPath returns the shortest sequence of events which leads the machine
+// from one state to another, assuming that every guard and choice condition
+// may pass or fail as needed. It returns ErrNoPath if no such sequence
+// exists.
+//
+// States of submachines are written as paths of states, separated by "/".
+// For example, `running/processing` is the processing state of the
+// submachine of running. An empty from state is the initial state. Events
+// of submachines are qualified by the submachine ID path, as in
+// `Machine.Submachine`, e.g. `process-id/succeed`. Submachines which exit to
+// a state of their supermachine (see ExitToState) are planned through.
+func (def *MachineDef) PlanPath(from, to string) ([]string, error) {
+	return def.PlanPathWithGuards(from, to, nil)
+}
+
+// PlanPathWithGuards is like PlanPath, but takes the known results of
+// guards and choice conditions, by their RegisteredFunc names or labels.
+// Transitions which these rule out aren't planned. Guards and conditions
+// which are not listed are assumed to pass or fail as needed.
+func (def *MachineDef) PlanPathWithGuards(from, to string, guards map[string]bool) ([]string, error) {
+	p := &planner{guards: guards, blocked: map[string]bool{}}
+	steps, err := p.plan(def, nil, splitStatePath(from), splitStatePath(to))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]string, 0, len(steps))
+	for _, step := range steps {
+		events = append(events, step.qualifiedEvent())
+	}
+	return events, nil
+}
+
+func splitStatePath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// planStep is an event fired in a (sub)machine, from state, which is
+// planned to lead the (sub)machine to the to state.
+type planStep struct {
+	idPath []string
+	state  string
+	event  string
+	to     string
+}
+
+func (step *planStep) qualifiedEvent() string {
+	return strings.Join(append(append([]string{}, step.idPath...), step.event), "/")
+}
+
+func (step *planStep) key() string {
+	return strings.Join(step.idPath, "/") + "|" + step.state + "|" + step.event
+}
+
+type planner struct {
+	guards map[string]bool
+
+	// blocked lists the steps which must not be planned.
+	blocked map[string]bool
+}
+
+type planEdge struct {
+	from  string
+	to    string
+	steps []*planStep
+}
+
+// plan returns the steps from the from state path to the to state path, in
+// the machine at idPath.
+func (p *planner) plan(def *MachineDef, idPath []string, from, to []string) ([]*planStep, error) {
+	if len(to) == 0 {
+		return nil, nil
+	}
+
+	start := def.InitialState
+	var subFrom []string
+	if len(from) > 0 {
+		start, subFrom = from[0], from[1:]
+	}
+	target := to[0]
+	if !def.isKnownState(target) {
+		return nil, fmt.Errorf("unknown state '%s'", strings.Join(to, "/"))
+	}
+
+	var steps []*planStep
+	if start != target {
+		var ok bool
+		if steps, ok = p.shortest(def, idPath, start, subFrom, target); !ok {
+			return nil, ErrNoPath
+		}
+		// the submachine of the target starts in its initial state.
+		subFrom = nil
+	}
+
+	if len(to) == 1 {
+		return steps, nil
+	}
+
+	for _, submachineDef := range def.Submachines[target] {
+		if !submachineDef.isKnownState(to[1]) {
+			continue
+		}
+		subIDPath := append(append([]string{}, idPath...), submachineDef.ID)
+		subSteps, err := p.plan(submachineDef, subIDPath, subFrom, to[1:])
+		if err != nil {
+			return nil, err
+		}
+		return append(steps, subSteps...), nil
+	}
+	return nil, fmt.Errorf("unknown state '%s'", strings.Join(to, "/"))
+}
+
+// shortest finds the steps with the fewest events from start to target,
+// within the machine at idPath.
+func (p *planner) shortest(def *MachineDef, idPath []string, start string, subFrom []string, target string) ([]*planStep, bool) {
+	states := append([]string{start}, def.KnownStates()...)
+	dist := map[string]int{start: 0}
+	prev := map[string]*planEdge{}
+	visited := map[string]bool{}
+
+	for {
+		current := ""
+		for _, state := range states {
+			if d, ok := dist[state]; ok && !visited[state] && (current == "" || d < dist[current]) {
+				current = state
+			}
+		}
+		if current == "" {
+			return nil, false
+		}
+		if current == target {
+			break
+		}
+		visited[current] = true
+
+		var currentSubFrom []string
+		if current == start {
+			currentSubFrom = subFrom
+		}
+		for _, edge := range p.edges(def, idPath, current, currentSubFrom) {
+			d := dist[current] + len(edge.steps)
+			if known, ok := dist[edge.to]; !ok || d < known {
+				dist[edge.to] = d
+				prev[edge.to] = edge
+				if !def.isKnownState(edge.to) {
+					states = append(states, edge.to)
+				}
+			}
+		}
+	}
+
+	var steps []*planStep
+	for state := target; state != start; state = prev[state].from {
+		steps = append(append([]*planStep{}, prev[state].steps...), steps...)
+	}
+	return steps, true
+}
+
+// edges returns the transitions from state to other states. These are made
+// by events of the machine, or by events of a submachine of state, which
+// exits to the machine.
+func (p *planner) edges(def *MachineDef, idPath []string, state string, subFrom []string) []*planEdge {
+	var edges []*planEdge
+
+	for _, event := range sortedEventNames(def.Events) {
+		if p.blocked[(&planStep{idPath: idPath, state: state, event: event}).key()] {
+			continue
+		}
+		seen := map[string]bool{state: true}
+		for _, to := range p.targets(def.Events[event], state) {
+			if !seen[to] {
+				seen[to] = true
+				step := &planStep{idPath: idPath, state: state, event: event, to: to}
+				edges = append(edges, &planEdge{from: state, to: to, steps: []*planStep{step}})
+			}
+		}
+	}
+
+	for _, submachineDef := range def.Submachines[state] {
+		subIDPath := append(append([]string{}, idPath...), submachineDef.ID)
+		for _, callbackDef := range submachineDef.AfterCallbacks {
+			if callbackDef.ExitToState == "" {
+				continue
+			}
+			for _, exitState := range submachineDef.KnownStates() {
+				if !callbackMatchesTo(callbackDef, exitState) || len(subFrom) > 0 && subFrom[0] == exitState {
+					continue
+				}
+				steps, err := p.plan(submachineDef, subIDPath, subFrom, []string{exitState})
+				if err == nil && len(steps) > 0 {
+					edges = append(edges, &planEdge{from: state, to: callbackDef.ExitToState, steps: steps})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(edges, func(i, j int) bool {
+		return len(edges[i].steps) < len(edges[j].steps)
+	})
+	return edges
+}
+
+// targets returns the states which eventDef may transition to from state,
+// given the known guard results.
+func (p *planner) targets(eventDef *EventDef, state string) []string {
+	if eventDef == nil {
+		return nil
+	}
+
+	var states []string
+	for _, transitionDef := range eventDef.Transitions {
+		if !transitionDef.Matches(state) {
+			continue
+		}
+		possible, certain := p.allows(transitionDef)
+		if !possible {
+			continue
+		}
+		states = append(states, transitionDef.To)
+		if certain {
+			// later transitions are never taken.
+			return states
+		}
+	}
+
+	choiceDef := eventDef.Choice
+	if choiceDef == nil {
+		return states
+	}
+	if choiceDef.UnlessGuard != nil {
+		if value, ok := p.guardValue(choiceDef.UnlessGuard.RegisteredFunc, choiceDef.UnlessGuard.Label); ok && value {
+			return states
+		}
+	}
+
+	values := []bool{true, false}
+	if choiceDef.Condition != nil {
+		if value, ok := p.guardValue(choiceDef.Condition.RegisteredFunc, choiceDef.Condition.Label); ok {
+			values = []bool{value}
+		}
+	}
+	for _, value := range values {
+		states = append(states, p.targets(choiceDef.Branch(value), state)...)
+	}
+	return states
+}
+
+// allows reports whether the guards of the transition may pass, and whether
+// they certainly do. A join depends on the states of the regions when the
+// event is fired, so it never certainly passes.
+func (p *planner) allows(transitionDef *TransitionDef) (possible bool, certain bool) {
+	certain = len(transitionDef.Join) == 0
+	for _, guardDef := range transitionDef.IfGuards {
+		value, ok := p.guardValue(guardDef.RegisteredFunc, guardDef.Label)
+		if ok && !value {
+			return false, false
+		}
+		certain = certain && ok
+	}
+	for _, guardDef := range transitionDef.UnlessGuards {
+		value, ok := p.guardValue(guardDef.RegisteredFunc, guardDef.Label)
+		if ok && value {
+			return false, false
+		}
+		certain = certain && ok
+	}
+	return true, certain
+}
+
+func (p *planner) guardValue(names ...string) (bool, bool) {
+	for _, name := range names {
+		if value, ok := p.guards[name]; ok && name != "" {
+			return value, true
+		}
+	}
+	return false, false
+}
+
+// callbackMatchesTo reports whether the callback runs on transitions to state,
+// from any state.
+func callbackMatchesTo(callbackDef *TransitionCallbackDef, state string) bool {
+	for _, exceptState := range callbackDef.ExceptTo {
+		if state == exceptState {
+			return false
+		}
+	}
+	if len(callbackDef.To) == 0 {
+		return true
+	}
+	for _, toState := range callbackDef.To {
+		if state == toState {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,361 @@
+package statemachine_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+var planProcessHCL = []byte(`
+	states        = ["unmonitored", "stopped", "starting", "running", "restarting"]
+	initial_state = "unmonitored"
+
+	event "monitor" {
+	  transition {
+	    from = ["unmonitored"]
+	    to   = "stopped"
+	  }
+	}
+
+	event "start" {
+	  transition {
+	    from = ["stopped"]
+	    to   = "starting"
+	  }
+	}
+
+	event "tick" {
+	  transition {
+	    from = ["starting"]
+	    to   = "running"
+	    if   = [is-process-running]
+	  }
+
+	  transition {
+	    from = ["starting"]
+	    to   = "restarting"
+	  }
+
+	  transition {
+	    from = ["restarting"]
+	    to   = "running"
+	  }
+	}
+
+	submachine "running" {
+	  id            = "process"
+	  states        = ["pending", "processing", "success"]
+	  initial_state = "pending"
+
+	  event "process" {
+	    transition {
+	      from = ["pending"]
+	      to   = "processing"
+	    }
+	  }
+
+	  event "succeed" {
+	    transition {
+	      from = ["processing"]
+	      to   = "success"
+	    }
+	  }
+
+	  after_transition {
+	    to            = ["success"]
+	    exit_to_state = "stopped"
+	  }
+	}
+`)
+
+func ExampleMachineDef_PlanPath() {
+	machineDef, err := statemachine.LoadHCL("process.hcl", planProcessHCL)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(machineDef.PlanPath("", "running"))
+	fmt.Println(machineDef.PlanPath("unmonitored", "running/processing"))
+	fmt.Println(machineDef.PlanPath("running/processing", "stopped"))
+	fmt.Println(machineDef.PlanPath("running", "unmonitored"))
+
+	guards := map[string]bool{"is-process-running": false}
+	fmt.Println(machineDef.PlanPathWithGuards("stopped", "running", guards))
+
+	// Output:
+	// [monitor start tick] <nil>
+	// [monitor start tick process/process] <nil>
+	// [process/succeed] <nil>
+	// [] no path to target state
+	// [start tick tick] <nil>
+}
+
+func ExampleMachine_DriveTo() {
+	isProcessRunning := false
+	statemachine.RegisterFunc("is-process-running", func() bool { return isProcessRunning })
+	statemachine.RegisterFunc("log-transition", func(t statemachine.Transition) {
+		fmt.Printf("%s -> %s\n", t.From(), t.To())
+	})
+
+	machineDef, err := statemachine.LoadHCL("process.hcl", planProcessHCL)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	machineDef.AddAfterCallback(&statemachine.TransitionCallbackDef{
+		Do: []*statemachine.TransitionCallbackFuncDef{{RegisteredFunc: "log-transition"}},
+	})
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+
+	// tick is planned from starting to running, but the guard fails and the
+	// machine restarts instead, so the path is replanned from restarting.
+	if err := machine.DriveTo(context.Background(), "running"); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(machine.GetState())
+
+	// Output:
+	// unmonitored -> stopped
+	// stopped -> starting
+	// starting -> restarting
+	// restarting -> running
+	// running
+}
+
+func TestMachine_DriveToReplansRejectedSteps(t *testing.T) {
+	statemachine.RegisterFunc("can-quick-start", func() bool { return false })
+
+	machineDef, err := statemachine.LoadHCL("server.hcl", []byte(`
+		states        = ["stopped", "booting", "running"]
+		initial_state = "stopped"
+
+		event "quick_start" {
+		  transition {
+		    from = ["stopped"]
+		    to   = "running"
+		    if   = [can-quick-start]
+		  }
+		}
+
+		event "boot" {
+		  transition {
+		    from = ["stopped"]
+		    to   = "booting"
+		  }
+		}
+
+		event "ready" {
+		  transition {
+		    from = ["booting"]
+		    to   = "running"
+		  }
+		}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := machineDef.PlanPath("stopped", "running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"quick_start"}; !reflect.DeepEqual(plan, want) {
+		t.Errorf("got plan %v, want %v", plan, want)
+	}
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+	if err := machine.DriveTo(context.Background(), "running"); err != nil {
+		t.Fatal(err)
+	}
+	if state := machine.GetState(); state != "running" {
+		t.Errorf("got state %s, want running", state)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	machine.SetMachineDef(machineDef)
+	if err := machine.DriveTo(ctx, "running"); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMachine_DriveToReplansDeferredSteps(t *testing.T) {
+	statemachine.RegisterFunc("can-quick-start", func() bool { return false })
+
+	machineDef, err := statemachine.LoadHCL("server.hcl", []byte(`
+		states        = ["stopped", "booting", "running"]
+		initial_state = "stopped"
+
+		event "quick_start" {
+		  transition {
+		    from = ["stopped"]
+		    to   = "running"
+		    if   = [can-quick-start]
+		  }
+		}
+
+		event "boot" {
+		  transition {
+		    from = ["stopped"]
+		    to   = "booting"
+		  }
+		}
+
+		event "ready" {
+		  transition {
+		    from = ["booting"]
+		    to   = "running"
+		  }
+		}
+
+		defer "quick_start" {
+		  in = ["stopped"]
+		}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := machine.DriveTo(ctx, "running"); err != nil {
+		t.Fatal(err)
+	}
+	if state := machine.GetState(); state != "running" {
+		t.Errorf("got state %s, want running", state)
+	}
+	if deferred := machine.Deferred(); len(deferred) > 0 {
+		t.Errorf("got deferred events %v, want none", deferred)
+	}
+}
+
+func TestMachine_DriveToReplansDivergedSteps(t *testing.T) {
+	statemachine.RegisterFunc("can-quick-start", func() bool { return false })
+
+	machineDef, err := statemachine.LoadHCL("server.hcl", []byte(`
+		states        = ["stopped", "booting", "running", "failed"]
+		initial_state = "stopped"
+
+		event "quick_start" {
+		  transition {
+		    from = ["stopped"]
+		    to   = "running"
+		    if   = [can-quick-start]
+		  }
+
+		  transition {
+		    from = ["stopped"]
+		    to   = "failed"
+		  }
+		}
+
+		event "reset" {
+		  transition {
+		    from = ["failed"]
+		    to   = "stopped"
+		  }
+		}
+
+		event "boot" {
+		  transition {
+		    from = ["stopped"]
+		    to   = "booting"
+		  }
+		}
+
+		event "ready" {
+		  transition {
+		    from = ["booting"]
+		    to   = "running"
+		  }
+		}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+
+	// quick_start is not rejected, but leads to failed rather than running,
+	// from where it would be planned again.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := machine.DriveTo(ctx, "running"); err != nil {
+		t.Fatal(err)
+	}
+	if state := machine.GetState(); state != "running" {
+		t.Errorf("got state %s, want running", state)
+	}
+}
+
+func TestMachineDef_PlanPathPastJoins(t *testing.T) {
+	machineDef, err := statemachine.LoadHCL("release.hcl", []byte(`
+		states        = ["draft", "released", "held"]
+		initial_state = "draft"
+
+		event "submit" {
+		  transition {
+		    from = ["draft"]
+		    to   = "releasing"
+		  }
+		}
+
+		event "release" {
+		  transition {
+		    from = ["releasing"]
+		    to   = "released"
+		    join = { review = "approved", build = "passed" }
+		  }
+
+		  transition {
+		    from = ["releasing"]
+		    to   = "held"
+		  }
+		}
+
+		submachine "releasing" {
+		  id            = "review"
+		  states        = ["pending", "approved"]
+		  initial_state = "pending"
+		}
+
+		submachine "releasing" {
+		  id            = "build"
+		  states        = ["running", "passed"]
+		  initial_state = "running"
+		}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the join may not pass, so the transition after it may be taken.
+	plan, err := machineDef.PlanPath("draft", "held")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"submit", "release"}; !reflect.DeepEqual(plan, want) {
+		t.Errorf("got plan %v, want %v", plan, want)
+	}
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+	if err := machine.DriveTo(context.Background(), "held"); err != nil {
+		t.Fatal(err)
+	}
+	if state := machine.GetState(); state != "held" {
+		t.Errorf("got state %s, want held", state)
+	}
+}
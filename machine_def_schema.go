@@ -0,0 +1,169 @@
+package statemachine
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//go:generate go run ./cmd/statemachine schema -o machine_def.schema.json
+
+// JSONSchemaID identifies the published JSON Schema for JSON encoded
+// MachineDef documents.
+const JSONSchemaID = "https://raw.githubusercontent.com/Gurpartap/statemachine-go/master/machine_def.schema.json"
+
+// schemaDescriptions describes the fields of the definition types in the
+// generated JSON Schema, by type and field name.
+var schemaDescriptions = map[string]string{
+	"MachineDef.id":                            "Identifies a parallel submachine.",
+	"MachineDef.States":                        "Possible states of the machine.",
+	"MachineDef.InitialState":                  "State of the machine before any event is fired.",
+	"MachineDef.FinalStates":                   "States in which the machine is done. Once the submachines of a state are all done, the supermachine fires the done.<state> event.",
+	"MachineDef.Events":                        "Events by name.",
+	"MachineDef.Always":                        "Eventless transitions, which are taken as soon as they match the current state and their guards allow them, after each transition.",
+	"MachineDef.Deferred":                      "States which defer each event, by event. A deferred event without a transition is queued until the machine is in a state which doesn't defer it.",
+	"MachineDef.Invokes":                       "Services invoked by the states of the machine, which run for as long as their state is active.",
+	"MachineDef.Submachines":                   "Submachines by the state they run in. More than one submachine for a state run in parallel.",
+	"MachineDef.Context":                       "Initial values of the context variables of the machine, which are updated by assign actions.",
+	"MachineDef.BeforeCallbacks":               "Callbacks run before a transition.",
+	"MachineDef.AroundCallbacks":               "Callbacks run around a transition, which must call the func passed to them.",
+	"MachineDef.AfterCallbacks":                "Callbacks run after a transition.",
+	"MachineDef.BeforeEventCallbacks":          "Callbacks run when an event is fired, before its transition is looked up. A callback returning an error vetoes the event.",
+	"MachineDef.AfterEventCallbacks":           "Callbacks run once an event has transitioned the machine.",
+	"MachineDef.FailureCallbacks":              "Callbacks run when an event fails.",
+	"EventDef.TimedEvery":                      "Interval at which the event is fired, in nanoseconds.",
+	"EventDef.Choice":                          "Transitions chosen by a condition.",
+	"TransitionDef.From":                       "States the transition is from. Any state if empty.",
+	"TransitionDef.ExceptFrom":                 "States the transition is not from.",
+	"TransitionDef.To":                         "State the transition is to.",
+	"TransitionDef.History":                    "Restores the last states of the submachines of the state the transition is to, either shallow (their own states only) or deep (including those of their submachines).",
+	"TransitionDef.IfGuards":                   "Guards which must all pass for the transition to be allowed.",
+	"TransitionDef.UnlessGuards":               "Guards which must all fail for the transition to be allowed.",
+	"TransitionDef.Assigns":                    "Actions which update the context when the transition is taken, along with the state.",
+	"TransitionDef.Fork":                       "States which the parallel submachines of the state the transition is to enter, by submachine ID, instead of their initial states.",
+	"TransitionDef.Join":                       "States which the parallel submachines of the state the transition is from must be in, by submachine ID, for the transition to be allowed.",
+	"TransitionDef.Do":                         "Actions run when the transition is taken, between the exit and the entry of states.",
+	"TransitionGuardDef.RegisteredFunc":        "Name of the guard func registered with statemachine.RegisterFunc.",
+	"TransitionGuardDef.Expr":                  "Guard expression over ctx and payload, such as `payload.attempt < 3 && !payload.fatal`.",
+	"TransitionGuardDef.All":                   "Guards which must all pass for the guard to pass.",
+	"TransitionGuardDef.Any":                   "Guards of which any must pass for the guard to pass.",
+	"TransitionGuardDef.Not":                   "Guard which must fail for the guard to pass.",
+	"ContextAssignDef.RegisteredFunc":          "Name of the assign func registered with statemachine.RegisterFunc.",
+	"ContextAssignDef.Var":                     "Context variable which is set to the value of Expr.",
+	"ContextAssignDef.Expr":                    "Expression over ctx and payload, such as `ctx.retries + 1`.",
+	"ChoiceDef.UnlessGuard":                    "Guard which must fail for the choice to be made.",
+	"ChoiceDef.OnTrue":                         "Transitions when the condition is true.",
+	"ChoiceDef.OnFalse":                        "Transitions when the condition is false.",
+	"ChoiceConditionDef.RegisteredFunc":        "Name of the condition func registered with statemachine.RegisterFunc.",
+	"ChoiceConditionDef.Expr":                  "Condition expression over ctx and payload, such as `payload.amount > 100`.",
+	"TransitionCallbackDef.ExitToState":        "State of the supermachine to transition to, exiting the submachine.",
+	"TransitionCallbackFuncDef.RegisteredFunc": "Name of the callback func registered with statemachine.RegisterFunc.",
+	"EventCallbackDef.On":                      "Events the callback runs on. Any event if empty.",
+	"EventCallbackDef.ExceptOn":                "Events the callback does not run on.",
+	"InvokeDef.ID":                             "Identifies the service. Its completion events are done.invoke.<id> and error.invoke.<id>.",
+	"InvokeDef.State":                          "State which invokes the service when it's entered, and stops it when it's exited.",
+	"InvokeDef.RegisteredFunc":                 "Name of the service func registered with statemachine.RegisterFunc.",
+	"EventCallbackFuncDef.RegisteredFunc":      "Name of the callback func registered with statemachine.RegisterFunc.",
+}
+
+// JSONSchema returns the JSON Schema (draft-07) for JSON encoded MachineDef
+// documents, as read by LoadJSON. The schema is generated from the
+// definition types, and published as machine_def.schema.json.
+func JSONSchema() ([]byte, error) {
+	definitions := map[string]interface{}{}
+	schema := map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"$id":         JSONSchemaID,
+		"title":       "MachineDef",
+		"$ref":        schemaRef(reflect.TypeOf(MachineDef{}), definitions)["$ref"],
+		"definitions": definitions,
+	}
+
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// schemaRef returns the schema for t, adding the definitions of struct
+// types it refers to.
+func schemaRef(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]interface{}{"type": "integer"}
+	}
+	if t == reflect.TypeOf(History("")) {
+		return map[string]interface{}{"type": "string", "enum": []History{Shallow, Deep}}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaRef(t.Elem(), definitions)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaRef(t.Elem(), definitions)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaRef(t.Elem(), definitions)}
+	case reflect.Struct:
+		if _, ok := definitions[t.Name()]; !ok {
+			properties := map[string]interface{}{}
+			definitions[t.Name()] = map[string]interface{}{
+				"type":                 "object",
+				"properties":           properties,
+				"additionalProperties": false,
+			}
+			for _, field := range jsonFields(t) {
+				property := schemaRef(field.Type, definitions)
+				if description, ok := schemaDescriptions[t.Name()+"."+field.Name]; ok {
+					if _, isRef := property["$ref"]; isRef {
+						// siblings of $ref are ignored in draft-07.
+						property = map[string]interface{}{"allOf": []interface{}{property}}
+					}
+					property["description"] = description
+				}
+				properties[field.Name] = property
+			}
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// jsonField is a struct field, named by its JSON key.
+type jsonField struct {
+	Name string
+	Type reflect.Type
+}
+
+// jsonFields returns the fields of struct type t which are encoded as JSON,
+// in declaration order.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+				name = tagName
+			}
+		}
+		fields = append(fields, jsonField{Name: name, Type: field.Type})
+	}
+	return fields
+}
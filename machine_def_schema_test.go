@@ -0,0 +1,44 @@
+package statemachine_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+func TestJSONSchemaIsUpToDate(t *testing.T) {
+	schema, err := statemachine.JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := ioutil.ReadFile("machine_def.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(schema, published) {
+		t.Error("machine_def.schema.json is out of date, run go generate")
+	}
+}
+
+func ExampleLoadJSONStrict() {
+	_, err := statemachine.LoadJSONStrict([]byte(`{
+		"States": ["stopped", "running"],
+		"InitialState": "stopped",
+		"Events": {
+			"start": {
+				"Transitions": [{"Form": ["stopped"], "To": "running"}]
+			}
+		},
+		"AfterCallbacks": [{"To": ["running"], "exit_into": "stopped"}]
+	}`))
+	fmt.Println(err)
+
+	// Output:
+	// AfterCallbacks[0].exit_into: unknown field 'exit_into'
+	// Events.start.Transitions[0].Form: unknown field 'Form'
+}
@@ -0,0 +1,406 @@
+package statemachine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError describes a single problem found in a definition. Path
+// locates the offending key using the snake_case definition keys, e.g.
+// `event.tick.transitions[2].to`, or the JSON keys for the unknown fields
+// reported by LoadJSONStrict.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors lists every problem found by MachineDef.Validate.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate lints the definition, including its submachines, without
+// requiring any of the registered funcs to be available. It returns
+// ValidationErrors if any problems were found, or nil otherwise.
+//
+// Validate checks that the initial state is defined, that transitions and
+// callbacks only refer to known states and events, that every guard,
+// condition, callback and invoked service has a func (or a registered func
+// name), that expressions type-check against the context, and that
+// ExitToState targets exist in the supermachine.
+func (def *MachineDef) Validate() error {
+	v := &validator{}
+	v.validateMachine("", def, nil)
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) errorf(path string, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// KnownStates returns the states defined by States, along with the states
+// which have submachines.
+func (def *MachineDef) KnownStates() []string {
+	states := append([]string{}, def.States...)
+	seen := map[string]bool{}
+	for _, state := range states {
+		seen[state] = true
+	}
+	for _, state := range sortedSubmachineStates(def.Submachines) {
+		if !seen[state] {
+			seen[state] = true
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+func (def *MachineDef) isKnownState(state string) bool {
+	for _, s := range def.States {
+		if s == state {
+			return true
+		}
+	}
+	_, ok := def.Submachines[state]
+	return ok
+}
+
+func (v *validator) validateMachine(path string, def *MachineDef, supermachineDef *MachineDef) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	if def.Context != nil && !isContextValue(def.Context) {
+		v.errorf(join("context"), "context must be a struct, a pointer to one, or a map[string]interface{}")
+	}
+
+	if def.InitialState == "" {
+		v.errorf(join("initial_state"), "initial state is not defined")
+	} else if !def.isKnownState(def.InitialState) {
+		v.errorf(join("initial_state"), "unknown state '%s'", def.InitialState)
+	}
+	for i, state := range def.FinalStates {
+		if !def.isKnownState(state) {
+			v.errorf(join(fmt.Sprintf("final_states[%d]", i)), "unknown state '%s'", state)
+		}
+	}
+
+	for _, event := range sortedEventNames(def.Events) {
+		v.validateEvent(join("event."+event), def, def.Events[event])
+	}
+	for i, transitionDef := range def.Always {
+		v.validateTransition(join(fmt.Sprintf("always[%d]", i)), def, transitionDef)
+	}
+	for _, event := range sortedDeferredEvents(def.Deferred) {
+		deferPath := join("defer." + event)
+		if _, ok := def.Events[event]; !ok {
+			v.errorf(deferPath, "unknown event '%s'", event)
+		}
+		v.validateStates(deferPath+".in", def, def.Deferred[event])
+	}
+	seenInvokes := map[string]bool{}
+	for i, invokeDef := range def.Invokes {
+		invokePath := join(fmt.Sprintf("invoke[%d]", i))
+		if invokeDef.ID == "" {
+			v.errorf(invokePath+".id", "id is not defined")
+		} else if seenInvokes[invokeDef.ID] {
+			v.errorf(invokePath+".id", "duplicate invoke id '%s'", invokeDef.ID)
+		}
+		seenInvokes[invokeDef.ID] = true
+		if invokeDef.State == "" {
+			v.errorf(invokePath+".state", "state is not defined")
+		} else if !def.isKnownState(invokeDef.State) {
+			v.errorf(invokePath+".state", "unknown state '%s'", invokeDef.State)
+		}
+		if invokeDef.Func == nil && invokeDef.RegisteredFunc == "" {
+			v.errorf(invokePath, "neither func nor registered func is set")
+		}
+	}
+
+	callbackLists := []struct {
+		key       string
+		callbacks []*TransitionCallbackDef
+	}{
+		{"before_callbacks", def.BeforeCallbacks},
+		{"around_callbacks", def.AroundCallbacks},
+		{"after_callbacks", def.AfterCallbacks},
+	}
+	for _, list := range callbackLists {
+		for i, callbackDef := range list.callbacks {
+			v.validateTransitionCallback(join(fmt.Sprintf("%s[%d]", list.key, i)), def, supermachineDef, callbackDef)
+		}
+	}
+
+	eventCallbackLists := []struct {
+		key       string
+		callbacks []*EventCallbackDef
+	}{
+		{"before_event_callbacks", def.BeforeEventCallbacks},
+		{"after_event_callbacks", def.AfterEventCallbacks},
+		{"failure_callbacks", def.FailureCallbacks},
+	}
+	for _, list := range eventCallbackLists {
+		for i, callbackDef := range list.callbacks {
+			callbackPath := join(fmt.Sprintf("%s[%d]", list.key, i))
+			for _, event := range append(append([]string{}, callbackDef.On...), callbackDef.ExceptOn...) {
+				if _, ok := def.Events[event]; !ok {
+					v.errorf(callbackPath, "unknown event '%s'", event)
+				}
+			}
+			for j, funcDef := range callbackDef.Do {
+				if funcDef.Func == nil && funcDef.RegisteredFunc == "" {
+					v.errorf(fmt.Sprintf("%s.do[%d]", callbackPath, j), "neither func nor registered func is set")
+				}
+			}
+		}
+	}
+
+	for _, state := range sortedSubmachineStates(def.Submachines) {
+		if !def.isKnownState(state) {
+			v.errorf(join("submachine."+state), "unknown state '%s'", state)
+		}
+		seenIDs := map[string]bool{}
+		for i, submachineDef := range def.Submachines[state] {
+			submachinePath := join(fmt.Sprintf("submachine.%s[%d]", state, i))
+			if len(def.Submachines[state]) > 1 {
+				if submachineDef.ID == "" {
+					v.errorf(submachinePath, "parallel submachines must have an id")
+				} else if seenIDs[submachineDef.ID] {
+					v.errorf(submachinePath, "duplicate submachine id '%s'", submachineDef.ID)
+				}
+				seenIDs[submachineDef.ID] = true
+			}
+			v.validateMachine(submachinePath, submachineDef, def)
+		}
+	}
+}
+
+func (v *validator) validateEvent(path string, def *MachineDef, eventDef *EventDef) {
+	if eventDef == nil {
+		v.errorf(path, "event is not defined")
+		return
+	}
+
+	if eventDef.TimedEvery < 0 {
+		v.errorf(path+".timed_every", "negative duration %s", eventDef.TimedEvery)
+	}
+
+	for i, transitionDef := range eventDef.Transitions {
+		v.validateTransition(fmt.Sprintf("%s.transitions[%d]", path, i), def, transitionDef)
+	}
+
+	choiceDef := eventDef.Choice
+	if choiceDef == nil {
+		return
+	}
+
+	choicePath := path + ".choice"
+	if choiceDef.Condition == nil {
+		v.errorf(choicePath+".condition", "condition is not defined")
+	} else {
+		conditionDef := choiceDef.Condition
+		hasFunc := conditionDef.Condition != nil || conditionDef.RegisteredFunc != ""
+		switch {
+		case hasFunc && conditionDef.Expr != "":
+			v.errorf(choicePath+".condition", "expr is set along with func or registered func")
+		case !hasFunc && conditionDef.Expr == "":
+			v.errorf(choicePath+".condition", "neither func, registered func nor expr is set")
+		case conditionDef.Expr != "":
+			v.validateExpr(choicePath+".condition.expr", def, conditionDef.Expr)
+		}
+	}
+	if choiceDef.UnlessGuard != nil {
+		v.validateGuard(choicePath+".unless_condition", def, choiceDef.UnlessGuard)
+	}
+	if choiceDef.OnTrue == nil && choiceDef.OnFalse == nil {
+		v.errorf(choicePath, "neither on_true nor on_false is defined")
+	}
+	if choiceDef.OnTrue != nil {
+		v.validateEvent(choicePath+".on_true", def, choiceDef.OnTrue)
+	}
+	if choiceDef.OnFalse != nil {
+		v.validateEvent(choicePath+".on_false", def, choiceDef.OnFalse)
+	}
+}
+
+func (v *validator) validateTransition(path string, def *MachineDef, transitionDef *TransitionDef) {
+	if transitionDef.To == "" {
+		v.errorf(path+".to", "target state is not defined")
+	} else if !def.isKnownState(transitionDef.To) {
+		v.errorf(path+".to", "unknown state '%s'", transitionDef.To)
+	}
+
+	if transitionDef.History != "" {
+		switch {
+		case !transitionDef.History.isValid():
+			v.errorf(path+".history", "unknown history '%s'", transitionDef.History)
+		case len(def.Submachines[transitionDef.To]) == 0:
+			v.errorf(path+".history", "history is only available for states with submachines")
+		}
+	}
+
+	v.validateStates(path+".from", def, transitionDef.From)
+	v.validateStates(path+".except_from", def, transitionDef.ExceptFrom)
+
+	v.validateRegions(path+".fork", def, transitionDef.To, transitionDef.Fork)
+	if len(transitionDef.Join) != 0 && len(transitionDef.From) == 0 {
+		v.errorf(path+".join", "join is only available for transitions from specific states")
+	}
+	for _, from := range transitionDef.From {
+		v.validateRegions(path+".join", def, from, transitionDef.Join)
+	}
+
+	for i, guardDef := range transitionDef.IfGuards {
+		v.validateGuard(fmt.Sprintf("%s.if_guard[%d]", path, i), def, guardDef)
+	}
+	for i, guardDef := range transitionDef.UnlessGuards {
+		v.validateGuard(fmt.Sprintf("%s.unless_guard[%d]", path, i), def, guardDef)
+	}
+	for i, assignDef := range transitionDef.Assigns {
+		v.validateAssign(fmt.Sprintf("%s.assign[%d]", path, i), def, assignDef)
+	}
+	for i, funcDef := range transitionDef.Do {
+		if funcDef.Func == nil && funcDef.RegisteredFunc == "" {
+			v.errorf(fmt.Sprintf("%s.do[%d]", path, i), "neither func nor registered func is set")
+		}
+	}
+}
+
+func (v *validator) validateGuard(path string, def *MachineDef, guardDef *TransitionGuardDef) {
+	combined := 0
+	if len(guardDef.All) != 0 {
+		combined++
+		for i, childDef := range guardDef.All {
+			v.validateGuard(fmt.Sprintf("%s.all[%d]", path, i), def, childDef)
+		}
+	}
+	if len(guardDef.Any) != 0 {
+		combined++
+		for i, childDef := range guardDef.Any {
+			v.validateGuard(fmt.Sprintf("%s.any[%d]", path, i), def, childDef)
+		}
+	}
+	if guardDef.Not != nil {
+		combined++
+		v.validateGuard(path+".not", def, guardDef.Not)
+	}
+
+	hasFunc := guardDef.Guard != nil || guardDef.RegisteredFunc != ""
+	switch {
+	case combined > 1:
+		v.errorf(path, "more than one of all, any and not is set")
+	case combined == 1 && (hasFunc || guardDef.Expr != ""):
+		v.errorf(path, "func, registered func or expr is set along with all, any or not")
+	case hasFunc && guardDef.Expr != "":
+		v.errorf(path, "expr is set along with func or registered func")
+	case combined == 0 && !hasFunc && guardDef.Expr == "":
+		v.errorf(path, "neither func, registered func nor expr is set")
+	case guardDef.Expr != "":
+		v.validateExpr(path+".expr", def, guardDef.Expr)
+	}
+}
+
+// validateExpr parses and type-checks a guard expression against the
+// context of def.
+func (v *validator) validateExpr(path string, def *MachineDef, src string) {
+	if _, err := compileExpr(src, def.exprType); err != nil {
+		v.errorf(path, "%s", err)
+	}
+}
+
+func (v *validator) validateAssign(path string, def *MachineDef, assignDef *ContextAssignDef) {
+	hasFunc := assignDef.Assign != nil || assignDef.RegisteredFunc != ""
+	switch {
+	case hasFunc && (assignDef.Var != "" || assignDef.Expr != ""):
+		v.errorf(path, "var or expr is set along with func or registered func")
+	case hasFunc:
+	case assignDef.Var == "" && assignDef.Expr == "":
+		v.errorf(path, "neither func, registered func nor var and expr are set")
+	case assignDef.Var == "":
+		v.errorf(path+".var", "context variable is not set")
+	case assignDef.Expr == "":
+		v.errorf(path+".expr", "expression is not set")
+	default:
+		if _, err := def.compileAssign(assignDef.Var, assignDef.Expr); err != nil {
+			v.errorf(path+".expr", "%s", err)
+		}
+	}
+}
+
+func (v *validator) validateTransitionCallback(path string, def *MachineDef, supermachineDef *MachineDef, callbackDef *TransitionCallbackDef) {
+	v.validateStates(path+".from", def, callbackDef.From)
+	v.validateStates(path+".except_from", def, callbackDef.ExceptFrom)
+	v.validateStates(path+".to", def, callbackDef.To)
+	v.validateStates(path+".except_to", def, callbackDef.ExceptTo)
+
+	for i, funcDef := range callbackDef.Do {
+		if funcDef.Func == nil && funcDef.RegisteredFunc == "" {
+			v.errorf(fmt.Sprintf("%s.do[%d]", path, i), "neither func nor registered func is set")
+		}
+	}
+
+	if callbackDef.ExitToState != "" {
+		switch {
+		case supermachineDef == nil:
+			v.errorf(path+".exit_to_state", "exit to state is only available in submachines")
+		case !supermachineDef.isKnownState(callbackDef.ExitToState):
+			v.errorf(path+".exit_to_state", "unknown supermachine state '%s'", callbackDef.ExitToState)
+		}
+	}
+}
+
+// validateRegions checks that the regions are parallel submachines of state,
+// which know of their states. Unknown states are reported elsewhere.
+func (v *validator) validateRegions(path string, def *MachineDef, state string, regions map[string]string) {
+	if !def.isKnownState(state) {
+		return
+	}
+	for _, region := range sortedRegions(regions) {
+		var regionDef *MachineDef
+		for _, submachineDef := range def.Submachines[state] {
+			if submachineDef.ID == region {
+				regionDef = submachineDef
+			}
+		}
+		switch {
+		case regionDef == nil:
+			v.errorf(path+"."+region, "no submachine '%s' in state '%s'", region, state)
+		case !regionDef.isKnownState(regions[region]):
+			v.errorf(path+"."+region, "unknown state '%s'", regions[region])
+		}
+	}
+}
+
+func (v *validator) validateStates(path string, def *MachineDef, states []string) {
+	for _, state := range states {
+		if !def.isKnownState(state) {
+			v.errorf(path, "unknown state '%s'", state)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package statemachine_test
+
+import (
+	"fmt"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+func ExampleMachineDef_Validate() {
+	machineDef := &statemachine.MachineDef{
+		States:       processStates,
+		InitialState: "unmonitored",
+		FinalStates:  []string{"exited"},
+		Context:      42,
+		Events: map[string]*statemachine.EventDef{
+			"monitor": {
+				Transitions: []*statemachine.TransitionDef{{From: []string{"unmonitored"}, To: "stoped"}},
+			},
+			"tick": {
+				Transitions: []*statemachine.TransitionDef{
+					{
+						From:     []string{"starting"},
+						To:       "running",
+						History:  "full",
+						Join:     map[string]string{"health": "ok"},
+						IfGuards: []*statemachine.TransitionGuardDef{{Label: "isRunning"}},
+						Assigns:  []*statemachine.ContextAssignDef{{Var: "restarts"}},
+					},
+				},
+			},
+		},
+		Always: []*statemachine.TransitionDef{
+			{From: []string{"restart"}, To: "starting"},
+		},
+		Deferred: map[string][]string{
+			"pause": {"running"},
+			"tick":  {"stoped"},
+		},
+		Invokes: []*statemachine.InvokeDef{
+			{ID: "process", State: "starting", RegisteredFunc: "spawn-process"},
+			{ID: "process", State: "stoped", RegisteredFunc: "watch-process"},
+		},
+		AfterEventCallbacks: []*statemachine.EventCallbackDef{
+			{ExceptOn: []string{"tick"}, Do: []*statemachine.EventCallbackFuncDef{{}}},
+		},
+		FailureCallbacks: []*statemachine.EventCallbackDef{
+			{On: []string{"start"}, Do: []*statemachine.EventCallbackFuncDef{{RegisteredFunc: "log-failure"}}},
+		},
+	}
+
+	fmt.Println(machineDef.Validate())
+
+	// Output: context: context must be a struct, a pointer to one, or a map[string]interface{}
+	// final_states[0]: unknown state 'exited'
+	// event.monitor.transitions[0].to: unknown state 'stoped'
+	// event.tick.transitions[0].history: unknown history 'full'
+	// event.tick.transitions[0].join.health: no submachine 'health' in state 'starting'
+	// event.tick.transitions[0].if_guard[0]: neither func, registered func nor expr is set
+	// event.tick.transitions[0].assign[0].expr: expression is not set
+	// always[0].from: unknown state 'restart'
+	// defer.pause: unknown event 'pause'
+	// defer.tick.in: unknown state 'stoped'
+	// invoke[1].id: duplicate invoke id 'process'
+	// invoke[1].state: unknown state 'stoped'
+	// after_event_callbacks[0].do[0]: neither func nor registered func is set
+	// failure_callbacks[0]: unknown event 'start'
+}
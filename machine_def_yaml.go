@@ -0,0 +1,731 @@
+package statemachine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadYAML decodes a YAML encoded MachineDef and validates it.
+//
+// The document uses the same snake_case keys as the HCL syntax (see
+// LoadHCL). Guards, choice conditions, callbacks and invoked services refer
+// to registered funcs by name, either as a plain string or as a mapping
+// with `func` and `label` keys. Guards may be combined by mappings with an
+// `all`, `any` or `not` key instead of `func`. Guards and choice conditions may also be
+// expressions (see Expr), given as strings which aren't func names, or as
+// mappings with an `expr` key. The context is a mapping of its initial
+// values, and assign actions are func names, or mappings with `var` and
+// `expr` keys. The actions of a transition are listed by `do`, as for
+// callbacks. Durations are written as strings, such as "1s":
+//
+//	states: [unmonitored, stopped, starting, running]
+//	initial_state: unmonitored
+//	final_states: [stopped]
+//	context: {retries: 0}
+//	events:
+//	  tick:
+//	    timed_every: 1s
+//	    transitions:
+//	      - from: [stopped]
+//	        to: starting
+//	        if: [{func: should-auto-start, label: shouldAutoStart}]
+//	        unless: [{any: [is-process-running, {not: is-enabled}]}]
+//	        assign: [{var: retries, expr: ctx.retries + 1}]
+//	      - from: [starting]
+//	        to: stopped
+//	        if: ["ctx.retries >= 3 || payload.force"]
+//	always:
+//	  - from: [starting]
+//	    to: running
+//	    if: [is-process-running]
+//	defer: {stop: [starting]}
+//	invoke:
+//	  - state: starting
+//	    id: process
+//	    src: spawn-process
+//	after_transition:
+//	  - to: [starting]
+//	    do: [start-process]
+//
+// Unknown keys are rejected. Funcs are resolved when the definition is set
+// on a machine.
+func LoadYAML(data []byte) (*MachineDef, error) {
+	doc := &yamlMachine{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(doc); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	def := doc.machineDef()
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// MarshalYAML encodes the definition as YAML, in the format read by
+// LoadYAML. Guards, conditions, assign actions, callbacks and invoked
+// services are written by their RegisteredFunc names, or as expressions. An
+// error is returned for funcs which have no RegisteredFunc name.
+func MarshalYAML(def *MachineDef) ([]byte, error) {
+	if err := def.assertRegisteredNames(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(newYAMLMachine(def)); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type yamlMachine struct {
+	ID           string                    `yaml:"id,omitempty"`
+	States       []string                  `yaml:"states,flow"`
+	InitialState string                    `yaml:"initial_state"`
+	FinalStates  []string                  `yaml:"final_states,flow,omitempty"`
+	Context      map[string]interface{}    `yaml:"context,omitempty"`
+	Events       map[string]*yamlEvent     `yaml:"events,omitempty"`
+	Always       []*yamlTransition         `yaml:"always,omitempty"`
+	Defer        map[string][]string       `yaml:"defer,flow,omitempty"`
+	Invoke       []*yamlInvoke             `yaml:"invoke,omitempty"`
+	Submachines  map[string][]*yamlMachine `yaml:"submachines,omitempty"`
+	Before       []*yamlTransitionCallback `yaml:"before_transition,omitempty"`
+	Around       []*yamlTransitionCallback `yaml:"around_transition,omitempty"`
+	After        []*yamlTransitionCallback `yaml:"after_transition,omitempty"`
+	BeforeEvent  []*yamlEventCallback      `yaml:"before_event,omitempty"`
+	AfterEvent   []*yamlEventCallback      `yaml:"after_event,omitempty"`
+	Failure      []*yamlEventCallback      `yaml:"after_failure,omitempty"`
+}
+
+// yamlInvoke is a service invoked by a state, whose id defaults to the
+// state.
+type yamlInvoke struct {
+	State string `yaml:"state"`
+	ID    string `yaml:"id,omitempty"`
+	Src   string `yaml:"src,omitempty"`
+}
+
+type yamlEvent struct {
+	TimedEvery  yamlDuration      `yaml:"timed_every,omitempty"`
+	Transitions []*yamlTransition `yaml:"transitions,omitempty"`
+	Choice      *yamlChoice       `yaml:"choice,omitempty"`
+}
+
+type yamlChoice struct {
+	Condition *yamlGuardRef `yaml:"condition"`
+	Unless    *yamlGuardRef `yaml:"unless,omitempty"`
+	OnTrue    *yamlEvent    `yaml:"on_true,omitempty"`
+	OnFalse   *yamlEvent    `yaml:"on_false,omitempty"`
+}
+
+func (doc *yamlChoice) UnmarshalYAML(node *yaml.Node) error {
+	type plain yamlChoice
+	if err := decodeYAMLNode(node, (*plain)(doc)); err != nil {
+		return err
+	}
+	if ref := doc.Condition; ref != nil && (len(ref.All) != 0 || len(ref.Any) != 0 || ref.Not != nil) {
+		return fmt.Errorf("line %d: choice condition must be a func or an expr", node.Line)
+	}
+	return nil
+}
+
+type yamlTransition struct {
+	From       []string          `yaml:"from,flow,omitempty"`
+	ExceptFrom []string          `yaml:"except_from,flow,omitempty"`
+	To         string            `yaml:"to"`
+	History    string            `yaml:"history,omitempty"`
+	Fork       map[string]string `yaml:"fork,flow,omitempty"`
+	Join       map[string]string `yaml:"join,flow,omitempty"`
+	If         []*yamlGuardRef   `yaml:"if,flow,omitempty"`
+	Unless     []*yamlGuardRef   `yaml:"unless,flow,omitempty"`
+	Assign     []*yamlAssignRef  `yaml:"assign,flow,omitempty"`
+	Do         []*yamlFuncRef    `yaml:"do,flow,omitempty"`
+}
+
+type yamlTransitionCallback struct {
+	From        []string       `yaml:"from,flow,omitempty"`
+	ExceptFrom  []string       `yaml:"except_from,flow,omitempty"`
+	To          []string       `yaml:"to,flow,omitempty"`
+	ExceptTo    []string       `yaml:"except_to,flow,omitempty"`
+	Do          []*yamlFuncRef `yaml:"do,flow,omitempty"`
+	ExitToState string         `yaml:"exit_to_state,omitempty"`
+}
+
+type yamlEventCallback struct {
+	On       []string       `yaml:"on,flow,omitempty"`
+	ExceptOn []string       `yaml:"except_on,flow,omitempty"`
+	Do       []*yamlFuncRef `yaml:"do,flow,omitempty"`
+}
+
+// yamlFuncRef refers to a registered func, either by its name alone, or as
+// a mapping with `func` and `label` keys.
+type yamlFuncRef struct {
+	Func  string `yaml:"func"`
+	Label string `yaml:"label,omitempty"`
+}
+
+func (ref *yamlFuncRef) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&ref.Func)
+	}
+	type plain yamlFuncRef
+	if err := decodeYAMLNode(node, (*plain)(ref)); err != nil {
+		return err
+	}
+	if ref.Func == "" {
+		return fmt.Errorf("line %d: func reference is missing the func key", node.Line)
+	}
+	return nil
+}
+
+func (ref *yamlFuncRef) MarshalYAML() (interface{}, error) {
+	if ref.Label == "" {
+		return ref.Func, nil
+	}
+	type plain yamlFuncRef
+	return (*plain)(ref), nil
+}
+
+// yamlGuardRef refers to a registered guard func as yamlFuncRef does, is a
+// guard expression, either as a string which isn't a func name or as a
+// mapping with an `expr` key, or combines guards, as a mapping with an
+// `all`, `any` or `not` key. Mappings have an optional `label` key.
+type yamlGuardRef struct {
+	Func  string          `yaml:"func,omitempty"`
+	Expr  string          `yaml:"expr,omitempty"`
+	All   []*yamlGuardRef `yaml:"all,flow,omitempty"`
+	Any   []*yamlGuardRef `yaml:"any,flow,omitempty"`
+	Not   *yamlGuardRef   `yaml:"not,omitempty"`
+	Label string          `yaml:"label,omitempty"`
+}
+
+func (ref *yamlGuardRef) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if err := node.Decode(&ref.Func); err != nil {
+			return err
+		}
+		if !isFuncName(ref.Func) {
+			ref.Func, ref.Expr = "", ref.Func
+		}
+		return nil
+	}
+	type plain yamlGuardRef
+	if err := decodeYAMLNode(node, (*plain)(ref)); err != nil {
+		return err
+	}
+
+	keys := 0
+	for _, set := range []bool{ref.Func != "", ref.Expr != "", len(ref.All) != 0, len(ref.Any) != 0, ref.Not != nil} {
+		if set {
+			keys++
+		}
+	}
+	if keys != 1 {
+		return fmt.Errorf("line %d: guard reference must have exactly one of the func, expr, all, any and not keys", node.Line)
+	}
+	return nil
+}
+
+func (ref *yamlGuardRef) MarshalYAML() (interface{}, error) {
+	switch {
+	case ref.Label == "" && ref.Func != "":
+		return ref.Func, nil
+	case ref.Label == "" && ref.Expr != "" && !isFuncName(ref.Expr):
+		return ref.Expr, nil
+	}
+	type plain yamlGuardRef
+	return (*plain)(ref), nil
+}
+
+// yamlAssignRef refers to a registered assign func as yamlFuncRef does, or
+// is an assign expression, as a mapping with `var` and `expr` keys.
+type yamlAssignRef struct {
+	Func  string `yaml:"func,omitempty"`
+	Var   string `yaml:"var,omitempty"`
+	Expr  string `yaml:"expr,omitempty"`
+	Label string `yaml:"label,omitempty"`
+}
+
+func (ref *yamlAssignRef) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&ref.Func)
+	}
+	type plain yamlAssignRef
+	if err := decodeYAMLNode(node, (*plain)(ref)); err != nil {
+		return err
+	}
+	if (ref.Func != "") == (ref.Var != "" || ref.Expr != "") {
+		return fmt.Errorf("line %d: assign action must have either the func key, or the var and expr keys", node.Line)
+	}
+	return nil
+}
+
+func (ref *yamlAssignRef) MarshalYAML() (interface{}, error) {
+	if ref.Label == "" && ref.Func != "" {
+		return ref.Func, nil
+	}
+	type plain yamlAssignRef
+	return (*plain)(ref), nil
+}
+
+// decodeYAMLNode decodes node into v like node.Decode, but fails on unknown
+// keys, as LoadYAML does. Unlike the decoder of LoadYAML, node.Decode
+// accepts them, within v and the values it decodes in turn.
+func decodeYAMLNode(node *yaml.Node, v interface{}) error {
+	if err := assertKnownYAMLKeys(node, reflect.TypeOf(v)); err != nil {
+		return err
+	}
+	return node.Decode(v)
+}
+
+// assertKnownYAMLKeys returns an error for the first key of the mappings
+// within node which is not a field of the struct of type t that they decode
+// into. Values which decode themselves are skipped, as they check their own
+// keys.
+func assertKnownYAMLKeys(node *yaml.Node, t reflect.Type) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.ScalarNode || reflect.PtrTo(t).Implements(reflect.TypeOf(new(yaml.Unmarshaler)).Elem()) {
+		return nil
+	}
+
+	switch {
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := assertKnownYAMLKeys(item, t.Elem()); err != nil {
+				return err
+			}
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := assertKnownYAMLKeys(node.Content[i], t.Elem()); err != nil {
+				return err
+			}
+		}
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := make(map[string]reflect.Type, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			fields[name] = t.Field(i).Type
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				return fmt.Errorf("line %d: field %s not found in type %s", key.Line, key.Value, t)
+			}
+			if err := assertKnownYAMLKeys(node.Content[i+1], fieldType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// yamlContext returns the context as a map, through JSON, as LoadJSON
+// would decode it.
+func yamlContext(context interface{}) map[string]interface{} {
+	if context == nil {
+		return nil
+	}
+	b, err := json.Marshal(context)
+	if err != nil {
+		return nil
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal(b, &vars); err != nil {
+		return nil
+	}
+	return vars
+}
+
+// yamlDuration is a time.Duration written as a string, such as "1s".
+type yamlDuration time.Duration
+
+func (d *yamlDuration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("line %d: %s", node.Line, err)
+	}
+	*d = yamlDuration(duration)
+	return nil
+}
+
+func (d yamlDuration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d yamlDuration) IsZero() bool {
+	return d == 0
+}
+
+func (doc *yamlMachine) machineDef() *MachineDef {
+	def := NewMachineDef()
+	def.ID = doc.ID
+	def.States = doc.States
+	def.InitialState = doc.InitialState
+	def.FinalStates = doc.FinalStates
+	if doc.Context != nil {
+		def.Context = yamlContext(doc.Context)
+	}
+
+	for event, eventDoc := range doc.Events {
+		def.AddEvent(event, eventDoc.eventDef())
+	}
+
+	for _, transitionDoc := range doc.Always {
+		def.AddAlways(transitionDoc.transitionDef())
+	}
+	for event, states := range doc.Defer {
+		def.SetDeferred(event, states...)
+	}
+	for _, invokeDoc := range doc.Invoke {
+		invokeDef := &InvokeDef{ID: invokeDoc.ID, State: invokeDoc.State, RegisteredFunc: invokeDoc.Src}
+		if invokeDef.ID == "" {
+			invokeDef.ID = invokeDef.State
+		}
+		def.AddInvoke(invokeDef)
+	}
+
+	for state, submachineDocs := range doc.Submachines {
+		for _, submachineDoc := range submachineDocs {
+			def.SetSubmachine(state, submachineDoc.machineDef())
+		}
+	}
+
+	for _, callbackDoc := range doc.Before {
+		def.AddBeforeCallback(callbackDoc.transitionCallbackDef())
+	}
+	for _, callbackDoc := range doc.Around {
+		def.AddAroundCallback(callbackDoc.transitionCallbackDef())
+	}
+	for _, callbackDoc := range doc.After {
+		def.AddAfterCallback(callbackDoc.transitionCallbackDef())
+	}
+
+	for _, callbackDoc := range doc.BeforeEvent {
+		def.AddBeforeEventCallback(callbackDoc.eventCallbackDef())
+	}
+	for _, callbackDoc := range doc.AfterEvent {
+		def.AddAfterEventCallback(callbackDoc.eventCallbackDef())
+	}
+	for _, callbackDoc := range doc.Failure {
+		def.AddFailureCallback(callbackDoc.eventCallbackDef())
+	}
+
+	return def
+}
+
+func (doc *yamlTransition) transitionDef() *TransitionDef {
+	def := &TransitionDef{
+		From:       doc.From,
+		ExceptFrom: doc.ExceptFrom,
+		To:         doc.To,
+		History:    History(doc.History),
+		Fork:       doc.Fork,
+		Join:       doc.Join,
+	}
+	for _, ref := range doc.If {
+		def.IfGuards = append(def.IfGuards, ref.guardDef())
+	}
+	for _, ref := range doc.Unless {
+		def.UnlessGuards = append(def.UnlessGuards, ref.guardDef())
+	}
+	for _, ref := range doc.Assign {
+		def.Assigns = append(def.Assigns, &ContextAssignDef{
+			RegisteredFunc: ref.Func,
+			Var:            ref.Var,
+			Expr:           ref.Expr,
+			Label:          ref.Label,
+		})
+	}
+	for _, ref := range doc.Do {
+		def.Do = append(def.Do, &TransitionCallbackFuncDef{RegisteredFunc: ref.Func, Label: ref.Label})
+	}
+	return def
+}
+
+func (doc *yamlEvent) eventDef() *EventDef {
+	def := &EventDef{}
+	if doc == nil {
+		return def
+	}
+
+	def.SetEvery(time.Duration(doc.TimedEvery))
+
+	for _, transitionDoc := range doc.Transitions {
+		def.AddTransition(transitionDoc.transitionDef())
+	}
+
+	if choiceDoc := doc.Choice; choiceDoc != nil {
+		choiceDef := &ChoiceDef{}
+		if choiceDoc.Condition != nil {
+			choiceDef.Condition = &ChoiceConditionDef{
+				RegisteredFunc: choiceDoc.Condition.Func,
+				Expr:           choiceDoc.Condition.Expr,
+				Label:          choiceDoc.Condition.Label,
+			}
+		}
+		if choiceDoc.Unless != nil {
+			choiceDef.UnlessGuard = choiceDoc.Unless.guardDef()
+		}
+		if choiceDoc.OnTrue != nil {
+			choiceDef.OnTrue = choiceDoc.OnTrue.eventDef()
+		}
+		if choiceDoc.OnFalse != nil {
+			choiceDef.OnFalse = choiceDoc.OnFalse.eventDef()
+		}
+		def.SetChoice(choiceDef)
+	}
+
+	return def
+}
+
+func (doc *yamlEventCallback) eventCallbackDef() *EventCallbackDef {
+	def := &EventCallbackDef{On: doc.On, ExceptOn: doc.ExceptOn}
+	for _, ref := range doc.Do {
+		def.Do = append(def.Do, &EventCallbackFuncDef{RegisteredFunc: ref.Func})
+	}
+	return def
+}
+
+func (doc *yamlTransitionCallback) transitionCallbackDef() *TransitionCallbackDef {
+	def := &TransitionCallbackDef{
+		From:        doc.From,
+		ExceptFrom:  doc.ExceptFrom,
+		To:          doc.To,
+		ExceptTo:    doc.ExceptTo,
+		ExitToState: doc.ExitToState,
+	}
+	for _, ref := range doc.Do {
+		def.Do = append(def.Do, &TransitionCallbackFuncDef{RegisteredFunc: ref.Func, Label: ref.Label})
+	}
+	return def
+}
+
+func (ref *yamlGuardRef) guardDef() *TransitionGuardDef {
+	def := &TransitionGuardDef{RegisteredFunc: ref.Func, Expr: ref.Expr, Label: ref.Label}
+	for _, childRef := range ref.All {
+		def.All = append(def.All, childRef.guardDef())
+	}
+	for _, childRef := range ref.Any {
+		def.Any = append(def.Any, childRef.guardDef())
+	}
+	if ref.Not != nil {
+		def.Not = ref.Not.guardDef()
+	}
+	return def
+}
+
+func newYAMLMachine(def *MachineDef) *yamlMachine {
+	doc := &yamlMachine{
+		ID:           def.ID,
+		States:       def.States,
+		InitialState: def.InitialState,
+		FinalStates:  def.FinalStates,
+		Context:      yamlContext(def.Context),
+	}
+
+	if len(def.Events) > 0 {
+		doc.Events = map[string]*yamlEvent{}
+		for event, eventDef := range def.Events {
+			doc.Events[event] = newYAMLEvent(eventDef)
+		}
+	}
+
+	for _, transitionDef := range def.Always {
+		doc.Always = append(doc.Always, newYAMLTransition(transitionDef))
+	}
+	doc.Defer = def.Deferred
+	for _, invokeDef := range def.Invokes {
+		invokeDoc := &yamlInvoke{State: invokeDef.State, Src: invokeDef.RegisteredFunc}
+		if invokeDef.ID != invokeDef.State {
+			invokeDoc.ID = invokeDef.ID
+		}
+		doc.Invoke = append(doc.Invoke, invokeDoc)
+	}
+
+	if len(def.Submachines) > 0 {
+		doc.Submachines = map[string][]*yamlMachine{}
+		for state, submachineDefs := range def.Submachines {
+			for _, submachineDef := range submachineDefs {
+				doc.Submachines[state] = append(doc.Submachines[state], newYAMLMachine(submachineDef))
+			}
+		}
+	}
+
+	doc.Before = newYAMLTransitionCallbacks(def.BeforeCallbacks)
+	doc.Around = newYAMLTransitionCallbacks(def.AroundCallbacks)
+	doc.After = newYAMLTransitionCallbacks(def.AfterCallbacks)
+
+	doc.BeforeEvent = newYAMLEventCallbacks(def.BeforeEventCallbacks)
+	doc.AfterEvent = newYAMLEventCallbacks(def.AfterEventCallbacks)
+	doc.Failure = newYAMLEventCallbacks(def.FailureCallbacks)
+
+	return doc
+}
+
+func newYAMLEvent(def *EventDef) *yamlEvent {
+	doc := &yamlEvent{TimedEvery: yamlDuration(def.TimedEvery)}
+
+	for _, transitionDef := range def.Transitions {
+		doc.Transitions = append(doc.Transitions, newYAMLTransition(transitionDef))
+	}
+
+	if choiceDef := def.Choice; choiceDef != nil {
+		choiceDoc := &yamlChoice{}
+		if conditionDef := choiceDef.Condition; conditionDef != nil && (conditionDef.RegisteredFunc != "" || conditionDef.Expr != "") {
+			choiceDoc.Condition = &yamlGuardRef{Func: conditionDef.RegisteredFunc, Expr: conditionDef.Expr, Label: conditionDef.Label}
+		}
+		if refs := newYAMLGuardRefs([]*TransitionGuardDef{choiceDef.UnlessGuard}); len(refs) > 0 {
+			choiceDoc.Unless = refs[0]
+		}
+		if choiceDef.OnTrue != nil {
+			choiceDoc.OnTrue = newYAMLEvent(choiceDef.OnTrue)
+		}
+		if choiceDef.OnFalse != nil {
+			choiceDoc.OnFalse = newYAMLEvent(choiceDef.OnFalse)
+		}
+		doc.Choice = choiceDoc
+	}
+
+	return doc
+}
+
+func newYAMLTransition(def *TransitionDef) *yamlTransition {
+	doc := &yamlTransition{
+		From:       def.From,
+		ExceptFrom: def.ExceptFrom,
+		To:         def.To,
+		History:    string(def.History),
+		Fork:       def.Fork,
+		Join:       def.Join,
+		If:         newYAMLGuardRefs(def.IfGuards),
+		Unless:     newYAMLGuardRefs(def.UnlessGuards),
+		Assign:     newYAMLAssignRefs(def.Assigns),
+	}
+	for _, funcDef := range def.Do {
+		if funcDef.RegisteredFunc != "" {
+			doc.Do = append(doc.Do, &yamlFuncRef{Func: funcDef.RegisteredFunc, Label: funcDef.Label})
+		}
+	}
+	return doc
+}
+
+// newYAMLGuardRefs returns references to the guards. Guards which refer to
+// funcs without a registered func name are omitted.
+func newYAMLGuardRefs(guardDefs []*TransitionGuardDef) []*yamlGuardRef {
+	var refs []*yamlGuardRef
+	for _, guardDef := range guardDefs {
+		if ref, ok := newYAMLGuardRef(guardDef); ok {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// newYAMLAssignRefs returns references to the assign actions. Actions which
+// refer to funcs without a registered func name are omitted.
+func newYAMLAssignRefs(assignDefs []*ContextAssignDef) []*yamlAssignRef {
+	var refs []*yamlAssignRef
+	for _, assignDef := range assignDefs {
+		if assignDef.RegisteredFunc != "" || assignDef.Expr != "" {
+			refs = append(refs, &yamlAssignRef{
+				Func:  assignDef.RegisteredFunc,
+				Var:   assignDef.Var,
+				Expr:  assignDef.Expr,
+				Label: assignDef.Label,
+			})
+		}
+	}
+	return refs
+}
+
+func newYAMLGuardRef(guardDef *TransitionGuardDef) (*yamlGuardRef, bool) {
+	if guardDef == nil {
+		return nil, false
+	}
+	if !guardDef.IsCombined() {
+		ref := &yamlGuardRef{Func: guardDef.RegisteredFunc, Expr: guardDef.Expr, Label: guardDef.Label}
+		return ref, guardDef.RegisteredFunc != "" || guardDef.Expr != ""
+	}
+
+	ref := &yamlGuardRef{Label: guardDef.Label}
+	for _, childDef := range guardDef.All {
+		childRef, ok := newYAMLGuardRef(childDef)
+		if !ok {
+			return nil, false
+		}
+		ref.All = append(ref.All, childRef)
+	}
+	for _, childDef := range guardDef.Any {
+		childRef, ok := newYAMLGuardRef(childDef)
+		if !ok {
+			return nil, false
+		}
+		ref.Any = append(ref.Any, childRef)
+	}
+	if guardDef.Not != nil {
+		var ok bool
+		if ref.Not, ok = newYAMLGuardRef(guardDef.Not); !ok {
+			return nil, false
+		}
+	}
+	return ref, true
+}
+
+func newYAMLEventCallbacks(callbackDefs []*EventCallbackDef) []*yamlEventCallback {
+	var docs []*yamlEventCallback
+	for _, callbackDef := range callbackDefs {
+		callbackDoc := &yamlEventCallback{On: callbackDef.On, ExceptOn: callbackDef.ExceptOn}
+		for _, funcDef := range callbackDef.Do {
+			if funcDef.RegisteredFunc != "" {
+				callbackDoc.Do = append(callbackDoc.Do, &yamlFuncRef{Func: funcDef.RegisteredFunc})
+			}
+		}
+		docs = append(docs, callbackDoc)
+	}
+	return docs
+}
+
+func newYAMLTransitionCallbacks(callbackDefs []*TransitionCallbackDef) []*yamlTransitionCallback {
+	var docs []*yamlTransitionCallback
+	for _, callbackDef := range callbackDefs {
+		callbackDoc := &yamlTransitionCallback{
+			From:        callbackDef.From,
+			ExceptFrom:  callbackDef.ExceptFrom,
+			To:          callbackDef.To,
+			ExceptTo:    callbackDef.ExceptTo,
+			ExitToState: callbackDef.ExitToState,
+		}
+		for _, funcDef := range callbackDef.Do {
+			if funcDef.RegisteredFunc != "" {
+				callbackDoc.Do = append(callbackDoc.Do, &yamlFuncRef{Func: funcDef.RegisteredFunc, Label: funcDef.Label})
+			}
+		}
+		docs = append(docs, callbackDoc)
+	}
+	return docs
+}
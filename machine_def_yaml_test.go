@@ -0,0 +1,143 @@
+package statemachine_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+func loadGoldenDefs(t *testing.T) map[string]*statemachine.MachineDef {
+	defs := map[string]*statemachine.MachineDef{}
+	loaders := map[string]func(b []byte) (*statemachine.MachineDef, error){
+		"testdata/cognizant.yaml": statemachine.LoadYAML,
+		"testdata/cognizant.json": statemachine.LoadJSON,
+		"testdata/cognizant.hcl": func(b []byte) (*statemachine.MachineDef, error) {
+			return statemachine.LoadHCL("testdata/cognizant.hcl", b)
+		},
+	}
+	for filename, load := range loaders {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		def, err := load(b)
+		if err != nil {
+			t.Fatalf("%s: %s", filename, err)
+		}
+		defs[filename] = def
+	}
+	return defs
+}
+
+func TestGoldenDefsAreEquivalent(t *testing.T) {
+	defs := loadGoldenDefs(t)
+
+	want, err := json.Marshal(defs["testdata/cognizant.json"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for filename, def := range defs {
+		got, err := json.Marshal(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is not equivalent to testdata/cognizant.json:\n%s\n%s", filename, got, want)
+		}
+	}
+}
+
+func TestGoldenDefsRoundTrip(t *testing.T) {
+	def := loadGoldenDefs(t)["testdata/cognizant.json"]
+
+	golden := func(filename string) []byte {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	y, err := statemachine.MarshalYAML(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := golden("testdata/cognizant.yaml"); !bytes.Equal(y, want) {
+		t.Errorf("MarshalYAML output differs from golden file:\n%s", y)
+	}
+
+	var h bytes.Buffer
+	if err := statemachine.WriteHCL(&h, def); err != nil {
+		t.Fatal(err)
+	}
+	if want := golden("testdata/cognizant.hcl"); !bytes.Equal(h.Bytes(), want) {
+		t.Errorf("WriteHCL output differs from golden file:\n%s", h.Bytes())
+	}
+}
+
+func TestMarshalYAML_UnregisteredFuncs(t *testing.T) {
+	machineDef := &statemachine.MachineDef{
+		States:       []string{"locked", "unlocked"},
+		InitialState: "locked",
+		Events: map[string]*statemachine.EventDef{
+			"coin": {
+				Transitions: []*statemachine.TransitionDef{
+					{
+						From:     []string{"locked"},
+						To:       "unlocked",
+						IfGuards: []*statemachine.TransitionGuardDef{{Guard: func() bool { return true }}},
+					},
+				},
+			},
+		},
+	}
+
+	want := "event 'coin': if guard: func has no registered name"
+	if _, err := statemachine.MarshalYAML(machineDef); err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestLoadYAML_UnknownKeys(t *testing.T) {
+	docs := map[string]string{
+		"exit_into": `
+states: [stopped, running]
+initial_state: stopped
+after_transition:
+  - to: [running]
+    exit_into: stopped
+`,
+		"labl": `
+states: [stopped, running]
+initial_state: stopped
+events:
+  start:
+    transitions:
+      - from: [stopped]
+        to: running
+        if: [{func: can-start, labl: canStart}]
+`,
+		"form": `
+states: [stopped, running]
+initial_state: stopped
+events:
+  start:
+    choice:
+      condition: can-start
+      on_true:
+        transitions:
+          - form: [stopped]
+            to: running
+`,
+	}
+	for key, doc := range docs {
+		_, err := statemachine.LoadYAML([]byte(doc))
+		if err == nil || !strings.Contains(err.Error(), "field "+key+" not found") {
+			t.Errorf("got error %v, want unknown field %s", err, key)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package statemachine
+
+import (
+	"context"
+	"errors"
+)
+
+// DeferredEvent is an event which was fired in a state that defers it, and
+// which is queued until the machine is in a state that doesn't.
+type DeferredEvent struct {
+	Event string
+
+	// Payload is passed to the event when it is fired again. Payloads of a
+	// restored snapshot are as decoded from it, e.g. from JSON.
+	Payload []interface{} `json:",omitempty"`
+}
+
+// Deferred implements Machine. Like GetState, it may be called from the
+// callbacks of a transition.
+func (m *machineImpl) Deferred() []DeferredEvent {
+	return copyDeferred(m.deferred)
+}
+
+// deferEvent queues event, which failed with err in state, if state defers
+// it, and reports whether it did. Only events without a transition, or whose
+// transitions aren't allowed, are deferred.
+func (m *machineImpl) deferEvent(event string, state string, err error, payload []interface{}) bool {
+	if !errors.Is(err, ErrNoMatchingTransition) && !errors.Is(err, ErrTransitionNotAllowed) {
+		return false
+	}
+	if !m.def.IsDeferred(event, state) {
+		return false
+	}
+	m.deferred = append(m.deferred, DeferredEvent{
+		Event:   event,
+		Payload: append([]interface{}(nil), payload...),
+	})
+	return true
+}
+
+// redispatch fires the queued events which the current state doesn't defer,
+// in order, and reports whether any of them transitioned the machine. Events
+// which fail are dropped, after the failure callbacks.
+func (m *machineImpl) redispatch() bool {
+	redispatched := false
+	for {
+		deferred, ok := m.nextDeferred()
+		if !ok {
+			return redispatched
+		}
+		// the context of the event's original call may have ended since.
+		if err := m.FireContext(context.Background(), deferred.Event, deferred.Payload...); err == nil {
+			redispatched = true
+		}
+	}
+}
+
+// nextDeferred removes the first queued event which the current state
+// doesn't defer from the queue, and returns it.
+func (m *machineImpl) nextDeferred() (DeferredEvent, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.isExited() {
+		return DeferredEvent{}, false
+	}
+	for i, deferred := range m.deferred {
+		if !m.def.IsDeferred(deferred.Event, m.currentState) {
+			m.deferred = append(m.deferred[:i:i], m.deferred[i+1:]...)
+			return deferred, true
+		}
+	}
+	return DeferredEvent{}, false
+}
+
+func copyDeferred(deferred []DeferredEvent) []DeferredEvent {
+	if len(deferred) == 0 {
+		return nil
+	}
+	return append([]DeferredEvent(nil), deferred...)
+}
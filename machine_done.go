@@ -0,0 +1,104 @@
+package statemachine
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// DoneEvent returns the name of the completion event which is fired on a
+// machine when all of the submachines of its state are in a final state
+// (see MachineBuilder.FinalStates), e.g. `done.running`. The event is only
+// fired if the machine defines it.
+func DoneEvent(state string) string {
+	return "done." + state
+}
+
+// Done implements Machine.
+func (m *machineImpl) Done() <-chan struct{} {
+	return m.done
+}
+
+// enteredState closes the done channel of the machine once it enters one of
+// its final states.
+func (m *machineImpl) enteredState(state string) {
+	if m.done != nil && m.def.IsFinalState(state) {
+		m.doneOnce.Do(func() { close(m.done) })
+	}
+}
+
+func (m *machineImpl) isExited() bool {
+	return atomic.LoadInt32(&m.exited) == 1
+}
+
+func (m *machineImpl) setExited() {
+	atomic.StoreInt32(&m.exited, 1)
+}
+
+// completeSubmachine fires the completion event of the current state once
+// submachine, and each of its parallel siblings, is in a final state.
+func (m *machineImpl) completeSubmachine(ctx context.Context, submachine *machineImpl) {
+	state := m.currentState
+	submachines := m.submachines[state]
+
+	active := false
+	for _, sibling := range submachines {
+		if sibling == submachine {
+			active = true
+			continue
+		}
+		sibling.mutex.RLock()
+		final := sibling.def.IsFinalState(sibling.currentState)
+		sibling.mutex.RUnlock()
+		if !final {
+			return
+		}
+	}
+	if !active {
+		return
+	}
+
+	event := DoneEvent(state)
+	if _, ok := m.def.Events[event]; ok {
+		_ = m.FireContext(ctx, event)
+	}
+}
+
+// completeEntered fires the completion events of the states which the machine
+// and its submachines have entered, innermost first, whose submachines are
+// all in a final state already. This is the case when they are forked or
+// restored into final states, or settle into them, without an event of
+// their own to complete them.
+func (m *machineImpl) completeEntered(ctx context.Context) {
+	m.mutex.Lock()
+	entered := m.entered
+	m.entered = false
+	state := m.currentState
+	submachines := append([]*machineImpl(nil), m.submachines[state]...)
+	m.mutex.Unlock()
+
+	states := make([]string, len(submachines))
+	for i, submachine := range submachines {
+		states[i] = submachine.GetState()
+		submachine.completeEntered(ctx)
+	}
+	if !entered || len(submachines) == 0 || m.isExited() || m.GetState() != state {
+		return
+	}
+
+	for i, submachine := range submachines {
+		submachine.mutex.RLock()
+		final := submachine.def.IsFinalState(submachine.currentState)
+		moved := submachine.currentState != states[i]
+		submachine.mutex.RUnlock()
+		// a submachine which moved has completed the state on its own, by
+		// the completion event of its own state.
+		if !final || moved {
+			return
+		}
+	}
+
+	event := DoneEvent(state)
+	if _, ok := m.def.Events[event]; ok {
+		_ = m.FireContext(ctx, event)
+	}
+}
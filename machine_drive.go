@@ -0,0 +1,62 @@
+package statemachine
+
+import (
+	"context"
+	"errors"
+)
+
+// DriveTo implements Machine.
+func (m *machineImpl) DriveTo(ctx context.Context, target string) error {
+	p := &planner{blocked: map[string]bool{}}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		steps, err := p.plan(m.def, nil, splitStatePath(m.statePath()), splitStatePath(target))
+		if err != nil {
+			return err
+		}
+		if len(steps) == 0 {
+			return nil
+		}
+
+		step := steps[0]
+		machine := m
+		if len(step.idPath) > 0 {
+			submachine, err := m.Submachine(step.idPath...)
+			if err != nil {
+				return err
+			}
+			machine = submachine.(*machineImpl)
+		}
+
+		// a step which the state defers is rejected rather than queued, or
+		// it would be replanned and fired again forever.
+		switch err := machine.fire(context.Background(), step.event, fireOptions{noDefer: true}, nil); {
+		case err == nil:
+			if machine.currentState != step.to {
+				// the step led elsewhere, e.g. by the transition after a
+				// failed guard, so plan around it from where it led.
+				p.blocked[step.key()] = true
+			}
+		case errors.Is(err, ErrNoMatchingTransition), errors.Is(err, ErrTransitionNotAllowed):
+			// a guard rejected the step, so plan around it.
+			p.blocked[step.key()] = true
+		default:
+			return err
+		}
+	}
+}
+
+// statePath returns the current state, followed by the current states of
+// the submachines, separated by "/". Parallel submachines are left out.
+func (m *machineImpl) statePath() string {
+	path := m.currentState
+	if submachines := m.submachines[m.currentState]; len(submachines) == 1 {
+		if subPath := submachines[0].statePath(); subPath != "" {
+			path += "/" + subPath
+		}
+	}
+	return path
+}
@@ -17,11 +17,48 @@ type machineImpl struct {
 	previousState string
 	currentState  string
 
+	// entered is set when the machine enters a state, until the completion
+	// of its submachines is checked (see completeEntered).
+	entered bool
+
+	// invokesPending is set when the machine enters a state, until the
+	// services of the state are invoked (see startEnteredInvokes).
+	invokesPending bool
+
 	supermachine *machineImpl
 	submachines  map[string][]*machineImpl
 
-	mutex     sync.RWMutex
-	hasExited bool
+	mutex sync.RWMutex
+
+	// exited is set, atomically, once the machine is a submachine whose
+	// supermachine has left its state.
+	exited int32
+
+	done     chan struct{}
+	doneOnce sync.Once
+
+	// history holds the states of the submachines of the states which the
+	// machine has left, by state and submachine ID.
+	history map[string]map[string]*Snapshot
+
+	// deferred queues the events which were deferred by the states they were
+	// fired in, in the order they were fired.
+	deferred []DeferredEvent
+
+	// clock and sends are guarded by their own mutex, so that events may be
+	// sent from the callbacks of a transition.
+	clock     Clock
+	sends     map[string]*delayedSend
+	sendMutex sync.Mutex
+
+	// invokes cancels the services invoked by the current state.
+	invokes     []context.CancelFunc
+	invokeMutex sync.Mutex
+
+	// context is guarded by its own mutex, so that it may be read by the
+	// callbacks of a transition.
+	context      interface{}
+	contextMutex sync.RWMutex
 
 	ctxTimedEvents  context.Context
 	stopTimedEvents context.CancelFunc
@@ -34,6 +71,7 @@ func NewMachine() Machine {
 	return &machineImpl{
 		def:             NewMachineDef(),
 		submachines:     map[string][]*machineImpl{},
+		done:            make(chan struct{}),
 		ctxTimedEvents:  ctxTimedEvents,
 		stopTimedEvents: stopTimedEvents,
 	}
@@ -55,32 +93,53 @@ func (m *machineImpl) Build(machineBuilderFn func(machineBuilder MachineBuilder)
 
 // SetMachineDef implements MachineBuildable.
 func (m *machineImpl) SetMachineDef(def *MachineDef) {
+	m.setMachineDef(def)
+	// submachines are completed by the supermachine, along with its state.
+	if m.supermachine == nil {
+		m.completeEntered(context.Background())
+	}
+}
+
+func (m *machineImpl) setMachineDef(def *MachineDef) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	// b, _ := json.MarshalIndent(def, "", "  ")
-	// // b, _ := hclencoder.Encode(def)
-	// fmt.Printf("machine def = %s\n", string(b))
+	if err := def.resolveOnce(); err != nil {
+		panic(err)
+	}
 
 	m.def = def
+	m.setContext(copyContext(def.Context))
 	if err := m.setCurrentState(m.def.InitialState); err != nil {
 		panic(err)
 	}
+	// submachines are settled by the supermachine, once it has restored
+	// their history, if any.
+	if m.supermachine == nil {
+		if err := m.settleEntered(); err != nil {
+			panic(err)
+		}
+		m.startEnteredInvokes()
+	}
 	m.restartTimedEventsLoops()
 }
 
 func (m *machineImpl) restartTimedEventsLoops() {
+	ctxTimedEvents := m.ctxTimedEvents
 	for event, eventDef := range m.def.Events {
 		if eventDef.TimedEvery > 0 {
 			go func(event string, timedEvery time.Duration) {
 				// fmt.Printf("event=%s timed_every=%d\n", event, timedEvery)
 				for {
+					due := make(chan struct{})
+					timer := m.getClock().AfterFunc(timedEvery, func() { close(due) })
 					select {
-					case <-time.After(timedEvery):
+					case <-due:
 						// fmt.Printf("firing timed event '%s'\n", event)
 						_ = m.Fire(event)
-					case <-m.ctxTimedEvents.Done():
+					case <-ctxTimedEvents.Done():
 						// fmt.Printf("stopping timed event '%s'\n", event)
+						timer.Stop()
 						return
 					}
 				}
@@ -113,10 +172,31 @@ func (m *machineImpl) GetState() string {
 
 // SetCurrentState implements Machine.
 func (m *machineImpl) SetCurrentState(state interface{}) error {
+	return m.overrideState(state, nil)
+}
+
+// overrideState sets the state like SetCurrentState. It does nothing if
+// invocation is done (see fireOptions).
+func (m *machineImpl) overrideState(state interface{}, invocation context.Context) error {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	if invocation != nil && invocation.Err() != nil {
+		m.mutex.Unlock()
+		return nil
+	}
+	err := m.setCurrentState(state)
+	if err == nil {
+		err = m.settleEntered()
+	}
+	if err == nil {
+		m.startEnteredInvokes()
+	}
+	m.mutex.Unlock()
+	if err != nil {
+		return err
+	}
 
-	return m.setCurrentState(state)
+	m.completeEntered(context.Background())
+	return nil
 }
 
 // IsState implements Machine.
@@ -126,23 +206,60 @@ func (m *machineImpl) IsState(state string) bool {
 
 // Send implements Machine.
 func (m *machineImpl) Send(signal Message) error {
+	return m.send(signal, nil)
+}
+
+// send sends signal like Send. It does nothing if invocation is done (see
+// fireOptions).
+func (m *machineImpl) send(signal Message, invocation context.Context) error {
 	switch signal.(type) {
 	case TriggerEvent:
-		return m.Fire(signal.(TriggerEvent).Event)
+		return m.fire(context.Background(), signal.(TriggerEvent).Event, fireOptions{invocation: invocation}, nil)
 	case OverrideState:
-		return m.SetCurrentState(signal.(OverrideState).State)
+		return m.overrideState(signal.(OverrideState).State, invocation)
 	}
 	return errors.New("no such signal")
 }
 
 // Fire implements Machine.
-func (m *machineImpl) Fire(event string) (err error) {
+func (m *machineImpl) Fire(event string) error {
+	return m.FireContext(context.Background(), event)
+}
+
+// FireContext implements Machine.
+func (m *machineImpl) FireContext(ctx context.Context, event string, payload ...interface{}) error {
+	return m.fire(ctx, event, fireOptions{}, payload)
+}
+
+// fireOptions change how fire fires an event.
+type fireOptions struct {
+	// noDefer fails an event which the current state defers, as if it
+	// didn't.
+	noDefer bool
+
+	// invocation is the context of the invoked service which fires the
+	// event, if any. The event is dropped if it's done, i.e. if the state
+	// which invoked the service has been exited. This is checked under the
+	// lock of the machine, which the state is exited under, so that a state
+	// entered since never gets the event.
+	invocation context.Context
+}
+
+// fire fires event like FireContext.
+func (m *machineImpl) fire(ctx context.Context, event string, opts fireOptions, payload []interface{}) (err error) {
 	m.mutex.Lock()
+	if opts.invocation != nil && opts.invocation.Err() != nil {
+		m.mutex.Unlock()
+		return nil
+	}
+	deferred := false
 	defer func() {
+		completed := err == nil && !deferred && m.supermachine != nil && m.def.IsFinalState(m.currentState)
 		if err != nil {
 			args := make(map[reflect.Type]interface{})
 			args[reflect.TypeOf(new(Event))] = &eventImpl{name: event}
 			args[reflect.TypeOf(new(error))] = err
+			m.setContextArgs(args, copyContext(m.getContext()))
 
 			for _, callbackDef := range m.def.FailureCallbacks {
 				if callbackDef.MatchesEvent(event) {
@@ -154,10 +271,23 @@ func (m *machineImpl) Fire(event string) (err error) {
 		}
 
 		m.mutex.Unlock()
-		if m.hasExited {
-			// TODO: should we wait for `<-m.stoppedTimedEvents`?
-			m.stopTimedEvents()
-			*m = machineImpl{}
+		if err != nil || deferred {
+			return
+		}
+		// the states entered by the transition, or by the transitions it
+		// exited to, may have completed submachines.
+		entered := m
+		for entered.isExited() && entered.supermachine != nil {
+			entered = entered.supermachine
+		}
+		entered.completeEntered(ctx)
+		if m.redispatch() {
+			// the redispatched events have completed the machine, if it's
+			// done.
+			return
+		}
+		if completed && !m.isExited() {
+			m.supermachine.completeSubmachine(ctx, m)
 		}
 	}()
 
@@ -165,80 +295,217 @@ func (m *machineImpl) Fire(event string) (err error) {
 		err = errors.New("state machine not initialized")
 		return
 	}
+	if m.isExited() {
+		err = errors.New("submachine not active")
+		return
+	}
 
 	// fmt.Printf("\n---\n🔁 %s\n", event)
 	// defer func() { fmt.Printf("=> %s\n---\n", m.GetState()) }()
 
 	fromState := m.GetState()
 
+	args := make(map[reflect.Type]interface{})
+	args[reflect.TypeOf(new(Machine))] = m
+	args[reflect.TypeOf(new(Event))] = &eventImpl{name: event}
+	args[reflect.TypeOf(new(context.Context))] = ctx
+	args[payloadArgsType] = payloadArgs(payload)
+	for _, value := range payload {
+		if value != nil {
+			args[reflect.PtrTo(reflect.TypeOf(value))] = value
+		}
+		if payloadErr, ok := value.(error); ok {
+			args[reflect.TypeOf(new(error))] = payloadErr
+		}
+	}
+
+	err = m.beforeEvent(event, args)
+	if err != nil {
+		return
+	}
+	m.setContextArgs(args, copyContext(m.getContext()))
+
 	var transition Transition
-	transition, err = m.findTransition(event, fromState)
+	transition, err = m.findTransition(event, fromState, args)
 	if err != nil {
+		if !opts.noDefer && m.deferEvent(event, fromState, err, payload) {
+			deferred = true
+			err = nil
+		}
 		return
 	}
 
-	err = m.applyTransition(transition)
+	var nextContext interface{}
+	nextContext, err = m.assign(transition, args)
+	if err != nil {
+		return
+	}
+
+	err = m.applyTransition(transition, nextContext, args)
+	if err != nil {
+		return
+	}
+
+	err = m.settle(args)
+	if err != nil {
+		return
+	}
+
+	m.afterEvent(event, transition, args)
 	return
 }
 
-func (m *machineImpl) findTransition(event string, fromState string) (transition Transition, err error) {
+// beforeEvent runs the BeforeEvent callbacks which match event, and returns
+// the error of the first one which vetoes it.
+func (m *machineImpl) beforeEvent(event string, args map[reflect.Type]interface{}) error {
+	for _, callbackDef := range m.def.BeforeEventCallbacks {
+		if !callbackDef.MatchesEvent(event) {
+			continue
+		}
+		for _, callback := range callbackDef.Do {
+			m.setContextArgs(args, copyContext(m.getContext()))
+			args[reflect.TypeOf(new(Machine))] = m
+			fn := dynafunc.NewDynamicFunc(callback.Func, args)
+			if err := fn.Call(); err != nil {
+				panic(err)
+			}
+			if len(fn.Out) == 1 && !fn.Out[0].IsNil() {
+				return fn.Out[0].Interface().(error)
+			}
+		}
+	}
+	return nil
+}
+
+// afterEvent runs the AfterEvent callbacks which match event, once it has
+// taken transition.
+func (m *machineImpl) afterEvent(event string, transition Transition, args map[reflect.Type]interface{}) {
+	args[reflect.TypeOf(new(Transition))] = transition
+	for _, callbackDef := range m.def.AfterEventCallbacks {
+		if !callbackDef.MatchesEvent(event) {
+			continue
+		}
+		for _, callback := range callbackDef.Do {
+			m.setContextArgs(args, copyContext(m.getContext()))
+			m.exec(callback.Func, args)
+		}
+	}
+}
+
+// assign runs the assign actions of transition on a copy of the context,
+// and returns it as the next context of the machine, or nil if the
+// transition has no assign actions.
+func (m *machineImpl) assign(transition Transition, args map[reflect.Type]interface{}) (interface{}, error) {
+	transitionImpl, ok := transition.(*transitionImpl)
+	if !ok || transitionImpl.def == nil || len(transitionImpl.def.Assigns) == 0 {
+		return nil, nil
+	}
+
+	args[reflect.TypeOf(new(Transition))] = transition
+	nextContext := copyContext(m.getContext())
+	m.setContextArgs(args, nextContext)
+	for _, assignDef := range transitionImpl.def.Assigns {
+		if err := assignDef.exec(nextContext, args); err != nil {
+			return nil, err
+		}
+	}
+	return nextContext, nil
+}
+
+// findTransition returns the transition of event from fromState. args are
+// passed to the guards and choice conditions of the event.
+func (m *machineImpl) findTransition(event string, fromState string, args map[reflect.Type]interface{}) (transition Transition, err error) {
 	eventDef, ok := m.def.Events[event]
 	if !ok {
 		err = errors.New("no such event")
 		return
 	}
 
-	transition, err = m.matchTransition(eventDef.Transitions, fromState)
-	if err == nil || eventDef.Choice == nil {
+	transition, err = m.matchTransition(eventDef.Transitions, fromState, args)
+	if err == nil || errors.Is(err, ErrMissingPayload) || eventDef.Choice == nil {
 		return
 	}
 
-	transition, err = m.findChoiceTransition(event, eventDef, fromState)
+	transition, err = m.findChoiceTransition(event, eventDef, fromState, args)
 	return
 }
 
-func (m *machineImpl) findChoiceTransition(event string, eventDef *EventDef, fromState string) (transition Transition, err error) {
-	args := make(map[reflect.Type]interface{})
-	args[reflect.TypeOf(new(Machine))] = m
-	args[reflect.TypeOf(new(Event))] = &eventImpl{name: event}
+func (m *machineImpl) findChoiceTransition(event string, eventDef *EventDef, fromState string, args map[reflect.Type]interface{}) (transition Transition, err error) {
+	// the state to transition to is not known yet.
+	args[reflect.TypeOf(new(Transition))] = newTransitionImpl(fromState, "")
 
 	if eventDef.Choice.UnlessGuard != nil {
-		if ok := execGuard(eventDef.Choice.UnlessGuard.Guard, args); ok {
+		var ok bool
+		if ok, err = eventDef.Choice.UnlessGuard.exec(args); err != nil {
+			return
+		}
+		if ok {
+			recordChoice(eventDef.Choice, func(choiceCoverage *ChoiceCoverage) {
+				choiceCoverage.Rejected++
+			})
 			err = ErrTransitionNotAllowed
 			return
 		}
 	}
 
-	if execChoice(eventDef.Choice.Condition.Condition, args) {
+	condition, err := eventDef.Choice.Condition.exec(args)
+	if err != nil {
+		return
+	}
+	recordChoice(eventDef.Choice, func(choiceCoverage *ChoiceCoverage) {
+		if condition {
+			choiceCoverage.OnTrue++
+		} else {
+			choiceCoverage.OnFalse++
+		}
+	})
+
+	if condition {
 		if eventDef.Choice.OnTrue.Choice != nil {
-			transition, err = m.findChoiceTransition(event, eventDef.Choice.OnTrue, fromState)
+			transition, err = m.findChoiceTransition(event, eventDef.Choice.OnTrue, fromState, args)
 			return
 		}
-		transition, err = m.matchTransition(eventDef.Choice.OnTrue.Transitions, fromState)
+		transition, err = m.matchTransition(eventDef.Choice.OnTrue.Transitions, fromState, args)
 		return
 	}
 
 	if eventDef.Choice.OnFalse.Choice != nil {
-		transition, err = m.findChoiceTransition(event, eventDef.Choice.OnFalse, fromState)
+		transition, err = m.findChoiceTransition(event, eventDef.Choice.OnFalse, fromState, args)
 		return
 	}
-	transition, err = m.matchTransition(eventDef.Choice.OnFalse.Transitions, fromState)
+	transition, err = m.matchTransition(eventDef.Choice.OnFalse.Transitions, fromState, args)
 	return
 }
 
-func (m *machineImpl) matchTransition(transitions []*TransitionDef, fromState string) (transition Transition, err error) {
+func (m *machineImpl) matchTransition(transitions []*TransitionDef, fromState string, args map[reflect.Type]interface{}) (transition Transition, err error) {
 	for _, transitionDef := range transitions {
 		matches := transitionDef.Matches(fromState)
 		if !matches {
 			err = ErrNoMatchingTransition
 			continue
 		}
-		if !transitionDef.IsAllowed(fromState, m) {
+		allowed, guardErr := transitionDef.isAllowed(fromState, args)
+		if guardErr != nil {
+			err = guardErr
+			return
+		}
+		if len(transitionDef.IfGuards) != 0 || len(transitionDef.UnlessGuards) != 0 || len(transitionDef.Join) != 0 {
+			recordTransition(transitionDef, func(transitionCoverage *TransitionCoverage) {
+				if allowed {
+					transitionCoverage.Allowed++
+				} else {
+					transitionCoverage.Rejected++
+				}
+			})
+		}
+		if !allowed {
 			err = ErrTransitionNotAllowed
 			continue
 		}
 
-		transition = newTransitionImpl(fromState, transitionDef.To)
+		transitionImpl := newTransitionImpl(fromState, transitionDef.To)
+		transitionImpl.def = transitionDef
+		transition = transitionImpl
 		err = nil
 
 		return
@@ -261,6 +528,23 @@ func (m *machineImpl) Submachine(idPath ...string) (Machine, error) {
 	return nil, errors.New("submachine not active")
 }
 
+// AvailableEvents implements Machine.
+func (m *machineImpl) AvailableEvents() []string {
+	var events []string
+	for _, event := range sortedEventNames(m.def.Events) {
+		if m.def.Events[event].hasTransitionFrom(m.currentState) {
+			events = append(events, event)
+		}
+	}
+
+	for _, submachine := range m.submachines[m.currentState] {
+		for _, event := range submachine.AvailableEvents() {
+			events = append(events, submachine.def.ID+"/"+event)
+		}
+	}
+	return events
+}
+
 func (m *machineImpl) setCurrentStateMap(state StateMap) error {
 	for rootState, subStates := range state {
 		switch subStates.(type) {
@@ -321,19 +605,32 @@ func (m *machineImpl) setCurrentState(state interface{}) error {
 	if state, ok := state.(string); ok {
 		for _, s := range m.def.States {
 			if s == state {
+				m.stopInvokes()
+				m.stopSubmachines()
 				m.previousState = m.currentState
 				m.currentState = state
+				m.entered = true
+				m.invokesPending = true
+				m.enteredState(state)
 				return nil
 			}
 		}
 
 		for s, submachineDefs := range m.def.Submachines {
 			if s == state {
+				m.stopInvokes()
+				m.stopSubmachines()
 				m.submachines[state] = []*machineImpl{}
 				for _, submachineDef := range submachineDefs {
+					// timed events of submachines stop along with the
+					// supermachine's.
+					ctxTimedEvents, stopTimedEvents := context.WithCancel(m.ctxTimedEvents)
 					submachine := &machineImpl{
-						supermachine: m,
-						submachines:  map[string][]*machineImpl{},
+						supermachine:    m,
+						submachines:     map[string][]*machineImpl{},
+						done:            make(chan struct{}),
+						ctxTimedEvents:  ctxTimedEvents,
+						stopTimedEvents: stopTimedEvents,
 					}
 					submachine.SetMachineDef(submachineDef)
 					m.submachines[state] = append(m.submachines[state], submachine)
@@ -341,6 +638,9 @@ func (m *machineImpl) setCurrentState(state interface{}) error {
 
 				m.previousState = m.currentState
 				m.currentState = state
+				m.entered = true
+				m.invokesPending = true
+				m.enteredState(state)
 				return nil
 			}
 		}
@@ -349,11 +649,37 @@ func (m *machineImpl) setCurrentState(state interface{}) error {
 	return ErrStateTypeNotSupported
 }
 
-func (m *machineImpl) applyTransition(transition Transition) error {
+// stopSubmachines stops the timed events and delayed sends of the
+// submachines of the current state, which are left behind by a transition,
+// and marks them as exited, after recording their states as the history of
+// the state.
+func (m *machineImpl) stopSubmachines() {
+	m.recordHistory()
+	for _, submachine := range m.submachines[m.currentState] {
+		submachine.setExited()
+		if submachine.stopTimedEvents != nil {
+			submachine.stopTimedEvents()
+		}
+		submachine.cancelSends()
+	}
+}
+
+// applyTransition transitions the machine, and replaces its context with
+// nextContext along with the state, unless it's nil. The actions of the
+// transition are passed eventArgs, the args of the event which it is taken
+// on.
+func (m *machineImpl) applyTransition(transition Transition, nextContext interface{}, eventArgs map[reflect.Type]interface{}) error {
 	fromState := m.GetState()
 
+	if transitionImpl, ok := transition.(*transitionImpl); ok && transitionImpl.def != nil {
+		recordTransition(transitionImpl.def, func(transitionCoverage *TransitionCoverage) {
+			transitionCoverage.Taken++
+		})
+	}
+
 	args := make(map[reflect.Type]interface{})
 	args[reflect.TypeOf(new(Transition))] = transition
+	m.setContextArgs(args, copyContext(m.getContext()))
 
 	for _, callbackDef := range m.def.BeforeCallbacks {
 		if callbackDef.Matches(fromState, transition.To()) {
@@ -369,11 +695,33 @@ func (m *machineImpl) applyTransition(transition Transition) error {
 			matchingCallbacks = append(matchingCallbacks, callbackDef.Do...)
 		}
 	}
+	var settleErr error
 	applyTransition := func() {
+		m.execActions(transition, nextContext, eventArgs)
 		m.setCurrentState(transition.To())
+		if transitionImpl, ok := transition.(*transitionImpl); ok && transitionImpl.def != nil && transitionImpl.def.History != "" {
+			m.restoreHistory(transition.To(), transitionImpl.def.History)
+		}
+		if transitionImpl, ok := transition.(*transitionImpl); ok && transitionImpl.def != nil && len(transitionImpl.def.Fork) != 0 {
+			m.fork(transition.To(), transitionImpl.def.Fork)
+		}
+		if nextContext != nil {
+			m.setContext(nextContext)
+		}
+		if eventArgs == nil {
+			// e.g. exiting a submachine isn't triggered by an event of
+			// the supermachine.
+			eventArgs = m.entryArgs()
+		}
+		settleErr = m.settleSubmachines(eventArgs)
+		m.startEnteredInvokes()
 	}
 
 	m.applyTransitionAroundCallbacks(matchingCallbacks, args, applyTransition)
+	if settleErr != nil {
+		return settleErr
+	}
+	m.setContextArgs(args, copyContext(m.getContext()))
 
 	for _, callbackDef := range m.def.AfterCallbacks {
 		if !callbackDef.Matches(fromState, transition.To()) {
@@ -383,12 +731,18 @@ func (m *machineImpl) applyTransition(transition Transition) error {
 			m.exec(callback.Func, args)
 		}
 		if callbackDef.ExitToState != "" && m.supermachine != nil {
-			if err := m.supermachine.applyTransition(
-				newTransitionImpl(m.supermachine.currentState, callbackDef.ExitToState),
+			supermachine := m.supermachine
+			if err := supermachine.applyTransition(
+				newTransitionImpl(supermachine.currentState, callbackDef.ExitToState),
+				nil,
+				nil,
 			); err != nil {
 				return fmt.Errorf("could not exit submachine: %s", err)
 			}
-			m.hasExited = true
+			// no event of the supermachine triggered the state it exited to.
+			if err := supermachine.settle(supermachine.entryArgs()); err != nil {
+				return fmt.Errorf("could not exit submachine: %s", err)
+			}
 			return nil
 		}
 	}
@@ -431,3 +785,60 @@ func (m *machineImpl) exec(callback TransitionCallbackFunc, args map[reflect.Typ
 		panic(err)
 	}
 }
+
+// execActions runs the actions of transition, which see the context as
+// assigned by it.
+func (m *machineImpl) execActions(transition Transition, nextContext interface{}, eventArgs map[reflect.Type]interface{}) {
+	transitionImpl, ok := transition.(*transitionImpl)
+	if !ok || transitionImpl.def == nil || len(transitionImpl.def.Do) == 0 {
+		return
+	}
+
+	args := make(map[reflect.Type]interface{})
+	for _, argType := range []reflect.Type{reflect.TypeOf(new(Event)), reflect.TypeOf(new(context.Context))} {
+		if arg, ok := eventArgs[argType]; ok {
+			args[argType] = arg
+		}
+	}
+	// actions which accept an error are passed nil, unless the event carried
+	// one.
+	args[reflect.TypeOf(new(error))] = eventArgs[reflect.TypeOf(new(error))]
+	args[reflect.TypeOf(new(Transition))] = transition
+	if nextContext == nil {
+		nextContext = m.getContext()
+	}
+	m.setContextArgs(args, copyContext(nextContext))
+
+	for _, action := range transitionImpl.def.Do {
+		m.exec(action.Func, args)
+	}
+}
+
+// GetContext implements Machine.
+func (m *machineImpl) GetContext() interface{} {
+	return copyContext(m.getContext())
+}
+
+func (m *machineImpl) getContext() interface{} {
+	m.contextMutex.RLock()
+	defer m.contextMutex.RUnlock()
+
+	return m.context
+}
+
+func (m *machineImpl) setContext(context interface{}) {
+	m.contextMutex.Lock()
+	defer m.contextMutex.Unlock()
+
+	m.context = context
+}
+
+// setContextArgs passes context to the funcs which accept it by its type,
+// and to expressions.
+func (m *machineImpl) setContextArgs(args map[reflect.Type]interface{}, context interface{}) {
+	if context == nil {
+		return
+	}
+	args[reflect.PtrTo(reflect.TypeOf(context))] = context
+	args[contextArgType] = contextArg{value: context}
+}
@@ -0,0 +1,88 @@
+package statemachine
+
+import (
+	"context"
+)
+
+// InvokeDoneEvent returns the name of the event which is fired on a machine
+// once the service with id, which its state invoked, returns nil, e.g.
+// `done.invoke.process`.
+func InvokeDoneEvent(id string) string {
+	return "done.invoke." + id
+}
+
+// InvokeErrorEvent returns the name of the event which is fired on a
+// machine once the service with id, which its state invoked, returns an
+// error, e.g. `error.invoke.process`. The error is the payload of the event.
+func InvokeErrorEvent(id string) string {
+	return "error.invoke." + id
+}
+
+// startInvokes invokes the services of state, which the machine has just
+// entered.
+func (m *machineImpl) startInvokes(state string) {
+	for _, invokeDef := range m.def.Invokes {
+		if invokeDef.State != state {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		m.invokeMutex.Lock()
+		m.invokes = append(m.invokes, cancel)
+		m.invokeMutex.Unlock()
+
+		go m.invoke(ctx, invokeDef)
+	}
+}
+
+// startEnteredInvokes invokes the services of the state which the machine
+// has entered, and of the states of its submachines, which are known once
+// fork, history and the eventless transitions of the submachines have set
+// them. Services of states which were entered and left in the meantime are
+// never invoked.
+func (m *machineImpl) startEnteredInvokes() {
+	if m.invokesPending {
+		m.invokesPending = false
+		m.startInvokes(m.currentState)
+	}
+	for _, submachine := range m.submachines[m.currentState] {
+		submachine.startEnteredInvokes()
+	}
+}
+
+// invoke runs the service of invokeDef, and fires its completion event. The
+// messages and the completion event of the service are dropped once ctx is
+// cancelled, i.e. once the state which invoked it is exited.
+func (m *machineImpl) invoke(ctx context.Context, invokeDef *InvokeDef) {
+	send := func(message Message) {
+		_ = m.send(message, ctx)
+	}
+
+	err := invokeDef.Func(ctx, send)
+
+	event := InvokeDoneEvent(invokeDef.ID)
+	var payload []interface{}
+	if err != nil {
+		event = InvokeErrorEvent(invokeDef.ID)
+		payload = append(payload, err)
+	}
+	if _, ok := m.def.Events[event]; ok {
+		_ = m.fire(context.Background(), event, fireOptions{invocation: ctx}, payload)
+	}
+}
+
+// stopInvokes cancels the services invoked by the current state of the
+// machine, and by the active submachines, which are left behind along with
+// it.
+func (m *machineImpl) stopInvokes() {
+	m.invokeMutex.Lock()
+	invokes := m.invokes
+	m.invokes = nil
+	m.invokeMutex.Unlock()
+
+	for _, cancel := range invokes {
+		cancel()
+	}
+	for _, submachine := range m.submachines[m.currentState] {
+		submachine.stopInvokes()
+	}
+}
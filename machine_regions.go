@@ -0,0 +1,67 @@
+package statemachine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// isJoined reports whether each of the parallel submachines of the current
+// state of machine, which the transition joins, is in its state.
+func (def *TransitionDef) isJoined(machine Machine) bool {
+	for region, state := range def.Join {
+		submachine, err := machine.Submachine(region)
+		if err != nil || !submachine.IsState(state) {
+			return false
+		}
+	}
+	return true
+}
+
+// fork sets the parallel submachines of state, which the machine has just
+// entered, to the states the transition forks into, in the order of their
+// IDs.
+func (m *machineImpl) fork(state string, fork map[string]string) {
+	for _, region := range sortedRegions(fork) {
+		for _, submachine := range m.submachines[state] {
+			if submachine.def.ID == region {
+				submachine.restoreConfiguration(&Snapshot{State: fork[region]}, Shallow)
+			}
+		}
+	}
+}
+
+// Broadcast implements Machine.
+func (m *machineImpl) Broadcast(event string) error {
+	delivered, err := m.broadcast(event)
+	if err == nil && !delivered {
+		return errors.New("no such event")
+	}
+	return err
+}
+
+// broadcast fires event on the active submachines which define it, and
+// reports whether any did. Submachines which are exited by an earlier one,
+// e.g. by a completion event, are skipped.
+func (m *machineImpl) broadcast(event string) (delivered bool, err error) {
+	// like Submachine, the submachines of the current state are read as is.
+	submachines := append([]*machineImpl(nil), m.submachines[m.currentState]...)
+
+	for _, submachine := range submachines {
+		if submachine.isExited() {
+			continue
+		}
+		if _, ok := submachine.def.Events[event]; ok {
+			delivered = true
+			if fireErr := submachine.Fire(event); fireErr != nil && err == nil {
+				err = fmt.Errorf("submachine '%s': %w", submachine.def.ID, fireErr)
+			}
+		}
+
+		subDelivered, subErr := submachine.broadcast(event)
+		delivered = delivered || subDelivered
+		if subErr != nil && err == nil {
+			err = fmt.Errorf("submachine '%s': %w", submachine.def.ID, subErr)
+		}
+	}
+	return delivered, err
+}
@@ -0,0 +1,134 @@
+package statemachine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"time"
+)
+
+// DelayedSend is an event sent by Machine.SendAfter, which is yet to be
+// fired, as included in snapshots.
+type DelayedSend struct {
+	ID    string
+	Event string
+
+	// Remaining is the time left until the event is fired, as of the
+	// snapshot.
+	Remaining time.Duration
+}
+
+// delayedSend is a pending event sent by Machine.SendAfter.
+type delayedSend struct {
+	event TriggerEvent
+	due   time.Time
+	timer ClockTimer
+}
+
+// SendAfter implements Machine.
+func (m *machineImpl) SendAfter(delay time.Duration, event TriggerEvent) string {
+	id := newSendID()
+	m.scheduleSend(id, delay, event)
+	return id
+}
+
+// Cancel implements Machine.
+func (m *machineImpl) Cancel(id string) bool {
+	m.sendMutex.Lock()
+	send, ok := m.sends[id]
+	delete(m.sends, id)
+	m.sendMutex.Unlock()
+
+	if !ok {
+		return false
+	}
+	send.timer.Stop()
+	return true
+}
+
+func (m *machineImpl) scheduleSend(id string, delay time.Duration, event TriggerEvent) {
+	clock := m.getClock()
+
+	m.sendMutex.Lock()
+	defer m.sendMutex.Unlock()
+
+	send := &delayedSend{event: event, due: clock.Now().Add(delay)}
+	if m.sends == nil {
+		m.sends = map[string]*delayedSend{}
+	}
+	m.sends[id] = send
+	send.timer = clock.AfterFunc(delay, func() {
+		m.sendMutex.Lock()
+		// the send may have been cancelled, or replaced by a restore, since.
+		pending := m.sends[id] == send
+		if pending {
+			delete(m.sends, id)
+		}
+		m.sendMutex.Unlock()
+
+		if pending {
+			_ = m.Send(send.event)
+		}
+	})
+}
+
+// delayedSends returns the pending sends of the machine, in the order they
+// are due.
+func (m *machineImpl) delayedSends() []*DelayedSend {
+	clock := m.getClock()
+
+	m.sendMutex.Lock()
+	defer m.sendMutex.Unlock()
+
+	if len(m.sends) == 0 {
+		return nil
+	}
+	now := clock.Now()
+	sends := make([]*DelayedSend, 0, len(m.sends))
+	for id, send := range m.sends {
+		remaining := send.due.Sub(now)
+		if remaining < 0 {
+			remaining = 0
+		}
+		sends = append(sends, &DelayedSend{ID: id, Event: send.event.Event, Remaining: remaining})
+	}
+	sort.Slice(sends, func(i, j int) bool {
+		if sends[i].Remaining != sends[j].Remaining {
+			return sends[i].Remaining < sends[j].Remaining
+		}
+		return sends[i].ID < sends[j].ID
+	})
+	return sends
+}
+
+// restoreSends replaces the pending sends of the machine with sends.
+func (m *machineImpl) restoreSends(sends []*DelayedSend) {
+	m.cancelSends()
+	for _, send := range sends {
+		m.scheduleSend(send.ID, send.Remaining, TriggerEvent{Event: send.Event})
+	}
+}
+
+// cancelSends cancels the pending sends of the machine, and of its active
+// submachines, which are left behind along with it.
+func (m *machineImpl) cancelSends() {
+	m.sendMutex.Lock()
+	sends := m.sends
+	m.sends = nil
+	m.sendMutex.Unlock()
+
+	for _, send := range sends {
+		send.timer.Stop()
+	}
+	for _, submachine := range m.submachines[m.currentState] {
+		submachine.cancelSends()
+	}
+}
+
+func newSendID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -1,9 +1,16 @@
 package statemachine_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
 
 	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/statemachinetest"
 )
 
 func ExampleBuildNewMachine() {
@@ -34,3 +41,638 @@ func ExampleNewMachine() {
 	fmt.Println(p.Machine.GetState())
 	// Output: unmonitored
 }
+
+func ExampleMachine_AvailableEvents() {
+	machineDef, err := statemachine.LoadHCL("process.hcl", []byte(`
+		states        = ["stopped", "starting"]
+		initial_state = "stopped"
+
+		event "start" {
+		  transition {
+		    from = ["stopped"]
+		    to   = "starting"
+		  }
+		}
+
+		event "tick" {
+		  transition {
+		    from = ["starting"]
+		    to   = "running"
+		  }
+		}
+
+		event "stop" {
+		  transition {
+		    to = "stopped"
+		  }
+		}
+
+		submachine "running" {
+		  id            = "process"
+		  states        = ["pending", "success"]
+		  initial_state = "pending"
+
+		  event "succeed" {
+		    transition {
+		      from = ["pending"]
+		      to   = "success"
+		    }
+		  }
+		}
+	`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+	fmt.Println(machine.AvailableEvents())
+
+	machine.Fire("start")
+	machine.Fire("tick")
+	fmt.Println(machine.AvailableEvents())
+
+	// Output:
+	// [start stop]
+	// [stop process/succeed]
+}
+
+func ExampleMachine_FireContext() {
+	type Order struct {
+		Amount int
+	}
+
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("pending", "paid", "review")
+		m.InitialState("pending")
+
+		m.Event("pay", func(e statemachine.EventBuilder) {
+			e.Choice(func(transition statemachine.Transition, order *Order) bool {
+				return transition.From() == "pending" && order.Amount > 100
+			}).OnTrue(func(e statemachine.EventBuilder) {
+				e.Transition().From("pending").To("review")
+			}).OnFalse(func(e statemachine.EventBuilder) {
+				e.Transition().From("pending").To("paid").If(func(ctx context.Context) bool {
+					return ctx.Err() == nil
+				})
+			})
+		})
+	})
+
+	fmt.Println(machine.Fire("pay"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fmt.Println(machine.FireContext(ctx, "pay", &Order{Amount: 10}))
+
+	fmt.Println(machine.FireContext(context.Background(), "pay", &Order{Amount: 10}))
+	fmt.Println(machine.GetState())
+
+	// Output:
+	// missing payload with type '*statemachine_test.Order'
+	// no matching transition
+	// <nil>
+	// paid
+}
+
+func ExampleMachine_Broadcast() {
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.InitialState("editing")
+
+		for _, id := range []string{"bold", "italics", "list"} {
+			id := id
+			m.Submachine("editing", func(sm statemachine.MachineBuilder) {
+				sm.ID(id)
+				sm.States("off", "on")
+				sm.InitialState("off")
+				if id == "list" {
+					return
+				}
+
+				sm.Event("toggle", func(e statemachine.EventBuilder) {
+					e.Transition().From("off").To("on")
+				})
+				sm.AfterTransition().Any().Do(func(t statemachine.Transition) {
+					fmt.Printf("%s: %s -> %s\n", id, t.From(), t.To())
+				})
+			})
+		}
+	})
+
+	fmt.Println(machine.Broadcast("toggle"))
+	fmt.Println(machine.Broadcast("toggle"))
+	fmt.Println(machine.Broadcast("indent"))
+
+	// Output:
+	// bold: off -> on
+	// italics: off -> on
+	// <nil>
+	// submachine 'bold': no matching transition
+	// no such event
+}
+
+func ExampleMachine_SendAfter() {
+	var timeoutID string
+	build := func(m statemachine.MachineBuilder) {
+		m.States("idle", "waiting", "timed-out")
+		m.InitialState("idle")
+
+		m.Event("request", func(e statemachine.EventBuilder) {
+			e.Transition().From("idle").To("waiting")
+		})
+		m.Event("reply", func(e statemachine.EventBuilder) {
+			e.Transition().From("waiting").To("idle")
+		})
+		m.Event("timeout", func(e statemachine.EventBuilder) {
+			e.Transition().From("waiting").To("timed-out")
+		})
+
+		m.AfterTransition().To("waiting").Do(func(machine statemachine.Machine) {
+			timeoutID = machine.SendAfter(5*time.Second, statemachine.TriggerEvent{Event: "timeout"})
+		})
+		m.AfterTransition().From("waiting").To("idle").Do(func(machine statemachine.Machine) {
+			machine.Cancel(timeoutID)
+		})
+	}
+
+	clock := statemachinetest.NewClock(time.Unix(0, 0))
+	machine := statemachine.BuildNewMachine(build)
+	machine.SetClock(clock)
+
+	_ = machine.Fire("request")
+	clock.Advance(3 * time.Second)
+	snapshot := machine.Snapshot()
+	fmt.Println(machine.GetState(), snapshot.Sends[0].Event, snapshot.Sends[0].Remaining)
+
+	_ = machine.Fire("reply")
+	clock.Advance(5 * time.Second)
+	fmt.Println(machine.GetState(), machine.Snapshot().Sends)
+
+	restored := statemachine.BuildNewMachine(build)
+	restored.SetClock(clock)
+	_ = restored.Restore(snapshot)
+	clock.Advance(2 * time.Second)
+	fmt.Println(restored.GetState())
+
+	// Output:
+	// waiting timeout 2s
+	// idle []
+	// timed-out
+}
+
+func TestTransitionGuardArgs(t *testing.T) {
+	type Order struct{}
+
+	valid := []interface{}{
+		new(bool),
+		func() bool { return true },
+		func(statemachine.Machine, statemachine.Transition, statemachine.Event, context.Context) bool {
+			return true
+		},
+		func(*Order, statemachine.Event) bool { return true },
+		func(error) bool { return true },
+	}
+	for _, guard := range valid {
+		statemachine.NewEventBuilder("pay").Transition().FromAny().To("paid").If(guard)
+		statemachine.NewEventBuilder("pay").Choice(guard)
+	}
+
+	invalid := []interface{}{
+		true,
+		func() {},
+		func() string { return "" },
+		func(fmt.Stringer) bool { return true },
+		func(*Order, *Order) bool { return true },
+	}
+	for _, guard := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("guard %T: want panic", guard)
+				}
+			}()
+			statemachine.NewEventBuilder("pay").Transition().FromAny().To("paid").If(guard)
+		}()
+	}
+}
+
+func TestAlways_SettlesEnteredStates(t *testing.T) {
+	var entered []string
+	build := func(initialState string) statemachine.Machine {
+		return statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+			m.States("checking", "approved", "idle")
+			m.InitialState(initialState)
+
+			m.Submachine("working", func(sm statemachine.MachineBuilder) {
+				sm.ID("task")
+				sm.States("routing", "fast", "slow")
+				sm.InitialState("routing")
+				sm.Event("slow_down", func(e statemachine.EventBuilder) {
+					e.Transition().From("fast").To("slow")
+				})
+				sm.Always().From("routing").To("fast").Do(func(t statemachine.Transition) {
+					entered = append(entered, t.To())
+				})
+			})
+
+			m.Event("work", func(e statemachine.EventBuilder) {
+				e.Transition().From("idle", "approved").To("working")
+			})
+			m.Event("pause", func(e statemachine.EventBuilder) {
+				e.Transition().From("working").To("idle")
+			})
+			m.Event("resume", func(e statemachine.EventBuilder) {
+				e.Transition().From("idle").To("working").WithHistory(statemachine.Shallow)
+			})
+			m.Always().From("checking").To("approved")
+		})
+	}
+	assertState := func(machine statemachine.Machine, want string) {
+		t.Helper()
+		if got := fmt.Sprint(machine.GetStateMap()); got != want {
+			t.Errorf("got state %s, want %s", got, want)
+		}
+	}
+
+	// the initial state.
+	machine := build("checking")
+	assertState(machine, "map[approved:map[]]")
+
+	// a submachine's initial state, when its state is entered by an event.
+	if err := machine.Fire("work"); err != nil {
+		t.Fatal(err)
+	}
+	assertState(machine, "map[working:map[task:fast]]")
+
+	// the history of a state isn't taken over by its initial state.
+	task, _ := machine.Submachine("task")
+	_ = task.Fire("slow_down")
+	_ = machine.Fire("pause")
+	entered = nil
+	_ = machine.Fire("resume")
+	assertState(machine, "map[working:map[task:slow]]")
+	if len(entered) > 0 {
+		t.Errorf("got eventless transitions to %v on resume, want none", entered)
+	}
+
+	// a state that is set, with its submachines.
+	if err := machine.SetCurrentState("checking"); err != nil {
+		t.Fatal(err)
+	}
+	assertState(machine, "map[approved:map[]]")
+	if err := machine.SetCurrentState("working"); err != nil {
+		t.Fatal(err)
+	}
+	assertState(machine, "map[working:map[task:fast]]")
+
+	// a restored snapshot.
+	machine = build("idle")
+	if err := machine.Restore(&statemachine.Snapshot{State: "checking"}); err != nil {
+		t.Fatal(err)
+	}
+	assertState(machine, "map[approved:map[]]")
+	if err := machine.Restore(&statemachine.Snapshot{
+		State:       "working",
+		Submachines: map[string]*statemachine.Snapshot{"task": {State: "routing"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertState(machine, "map[working:map[task:fast]]")
+}
+
+func TestMachine_RestoreRunsEventlessTransitions(t *testing.T) {
+	var transitions []string
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("draft", "checking", "approved")
+		m.InitialState("draft")
+
+		m.Event("submit", func(e statemachine.EventBuilder) {
+			e.Transition().From("draft").To("checking")
+		})
+		m.Always().From("checking").To("approved")
+
+		m.AfterTransition().Any().Do(func(t statemachine.Transition) {
+			transitions = append(transitions, t.From()+" -> "+t.To())
+		})
+	})
+
+	// restoring draft runs no callbacks, and restoring checking runs only
+	// those of the eventless transition it takes.
+	if err := machine.Restore(&statemachine.Snapshot{State: "draft"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := machine.Restore(&statemachine.Snapshot{State: "checking"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"checking -> approved"}; !reflect.DeepEqual(transitions, want) {
+		t.Errorf("got transitions %v, want %v", transitions, want)
+	}
+	if state := machine.GetState(); state != "approved" {
+		t.Errorf("got state %s, want approved", state)
+	}
+}
+
+func TestAlways_SettlesExitedToStates(t *testing.T) {
+	machineDef, err := statemachine.LoadHCL("process.hcl", []byte(`
+		states        = ["stopped", "restarting"]
+		initial_state = "running"
+
+		always {
+		  from = ["restarting"]
+		  to   = "running"
+		}
+
+		submachine "running" {
+		  id            = "process"
+		  states        = ["processing", "failure"]
+		  initial_state = "processing"
+
+		  event "fail" {
+		    transition {
+		      from = ["processing"]
+		      to   = "failure"
+		    }
+		  }
+
+		  after_transition {
+		    to            = ["failure"]
+		    exit_to_state = "restarting"
+		  }
+		}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+	process, _ := machine.Submachine("process")
+	if err := process.Fire("fail"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(machine.GetStateMap()), "map[running:map[process:processing]]"; got != want {
+		t.Errorf("got state %s, want %s", got, want)
+	}
+}
+
+func TestSubmachine_CompletesWithoutEvent(t *testing.T) {
+	build := func(cached bool) statemachine.Machine {
+		return statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+			m.States("pending", "deployed")
+			m.InitialState("pending")
+			m.FinalStates("deployed")
+
+			for _, id := range []string{"build", "test"} {
+				m.Submachine("checking", func(sm statemachine.MachineBuilder) {
+					sm.ID(id)
+					sm.States("running", "passed")
+					sm.InitialState("running")
+					sm.FinalStates("passed")
+
+					sm.Event("pass", func(e statemachine.EventBuilder) {
+						e.Transition().From("running").To("passed")
+					})
+					sm.Always().From("running").To("passed").If(func() bool { return cached })
+				})
+			}
+
+			m.Event("check", func(e statemachine.EventBuilder) {
+				e.Transition().From("pending").To("checking")
+			})
+			m.Event("skip", func(e statemachine.EventBuilder) {
+				e.Transition().From("pending").To("checking").Fork("build", "passed").Fork("test", "passed")
+			})
+			m.Event(statemachine.DoneEvent("checking"), func(e statemachine.EventBuilder) {
+				e.Transition().From("checking").To("deployed")
+			})
+		})
+	}
+	assertState := func(machine statemachine.Machine, want string) {
+		t.Helper()
+		if got := machine.GetState(); got != want {
+			t.Errorf("got state %s, want %s", got, want)
+		}
+	}
+
+	// the submachines are forked into final states.
+	machine := build(false)
+	if err := machine.Fire("skip"); err != nil {
+		t.Fatal(err)
+	}
+	assertState(machine, "deployed")
+
+	// the submachines settle into final states.
+	machine = build(true)
+	if err := machine.Fire("check"); err != nil {
+		t.Fatal(err)
+	}
+	assertState(machine, "deployed")
+
+	// the submachines are restored into final states.
+	machine = build(false)
+	if err := machine.Restore(&statemachine.Snapshot{
+		State: "checking",
+		Submachines: map[string]*statemachine.Snapshot{
+			"build": {State: "passed"},
+			"test":  {State: "passed"},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertState(machine, "deployed")
+
+	// the submachines are completed by their events, once.
+	machine = build(false)
+	_ = machine.Fire("check")
+	buildMachine, _ := machine.Submachine("build")
+	testMachine, _ := machine.Submachine("test")
+	_ = buildMachine.Fire("pass")
+	assertState(machine, "checking")
+	_ = testMachine.Fire("pass")
+	assertState(machine, "deployed")
+}
+
+func TestInvoke_DropsEventsOfExitedStates(t *testing.T) {
+	cancelling := make(chan struct{})
+	returned := make(chan struct{})
+
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("loading", "idle", "loaded")
+		m.InitialState("loading")
+
+		m.Invoke("loading", func(ctx context.Context, send func(statemachine.Message)) error {
+			defer close(returned)
+			<-cancelling
+			return nil
+		}).ID("load")
+
+		m.Event("cancel", func(e statemachine.EventBuilder) {
+			e.Transition().From("loading").To("idle")
+		})
+		m.Event(statemachine.InvokeDoneEvent("load"), func(e statemachine.EventBuilder) {
+			e.Transition().FromAny().To("loaded")
+		})
+
+		// the service returns while the machine is exiting its state, and
+		// waits for the machine to fire its done event.
+		m.BeforeTransition().From("loading").To("idle").Do(func() {
+			close(cancelling)
+			<-returned
+			time.Sleep(10 * time.Millisecond)
+		})
+	})
+
+	if err := machine.Fire("cancel"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if state := machine.GetState(); state != "idle" {
+		t.Errorf("got state %s, want idle", state)
+	}
+}
+
+func TestInvoke_PassesErrorToGuards(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	failed := make(chan error, 1)
+
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("loading", "retrying", "failed")
+		m.InitialState("loading")
+
+		m.Invoke("loading", func(ctx context.Context, send func(statemachine.Message)) error {
+			return fmt.Errorf("could not load: %w", errTimeout)
+		}).ID("load")
+
+		m.Event(statemachine.InvokeErrorEvent("load"), func(e statemachine.EventBuilder) {
+			e.Transition().From("loading").To("retrying").
+				If(func(err error) bool { return errors.Is(err, errTimeout) }).
+				Do(func(err error) { failed <- err })
+			e.Transition().From("loading").To("failed")
+		})
+		m.Event("retry", func(e statemachine.EventBuilder) {
+			e.Transition().From("retrying").To("loading").Do(func(err error) {
+				if err != nil {
+					t.Errorf("got error %v in action of retry, want nil", err)
+				}
+			})
+		})
+	})
+
+	select {
+	case err := <-failed:
+		if !errors.Is(err, errTimeout) {
+			t.Errorf("got error %v, want %v", err, errTimeout)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("error of the service was not passed to the action")
+	}
+
+	// retry waits for the transition to retrying to finish.
+	if err := machine.Fire("retry"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvoke_StartsAfterForkAndHistory(t *testing.T) {
+	var invoked int32
+	started := make(chan struct{}, 1)
+
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("idle")
+		m.InitialState("idle")
+
+		m.Submachine("working", func(sm statemachine.MachineBuilder) {
+			sm.ID("task")
+			sm.States("pending", "done")
+			sm.InitialState("pending")
+
+			sm.Invoke("pending", func(ctx context.Context, send func(statemachine.Message)) error {
+				atomic.AddInt32(&invoked, 1)
+				started <- struct{}{}
+				<-ctx.Done()
+				return nil
+			})
+		})
+
+		m.Event("skip", func(e statemachine.EventBuilder) {
+			e.Transition().From("idle").To("working").Fork("task", "done")
+		})
+		m.Event("pause", func(e statemachine.EventBuilder) {
+			e.Transition().From("working").To("idle")
+		})
+		m.Event("resume", func(e statemachine.EventBuilder) {
+			e.Transition().From("idle").To("working").WithHistory(statemachine.Shallow)
+		})
+		m.Event("work", func(e statemachine.EventBuilder) {
+			e.Transition().From("idle").To("working")
+		})
+	})
+
+	// the initial state of the submachine is replaced by fork, and by its
+	// history, before its service is invoked.
+	for _, event := range []string{"skip", "pause", "resume", "pause"} {
+		if err := machine.Fire(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&invoked); n != 0 {
+		t.Errorf("got %d invocations, want none", n)
+	}
+
+	if err := machine.Fire("work"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("service of the initial state was not invoked")
+	}
+	if n := atomic.LoadInt32(&invoked); n != 1 {
+		t.Errorf("got %d invocations, want 1", n)
+	}
+}
+
+func TestSubmachine_StopsTimedEventsOnExit(t *testing.T) {
+	var checks int32
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("idle")
+		m.InitialState("idle")
+
+		m.Submachine("monitoring", func(sm statemachine.MachineBuilder) {
+			sm.ID("health")
+			sm.States("watching")
+			sm.InitialState("watching")
+			sm.Event("check", func(e statemachine.EventBuilder) {
+				e.TimedEvery(5 * time.Millisecond)
+				e.Transition().From("watching").To("watching")
+			})
+			sm.AfterTransition().Any().Do(func() { atomic.AddInt32(&checks, 1) })
+		})
+
+		m.Event("monitor", func(e statemachine.EventBuilder) {
+			e.Transition().From("idle").To("monitoring")
+		})
+		m.Event("stop", func(e statemachine.EventBuilder) {
+			e.Transition().From("monitoring").To("idle")
+		})
+	})
+
+	// the timed event of the submachine is fired while it's active.
+	_ = machine.Fire("monitor")
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&checks) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("got no timed events of the submachine")
+		}
+	}
+
+	// and stops once the supermachine leaves its state.
+	_ = machine.Fire("stop")
+	time.Sleep(20 * time.Millisecond)
+	stopped := atomic.LoadInt32(&checks)
+	time.Sleep(50 * time.Millisecond)
+	if checks := atomic.LoadInt32(&checks); checks != stopped {
+		t.Errorf("got %d timed events after the submachine was exited", checks-stopped)
+	}
+}
@@ -0,0 +1,459 @@
+package statemachine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// resolveMutex guards the resolution of definitions for machines, which may
+// be built from the same definition concurrently.
+var resolveMutex sync.Mutex
+
+var funcRegistry = struct {
+	sync.RWMutex
+	funcs map[string]interface{}
+}{
+	funcs: map[string]interface{}{},
+}
+
+// RegisterFunc makes fn available to definitions which refer to it by name
+// with a RegisteredFunc field. This is how guards, choice conditions, assign
+// actions, transition actions, callbacks and invoked services are bound to
+// definitions decoded from JSON or HCL.
+//
+// Registering a name again replaces the previously registered func.
+func RegisterFunc(name string, fn interface{}) {
+	funcRegistry.Lock()
+	defer funcRegistry.Unlock()
+
+	funcRegistry.funcs[name] = fn
+}
+
+// LookupFunc returns the func registered with name, if any.
+func LookupFunc(name string) (fn interface{}, ok bool) {
+	funcRegistry.RLock()
+	defer funcRegistry.RUnlock()
+
+	fn, ok = funcRegistry.funcs[name]
+	return
+}
+
+// ResolveRegisteredFuncs binds every guard, choice condition, assign
+// action, transition action, callback and invoked service that only
+// specifies a RegisteredFunc to the func registered under that name. Defs
+// which already have a func are left as is. Expressions are compiled against
+// the context of the definition.
+//
+// An error is returned for names that haven't been registered, for
+// registered funcs whose signatures are not valid for their use, for
+// actions and callbacks which take a context of another type than the
+// definition's, and for invalid expressions.
+//
+// A machine resolves its definition when the definition is set on it, the
+// first time it's set on any machine, so that machines may share it.
+func (def *MachineDef) ResolveRegisteredFuncs() error {
+	resolveMutex.Lock()
+	defer resolveMutex.Unlock()
+
+	return def.resolveRegisteredFuncs()
+}
+
+// resolveOnce resolves the registered funcs of def, unless it has been
+// resolved already. Machines share their definition, so it's only written to
+// the first time one is set on a machine, and only read after that.
+func (def *MachineDef) resolveOnce() error {
+	resolveMutex.Lock()
+	defer resolveMutex.Unlock()
+
+	if def.resolved {
+		return nil
+	}
+	return def.resolveRegisteredFuncs()
+}
+
+// resolveRegisteredFuncs is like ResolveRegisteredFuncs, and marks def and
+// its submachines as resolved once it succeeds. resolveMutex must be held.
+func (def *MachineDef) resolveRegisteredFuncs() error {
+	for event, eventDef := range def.Events {
+		if err := eventDef.resolveRegisteredFuncs(def); err != nil {
+			return fmt.Errorf("event '%s': %s", event, err)
+		}
+	}
+	for i, transitionDef := range def.Always {
+		if err := transitionDef.resolveRegisteredFuncs(def); err != nil {
+			return fmt.Errorf("always[%d]: %s", i, err)
+		}
+	}
+	for _, invokeDef := range def.Invokes {
+		if invokeDef.Func != nil {
+			continue
+		}
+		fn, err := lookupRegisteredFunc(invokeDef.RegisteredFunc)
+		if err != nil {
+			return fmt.Errorf("invoke '%s': %s", invokeDef.ID, err)
+		}
+		if err := catchPanic(func() { invokeDef.Func = assertInvokeKind(fn) }); err != nil {
+			return fmt.Errorf("invoke '%s': %s", invokeDef.ID, err)
+		}
+	}
+
+	callbackLists := []struct {
+		validateFor string
+		callbacks   []*TransitionCallbackDef
+	}{
+		{"BeforeTransition", def.BeforeCallbacks},
+		{"AroundTransition", def.AroundCallbacks},
+		{"AfterTransition", def.AfterCallbacks},
+	}
+	for _, list := range callbackLists {
+		for _, callbackDef := range list.callbacks {
+			callbackDef.validateFor = list.validateFor
+			for _, funcDef := range callbackDef.Do {
+				if funcDef.Func == nil {
+					fn, err := lookupRegisteredFunc(funcDef.RegisteredFunc)
+					if err != nil {
+						return fmt.Errorf("%s callback: %s", list.validateFor, err)
+					}
+					if err := catchPanic(func() { callbackDef.assertCallbackKind(fn) }); err != nil {
+						return fmt.Errorf("%s callback '%s': %s", list.validateFor, funcDef.RegisteredFunc, err)
+					}
+					funcDef.Func = fn
+				}
+				if err := def.assertContextArgs(funcDef.Func); err != nil {
+					return fmt.Errorf("%s callback: %s", list.validateFor, err)
+				}
+			}
+		}
+	}
+
+	eventCallbackLists := []struct {
+		validateFor string
+		callbacks   []*EventCallbackDef
+	}{
+		{"BeforeEvent", def.BeforeEventCallbacks},
+		{"AfterEvent", def.AfterEventCallbacks},
+		{"AfterFailure", def.FailureCallbacks},
+	}
+	for _, list := range eventCallbackLists {
+		for _, callbackDef := range list.callbacks {
+			callbackDef.validateFor = list.validateFor
+			for _, funcDef := range callbackDef.Do {
+				if funcDef.Func == nil {
+					fn, err := lookupRegisteredFunc(funcDef.RegisteredFunc)
+					if err != nil {
+						return fmt.Errorf("%s callback: %s", list.validateFor, err)
+					}
+					if err := catchPanic(func() { callbackDef.assertCallbackKind(fn) }); err != nil {
+						return fmt.Errorf("%s callback '%s': %s", list.validateFor, funcDef.RegisteredFunc, err)
+					}
+					funcDef.Func = fn
+				}
+				if err := def.assertContextArgs(funcDef.Func); err != nil {
+					return fmt.Errorf("%s callback: %s", list.validateFor, err)
+				}
+			}
+		}
+	}
+
+	for state, submachineDefs := range def.Submachines {
+		for _, submachineDef := range submachineDefs {
+			if err := submachineDef.resolveRegisteredFuncs(); err != nil {
+				return fmt.Errorf("submachine '%s' of state '%s': %s", submachineDef.ID, state, err)
+			}
+		}
+	}
+
+	def.resolved = true
+	return nil
+}
+
+func (def *EventDef) resolveRegisteredFuncs(machineDef *MachineDef) error {
+	for _, transitionDef := range def.Transitions {
+		if err := transitionDef.resolveRegisteredFuncs(machineDef); err != nil {
+			return err
+		}
+	}
+
+	if def.Choice == nil {
+		return nil
+	}
+
+	if condition := def.Choice.Condition; condition != nil && condition.Expr != "" {
+		program, err := compileExpr(condition.Expr, machineDef.exprType)
+		if err != nil {
+			return fmt.Errorf("choice condition '%s': %s", condition.Expr, err)
+		}
+		condition.program = program
+	} else if condition != nil && condition.Condition == nil {
+		fn, err := lookupRegisteredFunc(condition.RegisteredFunc)
+		if err != nil {
+			return fmt.Errorf("choice condition: %s", err)
+		}
+		if err := catchPanic(func() { assertGuardKind(fn) }); err != nil {
+			return fmt.Errorf("choice condition '%s': %s", condition.RegisteredFunc, err)
+		}
+		condition.Condition = fn
+	}
+
+	if err := def.Choice.UnlessGuard.resolveRegisteredFunc(machineDef); err != nil {
+		return fmt.Errorf("choice unless guard: %s", err)
+	}
+
+	for _, branch := range []*EventDef{def.Choice.OnTrue, def.Choice.OnFalse} {
+		if branch == nil {
+			continue
+		}
+		if err := branch.resolveRegisteredFuncs(machineDef); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (def *TransitionDef) resolveRegisteredFuncs(machineDef *MachineDef) error {
+	for _, guardDef := range def.IfGuards {
+		if err := guardDef.resolveRegisteredFunc(machineDef); err != nil {
+			return fmt.Errorf("if guard: %s", err)
+		}
+	}
+	for _, guardDef := range def.UnlessGuards {
+		if err := guardDef.resolveRegisteredFunc(machineDef); err != nil {
+			return fmt.Errorf("unless guard: %s", err)
+		}
+	}
+	for _, assignDef := range def.Assigns {
+		if err := assignDef.resolveRegisteredFunc(machineDef); err != nil {
+			return fmt.Errorf("assign: %s", err)
+		}
+	}
+	for _, funcDef := range def.Do {
+		if funcDef.Func == nil {
+			fn, err := lookupRegisteredFunc(funcDef.RegisteredFunc)
+			if err != nil {
+				return fmt.Errorf("action: %s", err)
+			}
+			if err := catchPanic(func() { assertActionKind(fn) }); err != nil {
+				return fmt.Errorf("action '%s': %s", funcDef.RegisteredFunc, err)
+			}
+			funcDef.Func = fn
+		}
+		if err := machineDef.assertContextArgs(funcDef.Func); err != nil {
+			return fmt.Errorf("action: %s", err)
+		}
+	}
+	return nil
+}
+
+func (def *TransitionGuardDef) resolveRegisteredFunc(machineDef *MachineDef) error {
+	if def != nil && def.IsCombined() {
+		for _, guardDef := range def.children() {
+			if err := guardDef.resolveRegisteredFunc(machineDef); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if def == nil || def.Guard != nil {
+		return nil
+	}
+	if def.Expr != "" {
+		program, err := compileExpr(def.Expr, machineDef.exprType)
+		if err != nil {
+			return fmt.Errorf("'%s': %s", def.Expr, err)
+		}
+		def.program = program
+		return nil
+	}
+	fn, err := lookupRegisteredFunc(def.RegisteredFunc)
+	if err != nil {
+		return err
+	}
+	if err := catchPanic(func() { assertGuardKind(fn) }); err != nil {
+		return fmt.Errorf("'%s': %s", def.RegisteredFunc, err)
+	}
+	def.Guard = fn
+	return nil
+}
+
+func (def *ContextAssignDef) resolveRegisteredFunc(machineDef *MachineDef) error {
+	if def.Assign != nil {
+		return nil
+	}
+	if def.Expr != "" {
+		program, err := machineDef.compileAssign(def.Var, def.Expr)
+		if err != nil {
+			return fmt.Errorf("'%s': %s", def.Expr, err)
+		}
+		def.program = program
+		return nil
+	}
+	fn, err := lookupRegisteredFunc(def.RegisteredFunc)
+	if err != nil {
+		return err
+	}
+	if err := catchPanic(func() { assertAssignKind(fn) }); err != nil {
+		return fmt.Errorf("'%s': %s", def.RegisteredFunc, err)
+	}
+	def.Assign = fn
+	return nil
+}
+
+// assertRegisteredNames returns an error for the first guard, choice
+// condition, assign action, transition action, callback or invoked service
+// which is a func without a RegisteredFunc name, or an expression. These
+// can't be encoded, e.g. as HCL.
+func (def *MachineDef) assertRegisteredNames() error {
+	for _, event := range sortedEventNames(def.Events) {
+		if err := def.Events[event].assertRegisteredNames(); err != nil {
+			return fmt.Errorf("event '%s': %s", event, err)
+		}
+	}
+	for i, transitionDef := range def.Always {
+		if err := transitionDef.assertRegisteredNames(); err != nil {
+			return fmt.Errorf("always[%d]: %s", i, err)
+		}
+	}
+	for _, invokeDef := range def.Invokes {
+		if invokeDef.RegisteredFunc == "" {
+			return fmt.Errorf("invoke '%s': %s", invokeDef.ID, errNoRegisteredName)
+		}
+	}
+
+	callbackLists := []struct {
+		validateFor string
+		callbacks   []*TransitionCallbackDef
+	}{
+		{"BeforeTransition", def.BeforeCallbacks},
+		{"AroundTransition", def.AroundCallbacks},
+		{"AfterTransition", def.AfterCallbacks},
+	}
+	for _, list := range callbackLists {
+		for _, callbackDef := range list.callbacks {
+			for _, funcDef := range callbackDef.Do {
+				if funcDef.RegisteredFunc == "" {
+					return fmt.Errorf("%s callback: %s", list.validateFor, errNoRegisteredName)
+				}
+			}
+		}
+	}
+
+	eventCallbackLists := []struct {
+		validateFor string
+		callbacks   []*EventCallbackDef
+	}{
+		{"BeforeEvent", def.BeforeEventCallbacks},
+		{"AfterEvent", def.AfterEventCallbacks},
+		{"AfterFailure", def.FailureCallbacks},
+	}
+	for _, list := range eventCallbackLists {
+		for _, callbackDef := range list.callbacks {
+			for _, funcDef := range callbackDef.Do {
+				if funcDef.RegisteredFunc == "" {
+					return fmt.Errorf("%s callback: %s", list.validateFor, errNoRegisteredName)
+				}
+			}
+		}
+	}
+
+	for _, state := range sortedSubmachineStates(def.Submachines) {
+		for _, submachineDef := range def.Submachines[state] {
+			if err := submachineDef.assertRegisteredNames(); err != nil {
+				return fmt.Errorf("submachine '%s' of state '%s': %s", submachineDef.ID, state, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (def *EventDef) assertRegisteredNames() error {
+	for _, transitionDef := range def.Transitions {
+		if err := transitionDef.assertRegisteredNames(); err != nil {
+			return err
+		}
+	}
+
+	if def.Choice == nil {
+		return nil
+	}
+	if condition := def.Choice.Condition; condition != nil && condition.Expr == "" && condition.RegisteredFunc == "" {
+		return fmt.Errorf("choice condition: %s", errNoRegisteredName)
+	}
+	if err := def.Choice.UnlessGuard.assertRegisteredName(); err != nil {
+		return fmt.Errorf("choice unless guard: %s", err)
+	}
+	for _, branch := range []*EventDef{def.Choice.OnTrue, def.Choice.OnFalse} {
+		if branch == nil {
+			continue
+		}
+		if err := branch.assertRegisteredNames(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (def *TransitionDef) assertRegisteredNames() error {
+	for _, guardDef := range def.IfGuards {
+		if err := guardDef.assertRegisteredName(); err != nil {
+			return fmt.Errorf("if guard: %s", err)
+		}
+	}
+	for _, guardDef := range def.UnlessGuards {
+		if err := guardDef.assertRegisteredName(); err != nil {
+			return fmt.Errorf("unless guard: %s", err)
+		}
+	}
+	for _, assignDef := range def.Assigns {
+		if assignDef.Expr == "" && assignDef.RegisteredFunc == "" {
+			return fmt.Errorf("assign: %s", errNoRegisteredName)
+		}
+	}
+	for _, funcDef := range def.Do {
+		if funcDef.RegisteredFunc == "" {
+			return fmt.Errorf("action: %s", errNoRegisteredName)
+		}
+	}
+	return nil
+}
+
+func (def *TransitionGuardDef) assertRegisteredName() error {
+	if def != nil && def.IsCombined() {
+		for _, guardDef := range def.children() {
+			if err := guardDef.assertRegisteredName(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if def == nil || def.Expr != "" || def.RegisteredFunc != "" {
+		return nil
+	}
+	return errNoRegisteredName
+}
+
+var errNoRegisteredName = errors.New("func has no registered name")
+
+func lookupRegisteredFunc(name string) (interface{}, error) {
+	if name == "" {
+		return nil, fmt.Errorf("neither func nor registered func is set")
+	}
+	fn, ok := LookupFunc(name)
+	if !ok {
+		return nil, fmt.Errorf("func '%s' is not registered", name)
+	}
+	return fn, nil
+}
+
+// catchPanic converts the panics raised by the builder assertions into an
+// error, for use where definitions are not built with the DSL.
+func catchPanic(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	fn()
+	return nil
+}
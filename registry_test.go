@@ -0,0 +1,83 @@
+package statemachine_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+func ExampleRegisterFunc() {
+	statemachine.RegisterFunc("log-transition", func(transition statemachine.Transition) {
+		fmt.Printf("%s -> %s\n", transition.From(), transition.To())
+	})
+
+	machineDef := &statemachine.MachineDef{
+		States:       []string{"locked", "unlocked"},
+		InitialState: "locked",
+		Events: map[string]*statemachine.EventDef{
+			"coin": {
+				Transitions: []*statemachine.TransitionDef{{From: []string{"locked"}, To: "unlocked"}},
+			},
+		},
+		AfterCallbacks: []*statemachine.TransitionCallbackDef{
+			{Do: []*statemachine.TransitionCallbackFuncDef{{RegisteredFunc: "log-transition"}}},
+		},
+	}
+
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(machineDef)
+	_ = machine.Fire("coin")
+
+	// Output: locked -> unlocked
+}
+
+func TestSetMachineDef_SharedDef(t *testing.T) {
+	statemachine.RegisterFunc("count-coins", func() {})
+
+	machineDef, err := statemachine.LoadHCL("turnstile.hcl", []byte(`
+		states        = ["locked", "unlocked"]
+		initial_state = "locked"
+		context       = { coins = 0 }
+
+		event "coin" {
+		  transition {
+		    from   = ["locked"]
+		    to     = "unlocked"
+		    if     = ["ctx.coins < 3"]
+		    assign = [{ var = "coins", expr = "ctx.coins + 1" }]
+		  }
+		}
+
+		after_transition {
+		  do = [count-coins]
+		}
+
+		after_event {
+		  do = [count-coins]
+		}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// machines built from the same definition concurrently don't write to
+	// it, once it's resolved.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				machine := statemachine.NewMachine()
+				machine.SetMachineDef(machineDef)
+				if err := machine.Fire("coin"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,127 @@
+package scxml_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/scxml"
+)
+
+func ExampleImport() {
+	machineDef, warnings, err := scxml.Import(strings.NewReader(`
+		<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="stopped">
+		  <state id="stopped">
+		    <transition event="start" target="running"/>
+		  </state>
+		  <state id="running" initial="pending">
+		    <onentry><script>log-start</script></onentry>
+		    <onexit><log expr="'stopping'"/></onexit>
+		    <transition event="stop" cond="!is-busy" target="stopped"/>
+		    <transition event="done.state.running" target="exited"/>
+		    <state id="pending">
+		      <transition event="process" cond="has-work" target="processing"/>
+		    </state>
+		    <state id="processing">
+		      <transition event="done" target="pending"/>
+		      <transition event="crash" target="stopped"/>
+		    </state>
+		  </state>
+		  <final id="exited"/>
+		</scxml>`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, warning := range warnings {
+		fmt.Println(warning)
+	}
+
+	process := machineDef.Submachines["running"][0].Events["process"].Transitions[0]
+	fmt.Println(machineDef.States, machineDef.Submachines["running"][0].States)
+	fmt.Println(process.From, process.To, process.IfGuards[0].RegisteredFunc)
+	fmt.Println(machineDef.Events["stop"].Transitions[0].UnlessGuards[0].RegisteredFunc)
+	fmt.Println(machineDef.AfterCallbacks[0].To, machineDef.AfterCallbacks[0].Do[0].RegisteredFunc)
+	fmt.Println(machineDef.FinalStates, machineDef.Events[statemachine.DoneEvent("running")].Transitions[0].To)
+
+	// Output:
+	// line 8: element <log> in <onexit> of 'running' is not supported
+	// line 16: transition on 'crash' from 'processing' targets 'stopped', which is not a sibling state
+	// [stopped running exited] [pending processing]
+	// [pending] processing has-work
+	// is-busy
+	// [running] log-start
+	// [exited] exited
+}
+
+func ExampleExport() {
+	machineDef := &statemachine.MachineDef{
+		ID:           "turnstile",
+		States:       []string{"locked", "unlocked"},
+		InitialState: "locked",
+		Events: map[string]*statemachine.EventDef{
+			"coin": {
+				Transitions: []*statemachine.TransitionDef{{From: []string{"locked"}, To: "unlocked"}},
+			},
+			"push": {
+				Choice: &statemachine.ChoiceDef{
+					Condition: &statemachine.ChoiceConditionDef{RegisteredFunc: "is-clear"},
+					OnTrue: &statemachine.EventDef{
+						Transitions: []*statemachine.TransitionDef{
+							{
+								From: []string{"unlocked"},
+								To:   "locked",
+								Do:   []*statemachine.TransitionCallbackFuncDef{{RegisteredFunc: "count-pass"}},
+							},
+						},
+					},
+				},
+			},
+			"tick": {
+				TimedEvery: time.Second,
+			},
+		},
+		AfterCallbacks: []*statemachine.TransitionCallbackDef{
+			{
+				To: []string{"unlocked"},
+				Do: []*statemachine.TransitionCallbackFuncDef{{RegisteredFunc: "unlock-gate"}},
+			},
+		},
+		FailureCallbacks: []*statemachine.EventCallbackDef{
+			{
+				Do: []*statemachine.EventCallbackFuncDef{{RegisteredFunc: "log-failure"}},
+			},
+		},
+	}
+
+	warnings, err := scxml.Export(os.Stdout, machineDef)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, warning := range warnings {
+		fmt.Println(warning)
+	}
+
+	// Output:
+	// <?xml version="1.0" encoding="UTF-8"?>
+	// <scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" name="turnstile" initial="locked">
+	//   <state id="locked">
+	//     <transition event="coin" target="unlocked"></transition>
+	//   </state>
+	//   <state id="unlocked">
+	//     <onentry>
+	//       <script>unlock-gate</script>
+	//     </onentry>
+	//     <transition event="push" cond="is-clear" target="locked">
+	//       <script>count-pass</script>
+	//     </transition>
+	//   </state>
+	// </scxml>
+	// event 'tick' is exported without its timed_every of 1s
+	// after_failure callbacks are not supported
+}
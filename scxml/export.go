@@ -0,0 +1,415 @@
+package scxml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// Export encodes the definition as a SCXML document.
+//
+// The returned warnings list the parts of the definition which were left out
+// because they have no equivalent in SCXML, such as timed events, the context
+// and assign actions, history, fork and join, around, event and failure
+// callbacks, and guards, callbacks or invoked services without a
+// RegisteredFunc name.
+func Export(w io.Writer, def *statemachine.MachineDef) ([]Warning, error) {
+	ex := &exporter{}
+
+	root := &element{name: xml.Name{Space: Namespace, Local: "scxml"}}
+	root.setAttr("version", "1.0")
+	root.setAttr("name", def.ID)
+	root.setAttr("initial", def.InitialState)
+	ex.machine(root, def, "")
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return ex.warnings, err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := writeElement(encoder, root); err != nil {
+		return ex.warnings, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return ex.warnings, err
+	}
+	_, err := io.WriteString(w, "\n")
+	return ex.warnings, err
+}
+
+func (el *element) setAttr(name, value string) {
+	if value != "" {
+		el.attrs = append(el.attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+	}
+}
+
+func newElement(name string, children ...*element) *element {
+	return &element{name: xml.Name{Local: name}, children: children}
+}
+
+func writeElement(encoder *xml.Encoder, el *element) error {
+	start := xml.StartElement{Name: el.name, Attr: el.attrs}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	if el.text != "" {
+		if err := encoder.EncodeToken(xml.CharData(el.text)); err != nil {
+			return err
+		}
+	}
+	for _, child := range el.children {
+		if err := writeElement(encoder, child); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+type exporter struct {
+	warnings []Warning
+}
+
+// warnf records a warning about the machine at path, which lists the states
+// of its supermachines.
+func (ex *exporter) warnf(path string, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if path != "" {
+		message = fmt.Sprintf("in '%s': %s", path, message)
+	}
+	ex.warnings = append(ex.warnings, Warning{Message: message})
+}
+
+// exportState collects the content of a state element.
+type exportState struct {
+	id          string
+	onEntry     []*element
+	onExit      []*element
+	invokes     []*element
+	transitions []*element
+}
+
+// machine appends the states of def to parent.
+func (ex *exporter) machine(parent *element, def *statemachine.MachineDef, path string) {
+	var states []*exportState
+	for _, state := range def.KnownStates() {
+		states = append(states, &exportState{id: state})
+	}
+	if def.Context != nil {
+		ex.warnf(path, "context is not supported")
+	}
+
+	deferred := make([]string, 0, len(def.Deferred))
+	for event := range def.Deferred {
+		deferred = append(deferred, event)
+	}
+	sort.Strings(deferred)
+	for _, event := range deferred {
+		ex.warnf(path, "deferral of event '%s' in %v is not supported", event, def.Deferred[event])
+	}
+
+	events := make([]string, 0, len(def.Events))
+	for event := range def.Events {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	for _, event := range events {
+		eventDef := def.Events[event]
+		if eventDef != nil && eventDef.TimedEvery != 0 {
+			ex.warnf(path, "event '%s' is exported without its timed_every of %s", event, eventDef.TimedEvery)
+		}
+		ex.event(states, path, event, eventDef, nil)
+	}
+	ex.event(states, path, "", &statemachine.EventDef{Transitions: def.Always}, nil)
+	ex.invokes(states, path, def.Invokes)
+
+	ex.callbacks(states, path, "before_transition", def.BeforeCallbacks)
+	ex.callbacks(states, path, "after_transition", def.AfterCallbacks)
+	for range def.AroundCallbacks {
+		ex.warnf(path, "around_transition callbacks are not supported")
+	}
+	for range def.BeforeEventCallbacks {
+		ex.warnf(path, "before_event callbacks are not supported")
+	}
+	for range def.AfterEventCallbacks {
+		ex.warnf(path, "after_event callbacks are not supported")
+	}
+	for range def.FailureCallbacks {
+		ex.warnf(path, "after_failure callbacks are not supported")
+	}
+
+	for _, state := range states {
+		el := newElement("state")
+		if def.IsFinalState(state.id) {
+			if len(state.transitions) > 0 || len(def.Submachines[state.id]) > 0 {
+				ex.warnf(path, "final state '%s' with transitions or a submachine is exported as a state", state.id)
+			} else {
+				el.name.Local = "final"
+			}
+		}
+		el.setAttr("id", state.id)
+		if len(state.onEntry) > 0 {
+			el.children = append(el.children, newElement("onentry", state.onEntry...))
+		}
+		if len(state.onExit) > 0 {
+			el.children = append(el.children, newElement("onexit", state.onExit...))
+		}
+		el.children = append(el.children, state.invokes...)
+		el.children = append(el.children, state.transitions...)
+
+		submachineDefs := def.Submachines[state.id]
+		switch {
+		case len(submachineDefs) == 1:
+			submachineDef := submachineDefs[0]
+			if submachineDef.ID != "" {
+				ex.warnf(path, "id '%s' of the submachine of '%s' is not exported", submachineDef.ID, state.id)
+			}
+			el.setAttr("initial", submachineDef.InitialState)
+			ex.machine(el, submachineDef, joinPath(path, state.id))
+		case len(submachineDefs) > 1:
+			el.name.Local = "parallel"
+			for i, submachineDef := range submachineDefs {
+				el.children = append(el.children, ex.region(submachineDef, state.id, i, path))
+			}
+		}
+
+		parent.children = append(parent.children, el)
+	}
+}
+
+// invokes adds invoke elements for the services to the states which invoke
+// them.
+func (ex *exporter) invokes(states []*exportState, path string, invokeDefs []*statemachine.InvokeDef) {
+	for _, invokeDef := range invokeDefs {
+		if invokeDef.RegisteredFunc == "" {
+			ex.warnf(path, "invoked service '%s' without a registered func is not supported", invokeDef.ID)
+			continue
+		}
+		for _, state := range states {
+			if state.id == invokeDef.State {
+				el := newElement("invoke")
+				el.setAttr("id", invokeDef.ID)
+				el.setAttr("src", invokeDef.RegisteredFunc)
+				state.invokes = append(state.invokes, el)
+			}
+		}
+	}
+}
+
+// region returns the element for the i'th parallel submachine of state.
+func (ex *exporter) region(def *statemachine.MachineDef, state string, i int, path string) *element {
+	id := def.ID
+	if id == "" {
+		id = state + "-region" + strconv.Itoa(i)
+	}
+
+	region := newElement("state")
+	region.setAttr("id", id)
+	region.setAttr("initial", def.InitialState)
+	ex.machine(region, def, joinPath(path, state+"/"+id))
+
+	// a submachine of a single state named after it is an atomic region.
+	if knownStates := def.KnownStates(); len(knownStates) == 1 && knownStates[0] == id {
+		return region.children[0]
+	}
+	return region
+}
+
+// event adds transition elements for eventDef to the states they are from.
+// Transitions in the branches of a choice carry the choice condition in conds.
+// The transitions of an empty event are eventless.
+func (ex *exporter) event(states []*exportState, path, event string, eventDef *statemachine.EventDef, conds []string) {
+	if eventDef == nil {
+		return
+	}
+
+	for _, transitionDef := range eventDef.Transitions {
+		cond, ok := guardConds(conds, transitionDef.IfGuards, transitionDef.UnlessGuards)
+		if !ok {
+			ex.warnf(path, "%s has a guard without a registered func", describeTransition(event, transitionDef.To))
+			continue
+		}
+		if len(transitionDef.Assigns) > 0 {
+			ex.warnf(path, "%s is exported without its assign actions", describeTransition(event, transitionDef.To))
+		}
+		if transitionDef.History != "" {
+			ex.warnf(path, "%s is exported without its %s history", describeTransition(event, transitionDef.To), transitionDef.History)
+		}
+		if len(transitionDef.Fork) != 0 || len(transitionDef.Join) != 0 {
+			ex.warnf(path, "%s is exported without its fork and join", describeTransition(event, transitionDef.To))
+		}
+
+		var scripts []*element
+		for _, funcDef := range transitionDef.Do {
+			if funcDef.RegisteredFunc == "" {
+				ex.warnf(path, "action of %s without a registered func is not supported", describeTransition(event, transitionDef.To))
+				continue
+			}
+			script := newElement("script")
+			script.text = funcDef.RegisteredFunc
+			scripts = append(scripts, script)
+		}
+
+		for _, state := range states {
+			if !transitionDef.Matches(state.id) {
+				continue
+			}
+			el := newElement("transition")
+			el.setAttr("event", scxmlEvent(event, state.id))
+			el.setAttr("cond", strings.Join(cond, " && "))
+			el.setAttr("target", transitionDef.To)
+			el.children = append(el.children, scripts...)
+			state.transitions = append(state.transitions, el)
+		}
+	}
+
+	choiceDef := eventDef.Choice
+	if choiceDef == nil {
+		return
+	}
+	if choiceDef.Condition == nil || choiceDef.Condition.RegisteredFunc == "" {
+		ex.warnf(path, "choice on '%s' has a condition without a registered func", event)
+		return
+	}
+	var unlessGuards []*statemachine.TransitionGuardDef
+	if choiceDef.UnlessGuard != nil {
+		unlessGuards = append(unlessGuards, choiceDef.UnlessGuard)
+	}
+	cond, ok := guardConds(conds, nil, unlessGuards)
+	if !ok {
+		ex.warnf(path, "choice on '%s' has an unless guard without a registered func", event)
+		return
+	}
+
+	condition := choiceDef.Condition.RegisteredFunc
+	ex.event(states, path, event, choiceDef.OnTrue, append(append([]string{}, cond...), condition))
+	ex.event(states, path, event, choiceDef.OnFalse, append(append([]string{}, cond...), "!"+condition))
+}
+
+// callbacks maps before callbacks from states to <onexit>, and after
+// callbacks to states to <onentry>.
+func (ex *exporter) callbacks(states []*exportState, path, kind string, callbackDefs []*statemachine.TransitionCallbackDef) {
+	for _, callbackDef := range callbackDefs {
+		if callbackDef.ExitToState != "" {
+			ex.warnf(path, "%s callback exiting to state '%s' is not supported", kind, callbackDef.ExitToState)
+		}
+
+		var scripts []*element
+		for _, funcDef := range callbackDef.Do {
+			if funcDef.RegisteredFunc == "" {
+				ex.warnf(path, "%s callback func without a registered func is not supported", kind)
+				continue
+			}
+			script := newElement("script")
+			script.text = funcDef.RegisteredFunc
+			scripts = append(scripts, script)
+		}
+		if len(scripts) == 0 {
+			continue
+		}
+
+		var matchStates []string
+		if kind == "before_transition" {
+			matchStates = callbackDef.From
+			if len(callbackDef.ExceptFrom) > 0 || len(callbackDef.To) > 0 || len(callbackDef.ExceptTo) > 0 {
+				ex.warnf(path, "%s callback %v is only supported when filtered by from states", kind, scriptNames(scripts))
+				continue
+			}
+		} else {
+			matchStates = callbackDef.To
+			if len(callbackDef.From) > 0 || len(callbackDef.ExceptFrom) > 0 || len(callbackDef.ExceptTo) > 0 {
+				ex.warnf(path, "%s callback %v is only supported when filtered by to states", kind, scriptNames(scripts))
+				continue
+			}
+		}
+
+		for _, state := range states {
+			if len(matchStates) > 0 && !contains(matchStates, state.id) {
+				continue
+			}
+			if kind == "before_transition" {
+				state.onExit = append(state.onExit, scripts...)
+			} else {
+				state.onEntry = append(state.onEntry, scripts...)
+			}
+		}
+	}
+}
+
+// guardConds appends the expressions of the guards to conds, with unless
+// guards negated. It returns false if a guard has no registered func.
+func guardConds(conds []string, ifGuards, unlessGuards []*statemachine.TransitionGuardDef) ([]string, bool) {
+	cond := append([]string{}, conds...)
+	for _, guardDef := range ifGuards {
+		expr, ok := guardCond(guardDef)
+		if !ok {
+			return nil, false
+		}
+		cond = append(cond, expr)
+	}
+	for _, guardDef := range unlessGuards {
+		expr, ok := guardCond(guardDef)
+		if !ok {
+			return nil, false
+		}
+		cond = append(cond, "!"+expr)
+	}
+	return cond, true
+}
+
+// guardCond returns the expression of the guard, in parentheses when it
+// combines more than one guard.
+func guardCond(guardDef *statemachine.TransitionGuardDef) (string, bool) {
+	expr, ok := guardDef.Cond()
+	if len(guardDef.All) > 1 || len(guardDef.Any) > 1 {
+		expr = "(" + expr + ")"
+	}
+	return expr, ok
+}
+
+func scriptNames(scripts []*element) []string {
+	var names []string
+	for _, script := range scripts {
+		names = append(names, script.text)
+	}
+	return names
+}
+
+// describeTransition names the transition on event, or the eventless
+// transition if event is empty, to the state, for warnings.
+func describeTransition(event, to string) string {
+	if event == "" {
+		return fmt.Sprintf("eventless transition to '%s'", to)
+	}
+	return fmt.Sprintf("transition on '%s' to '%s'", event, to)
+}
+
+// scxmlEvent returns the SCXML name of event, which is the completion event
+// of the state it is from if it is statemachine.DoneEvent of that state.
+func scxmlEvent(event, from string) string {
+	if event == statemachine.DoneEvent(from) {
+		return doneStatePrefix + from
+	}
+	return event
+}
+
+func joinPath(path, state string) string {
+	if path == "" {
+		return state
+	}
+	return path + "/" + state
+}
+
+func contains(states []string, state string) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,448 @@
+package scxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// element is a parsed XML element, along with its line in the document.
+type element struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*element
+	text     string
+	line     int
+}
+
+func (el *element) attr(name string) string {
+	for _, attr := range el.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Import decodes a SCXML document into a MachineDef, and validates it.
+//
+// The returned warnings list the elements and attributes which were left out
+// because they have no equivalent in a MachineDef.
+func Import(r io.Reader) (*statemachine.MachineDef, []Warning, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root, err := parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if root.name.Local != "scxml" {
+		return nil, nil, fmt.Errorf("line %d: expected <scxml> root element, found <%s>", root.line, root.name.Local)
+	}
+
+	im := &importer{foreign: map[*element]bool{}}
+	im.checkAttrs(root, "version", "name", "initial", "datamodel")
+	if datamodel := root.attr("datamodel"); datamodel != "" && datamodel != "null" {
+		im.warnf(root, "datamodel '%s' is not supported", datamodel)
+	}
+
+	def := im.machine(root, root.attr("initial"))
+	def.ID = root.attr("name")
+
+	if err := def.Validate(); err != nil {
+		return nil, im.warnings, err
+	}
+	return def, im.warnings, nil
+}
+
+// parse reads the document into a tree of elements.
+func parse(data []byte) (*element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	lineAt := func(offset int64) int {
+		return bytes.Count(data[:offset], []byte("\n")) + 1
+	}
+
+	var root *element
+	var stack []*element
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			el := &element{
+				name:  token.Name,
+				attrs: token.Attr,
+				line:  lineAt(offset),
+			}
+			if len(stack) == 0 {
+				root = el
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, el)
+			}
+			stack = append(stack, el)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(token)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("document has no root element")
+	}
+	return root, nil
+}
+
+type importer struct {
+	warnings []Warning
+	foreign  map[*element]bool
+}
+
+func (im *importer) warnf(el *element, format string, args ...interface{}) {
+	im.warnings = append(im.warnings, Warning{
+		Line:    el.line,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// checkAttrs warns about the attributes of el which aren't listed as known.
+func (im *importer) checkAttrs(el *element, known ...string) {
+	for _, attr := range el.attrs {
+		if attr.Name.Space != "" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		isKnown := false
+		for _, name := range known {
+			if attr.Name.Local == name {
+				isKnown = true
+			}
+		}
+		if !isKnown {
+			im.warnf(el, "attribute '%s' of <%s> is not supported", attr.Name.Local, el.name.Local)
+		}
+	}
+}
+
+func (im *importer) isSCXML(el *element) bool {
+	if el.name.Space != "" && el.name.Space != Namespace {
+		if im.foreign[el] {
+			return false
+		}
+		im.foreign[el] = true
+		im.warnf(el, "element <%s> in namespace '%s' is not supported", el.name.Local, el.name.Space)
+		return false
+	}
+	return true
+}
+
+// pendingTransition is an event transition, or an eventless one, held back
+// until all states at its level are known.
+type pendingTransition struct {
+	el     *element
+	event  string
+	always bool
+	def    *statemachine.TransitionDef
+}
+
+// machine maps the child states of el into a MachineDef.
+func (im *importer) machine(el *element, initial string) *statemachine.MachineDef {
+	def := statemachine.NewMachineDef()
+
+	var transitions []*pendingTransition
+	for _, child := range el.children {
+		if !im.isSCXML(child) {
+			continue
+		}
+		switch child.name.Local {
+		case "state", "parallel", "final":
+			transitions = append(transitions, im.state(def, child)...)
+		case "initial":
+			if initial == "" {
+				initial = im.initial(child)
+			} else {
+				im.warnf(child, "<initial> is ignored in favor of the initial attribute")
+			}
+		case "transition", "onentry", "onexit", "history", "invoke", "datamodel":
+			if el.name.Local == "scxml" {
+				im.warnf(child, "element <%s> is not supported", child.name.Local)
+			}
+			// otherwise handled by state(), at the parent level.
+		default:
+			im.warnf(child, "element <%s> is not supported", child.name.Local)
+		}
+	}
+
+	if targets := strings.Fields(initial); len(targets) > 1 {
+		im.warnf(el, "initial states %v are not supported, using '%s'", targets, targets[0])
+		initial = targets[0]
+	}
+	if initial == "" && len(def.States) > 0 {
+		initial = def.States[0]
+	}
+	def.InitialState = initial
+
+	for _, transition := range transitions {
+		if !isKnownState(def, transition.def.To) {
+			name := fmt.Sprintf("transition on '%s'", transition.event)
+			if transition.always {
+				name = "eventless transition"
+			}
+			im.warnf(transition.el, "%s from '%s' targets '%s', which is not a sibling state",
+				name, transition.def.From[0], transition.def.To)
+			continue
+		}
+		if transition.always {
+			def.AddAlways(transition.def)
+			continue
+		}
+		eventDef, ok := def.Events[transition.event]
+		if !ok {
+			eventDef = &statemachine.EventDef{}
+			def.AddEvent(transition.event, eventDef)
+		}
+		eventDef.AddTransition(transition.def)
+	}
+
+	return def
+}
+
+// state adds the state el to def, and returns its event transitions.
+func (im *importer) state(def *statemachine.MachineDef, el *element) []*pendingTransition {
+	switch el.name.Local {
+	case "parallel", "final":
+		im.checkAttrs(el, "id")
+	default:
+		im.checkAttrs(el, "id", "initial")
+	}
+
+	id := el.attr("id")
+	if id == "" {
+		im.warnf(el, "<%s> without an id is not supported", el.name.Local)
+		return nil
+	}
+	def.SetStates(id)
+
+	if el.name.Local == "final" {
+		def.SetFinalStates(id)
+	}
+
+	var transitions []*pendingTransition
+	var regions []*element
+	for _, child := range el.children {
+		if !im.isSCXML(child) {
+			continue
+		}
+		switch child.name.Local {
+		case "transition":
+			transitions = append(transitions, im.transition(id, child)...)
+		case "onentry":
+			if funcDefs := im.script(id, child); len(funcDefs) > 0 {
+				def.AddAfterCallback(&statemachine.TransitionCallbackDef{To: []string{id}, Do: funcDefs})
+			}
+		case "onexit":
+			if funcDefs := im.script(id, child); len(funcDefs) > 0 {
+				def.AddBeforeCallback(&statemachine.TransitionCallbackDef{From: []string{id}, Do: funcDefs})
+			}
+		case "invoke":
+			im.invoke(def, id, child)
+		case "state", "parallel", "final":
+			regions = append(regions, child)
+		case "initial":
+			// handled by machine().
+		default:
+			im.warnf(child, "element <%s> in state '%s' is not supported", child.name.Local, id)
+		}
+	}
+
+	if len(regions) == 0 {
+		return transitions
+	}
+
+	if el.name.Local != "parallel" {
+		def.SetSubmachine(id, im.machine(el, el.attr("initial")))
+		return transitions
+	}
+
+	for _, region := range regions {
+		regionID := region.attr("id")
+		if !hasChildStates(region) {
+			// an atomic region is a submachine of its single state.
+			submachineDef := im.machine(&element{name: el.name, children: []*element{region}}, "")
+			submachineDef.ID = regionID
+			def.SetSubmachine(id, submachineDef)
+			continue
+		}
+
+		for _, child := range region.children {
+			switch child.name.Local {
+			case "transition", "onentry", "onexit":
+				im.warnf(child, "element <%s> of parallel region '%s' is not supported", child.name.Local, regionID)
+			}
+		}
+		if region.name.Local == "parallel" {
+			im.warnf(region, "nested parallel region '%s' is imported as a compound state", regionID)
+		}
+		im.checkAttrs(region, "id", "initial")
+		submachineDef := im.machine(region, region.attr("initial"))
+		submachineDef.ID = regionID
+		def.SetSubmachine(id, submachineDef)
+	}
+
+	return transitions
+}
+
+// invoke adds the service invoked by the state to def. The src of the
+// <invoke> element names the registered func of the service, and its id
+// defaults to the state.
+func (im *importer) invoke(def *statemachine.MachineDef, state string, el *element) {
+	im.checkAttrs(el, "id", "src")
+	for _, child := range el.children {
+		if im.isSCXML(child) {
+			im.warnf(child, "element <%s> of <invoke> in state '%s' is not supported", child.name.Local, state)
+		}
+	}
+
+	name, ok := parseFuncName(el.attr("src"))
+	if !ok {
+		im.warnf(el, "<invoke> in state '%s' without a registered func as its src is not supported", state)
+		return
+	}
+	id := el.attr("id")
+	if id == "" {
+		id = state
+	}
+	def.AddInvoke(&statemachine.InvokeDef{ID: id, State: state, RegisteredFunc: name})
+}
+
+// initial returns the target of the <initial> element's transition.
+func (im *importer) initial(el *element) string {
+	for _, child := range el.children {
+		if child.name.Local == "transition" {
+			if len(child.children) > 0 {
+				im.warnf(child, "executable content of the initial transition is not supported")
+			}
+			return child.attr("target")
+		}
+	}
+	im.warnf(el, "<initial> without a transition is not supported")
+	return ""
+}
+
+func (im *importer) transition(from string, el *element) []*pendingTransition {
+	im.checkAttrs(el, "event", "cond", "target", "type")
+
+	event, target, cond := el.attr("event"), el.attr("target"), el.attr("cond")
+	name := fmt.Sprintf("transition on '%s'", event)
+	if event == "" {
+		name = "eventless transition"
+	}
+	switch {
+	case target == "":
+		im.warnf(el, "targetless %s from '%s' is not supported", name, from)
+		return nil
+	case len(strings.Fields(target)) > 1:
+		im.warnf(el, "%s from '%s' to multiple targets is not supported", name, from)
+		return nil
+	}
+
+	if kind := el.attr("type"); kind != "" && kind != "external" {
+		im.warnf(el, "transition type '%s' is imported as external", kind)
+	}
+	actions := im.script(from, el)
+
+	var ifGuards, unlessGuards []*statemachine.TransitionGuardDef
+	if cond != "" {
+		var ok bool
+		if ifGuards, unlessGuards, ok = parseCond(cond); !ok {
+			im.warnf(el, "cond '%s' of %s from '%s' is not an expression of registered func names", cond, name, from)
+			return nil
+		}
+	}
+
+	if event == "" {
+		transitionDef := &statemachine.TransitionDef{
+			From:         []string{from},
+			To:           target,
+			IfGuards:     ifGuards,
+			UnlessGuards: unlessGuards,
+			Do:           actions,
+		}
+		return []*pendingTransition{{el: el, always: true, def: transitionDef}}
+	}
+
+	var transitions []*pendingTransition
+	for _, event := range strings.Fields(event) {
+		if strings.Contains(event, "*") {
+			im.warnf(el, "event descriptor '%s' is not supported", event)
+			continue
+		}
+
+		transitionDef := &statemachine.TransitionDef{
+			From:         []string{from},
+			To:           target,
+			IfGuards:     ifGuards,
+			UnlessGuards: unlessGuards,
+			Do:           actions,
+		}
+		if strings.HasPrefix(event, doneStatePrefix) {
+			event = statemachine.DoneEvent(strings.TrimPrefix(event, doneStatePrefix))
+		}
+		transitions = append(transitions, &pendingTransition{el: el, event: event, def: transitionDef})
+	}
+	return transitions
+}
+
+// script maps the <script> elements of an <onentry>, <onexit> or
+// <transition> element to callback or action funcs.
+func (im *importer) script(state string, el *element) []*statemachine.TransitionCallbackFuncDef {
+	var funcDefs []*statemachine.TransitionCallbackFuncDef
+	for _, child := range el.children {
+		if child.name.Local != "script" || child.attr("src") != "" {
+			im.warnf(child, "element <%s> in <%s> of '%s' is not supported", child.name.Local, el.name.Local, state)
+			continue
+		}
+		name, ok := parseFuncName(child.text)
+		if !ok {
+			im.warnf(child, "script '%s' in <%s> of '%s' is not a registered func name", strings.TrimSpace(child.text), el.name.Local, state)
+			continue
+		}
+		funcDefs = append(funcDefs, &statemachine.TransitionCallbackFuncDef{RegisteredFunc: name})
+	}
+	return funcDefs
+}
+
+func hasChildStates(el *element) bool {
+	for _, child := range el.children {
+		switch child.name.Local {
+		case "state", "parallel", "final":
+			return true
+		}
+	}
+	return false
+}
+
+func isKnownState(def *statemachine.MachineDef, state string) bool {
+	for _, known := range def.KnownStates() {
+		if known == state {
+			return true
+		}
+	}
+	return false
+}
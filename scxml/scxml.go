@@ -0,0 +1,195 @@
+// Package scxml imports and exports state machine definitions as W3C SCXML
+// (State Chart XML) documents.
+//
+// SCXML elements are mapped to a MachineDef as follows:
+//
+//	<state>                          state
+//	<final>                          final state
+//	<state> with child states        state with a submachine
+//	<parallel>                       state with a submachine per child region
+//	<initial>, initial="..."         initial state
+//	<transition event cond target>   event transition from the parent state
+//	<transition cond target>         eventless transition from the parent state
+//	<transition><script>fn</script>  action of the transition
+//	event="done.state.id"            completion event "done.<id>"
+//	<onentry><script>fn</script>     after callback, to the parent state
+//	<onexit><script>fn</script>      before callback, from the parent state
+//	<invoke id src="fn">             service invoked by the parent state
+//	event="done.invoke.id"           completion event of the service
+//
+// The cond attribute of a transition is an expression of registered func
+// names, combined by the &&, || and ! operators and parentheses, such as
+// `is-running && !(is-paused || is-stopping)`. Negated terms of the
+// top-level conjunction become unless guards, and other combinations become
+// combined guards (see statemachine.All). Executable content refers to
+// registered funcs by the body of a <script> element.
+//
+// Anything that can't be mapped, in either direction, is left out and
+// reported as a Warning.
+package scxml
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// Namespace is the SCXML namespace URI.
+const Namespace = "http://www.w3.org/2005/07/scxml"
+
+// doneStatePrefix prefixes the id of a state in the name of its SCXML
+// completion event, which is statemachine.DoneEvent in a definition.
+const doneStatePrefix = "done.state."
+
+// Warning describes an element or definition which was left out of the
+// result because it can't be mapped.
+type Warning struct {
+	// Line is the line number of the element in the imported document. It is
+	// zero for warnings produced by Export.
+	Line    int
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Line == 0 {
+		return w.Message
+	}
+	return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+}
+
+var funcNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.:-]*$`)
+
+// parseFuncName returns the registered func name referred to by s, which may
+// be written as a call without args, such as `start()`.
+func parseFuncName(s string) (string, bool) {
+	name := strings.TrimSuffix(strings.TrimSpace(s), "()")
+	return name, funcNamePattern.MatchString(name)
+}
+
+// parseCond parses a cond expression into its if and unless guards. Negated
+// terms of the top-level conjunction become unless guards.
+func parseCond(cond string) (ifGuards, unlessGuards []*statemachine.TransitionGuardDef, ok bool) {
+	p := &condParser{tokens: condTokens(cond)}
+	guardDef, ok := p.or()
+	if !ok || p.pos != len(p.tokens) {
+		return nil, nil, false
+	}
+
+	terms := []*statemachine.TransitionGuardDef{guardDef}
+	if len(guardDef.All) != 0 {
+		terms = guardDef.All
+	}
+	for _, term := range terms {
+		if term.Not != nil {
+			unlessGuards = append(unlessGuards, term.Not)
+		} else {
+			ifGuards = append(ifGuards, term)
+		}
+	}
+	return ifGuards, unlessGuards, true
+}
+
+// condTokens splits a cond expression into operators, parentheses and
+// names.
+func condTokens(cond string) []string {
+	var tokens []string
+	for i := 0; i < len(cond); {
+		switch {
+		case cond[i] == ' ' || cond[i] == '\t' || cond[i] == '\n' || cond[i] == '\r':
+			i++
+		case strings.HasPrefix(cond[i:], "&&"), strings.HasPrefix(cond[i:], "||"):
+			tokens = append(tokens, cond[i:i+2])
+			i += 2
+		case strings.ContainsRune("()!&|", rune(cond[i])):
+			tokens = append(tokens, cond[i:i+1])
+			i++
+		default:
+			j := i
+			for j < len(cond) && !strings.ContainsRune(" \t\n\r()!&|", rune(cond[j])) {
+				j++
+			}
+			tokens = append(tokens, cond[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+// condParser parses cond expressions of registered func names, combined by
+// the &&, || and ! operators, and parentheses.
+type condParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *condParser) peek(token string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos] == token
+}
+
+func (p *condParser) or() (*statemachine.TransitionGuardDef, bool) {
+	return p.binary("||", p.and, func(guardDefs []*statemachine.TransitionGuardDef) *statemachine.TransitionGuardDef {
+		return &statemachine.TransitionGuardDef{Any: guardDefs}
+	})
+}
+
+func (p *condParser) and() (*statemachine.TransitionGuardDef, bool) {
+	return p.binary("&&", p.unary, func(guardDefs []*statemachine.TransitionGuardDef) *statemachine.TransitionGuardDef {
+		return &statemachine.TransitionGuardDef{All: guardDefs}
+	})
+}
+
+func (p *condParser) binary(op string, operand func() (*statemachine.TransitionGuardDef, bool), combine func([]*statemachine.TransitionGuardDef) *statemachine.TransitionGuardDef) (*statemachine.TransitionGuardDef, bool) {
+	guardDef, ok := operand()
+	if !ok {
+		return nil, false
+	}
+	guardDefs := []*statemachine.TransitionGuardDef{guardDef}
+	for p.peek(op) {
+		p.pos++
+		if guardDef, ok = operand(); !ok {
+			return nil, false
+		}
+		guardDefs = append(guardDefs, guardDef)
+	}
+	if len(guardDefs) == 1 {
+		return guardDefs[0], true
+	}
+	return combine(guardDefs), true
+}
+
+func (p *condParser) unary() (*statemachine.TransitionGuardDef, bool) {
+	switch {
+	case p.pos == len(p.tokens):
+		return nil, false
+
+	case p.peek("!"):
+		p.pos++
+		guardDef, ok := p.unary()
+		if !ok {
+			return nil, false
+		}
+		return &statemachine.TransitionGuardDef{Not: guardDef}, true
+
+	case p.peek("("):
+		p.pos++
+		guardDef, ok := p.or()
+		if !ok || !p.peek(")") {
+			return nil, false
+		}
+		p.pos++
+		return guardDef, true
+	}
+
+	name, ok := parseFuncName(p.tokens[p.pos])
+	if !ok {
+		return nil, false
+	}
+	p.pos++
+	// names may be written as calls without args, such as `is-running()`.
+	if p.peek("(") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == ")" {
+		p.pos += 2
+	}
+	return &statemachine.TransitionGuardDef{RegisteredFunc: name}, true
+}
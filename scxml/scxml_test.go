@@ -0,0 +1,120 @@
+package scxml_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/scxml"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	machineDef, err := statemachine.LoadHCL("player.hcl", []byte(`
+		id            = "player"
+		states        = ["idle", "playing"]
+		initial_state = "idle"
+
+		event "play" {
+		  transition {
+		    from   = ["idle"]
+		    to     = "playing"
+		    if     = [has-media, any(is-local, all(is-online, not(is-metered)))]
+		    unless = [is-muted]
+		  }
+		}
+
+		event "stop" {
+		  transition {
+		    from = ["playing"]
+		    to   = "idle"
+		  }
+		}
+
+		event "done.playing" {
+		  transition {
+		    from = ["playing"]
+		    to   = "idle"
+		  }
+		}
+
+		event "done.invoke.loader" {
+		  transition {
+		    from = ["idle"]
+		    to   = "playing"
+		  }
+		}
+
+		always {
+		  from = ["idle"]
+		  to   = "playing"
+		  if   = [is-autoplay]
+		}
+
+		invoke "idle" {
+		  id  = "loader"
+		  src = fetch-media
+		}
+
+		invoke "playing" {
+		  src = play-media
+		}
+
+		submachine "playing" {
+		  id            = "video"
+		  states        = ["buffering", "rendering"]
+		  initial_state = "buffering"
+		  final_states  = ["rendering"]
+
+		  event "buffered" {
+		    transition {
+		      from = ["buffering"]
+		      to   = "rendering"
+		    }
+		  }
+		}
+
+		submachine "playing" {
+		  id            = "audio"
+		  states        = ["audio"]
+		  initial_state = "audio"
+		  final_states  = ["audio"]
+		}
+
+		before_transition {
+		  from = ["playing"]
+		  do   = [release-media]
+		}
+
+		after_transition {
+		  to = ["playing"]
+		  do = [acquire-media]
+		}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc bytes.Buffer
+	warnings, err := scxml.Export(&doc, machineDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("unexpected export warnings: %v", warnings)
+	}
+
+	importedDef, warnings, err := scxml.Import(&doc)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, doc.String())
+	}
+	if len(warnings) > 0 {
+		t.Errorf("unexpected import warnings: %v", warnings)
+	}
+
+	want, _ := json.Marshal(machineDef)
+	got, _ := json.Marshal(importedDef)
+	if !bytes.Equal(got, want) {
+		t.Errorf("round trip changed the definition:\n got: %s\nwant: %s", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package statemachine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Snapshot is the state and context of a machine, and of its active
+// submachines by ID, as returned by Machine.Snapshot. It encodes as JSON,
+// with the context being converted back to the type of the definition's
+// when restored.
+type Snapshot struct {
+	State       string
+	Context     interface{}          `json:",omitempty"`
+	Submachines map[string]*Snapshot `json:",omitempty"`
+
+	// History holds the states of the submachines of the states which the
+	// machine has left, by state and submachine ID, which are restored by
+	// transitions with history (see TransitionToBuilder.WithHistory).
+	History map[string]map[string]*Snapshot `json:",omitempty"`
+
+	// Deferred holds the events queued by the states which defer them (see
+	// MachineBuilder.Defer), in the order they were fired.
+	Deferred []DeferredEvent `json:",omitempty"`
+
+	// Sends holds the pending sends of the machine (see Machine.SendAfter),
+	// in the order they are due, which are rescheduled by Restore with the
+	// time they had left.
+	Sends []*DelayedSend `json:",omitempty"`
+}
+
+// Snapshot implements Machine. Like GetState, it may be called from the
+// callbacks of a transition, e.g. to persist the machine after it.
+func (m *machineImpl) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		State:    m.currentState,
+		Context:  m.GetContext(),
+		History:  copyHistory(m.history),
+		Deferred: copyDeferred(m.deferred),
+		Sends:    m.delayedSends(),
+	}
+	for _, submachine := range m.submachines[m.currentState] {
+		if snapshot.Submachines == nil {
+			snapshot.Submachines = map[string]*Snapshot{}
+		}
+		snapshot.Submachines[submachine.def.ID] = submachine.Snapshot()
+	}
+	return snapshot
+}
+
+// Restore implements Machine.
+func (m *machineImpl) Restore(snapshot *Snapshot) error {
+	if err := m.restore(snapshot); err != nil {
+		return err
+	}
+	m.completeEntered(context.Background())
+	return nil
+}
+
+func (m *machineImpl) restore(snapshot *Snapshot) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if snapshot == nil {
+		return errors.New("no snapshot")
+	}
+	if err := m.setCurrentState(snapshot.State); err != nil {
+		return err
+	}
+	m.history = copyHistory(snapshot.History)
+	m.deferred = copyDeferred(snapshot.Deferred)
+	m.restoreSends(snapshot.Sends)
+
+	if snapshot.Context != nil {
+		context, err := convertContext(snapshot.Context, m.def.Context)
+		if err != nil {
+			return fmt.Errorf("could not restore context: %s", err)
+		}
+		m.setContext(context)
+	} else {
+		m.setContext(copyContext(m.def.Context))
+	}
+
+	for id, submachineSnapshot := range snapshot.Submachines {
+		submachine := m.activeSubmachine(id)
+		if submachine == nil {
+			return fmt.Errorf("no submachine '%s' in state '%s'", id, snapshot.State)
+		}
+		if err := submachine.restore(submachineSnapshot); err != nil {
+			return fmt.Errorf("submachine '%s': %s", id, err)
+		}
+	}
+	if err := m.settleEntered(); err != nil {
+		return err
+	}
+	m.startEnteredInvokes()
+	return nil
+}
+
+func (m *machineImpl) activeSubmachine(id string) *machineImpl {
+	for _, submachine := range m.submachines[m.currentState] {
+		if submachine.def.ID == id {
+			return submachine
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package statemachinetest
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// AssertTransition fires event on machine, and checks that it transitions
+// to wantState. The event may be qualified by a submachine ID path, e.g.
+// `process-id/succeed`. wantState is a path of states from the machine
+// down through its single submachines, e.g. `running/processing`, and only
+// as many states as it names are compared.
+//
+// It reports whether the assertion held.
+func AssertTransition(t testing.TB, machine statemachine.Machine, event string, wantState string) bool {
+	t.Helper()
+
+	if err := fire(machine, event); err != nil {
+		t.Errorf("fire %s: got error '%s', want transition to '%s'", event, err, wantState)
+		return false
+	}
+
+	want := strings.Split(wantState, "/")
+	got := statePath(machine.GetStateMap())
+	if len(got) > len(want) {
+		got = got[:len(want)]
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fire %s: got state '%s', want '%s'", event, strings.Join(got, "/"), wantState)
+		return false
+	}
+	return true
+}
+
+// AssertRejected fires event on machine, and checks that it fails with
+// wantErr, such as statemachine.ErrNoMatchingTransition, or an error which
+// wraps it, leaving the state of the machine as is. Any error is accepted if
+// wantErr is nil.
+//
+// It reports whether the assertion held.
+func AssertRejected(t testing.TB, machine statemachine.Machine, event string, wantErr error) bool {
+	t.Helper()
+
+	before := machine.GetStateMap()
+	err := fire(machine, event)
+	switch {
+	case err == nil:
+		t.Errorf("fire %s: got transition to '%s', want error", event, strings.Join(statePath(machine.GetStateMap()), "/"))
+		return false
+	case wantErr != nil && !errors.Is(err, wantErr):
+		t.Errorf("fire %s: got error '%s', want '%s'", event, err, wantErr)
+		return false
+	}
+
+	if after := machine.GetStateMap(); !reflect.DeepEqual(after, before) {
+		t.Errorf("fire %s: state changed from %v to %v", event, before, after)
+		return false
+	}
+	return true
+}
+
+// AssertCalls checks that the callbacks recorded by stubs since the last
+// check were called in the wanted order, and forgets them. Calls are written
+// as their kind and name, e.g. `before_transition notify-triggers`, or
+// `after_failure log-failure`.
+//
+// It reports whether the assertion held.
+func AssertCalls(t testing.TB, stubs *Stubs, want ...string) bool {
+	t.Helper()
+
+	calls := stubs.Calls()
+	stubs.ResetCalls()
+
+	got := make([]string, 0, len(calls))
+	for _, call := range calls {
+		got = append(got, call.String())
+	}
+	if len(got) == 0 && len(want) == 0 {
+		return true
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls:\n\t%s\nwant:\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+		return false
+	}
+	return true
+}
+
+// statePath returns the states of a state map, from the machine down
+// through its single submachines. Parallel submachines are left out.
+func statePath(stateMap statemachine.StateMap) []string {
+	var path []string
+	for len(stateMap) == 1 {
+		var substate interface{}
+		for state, value := range stateMap {
+			path = append(path, state)
+			substate = value
+		}
+
+		submachines, ok := substate.(statemachine.StateMap)
+		if !ok || len(submachines) != 1 {
+			break
+		}
+		var next interface{}
+		for _, value := range submachines {
+			next = value
+		}
+		switch next := next.(type) {
+		case string:
+			return append(path, next)
+		case statemachine.StateMap:
+			stateMap = next
+		default:
+			return path
+		}
+	}
+	return path
+}
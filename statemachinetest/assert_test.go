@@ -0,0 +1,209 @@
+package statemachinetest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/statemachinetest"
+)
+
+var callbacksHCL = []byte(`
+	states        = ["stopped", "starting", "running"]
+	initial_state = "stopped"
+
+	event "start" {
+	  transition {
+	    from = ["stopped"]
+	    to   = "starting"
+	    do   = [start-process]
+	  }
+	}
+
+	event "tick" {
+	  transition {
+	    from = ["starting"]
+	    to   = "running"
+	    if   = [is-process-running]
+	  }
+	}
+
+	before_transition {
+	  do = [notify-triggers]
+	}
+
+	around_transition {
+	  do = [measure]
+	}
+
+	after_transition {
+	  to = ["running"]
+	  do = [record-transition]
+	}
+
+	after_failure {
+	  do = [log-failure]
+	}
+`)
+
+func TestAssertHelpers(t *testing.T) {
+	machineDef, err := statemachine.LoadHCL("process.hcl", callbacksHCL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var measured []string
+	stubs := statemachinetest.Stub(machineDef).
+		Guard("is-process-running", false).
+		Func("measure", func(transition statemachine.Transition, next func()) {
+			measured = append(measured, transition.From()+" -> "+transition.To())
+			next()
+		})
+	machine := stubs.NewMachine()
+
+	statemachinetest.AssertTransition(t, machine, "start", "starting")
+	statemachinetest.AssertCalls(t, stubs,
+		"before_transition notify-triggers",
+		"around_transition measure",
+		"transition_action start-process",
+	)
+
+	statemachinetest.AssertRejected(t, machine, "tick", statemachine.ErrNoMatchingTransition)
+	statemachinetest.AssertCalls(t, stubs, "after_failure log-failure")
+
+	stubs.Guard("is-process-running", true)
+	statemachinetest.AssertTransition(t, machine, "tick", "running")
+	statemachinetest.AssertCalls(t, stubs,
+		"before_transition notify-triggers",
+		"around_transition measure",
+		"after_transition record-transition",
+	)
+
+	if want := []string{"stopped -> starting", "starting -> running"}; fmt.Sprint(measured) != fmt.Sprint(want) {
+		t.Errorf("got measured transitions %v, want %v", measured, want)
+	}
+
+	// the definition itself is left as is.
+	if machineDef.Events["tick"].Transitions[0].IfGuards[0].Guard != nil {
+		t.Errorf("got a bound guard in the original definition")
+	}
+}
+
+func TestAssertHelpers_Failures(t *testing.T) {
+	machineDef, err := statemachine.LoadHCL("process.hcl", callbacksHCL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stubs := statemachinetest.Stub(machineDef).Guard("is-process-running", true)
+	machine := stubs.NewMachine()
+
+	ft := &fakeT{TB: t}
+	if statemachinetest.AssertTransition(ft, machine, "tick", "running") {
+		t.Errorf("AssertTransition passed for an event without a matching transition")
+	}
+	if statemachinetest.AssertRejected(ft, machine, "start", nil) {
+		t.Errorf("AssertRejected passed for an allowed event")
+	}
+	if statemachinetest.AssertCalls(ft, stubs, "after_failure log-failure") {
+		t.Errorf("AssertCalls passed for calls out of order")
+	}
+	if len(ft.errors) != 3 {
+		t.Errorf("got %d errors, want 3: %v", len(ft.errors), ft.errors)
+	}
+}
+
+// fakeT collects errors instead of failing the test.
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestStub_PassesPayload(t *testing.T) {
+	type Order struct {
+		Amount int
+	}
+
+	stubs := statemachinetest.Stub(&statemachine.MachineDef{
+		States:       []string{"pending", "paid"},
+		InitialState: "pending",
+		Events: map[string]*statemachine.EventDef{
+			"pay": {
+				Transitions: []*statemachine.TransitionDef{{
+					From: []string{"pending"},
+					To:   "paid",
+					IfGuards: []*statemachine.TransitionGuardDef{{
+						Label: "positive-amount",
+						Guard: func(ctx context.Context, order *Order) bool { return order.Amount > 0 },
+					}},
+				}},
+			},
+		},
+	})
+	machine := stubs.NewMachine()
+
+	if err := machine.FireContext(context.Background(), "pay", &Order{}); err != statemachine.ErrNoMatchingTransition {
+		t.Fatalf("got error '%v', want '%s'", err, statemachine.ErrNoMatchingTransition)
+	}
+	if err := machine.FireContext(context.Background(), "pay", &Order{Amount: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	stubs.Guard("positive-amount", true)
+	machine = stubs.NewMachine()
+	if err := machine.FireContext(context.Background(), "pay", &Order{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStub_EventCallbacks(t *testing.T) {
+	machineDef, err := statemachine.LoadHCL("process.hcl", []byte(`
+		states        = ["stopped", "running"]
+		initial_state = "stopped"
+
+		event "start" {
+		  transition {
+		    from = ["stopped"]
+		    to   = "running"
+		  }
+		}
+
+		before_event {
+		  on = ["start"]
+		  do = [check-quota]
+		}
+
+		after_event {
+		  do = [audit-event]
+		}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errNoQuota := errors.New("no quota")
+	stubs := statemachinetest.Stub(machineDef).
+		Func("check-quota", func(event statemachine.Event) error { return errNoQuota })
+	machine := stubs.NewMachine()
+
+	statemachinetest.AssertRejected(t, machine, "start", errNoQuota)
+	statemachinetest.AssertCalls(t, stubs, "before_event check-quota")
+
+	stubs.Func("check-quota", func(event statemachine.Event) error { return fmt.Errorf("check quota: %w", errNoQuota) })
+	statemachinetest.AssertRejected(t, machine, "start", errNoQuota)
+	statemachinetest.AssertCalls(t, stubs, "before_event check-quota")
+
+	stubs.Func("check-quota", func() error { return nil })
+	statemachinetest.AssertTransition(t, machine, "start", "running")
+	if calls := stubs.Calls(); len(calls) != 2 || calls[1].From != "stopped" || calls[1].Event != "start" {
+		t.Errorf("got calls %+v, want an after_event call from stopped on start", calls)
+	}
+	statemachinetest.AssertCalls(t, stubs, "before_event check-quota", "after_event audit-event")
+}
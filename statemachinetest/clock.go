@@ -0,0 +1,95 @@
+package statemachinetest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// Clock is a fake statemachine.Clock, whose time only moves when it is
+// advanced, e.g. to fire the delayed sends of a machine (see
+// statemachine.Machine.SetClock) without waiting for them.
+type Clock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*clockTimer
+}
+
+var _ statemachine.Clock = (*Clock)(nil)
+
+// NewClock returns a Clock, which starts at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+type clockTimer struct {
+	clock *Clock
+	due   time.Time
+	f     func()
+}
+
+// Now implements statemachine.Clock.
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// AfterFunc implements statemachine.Clock. f is called by Advance, from the
+// goroutine which advances the clock.
+func (c *Clock) AfterFunc(d time.Duration, f func()) statemachine.ClockTimer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timer := &clockTimer{clock: c, due: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// Stop implements statemachine.ClockTimer.
+func (t *clockTimer) Stop() bool {
+	c := t.clock
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance moves the clock forward by d, and calls the funcs which become due,
+// in the order they are due, with the clock set to the time each is due at.
+// Funcs which are scheduled by those, and which are due by then, are called
+// too.
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	end := c.now.Add(d)
+	c.mutex.Unlock()
+
+	for {
+		c.mutex.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].due.Before(c.timers[j].due)
+		})
+		if len(c.timers) == 0 || c.timers[0].due.After(end) {
+			c.now = end
+			c.mutex.Unlock()
+			return
+		}
+		timer := c.timers[0]
+		c.timers = c.timers[1:]
+		if timer.due.After(c.now) {
+			c.now = timer.due
+		}
+		c.mutex.Unlock()
+
+		timer.f()
+	}
+}
@@ -0,0 +1,253 @@
+package statemachinetest_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/statemachinetest"
+)
+
+var processHCL = []byte(`
+	states        = ["stopped", "starting", "restarting"]
+	initial_state = "stopped"
+
+	event "start" {
+	  transition {
+	    from = ["stopped"]
+	    to   = "starting"
+	  }
+	}
+
+	event "tick" {
+	  transition {
+	    from = ["starting"]
+	    to   = "running"
+	    if   = [is-healthy]
+	  }
+
+	  transition {
+	    from = ["starting", "restarting"]
+	    to   = "restarting"
+	  }
+	}
+
+	event "stop" {
+	  choice {
+	    condition = is-graceful
+
+	    on_true {
+	      transition {
+	        from = ["running"]
+	        to   = "stopped"
+	      }
+	    }
+
+	    on_false {
+	      transition {
+	        to = "stopped"
+	      }
+	    }
+	  }
+	}
+
+	submachine "running" {
+	  id            = "job"
+	  states        = ["pending", "done"]
+	  initial_state = "pending"
+
+	  event "finish" {
+	    transition {
+	      from = ["pending"]
+	      to   = "done"
+	    }
+	  }
+
+	  after_transition {
+	    to            = ["done"]
+	    exit_to_state = "stopped"
+	  }
+	}
+`)
+
+func ExampleGenerate() {
+	machineDef, err := statemachine.LoadHCL("process.hcl", processHCL)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	suite, err := statemachinetest.Generate(machineDef)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, sequence := range suite.Sequences {
+		fmt.Println(sequence.Name)
+		for _, step := range sequence.Steps {
+			fmt.Println(" ", step.Event, step.Guards, step.Want)
+		}
+	}
+
+	// Output:
+	// sequence-1
+	//   start map[] map[starting:map[]]
+	//   stop map[is-graceful:false] map[stopped:map[]]
+	//   start map[] map[starting:map[]]
+	//   tick map[is-healthy:true] map[running:map[job:pending]]
+	//   stop map[is-graceful:true] map[stopped:map[]]
+	//   start map[] map[starting:map[]]
+	//   tick map[is-healthy:false] map[restarting:map[]]
+	//   stop map[is-graceful:false] map[stopped:map[]]
+	//   start map[] map[starting:map[]]
+	//   tick map[is-healthy:true] map[running:map[job:pending]]
+	//   job/finish map[] map[stopped:map[]]
+}
+
+func ExampleWriteGoTable() {
+	machineDef, err := statemachine.LoadHCL("turnstile.hcl", []byte(`
+		states        = ["locked", "unlocked"]
+		initial_state = "locked"
+
+		event "coin" {
+		  transition {
+		    from = ["locked"]
+		    to   = "unlocked"
+		  }
+		}
+
+		event "push" {
+		  transition {
+		    from = ["unlocked"]
+		    to   = "locked"
+		  }
+		}
+	`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	suite, err := statemachinetest.Generate(machineDef)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	statemachinetest.WriteGoTable(os.Stdout, "turnstile_test", "turnstileSequences", suite)
+
+	// Output:
+	// // Code generated by statemachine testgen. DO NOT EDIT.
+	//
+	// package turnstile_test
+	//
+	// import (
+	// 	"github.com/Gurpartap/statemachine-go"
+	// 	"github.com/Gurpartap/statemachine-go/statemachinetest"
+	// )
+	//
+	// var turnstileSequences = []*statemachinetest.Sequence{
+	// 	{
+	// 		Name: "sequence-1",
+	// 		Steps: []*statemachinetest.Step{
+	// 			{
+	// 				Event:  "coin",
+	// 				Covers: "event.coin.transitions[0]",
+	// 				Want:   statemachine.StateMap{"unlocked": statemachine.StateMap{}},
+	// 			},
+	// 			{
+	// 				Event:  "push",
+	// 				Covers: "event.push.transitions[0]",
+	// 				Want:   statemachine.StateMap{"locked": statemachine.StateMap{}},
+	// 			},
+	// 		},
+	// 	},
+	// }
+}
+
+func TestSequence_Run(t *testing.T) {
+	guards := map[string]bool{}
+	statemachine.RegisterFunc("is-healthy", func() bool { return guards["is-healthy"] })
+	statemachine.RegisterFunc("is-graceful", func() bool { return guards["is-graceful"] })
+
+	machineDef, err := statemachine.LoadHCL("process.hcl", processHCL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suite, err := statemachinetest.Generate(machineDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suite.Uncovered) > 0 {
+		t.Errorf("got uncovered transitions %v", suite.Uncovered)
+	}
+
+	coverage := statemachine.NewCoverage()
+	coverage.Track("process", machineDef)
+	defer coverage.Stop()
+
+	for _, sequence := range suite.Sequences {
+		machine := statemachine.NewMachine()
+		machine.SetMachineDef(machineDef)
+		sequence.Run(t, machine, func(stubs map[string]bool) {
+			guards = stubs
+		})
+	}
+
+	for key, transitionCoverage := range coverage.Machines["process"].Transitions {
+		if transitionCoverage.Taken == 0 {
+			t.Errorf("transition %s was not taken", key)
+		}
+	}
+}
+
+func TestGenerate_CombinedGuards(t *testing.T) {
+	machineDef, err := statemachine.LoadHCL("door.hcl", []byte(`
+		states        = ["closed", "open", "locked"]
+		initial_state = "closed"
+
+		event "push" {
+		  transition {
+		    from   = ["closed"]
+		    to     = "open"
+		    if     = [all(is-unlatched, not(is-jammed))]
+		    unless = [any(is-alarmed, is-jammed)]
+		  }
+
+		  transition {
+		    from = ["closed"]
+		    to   = "locked"
+		    if   = [not(all(is-unlatched, not(is-jammed)))]
+		  }
+		}
+
+		event "reset" {
+		  transition {
+		    to = "closed"
+		  }
+		}
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suite, err := statemachinetest.Generate(machineDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suite.Uncovered) > 0 {
+		t.Errorf("got uncovered transitions %v", suite.Uncovered)
+	}
+
+	stubs := statemachinetest.Stub(machineDef)
+	for _, sequence := range suite.Sequences {
+		sequence.Run(t, stubs.NewMachine(), func(guards map[string]bool) {
+			for name, result := range guards {
+				stubs.Guard(name, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package statemachinetest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// MaxConfigurations limits the number of distinct configurations, i.e.
+// combinations of the states of a machine and its submachines, which
+// Generate explores.
+var MaxConfigurations = 10000
+
+// Suite is a set of event sequences which, together, take every transition
+// of a definition which can be taken.
+type Suite struct {
+	Sequences []*Sequence
+
+	// Uncovered lists the transitions which no sequence takes, because they
+	// are unreachable, shadowed by earlier transitions, or need guard results
+	// which conflict or can't be set, such as those of unnamed guards and
+	// guard expressions. Eventless transitions are not modeled, and are
+	// always listed.
+	Uncovered []string `json:",omitempty"`
+}
+
+// Sequence is a list of steps, starting from a new machine in its initial
+// state.
+type Sequence struct {
+	Name  string
+	Steps []*Step
+}
+
+// Step is an event to fire, with the results its guards must return, and
+// the state map expected after the event.
+type Step struct {
+	// Event is qualified by the submachine ID path of the machine to fire
+	// it in, as in `Machine.Submachine`, e.g. `process-id/succeed`.
+	Event string
+
+	// Guards holds the results of the guards and choice conditions
+	// evaluated by the event, by name.
+	Guards map[string]bool `json:",omitempty"`
+
+	// Covers is the key of the transition taken by the event, e.g.
+	// `event.tick.transitions[1]`, or
+	// `submachine.running[0].event.stop.choice.on_true.transitions[0]`.
+	Covers string `json:",omitempty"`
+
+	Want statemachine.StateMap
+}
+
+// edge is a step from one configuration to another.
+type edge struct {
+	step *Step
+	to   string
+}
+
+type generator struct {
+	nodes map[string]*node
+	edges map[string][]*edge
+}
+
+// Generate returns event sequences which, together, take every transition of
+// def, and of its submachines, at least once.
+//
+// The sequences form a transition tour of the configurations of the machine:
+// the next transition to take is always the nearest one not taken yet, and a
+// new sequence is started when none is reachable anymore. This keeps the
+// number of events close to the minimum, without guaranteeing it.
+func Generate(def *statemachine.MachineDef) (*Suite, error) {
+	g := &generator{
+		nodes: map[string]*node{},
+		edges: map[string][]*edge{},
+	}
+
+	initial := newNode(def)
+	if err := g.explore(initial); err != nil {
+		return nil, err
+	}
+
+	suite := &Suite{}
+	covered := map[string]bool{}
+	current := initial.key()
+	var sequence *Sequence
+	for {
+		path := g.nearest(current, covered)
+		if path == nil {
+			if sequence == nil {
+				break
+			}
+			// start over from the initial state.
+			sequence = nil
+			current = initial.key()
+			continue
+		}
+
+		if sequence == nil {
+			sequence = &Sequence{Name: fmt.Sprintf("sequence-%d", len(suite.Sequences)+1)}
+			suite.Sequences = append(suite.Sequences, sequence)
+		}
+		for _, e := range path {
+			sequence.Steps = append(sequence.Steps, e.step)
+			covered[e.step.Covers] = true
+			current = e.to
+		}
+	}
+
+	for _, key := range transitionKeys("", def) {
+		if !covered[key] {
+			suite.Uncovered = append(suite.Uncovered, key)
+		}
+	}
+	return suite, nil
+}
+
+// explore adds every configuration reachable from initial, and the steps
+// between them.
+func (g *generator) explore(initial *node) error {
+	g.nodes[initial.key()] = initial
+	queue := []*node{initial}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		key := n.key()
+		for _, a := range n.actives(&active{def: n.def, state: n.state}) {
+			for _, event := range sortedKeys(a.def.Events) {
+				for _, opt := range options(a.def.Events[event], joinKey(a.path, "event."+event), a.state, nil) {
+					next := n.clone()
+					transition(next.chain(a.indexPath), opt.to)
+
+					nextKey := next.key()
+					if _, ok := g.nodes[nextKey]; !ok {
+						if len(g.nodes) >= MaxConfigurations {
+							return fmt.Errorf("more than %d configurations", MaxConfigurations)
+						}
+						g.nodes[nextKey] = next
+						queue = append(queue, next)
+					}
+
+					g.edges[key] = append(g.edges[key], &edge{
+						step: &Step{
+							Event:  strings.Join(append(append([]string{}, a.idPath...), event), "/"),
+							Guards: opt.guards,
+							Covers: opt.key,
+							Want:   next.stateMap(),
+						},
+						to: nextKey,
+					})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// nearest returns the shortest path from the configuration which ends with a
+// transition not covered yet, or nil if there's none.
+func (g *generator) nearest(from string, covered map[string]bool) []*edge {
+	prev := map[string]*edge{}
+	prevKey := map[string]string{}
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+
+		for _, e := range g.edges[key] {
+			if !covered[e.step.Covers] {
+				path := []*edge{e}
+				for k := key; k != from; k = prevKey[k] {
+					path = append([]*edge{prev[k]}, path...)
+				}
+				return path
+			}
+			if !visited[e.to] {
+				visited[e.to] = true
+				prev[e.to] = e
+				prevKey[e.to] = key
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return nil
+}
+
+// sortedGuards returns the names of the guards in order.
+func sortedGuards(guards map[string]bool) []string {
+	names := make([]string, 0, len(guards))
+	for name := range guards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,374 @@
+package statemachinetest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// node models a running (sub)machine: its current state, and the
+// submachines of that state.
+type node struct {
+	def   *statemachine.MachineDef
+	state string
+	subs  []*node
+}
+
+func newNode(def *statemachine.MachineDef) *node {
+	n := &node{def: def}
+	n.enter(def.InitialState)
+	return n
+}
+
+// enter makes state the current state, starting its submachines afresh.
+func (n *node) enter(state string) {
+	n.state = state
+	n.subs = nil
+	if !hasSubmachines(n.def, state) {
+		return
+	}
+	for _, submachineDef := range n.def.Submachines[state] {
+		n.subs = append(n.subs, newNode(submachineDef))
+	}
+}
+
+func (n *node) clone() *node {
+	c := &node{def: n.def, state: n.state}
+	for _, sub := range n.subs {
+		c.subs = append(c.subs, sub.clone())
+	}
+	return c
+}
+
+func (n *node) key() string {
+	if len(n.subs) == 0 {
+		return n.state
+	}
+	keys := make([]string, 0, len(n.subs))
+	for _, sub := range n.subs {
+		keys = append(keys, sub.key())
+	}
+	return n.state + "{" + strings.Join(keys, ",") + "}"
+}
+
+// stateMap returns the state map reported by Machine.GetStateMap.
+func (n *node) stateMap() statemachine.StateMap {
+	substate := statemachine.StateMap{}
+	for _, sub := range n.subs {
+		if hasSubmachines(sub.def, sub.state) {
+			substate[sub.def.ID] = sub.stateMap()
+		} else {
+			substate[sub.def.ID] = sub.state
+		}
+	}
+	return statemachine.StateMap{n.state: substate}
+}
+
+// hasSubmachines reports whether the machine starts submachines in state.
+// Like the machine, a state listed in States has none.
+func hasSubmachines(def *statemachine.MachineDef, state string) bool {
+	for _, s := range def.States {
+		if s == state {
+			return false
+		}
+	}
+	_, ok := def.Submachines[state]
+	return ok
+}
+
+// chain returns the nodes from n down to the node at the index path.
+func (n *node) chain(indexPath []int) []*node {
+	chain := []*node{n}
+	for _, i := range indexPath {
+		n = n.subs[i]
+		chain = append(chain, n)
+	}
+	return chain
+}
+
+// transition moves the last node of chain to state. After callbacks which
+// exit to a state of the supermachine move the supermachine too.
+func transition(chain []*node, to string) {
+	n := chain[len(chain)-1]
+	from := n.state
+	n.enter(to)
+
+	if len(chain) == 1 {
+		return
+	}
+	for _, callbackDef := range n.def.AfterCallbacks {
+		if callbackDef.ExitToState != "" && callbackDef.Matches(from, to) {
+			transition(chain[:len(chain)-1], callbackDef.ExitToState)
+			return
+		}
+	}
+}
+
+// active is a (sub)machine which is running in a configuration.
+type active struct {
+	def       *statemachine.MachineDef
+	state     string
+	idPath    []string
+	indexPath []int
+
+	// path prefixes the keys of the transitions of def.
+	path string
+}
+
+// actives returns n and its running submachines, depth first.
+func (n *node) actives(a *active) []*active {
+	actives := []*active{a}
+	for i, sub := range n.subs {
+		submachineDefs := n.def.Submachines[n.state]
+		index := 0
+		for index < len(submachineDefs) && submachineDefs[index] != sub.def {
+			index++
+		}
+		actives = append(actives, sub.actives(&active{
+			def:       sub.def,
+			state:     sub.state,
+			idPath:    append(append([]string{}, a.idPath...), sub.def.ID),
+			indexPath: append(append([]int{}, a.indexPath...), i),
+			path:      joinKey(a.path, fmt.Sprintf("submachine.%s[%d]", n.state, index)),
+		})...)
+	}
+	return actives
+}
+
+// option is a transition which an event may take, given the guard results.
+type option struct {
+	guards map[string]bool
+	key    string
+	to     string
+}
+
+// options returns the transitions which eventDef may take from state, each
+// with the guard results it needs.
+func options(eventDef *statemachine.EventDef, path, state string, guards map[string]bool) []*option {
+	if eventDef == nil {
+		return nil
+	}
+
+	var opts []*option
+	for i, transitionDef := range eventDef.Transitions {
+		if !transitionDef.Matches(state) {
+			continue
+		}
+		if allowed, ok := allow(guards, transitionDef); ok {
+			opts = append(opts, &option{
+				guards: allowed,
+				key:    fmt.Sprintf("%s.transitions[%d]", path, i),
+				to:     transitionDef.To,
+			})
+		}
+		var ok bool
+		if guards, ok = reject(guards, transitionDef); !ok {
+			// later transitions and the choice are never reached.
+			return opts
+		}
+	}
+
+	choiceDef := eventDef.Choice
+	if choiceDef == nil {
+		return opts
+	}
+	if choiceDef.UnlessGuard != nil {
+		var ok bool
+		if guards, ok = satisfy(guards, choiceDef.UnlessGuard, false); !ok {
+			return opts
+		}
+	}
+
+	condition := ""
+	if choiceDef.Condition != nil {
+		condition = choiceName(choiceDef.Condition)
+	}
+	branches := []struct {
+		key   string
+		value bool
+	}{
+		{".choice.on_true", true},
+		{".choice.on_false", false},
+	}
+	for _, b := range branches {
+		branchGuards, ok := assign(guards, condition, b.value)
+		if branch := choiceDef.Branch(b.value); ok && branch != nil {
+			opts = append(opts, options(branch, path+b.key, state, branchGuards)...)
+		}
+	}
+	return opts
+}
+
+// allow returns guards along with the results which let the transition's
+// guards pass.
+func allow(guards map[string]bool, transitionDef *statemachine.TransitionDef) (map[string]bool, bool) {
+	guards, ok := every(guards, transitionDef.IfGuards, true)
+	if !ok {
+		return nil, false
+	}
+	return every(guards, transitionDef.UnlessGuards, false)
+}
+
+// reject returns guards along with a result which makes the transition's
+// guards fail. Results which are already known are preferred.
+func reject(guards map[string]bool, transitionDef *statemachine.TransitionDef) (map[string]bool, bool) {
+	for _, known := range []bool{true, false} {
+		if rejected, ok := some(guards, transitionDef.IfGuards, false, known); ok {
+			return rejected, true
+		}
+		if rejected, ok := some(guards, transitionDef.UnlessGuards, true, known); ok {
+			return rejected, true
+		}
+	}
+	return nil, false
+}
+
+// satisfy returns guards along with the results which make the guard return
+// value. Results which are already known are preferred.
+func satisfy(guards map[string]bool, guardDef *statemachine.TransitionGuardDef, value bool) (map[string]bool, bool) {
+	switch {
+	case guardDef.Not != nil:
+		return satisfy(guards, guardDef.Not, !value)
+
+	case len(guardDef.All) != 0 && value, len(guardDef.Any) != 0 && !value:
+		return every(guards, combined(guardDef), value)
+
+	case len(guardDef.All) != 0, len(guardDef.Any) != 0:
+		for _, known := range []bool{true, false} {
+			if satisfied, ok := some(guards, combined(guardDef), value, known); ok {
+				return satisfied, true
+			}
+		}
+		return nil, false
+	}
+
+	return assign(guards, guardName(guardDef), value)
+}
+
+// combined returns the guards which an All or Any guard combines.
+func combined(guardDef *statemachine.TransitionGuardDef) []*statemachine.TransitionGuardDef {
+	if len(guardDef.All) != 0 {
+		return guardDef.All
+	}
+	return guardDef.Any
+}
+
+// every returns guards along with the results which make all of the guards
+// return value.
+func every(guards map[string]bool, guardDefs []*statemachine.TransitionGuardDef, value bool) (map[string]bool, bool) {
+	ok := true
+	for _, guardDef := range guardDefs {
+		if guards, ok = satisfy(guards, guardDef, value); !ok {
+			return nil, false
+		}
+	}
+	return guards, true
+}
+
+// some returns guards along with the results which make one of the guards
+// return value. If known is set, only guards which already return value
+// given the known results are considered.
+func some(guards map[string]bool, guardDefs []*statemachine.TransitionGuardDef, value, known bool) (map[string]bool, bool) {
+	for _, guardDef := range guardDefs {
+		satisfied, ok := satisfy(guards, guardDef, value)
+		if ok && (!known || len(satisfied) == len(guards)) {
+			return satisfied, true
+		}
+	}
+	return nil, false
+}
+
+// assign returns a copy of guards with the result of the named guard, unless
+// it conflicts with a known result. Unnamed guards can't be assigned.
+func assign(guards map[string]bool, name string, value bool) (map[string]bool, bool) {
+	if name == "" {
+		return nil, false
+	}
+	if known, ok := guards[name]; ok {
+		return guards, known == value
+	}
+	assigned := make(map[string]bool, len(guards)+1)
+	for k, v := range guards {
+		assigned[k] = v
+	}
+	assigned[name] = value
+	return assigned, true
+}
+
+func guardName(guardDef *statemachine.TransitionGuardDef) string {
+	if guardDef.Expr != "" {
+		// guard expressions aren't stubbed, so their results can't be
+		// assigned.
+		return ""
+	}
+	if guardDef.RegisteredFunc != "" {
+		return guardDef.RegisteredFunc
+	}
+	return guardDef.Label
+}
+
+func choiceName(conditionDef *statemachine.ChoiceConditionDef) string {
+	if conditionDef.Expr != "" {
+		return ""
+	}
+	if conditionDef.RegisteredFunc != "" {
+		return conditionDef.RegisteredFunc
+	}
+	return conditionDef.Label
+}
+
+// transitionKeys returns the keys of every transition of def and its
+// submachines, including those of choice branches.
+func transitionKeys(path string, def *statemachine.MachineDef) []string {
+	var keys []string
+	var eventKeys func(path string, eventDef *statemachine.EventDef)
+	eventKeys = func(path string, eventDef *statemachine.EventDef) {
+		if eventDef == nil {
+			return
+		}
+		for i := range eventDef.Transitions {
+			keys = append(keys, fmt.Sprintf("%s.transitions[%d]", path, i))
+		}
+		if choiceDef := eventDef.Choice; choiceDef != nil {
+			eventKeys(path+".choice.on_true", choiceDef.OnTrue)
+			eventKeys(path+".choice.on_false", choiceDef.OnFalse)
+		}
+	}
+
+	for _, event := range sortedKeys(def.Events) {
+		eventKeys(joinKey(path, "event."+event), def.Events[event])
+	}
+	for i := range def.Always {
+		keys = append(keys, joinKey(path, fmt.Sprintf("always[%d]", i)))
+	}
+
+	states := make([]string, 0, len(def.Submachines))
+	for state := range def.Submachines {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		for i, submachineDef := range def.Submachines[state] {
+			keys = append(keys, transitionKeys(joinKey(path, fmt.Sprintf("submachine.%s[%d]", state, i)), submachineDef)...)
+		}
+	}
+	return keys
+}
+
+func sortedKeys(events map[string]*statemachine.EventDef) []string {
+	keys := make([]string, 0, len(events))
+	for key := range events {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
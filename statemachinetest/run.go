@@ -0,0 +1,46 @@
+package statemachinetest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// Run fires the events of the sequence on machine, which must be in its
+// initial state, and fails t when an event fails, or when the state map
+// after an event differs from the expected one.
+//
+// Before each event, setGuards is called with the results its guards must
+// return, so that they can be stubbed. setGuards may be nil when the
+// sequence doesn't depend on guards.
+func (sequence *Sequence) Run(t testing.TB, machine statemachine.Machine, setGuards func(guards map[string]bool)) {
+	t.Helper()
+
+	for i, step := range sequence.Steps {
+		if setGuards != nil {
+			setGuards(step.Guards)
+		}
+
+		if err := fire(machine, step.Event); err != nil {
+			t.Fatalf("%s: step %d: %s: %s", sequence.Name, i+1, step.Event, err)
+		}
+		if got := machine.GetStateMap(); !reflect.DeepEqual(got, step.Want) {
+			t.Fatalf("%s: step %d: %s: got state map %v, want %v", sequence.Name, i+1, step.Event, got, step.Want)
+		}
+	}
+}
+
+// fire fires an event of the form `event`, or `submachine-id/.../event`.
+func fire(machine statemachine.Machine, event string) error {
+	path := strings.Split(event, "/")
+	if len(path) > 1 {
+		submachine, err := machine.Submachine(path[:len(path)-1]...)
+		if err != nil {
+			return err
+		}
+		machine = submachine
+	}
+	return machine.Fire(path[len(path)-1])
+}
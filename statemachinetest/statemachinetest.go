@@ -0,0 +1,24 @@
+// Package statemachinetest helps test state machines, and the code driven by
+// them.
+//
+// Generate derives event sequences from a definition which, together, take
+// every transition of the definition. The sequences are written as JSON or
+// as Go test tables, and replayed against a machine with Sequence.Run, which
+// checks the state map after every step.
+//
+// Walker fires random events on a machine instead, and checks invariants
+// after every step. A walk which breaks an invariant is shrunk to the fewest
+// steps which still break it, and reported with the seed which reproduces
+// it.
+//
+// Stub copies a definition with guards and callbacks which are stubbed by
+// name, and records the callbacks called, in order. AssertTransition,
+// AssertRejected and AssertCalls check machines running it.
+//
+// Clock is a fake clock for Machine.SetClock, which fires timed events and
+// delayed sends only when it is advanced.
+//
+// Guards and choice conditions are named by their RegisteredFunc name, or by
+// their label. Steps list the results which the guards of their event must
+// return for the transition being tested to be taken.
+package statemachinetest
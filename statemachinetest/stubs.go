@@ -0,0 +1,531 @@
+package statemachinetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/internal/dynafunc"
+)
+
+// Stubs is a copy of a definition whose guards, choice conditions,
+// callbacks, transition actions and invoked services can be stubbed by name,
+// and which records the callbacks, actions and services called by machines
+// running it.
+//
+// Guards, conditions, callbacks, transition actions and invoked services are
+// named by their RegisteredFunc name, by their label, or otherwise by their
+// path, e.g. `event.tick.transitions[0].if_guard[0]` or
+// `after_callbacks[1].do[0]`. Those which aren't stubbed call the func they
+// are bound to, or else the func registered with their RegisteredFunc name.
+// Unbound callbacks do nothing, as do unbound actions, unbound services run
+// until their state is exited, and unbound guards panic. The guards combined
+// by statemachine.All, Any and Not are stubbed one by one. Guard expressions
+// (see statemachine.Expr) and assign actions aren't stubbed, and are
+// evaluated as they are.
+type Stubs struct {
+	def *statemachine.MachineDef
+
+	mutex     sync.Mutex
+	guards    map[string]bool
+	funcs     map[string]interface{}
+	calls     []Call
+	guardFunc func(name string) (bool, bool)
+}
+
+// Call is a recorded callback call.
+type Call struct {
+	// Kind is one of before_event, before_transition, around_transition,
+	// transition_action, after_transition, after_event, after_failure, or
+	// invoke. Invoked services are recorded by their own goroutine, once
+	// their state has been entered.
+	Kind string
+	Name string
+
+	// From and To are set for transition callbacks and actions, and for
+	// after_event callbacks.
+	From string
+	To   string
+
+	// Event is set for event callbacks and transition actions, and Err for
+	// failure callbacks.
+	Event string
+	Err   error
+}
+
+func (c Call) String() string {
+	return c.Kind + " " + c.Name
+}
+
+// Stub returns stubs for a copy of def. The definition itself is left as is.
+func Stub(def *statemachine.MachineDef) *Stubs {
+	s := &Stubs{
+		guards: map[string]bool{},
+		funcs:  map[string]interface{}{},
+	}
+	s.def = s.machine("", def, false)
+	return s
+}
+
+// Def returns the stubbed copy of the definition.
+func (s *Stubs) Def() *statemachine.MachineDef {
+	return s.def
+}
+
+// NewMachine returns a machine running the stubbed definition.
+func (s *Stubs) NewMachine() statemachine.Machine {
+	machine := statemachine.NewMachine()
+	machine.SetMachineDef(s.def)
+	return machine
+}
+
+// Guard stubs the named guard or choice condition to return result.
+func (s *Stubs) Guard(name string, result bool) *Stubs {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.guards[name] = result
+	return s
+}
+
+// Func stubs the named guard, choice condition, callback, action or invoked
+// service with fn, which takes the same args as the func it replaces.
+func (s *Stubs) Func(name string, fn interface{}) *Stubs {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.guards, name)
+	s.funcs[name] = fn
+	return s
+}
+
+// Calls returns the callbacks and actions called so far, in order.
+func (s *Stubs) Calls() []Call {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Call{}, s.calls...)
+}
+
+// ResetCalls forgets the callbacks and actions called so far.
+func (s *Stubs) ResetCalls() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.calls = nil
+}
+
+// machine copies def, with stubbed guards, conditions and callbacks. With
+// untimed set, timed events are copied without their interval, so that they
+// only fire when asked to.
+func (s *Stubs) machine(path string, def *statemachine.MachineDef, untimed bool) *statemachine.MachineDef {
+	c := *def
+	c.Events = map[string]*statemachine.EventDef{}
+	for event, eventDef := range def.Events {
+		c.Events[event] = s.event(joinKey(path, "event."+event), eventDef)
+		if untimed && c.Events[event] != nil {
+			c.Events[event].TimedEvery = 0
+		}
+	}
+	c.Always = nil
+	for i, transitionDef := range def.Always {
+		c.Always = append(c.Always, s.transition(joinKey(path, fmt.Sprintf("always[%d]", i)), transitionDef))
+	}
+	c.Invokes = nil
+	for i, invokeDef := range def.Invokes {
+		c.Invokes = append(c.Invokes, s.invoke(joinKey(path, fmt.Sprintf("invoke[%d]", i)), invokeDef))
+	}
+
+	c.Submachines = map[string][]*statemachine.MachineDef{}
+	for state, submachineDefs := range def.Submachines {
+		for i, submachineDef := range submachineDefs {
+			c.Submachines[state] = append(c.Submachines[state], s.machine(joinKey(path, fmt.Sprintf("submachine.%s[%d]", state, i)), submachineDef, untimed))
+		}
+	}
+
+	c.BeforeCallbacks = s.transitionCallbacks(joinKey(path, "before_callbacks"), "before_transition", def.BeforeCallbacks)
+	c.AroundCallbacks = s.transitionCallbacks(joinKey(path, "around_callbacks"), "around_transition", def.AroundCallbacks)
+	c.AfterCallbacks = s.transitionCallbacks(joinKey(path, "after_callbacks"), "after_transition", def.AfterCallbacks)
+
+	c.BeforeEventCallbacks = s.eventCallbacks(joinKey(path, "before_event_callbacks"), "before_event", def.BeforeEventCallbacks)
+	c.AfterEventCallbacks = s.eventCallbacks(joinKey(path, "after_event_callbacks"), "after_event", def.AfterEventCallbacks)
+	c.FailureCallbacks = s.eventCallbacks(joinKey(path, "failure_callbacks"), "after_failure", def.FailureCallbacks)
+	return &c
+}
+
+func (s *Stubs) eventCallbacks(path, kind string, callbackDefs []*statemachine.EventCallbackDef) []*statemachine.EventCallbackDef {
+	var copies []*statemachine.EventCallbackDef
+	for i, callbackDef := range callbackDefs {
+		callbackPath := fmt.Sprintf("%s[%d]", path, i)
+		c := *callbackDef
+		c.Do = nil
+		for j, funcDef := range callbackDef.Do {
+			name := stubName(fmt.Sprintf("%s.do[%d]", callbackPath, j), funcDef.RegisteredFunc, "")
+			original := bound{funcDef.Func, funcDef.RegisteredFunc}
+
+			var fn statemachine.EventCallbackFunc
+			switch kind {
+			case "before_event":
+				fn = func(machine statemachine.Machine, event statemachine.Event, ctx context.Context) error {
+					s.record(Call{Kind: kind, Name: name, Event: event.Event()})
+					var out []reflect.Value
+					if s.callWithOut(name, original, &out, machine, event, ctx) && len(out) == 1 && !out[0].IsNil() {
+						return out[0].Interface().(error)
+					}
+					return nil
+				}
+			case "after_event":
+				fn = func(machine statemachine.Machine, event statemachine.Event, transition statemachine.Transition, ctx context.Context) {
+					s.record(Call{Kind: kind, Name: name, From: transition.From(), To: transition.To(), Event: event.Event()})
+					s.call(name, original, machine, event, transition, ctx)
+				}
+			default:
+				fn = func(machine statemachine.Machine, event statemachine.Event, err error) {
+					s.record(Call{Kind: kind, Name: name, Event: event.Event(), Err: err})
+					s.call(name, original, machine, event, err)
+				}
+			}
+
+			c.Do = append(c.Do, &statemachine.EventCallbackFuncDef{
+				RegisteredFunc: funcDef.RegisteredFunc,
+				Func:           fn,
+			})
+		}
+		copies = append(copies, &c)
+	}
+	return copies
+}
+
+func (s *Stubs) transitionCallbacks(path, kind string, callbackDefs []*statemachine.TransitionCallbackDef) []*statemachine.TransitionCallbackDef {
+	var copies []*statemachine.TransitionCallbackDef
+	for i, callbackDef := range callbackDefs {
+		callbackPath := fmt.Sprintf("%s[%d]", path, i)
+		c := *callbackDef
+		c.Do = nil
+		for j, funcDef := range callbackDef.Do {
+			name := stubName(fmt.Sprintf("%s.do[%d]", callbackPath, j), funcDef.RegisteredFunc, funcDef.Label)
+			original := bound{funcDef.Func, funcDef.RegisteredFunc}
+
+			var fn statemachine.TransitionCallbackFunc
+			if kind == "around_transition" {
+				fn = func(machine statemachine.Machine, transition statemachine.Transition, next func()) {
+					s.record(Call{Kind: kind, Name: name, From: transition.From(), To: transition.To()})
+					if !s.call(name, original, machine, transition, next) {
+						next()
+					}
+				}
+			} else {
+				fn = func(machine statemachine.Machine, transition statemachine.Transition) {
+					s.record(Call{Kind: kind, Name: name, From: transition.From(), To: transition.To()})
+					s.call(name, original, machine, transition)
+				}
+			}
+
+			c.Do = append(c.Do, &statemachine.TransitionCallbackFuncDef{
+				Label:          funcDef.Label,
+				RegisteredFunc: funcDef.RegisteredFunc,
+				Func:           fn,
+			})
+		}
+		copies = append(copies, &c)
+	}
+	return copies
+}
+
+func (s *Stubs) event(path string, eventDef *statemachine.EventDef) *statemachine.EventDef {
+	if eventDef == nil {
+		return nil
+	}
+
+	c := &statemachine.EventDef{TimedEvery: eventDef.TimedEvery}
+	for i, transitionDef := range eventDef.Transitions {
+		c.Transitions = append(c.Transitions, s.transition(fmt.Sprintf("%s.transitions[%d]", path, i), transitionDef))
+	}
+
+	if choiceDef := eventDef.Choice; choiceDef != nil {
+		choicePath := path + ".choice"
+		c.Choice = &statemachine.ChoiceDef{
+			OnTrue:  s.event(choicePath+".on_true", choiceDef.OnTrue),
+			OnFalse: s.event(choicePath+".on_false", choiceDef.OnFalse),
+		}
+		if conditionDef := choiceDef.Condition; conditionDef != nil && conditionDef.Expr != "" {
+			c.Choice.Condition = &statemachine.ChoiceConditionDef{Label: conditionDef.Label, Expr: conditionDef.Expr}
+		} else if conditionDef != nil {
+			name := stubName(choicePath+".condition", conditionDef.RegisteredFunc, conditionDef.Label)
+			original := bound{conditionDef.Condition, conditionDef.RegisteredFunc}
+			c.Choice.Condition = &statemachine.ChoiceConditionDef{
+				Label:          conditionDef.Label,
+				RegisteredFunc: conditionDef.RegisteredFunc,
+				Condition:      s.guardStub(name, original),
+			}
+		}
+		if guardDef := choiceDef.UnlessGuard; guardDef != nil {
+			c.Choice.UnlessGuard = s.transitionGuard(choicePath+".unless_condition", guardDef)
+		}
+	}
+	return c
+}
+
+// transition returns a copy of transitionDef, whose guards and actions are
+// stubbed.
+func (s *Stubs) transition(path string, transitionDef *statemachine.TransitionDef) *statemachine.TransitionDef {
+	t := *transitionDef
+	t.IfGuards = nil
+	for j, guardDef := range transitionDef.IfGuards {
+		t.IfGuards = append(t.IfGuards, s.transitionGuard(fmt.Sprintf("%s.if_guard[%d]", path, j), guardDef))
+	}
+	t.UnlessGuards = nil
+	for j, guardDef := range transitionDef.UnlessGuards {
+		t.UnlessGuards = append(t.UnlessGuards, s.transitionGuard(fmt.Sprintf("%s.unless_guard[%d]", path, j), guardDef))
+	}
+	t.Do = nil
+	for j, funcDef := range transitionDef.Do {
+		name := stubName(fmt.Sprintf("%s.do[%d]", path, j), funcDef.RegisteredFunc, funcDef.Label)
+		t.Do = append(t.Do, &statemachine.TransitionCallbackFuncDef{
+			Label:          funcDef.Label,
+			RegisteredFunc: funcDef.RegisteredFunc,
+			Func:           s.actionStub(name, bound{funcDef.Func, funcDef.RegisteredFunc}),
+		})
+	}
+	return &t
+}
+
+// invoke returns a copy of the invoked service, which records its call, and
+// calls the named service. Unbound services run until their state is
+// exited.
+func (s *Stubs) invoke(path string, invokeDef *statemachine.InvokeDef) *statemachine.InvokeDef {
+	name := stubName(path, invokeDef.RegisteredFunc, "")
+	original := bound{invokeDef.Func, invokeDef.RegisteredFunc}
+
+	c := *invokeDef
+	c.Func = func(ctx context.Context, send func(statemachine.Message)) error {
+		s.record(Call{Kind: "invoke", Name: name})
+		var out []reflect.Value
+		if !s.callWithOut(name, original, &out, ctx, send) {
+			<-ctx.Done()
+			return nil
+		}
+		if len(out) == 1 && !out[0].IsNil() {
+			return out[0].Interface().(error)
+		}
+		return nil
+	}
+	return &c
+}
+
+// transitionGuard returns a copy of the guard, whose funcs are stubbed. The
+// guards which a guard combines are stubbed one by one, except for guard
+// expressions.
+func (s *Stubs) transitionGuard(path string, guardDef *statemachine.TransitionGuardDef) *statemachine.TransitionGuardDef {
+	if guardDef.IsCombined() {
+		g := &statemachine.TransitionGuardDef{Label: guardDef.Label}
+		for i, childDef := range guardDef.All {
+			g.All = append(g.All, s.transitionGuard(fmt.Sprintf("%s.all[%d]", path, i), childDef))
+		}
+		for i, childDef := range guardDef.Any {
+			g.Any = append(g.Any, s.transitionGuard(fmt.Sprintf("%s.any[%d]", path, i), childDef))
+		}
+		if guardDef.Not != nil {
+			g.Not = s.transitionGuard(path+".not", guardDef.Not)
+		}
+		return g
+	}
+	if guardDef.Expr != "" {
+		return &statemachine.TransitionGuardDef{Label: guardDef.Label, Expr: guardDef.Expr}
+	}
+
+	name := stubName(path, guardDef.RegisteredFunc, guardDef.Label)
+	original := bound{guardDef.Guard, guardDef.RegisteredFunc}
+	return &statemachine.TransitionGuardDef{
+		Label:          guardDef.Label,
+		RegisteredFunc: guardDef.RegisteredFunc,
+		Guard:          s.guardStub(name, original),
+	}
+}
+
+// guardStub returns a guard func which returns the result of the named
+// guard. It accepts the same args as the func the guard is bound to, so that
+// the func is passed the payload of the event, if any.
+func (s *Stubs) guardStub(name string, original bound) interface{} {
+	fn := original.fn
+	if isNil(fn) {
+		fn, _ = statemachine.LookupFunc(original.registeredFunc)
+	}
+	fnType := reflect.TypeOf(func(statemachine.Machine, statemachine.Transition, statemachine.Event, context.Context) bool {
+		return false
+	})
+	if !isNil(fn) && reflect.TypeOf(fn).Kind() == reflect.Func {
+		fnType = reflect.TypeOf(fn)
+	}
+
+	return reflect.MakeFunc(fnType, func(in []reflect.Value) []reflect.Value {
+		args := make([]interface{}, 0, len(in))
+		for _, value := range in {
+			args = append(args, value.Interface())
+		}
+		result := reflect.ValueOf(s.guard(name, original, args...))
+		return []reflect.Value{result.Convert(fnType.Out(0))}
+	}).Interface()
+}
+
+// actionStub returns a transition action which records its call, and calls
+// the named action. It accepts the args of the func the action is bound to,
+// so that the func is passed the context of the machine, if it takes it.
+func (s *Stubs) actionStub(name string, original bound) interface{} {
+	in := []reflect.Type{
+		reflect.TypeOf(new(statemachine.Machine)).Elem(),
+		reflect.TypeOf(new(statemachine.Transition)).Elem(),
+		reflect.TypeOf(new(statemachine.Event)).Elem(),
+		reflect.TypeOf(new(context.Context)).Elem(),
+	}
+	fn := original.fn
+	if isNil(fn) {
+		fn, _ = statemachine.LookupFunc(original.registeredFunc)
+	}
+	if !isNil(fn) && reflect.TypeOf(fn).Kind() == reflect.Func {
+		fnType := reflect.TypeOf(fn)
+		for i := 0; i < fnType.NumIn(); i++ {
+			if argType := fnType.In(i); argType.Kind() != reflect.Interface {
+				in = append(in, argType)
+			}
+		}
+	}
+
+	return reflect.MakeFunc(reflect.FuncOf(in, nil, false), func(in []reflect.Value) []reflect.Value {
+		transition := in[1].Interface().(statemachine.Transition)
+		event, _ := in[2].Interface().(statemachine.Event)
+		call := Call{Kind: "transition_action", Name: name, From: transition.From(), To: transition.To()}
+		if event != nil {
+			call.Event = event.Event()
+		}
+		s.record(call)
+
+		args := make([]interface{}, 0, len(in))
+		for _, value := range in {
+			args = append(args, value.Interface())
+		}
+		s.call(name, original, args...)
+		return nil
+	}).Interface()
+}
+
+// guard returns the result of the named guard: its stubbed result, or the
+// result of its stub func, bound func, or registered func.
+func (s *Stubs) guard(name string, original bound, args ...interface{}) bool {
+	s.mutex.Lock()
+	guardFunc := s.guardFunc
+	result, ok := s.guards[name]
+	s.mutex.Unlock()
+
+	if guardFunc != nil {
+		if result, ok := guardFunc(name); ok {
+			return result
+		}
+	}
+	if ok {
+		return result
+	}
+
+	var out []reflect.Value
+	if !s.callWithOut(name, original, &out, args...) {
+		panic(fmt.Sprintf("guard '%s' is neither stubbed nor bound to a func", name))
+	}
+	return out[0].Bool()
+}
+
+// bound is the func which a guard or callback is bound to, or else the name
+// of its registered func.
+type bound struct {
+	fn             interface{}
+	registeredFunc string
+}
+
+// call calls the stub func of name, or else the original func. It reports
+// whether a func was called.
+func (s *Stubs) call(name string, original bound, args ...interface{}) bool {
+	var out []reflect.Value
+	return s.callWithOut(name, original, &out, args...)
+}
+
+// callWithOut is like call, and sets out to the results of the func.
+func (s *Stubs) callWithOut(name string, original bound, out *[]reflect.Value, args ...interface{}) bool {
+	s.mutex.Lock()
+	fn, ok := s.funcs[name]
+	s.mutex.Unlock()
+
+	if !ok {
+		fn = original.fn
+	}
+	if isNil(fn) {
+		if original.registeredFunc == "" {
+			return false
+		}
+		if fn, ok = statemachine.LookupFunc(original.registeredFunc); !ok {
+			return false
+		}
+	}
+	if ptr, ok := fn.(*bool); ok {
+		*out = []reflect.Value{reflect.ValueOf(*ptr)}
+		return true
+	}
+
+	in := map[reflect.Type]interface{}{}
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case statemachine.Machine:
+			in[reflect.TypeOf(new(statemachine.Machine))] = arg
+		case statemachine.Transition:
+			in[reflect.TypeOf(new(statemachine.Transition))] = arg
+		case statemachine.Event:
+			in[reflect.TypeOf(new(statemachine.Event))] = arg
+		case error:
+			in[reflect.TypeOf(new(error))] = arg
+		case context.Context:
+			in[reflect.TypeOf(new(context.Context))] = arg
+		case func():
+			in[reflect.TypeOf(new(func()))] = arg
+		case nil:
+		default:
+			// payloads are passed by their exact type.
+			in[reflect.PtrTo(reflect.TypeOf(arg))] = arg
+		}
+	}
+	f := dynafunc.NewDynamicFunc(fn, in)
+	if err := f.Call(); err != nil {
+		panic(fmt.Sprintf("%s: %s", name, err))
+	}
+	*out = f.Out
+	return true
+}
+
+func (s *Stubs) record(call Call) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.calls = append(s.calls, call)
+}
+
+func isNil(fn interface{}) bool {
+	if fn == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(fn); v.Kind() {
+	case reflect.Func, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// stubName names a guard or callback by its RegisteredFunc name, label, or
+// path, in that order.
+func stubName(path, registeredFunc, label string) string {
+	if registeredFunc != "" {
+		return registeredFunc
+	}
+	if label != "" {
+		return label
+	}
+	return path
+}
@@ -0,0 +1,241 @@
+package statemachinetest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// Invariant is a property of a machine which must hold after every step of
+// a walk.
+type Invariant struct {
+	Name  string
+	Holds func(machine statemachine.Machine) bool
+}
+
+// SubmachineActiveOnlyIn returns an invariant which holds when the
+// submachine at idPath is only active while the machine is in one of states.
+func SubmachineActiveOnlyIn(idPath string, states ...string) Invariant {
+	return Invariant{
+		Name: fmt.Sprintf("submachine '%s' is active only in %v", idPath, states),
+		Holds: func(machine statemachine.Machine) bool {
+			if _, err := machine.Submachine(strings.Split(idPath, "/")...); err != nil {
+				return true
+			}
+			for _, state := range states {
+				if machine.IsState(state) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// Walker fires random sequences of events on machines running Def, and
+// checks the Invariants after every event.
+//
+// Events are picked from the machine's AvailableEvents. The guards and
+// choice conditions of Def are replaced by stubs, whose results are picked
+// by Guard, so that every transition can be taken. Timed events only fire
+// when picked.
+type Walker struct {
+	Def        *statemachine.MachineDef
+	Invariants []Invariant
+
+	// Walks is the number of walks, 100 by default. Each walk starts from a
+	// new machine.
+	Walks int
+
+	// Steps is the number of events fired by each walk, 100 by default. A
+	// walk ends early when no event is available.
+	Steps int
+
+	// Seed seeds the first walk, and is incremented for every walk after
+	// it. The current time is used if it's 0.
+	Seed int64
+
+	// Guard returns the result of a guard or choice condition, named by its
+	// RegisteredFunc name, label, or otherwise by its path. The result is
+	// picked at random by default. A guard evaluated more than once by a
+	// step returns the same result every time.
+	Guard func(name string, rnd *rand.Rand) bool
+
+	// Reset is called before every walk, and before every replay of the
+	// steps of a walk while shrinking it, to reset the state which callbacks
+	// act upon, if any.
+	Reset func()
+}
+
+// Failure is a walk which broke an invariant.
+type Failure struct {
+	Invariant string
+
+	// Seed reproduces the walk, as the Seed of a Walker with a single walk.
+	Seed int64
+
+	// Steps is the shortest sequence of steps found which still breaks the
+	// invariant, when replayed with the same guard results.
+	Steps []*Step
+}
+
+func (f *Failure) Error() string {
+	events := make([]string, 0, len(f.Steps))
+	for _, step := range f.Steps {
+		event := step.Event
+		if len(step.Guards) > 0 {
+			var guards []string
+			for _, name := range sortedGuards(step.Guards) {
+				guards = append(guards, fmt.Sprintf("%s=%t", name, step.Guards[name]))
+			}
+			event += " (" + strings.Join(guards, ", ") + ")"
+		}
+		events = append(events, event)
+	}
+	return fmt.Sprintf("invariant '%s' broken after %d step(s) (seed %d): %s",
+		f.Invariant, len(f.Steps), f.Seed, strings.Join(events, ", "))
+}
+
+// Test runs the walks, and fails t with the first failure.
+func (w *Walker) Test(t testing.TB) {
+	t.Helper()
+
+	if failure := w.Run(); failure != nil {
+		t.Fatal(failure)
+	}
+}
+
+// Run runs the walks, and returns the first failure, shrunk to the shortest
+// sequence of steps found which still breaks the same invariant. It returns
+// nil if every invariant held.
+func (w *Walker) Run() *Failure {
+	walks, steps := w.Walks, w.Steps
+	if walks == 0 {
+		walks = 100
+	}
+	if steps == 0 {
+		steps = 100
+	}
+	seed := w.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	s := Stub(w.Def)
+	s.def = s.machine("", w.Def, true)
+	for i := 0; i < walks; i++ {
+		walkSeed := seed + int64(i)
+		if failure := w.walk(s, walkSeed, steps); failure != nil {
+			failure.Steps = w.shrink(s, failure.Invariant, failure.Steps)
+			return failure
+		}
+	}
+	return nil
+}
+
+// walk fires random events, and returns the steps up to the first broken
+// invariant.
+func (w *Walker) walk(s *Stubs, seed int64, steps int) *Failure {
+	rnd := rand.New(rand.NewSource(seed))
+	machine := w.newMachine(s)
+
+	guard := w.Guard
+	if guard == nil {
+		guard = func(name string, rnd *rand.Rand) bool { return rnd.Intn(2) == 1 }
+	}
+
+	var walked []*Step
+	if invariant := w.broken(machine); invariant != "" {
+		return &Failure{Invariant: invariant, Seed: seed}
+	}
+	for len(walked) < steps {
+		events := machine.AvailableEvents()
+		if len(events) == 0 {
+			break
+		}
+
+		step := &Step{Event: events[rnd.Intn(len(events))], Guards: map[string]bool{}}
+		s.guardFunc = func(name string) (bool, bool) {
+			if value, ok := step.Guards[name]; ok {
+				return value, true
+			}
+			value := guard(name, rnd)
+			step.Guards[name] = value
+			return value, true
+		}
+		fire(machine, step.Event)
+		step.Want = machine.GetStateMap()
+		walked = append(walked, step)
+
+		if invariant := w.broken(machine); invariant != "" {
+			return &Failure{Invariant: invariant, Seed: seed, Steps: walked}
+		}
+	}
+	return nil
+}
+
+// replay fires the steps on a new machine, with their guard results, and
+// returns the first broken invariant, along with the number of steps fired
+// until then.
+func (w *Walker) replay(s *Stubs, steps []*Step) (string, int) {
+	machine := w.newMachine(s)
+	if invariant := w.broken(machine); invariant != "" {
+		return invariant, 0
+	}
+	for i, step := range steps {
+		guards := step.Guards
+		s.guardFunc = func(name string) (bool, bool) { return guards[name], true }
+		fire(machine, step.Event)
+		if invariant := w.broken(machine); invariant != "" {
+			return invariant, i + 1
+		}
+	}
+	return "", len(steps)
+}
+
+// shrink removes steps, as long as the remaining steps still break the
+// invariant, first in large chunks, then one by one.
+func (w *Walker) shrink(s *Stubs, invariant string, steps []*Step) []*Step {
+	for chunk := len(steps) / 2; chunk >= 1; chunk /= 2 {
+		for start := 0; start+chunk <= len(steps); {
+			candidate := append(append([]*Step{}, steps[:start]...), steps[start+chunk:]...)
+			if broken, n := w.replay(s, candidate); broken == invariant {
+				steps = candidate[:n]
+				continue
+			}
+			start += chunk
+		}
+	}
+
+	// record the state maps of the shrunk steps.
+	machine := w.newMachine(s)
+	shrunk := make([]*Step, 0, len(steps))
+	for _, step := range steps {
+		guards := step.Guards
+		s.guardFunc = func(name string) (bool, bool) { return guards[name], true }
+		fire(machine, step.Event)
+		shrunk = append(shrunk, &Step{Event: step.Event, Guards: guards, Want: machine.GetStateMap()})
+	}
+	return shrunk
+}
+
+func (w *Walker) newMachine(s *Stubs) statemachine.Machine {
+	if w.Reset != nil {
+		w.Reset()
+	}
+	s.ResetCalls()
+	return s.NewMachine()
+}
+
+func (w *Walker) broken(machine statemachine.Machine) string {
+	for _, invariant := range w.Invariants {
+		if !invariant.Holds(machine) {
+			return invariant.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package statemachinetest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/statemachinetest"
+)
+
+var monitorHCL = []byte(`
+	states        = ["unmonitored", "stopped", "starting", "running"]
+	initial_state = "unmonitored"
+
+	event "monitor" {
+	  transition {
+	    from = ["unmonitored"]
+	    to   = "stopped"
+	  }
+	}
+
+	event "start" {
+	  transition {
+	    from = ["stopped"]
+	    to   = "starting"
+	  }
+	}
+
+	event "tick" {
+	  transition {
+	    from = ["starting"]
+	    to   = "running"
+	    if   = [is-process-running]
+	  }
+
+	  transition {
+	    from = ["starting"]
+	    to   = "stopped"
+	  }
+	}
+
+	event "stop" {
+	  transition {
+	    from = ["starting", "running"]
+	    to   = "stopped"
+	  }
+	}
+
+	event "unmonitor" {
+	  transition {
+	    to = "unmonitored"
+	  }
+	}
+
+	after_transition {
+	  to = ["running"]
+	  do = [start-process]
+	}
+
+	after_transition {
+	  from = ["running"]
+	  to   = ["stopped"]
+	  do   = [stop-process]
+	}
+`)
+
+func ExampleWalker() {
+	// the process keeps running when the machine stops monitoring it.
+	processRunning := false
+	statemachine.RegisterFunc("start-process", func() { processRunning = true })
+	statemachine.RegisterFunc("stop-process", func() { processRunning = false })
+
+	machineDef, err := statemachine.LoadHCL("monitor.hcl", monitorHCL)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	walker := &statemachinetest.Walker{
+		Def: machineDef,
+		Invariants: []statemachinetest.Invariant{
+			{
+				Name: "process is stopped while unmonitored",
+				Holds: func(machine statemachine.Machine) bool {
+					return !machine.IsState("unmonitored") || !processRunning
+				},
+			},
+		},
+		Seed:  1,
+		Reset: func() { processRunning = false },
+	}
+
+	failure := walker.Run()
+	for _, step := range failure.Steps {
+		fmt.Println(step.Event, step.Guards, step.Want)
+	}
+
+	// Output:
+	// monitor map[] map[stopped:map[]]
+	// start map[] map[starting:map[]]
+	// tick map[is-process-running:true] map[running:map[]]
+	// unmonitor map[] map[unmonitored:map[]]
+}
+
+func TestWalker_SeedReproducesFailure(t *testing.T) {
+	processRunning := false
+	statemachine.RegisterFunc("start-process", func() { processRunning = true })
+	statemachine.RegisterFunc("stop-process", func() { processRunning = false })
+
+	machineDef, err := statemachine.LoadHCL("monitor.hcl", monitorHCL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newWalker := func(seed int64, walks int) *statemachinetest.Walker {
+		return &statemachinetest.Walker{
+			Def: machineDef,
+			Invariants: []statemachinetest.Invariant{
+				{
+					Name: "process is stopped while unmonitored",
+					Holds: func(machine statemachine.Machine) bool {
+						return !machine.IsState("unmonitored") || !processRunning
+					},
+				},
+			},
+			Walks: walks,
+			Seed:  seed,
+			Reset: func() { processRunning = false },
+		}
+	}
+
+	failure := newWalker(0, 100).Run()
+	if failure == nil {
+		t.Fatal("expected the invariant to break")
+	}
+
+	replayed := newWalker(failure.Seed, 1).Run()
+	if replayed == nil || replayed.Error() != failure.Error() {
+		t.Errorf("got %v, want %v", replayed, failure)
+	}
+}
+
+func TestWalker_InvariantsHold(t *testing.T) {
+	statemachine.RegisterFunc("start-process", func() {})
+	statemachine.RegisterFunc("stop-process", func() {})
+
+	machineDef, err := statemachine.LoadHCL("process.hcl", processHCL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walker := &statemachinetest.Walker{
+		Def: machineDef,
+		Invariants: []statemachinetest.Invariant{
+			statemachinetest.SubmachineActiveOnlyIn("job", "running"),
+		},
+	}
+	walker.Test(t)
+}
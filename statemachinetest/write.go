@@ -0,0 +1,96 @@
+package statemachinetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// WriteJSON writes the suite to w as indented JSON.
+func WriteJSON(w io.Writer, suite *Suite) error {
+	b, err := json.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteGoTable writes a Go source file of package pkg to w, which declares
+// the sequences of the suite as a table named name, of type
+// []*statemachinetest.Sequence. Uncovered transitions are listed in a
+// comment.
+func WriteGoTable(w io.Writer, pkg, name string, suite *Suite) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by statemachine testgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import (\n")
+	fmt.Fprintf(&buf, "\t%q\n", "github.com/Gurpartap/statemachine-go")
+	fmt.Fprintf(&buf, "\t%q\n", "github.com/Gurpartap/statemachine-go/statemachinetest")
+	fmt.Fprintf(&buf, ")\n\n")
+
+	if len(suite.Uncovered) > 0 {
+		fmt.Fprintf(&buf, "// %s doesn't take these transitions:\n", name)
+		for _, key := range suite.Uncovered {
+			fmt.Fprintf(&buf, "//\t%s\n", key)
+		}
+	}
+	fmt.Fprintf(&buf, "var %s = []*statemachinetest.Sequence{\n", name)
+	for _, sequence := range suite.Sequences {
+		fmt.Fprintf(&buf, "{\nName: %q,\nSteps: []*statemachinetest.Step{\n", sequence.Name)
+		for _, step := range sequence.Steps {
+			fmt.Fprintf(&buf, "{\nEvent: %q,\n", step.Event)
+			if len(step.Guards) > 0 {
+				fmt.Fprintf(&buf, "Guards: map[string]bool{")
+				for _, guard := range sortedGuards(step.Guards) {
+					fmt.Fprintf(&buf, "%q: %t, ", guard, step.Guards[guard])
+				}
+				fmt.Fprintf(&buf, "},\n")
+			}
+			fmt.Fprintf(&buf, "Covers: %q,\n", step.Covers)
+			fmt.Fprintf(&buf, "Want: %s,\n", stateMapLiteral(step.Want))
+			fmt.Fprintf(&buf, "},\n")
+		}
+		fmt.Fprintf(&buf, "},\n},\n")
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func stateMapLiteral(stateMap statemachine.StateMap) string {
+	keys := make([]string, 0, len(stateMap))
+	for key := range stateMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("statemachine.StateMap{")
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(strconv.Quote(key))
+		buf.WriteString(": ")
+		switch value := stateMap[key].(type) {
+		case statemachine.StateMap:
+			buf.WriteString(stateMapLiteral(value))
+		default:
+			fmt.Fprintf(&buf, "%q", value)
+		}
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
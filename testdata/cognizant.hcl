@@ -0,0 +1,158 @@
+states        = ["unmonitored", "stopped", "starting", "running", "stopping", "restarting"]
+initial_state = "unmonitored"
+context = {
+  restarts = 0
+}
+
+event "monitor" {
+  transition {
+    from = ["unmonitored"]
+    to   = "stopped"
+  }
+}
+
+event "restart" {
+  transition {
+    from   = ["running", "stopped"]
+    to     = "restarting"
+    unless = ["payload.reason == 'upgrade' && !payload.force"]
+    assign = [{ var = "restarts", expr = "ctx.restarts + 1" }]
+    do     = [{ func = log-restart, label = "logRestart()" }]
+  }
+}
+
+event "start" {
+  transition {
+    from = ["unmonitored", "stopped"]
+    to   = "starting"
+  }
+}
+
+event "stop" {
+  transition {
+    from = ["running"]
+    to   = "stopping"
+  }
+}
+
+event "tick" {
+  timed_every = "1s"
+  choice {
+    condition = { func = is-process-running, label = "isRunning" }
+    unless    = skip-tick
+
+    on_true {
+      transition {
+        from = ["starting"]
+        to   = "running"
+      }
+
+      transition {
+        from = ["restarting"]
+        to   = "running"
+      }
+
+      transition {
+        from = ["stopping"]
+        to   = "running"
+      }
+
+      transition {
+        from = ["stopped"]
+        to   = "running"
+      }
+    }
+
+    on_false {
+      transition {
+        from = ["starting"]
+        to   = "stopped"
+      }
+
+      transition {
+        from = ["restarting"]
+        to   = "stopped"
+      }
+
+      transition {
+        from = ["running"]
+        to   = "stopped"
+      }
+
+      transition {
+        from = ["stopping"]
+        to   = "stopped"
+      }
+
+      transition {
+        from   = ["stopped"]
+        to     = "starting"
+        if     = [{ func = should-auto-start, label = "shouldAutoStart" }]
+        unless = [any(is-flapping, not(is-restart-allowed))]
+      }
+    }
+  }
+}
+
+event "unmonitor" {
+  transition {
+    to = "unmonitored"
+  }
+}
+
+before_transition {
+  to = ["starting"]
+  do = [{ func = set-auto-start-on, label = "setAutoStartOn()" }]
+}
+
+before_transition {
+  to = ["stopping"]
+  do = [{ func = set-auto-start-off, label = "setAutoStartOff()" }]
+}
+
+before_transition {
+  to = ["restarting"]
+  do = [{ func = set-auto-start-on, label = "setAutoStartOn()" }]
+}
+
+before_transition {
+  to = ["unmonitored"]
+  do = [{ func = set-auto-start-off, label = "setAutoStartOff()" }]
+}
+
+before_transition {
+  do = [notify-triggers]
+}
+
+around_transition {
+  do = [record-transition]
+}
+
+after_transition {
+  to = ["starting"]
+  do = [{ func = start, label = "start()" }]
+}
+
+after_transition {
+  to = ["stopping"]
+  do = [{ func = stop, label = "stop()" }]
+}
+
+after_transition {
+  to = ["restarting"]
+  do = [{ func = restart, label = "restart()" }]
+}
+
+before_event {
+  on = ["start", "restart"]
+  do = [check-quota]
+}
+
+after_event {
+  except_on = ["tick"]
+  do        = [audit-event]
+}
+
+after_failure {
+  do = [log-failure]
+}
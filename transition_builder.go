@@ -1,13 +1,18 @@
 package statemachine
 
-// TransitionGuard may accept Transition object as input, and it must
-// return a bool type.
+// TransitionGuard may accept any of Machine, Transition, Event and
+// context.Context as input, along with payloads of the event passed to
+// Machine.FireContext, by their exact types, or as error for payloads which
+// are errors (see InvokeErrorEvent). It must return a bool type.
 //
 // Valid TransitionGuard types:
 //
-//  bool
+//  *bool
 // 	func() bool
 // 	func(transition statemachine.Transition) bool
+// 	func(machine statemachine.Machine, event statemachine.Event) bool
+// 	func(ctx context.Context, order *Order) bool
+// 	func(err error) bool
 type TransitionGuard interface{}
 
 // TransitionBuilder provides the ability to define the `from` state(s) of
@@ -34,18 +39,60 @@ type TransitionExceptFromBuilder interface {
 
 // TransitionToBuilder inherits from TransitionFromBuilder (or
 // TransitionExceptFromBuilder) and provides the ability to define the guard
-// condition funcs for the transition.
+// condition funcs, the assign actions and the actions of the transition.
 type TransitionToBuilder interface {
 	If(guards ...TransitionGuard) TransitionAndGuardBuilder
 	Unless(guards ...TransitionGuard) TransitionAndGuardBuilder
+
+	// Assign adds actions which update the context of the machine when the
+	// transition is taken. Each is either a ContextAssign func, the name of
+	// a registered func, or an AssignExpr.
+	//
+	// Assign actions run in order, after the guards allow the transition
+	// and before its callbacks, on a copy of the context which replaces it
+	// along with the state. If an action fails, the event fails, and
+	// neither the state nor the context change.
+	Assign(assigns ...ContextAssign) TransitionAndGuardBuilder
+
+	// Do adds actions which run when the transition is taken, unlike
+	// callbacks, only for this transition of this event. Each is either a
+	// TransitionAction func, or the name of a registered func.
+	//
+	// Actions run in order between the exit and the entry of states: after
+	// the before callbacks, inside the around callbacks, and right before
+	// the machine enters the target state, ahead of the after callbacks.
+	// They see the context as assigned by the transition.
+	Do(actions ...TransitionAction) TransitionAndGuardBuilder
+
+	// WithHistory makes the transition restore the last active states of
+	// the submachines of the target state, as they were when the machine
+	// last left it, instead of starting them over from their initial
+	// states. Shallow history only restores the states of the submachines,
+	// while deep history also restores those of their own submachines.
+	WithHistory(history History) TransitionToBuilder
+
+	// Fork enters state in the parallel submachine (region) with the ID
+	// region, of the state which the transition is to, instead of its
+	// initial state. It may be repeated to fork into several regions at
+	// once.
+	Fork(region string, state string) TransitionToBuilder
+
+	// Join only allows the transition once the parallel submachine (region)
+	// with the ID region, of the state which the transition is from, is in
+	// state. It may be repeated to join several regions, like a guard which
+	// passes once all of them are in their states.
+	Join(region string, state string) TransitionToBuilder
 }
 
 // TransitionAndGuardBuilder inherits from TransitionToBuilder and provides
 // the ability to define additional guard condition funcs for the transition.
+// Label labels the guard, assign action or action added last.
 type TransitionAndGuardBuilder interface {
 	Label(label string) TransitionAndGuardBuilder
 	AndIf(guards ...TransitionGuard) TransitionAndGuardBuilder
 	AndUnless(guards ...TransitionGuard) TransitionAndGuardBuilder
+	Assign(assigns ...ContextAssign) TransitionAndGuardBuilder
+	Do(actions ...TransitionAction) TransitionAndGuardBuilder
 }
 
 // newTransitionBuilder returns a zero-valued instance of
@@ -148,6 +195,31 @@ func (builder *transitionToBuilder) Unless(guard ...TransitionGuard) TransitionA
 	return newTransitionAndGuardBuilder(builder.transitionDef, "unless")
 }
 
+func (builder *transitionToBuilder) Assign(assigns ...ContextAssign) TransitionAndGuardBuilder {
+	builder.transitionDef.AddAssign(assigns...)
+	return newTransitionAndGuardBuilder(builder.transitionDef, "assign")
+}
+
+func (builder *transitionToBuilder) Do(actions ...TransitionAction) TransitionAndGuardBuilder {
+	builder.transitionDef.AddAction(actions...)
+	return newTransitionAndGuardBuilder(builder.transitionDef, "do")
+}
+
+func (builder *transitionToBuilder) WithHistory(history History) TransitionToBuilder {
+	builder.transitionDef.SetHistory(history)
+	return builder
+}
+
+func (builder *transitionToBuilder) Fork(region string, state string) TransitionToBuilder {
+	builder.transitionDef.SetFork(region, state)
+	return builder
+}
+
+func (builder *transitionToBuilder) Join(region string, state string) TransitionToBuilder {
+	builder.transitionDef.SetJoin(region, state)
+	return builder
+}
+
 // newTransitionAndGuardBuilder returns a zero-valued instance of
 // TransitionAndGuardBuilder, which implements TransitionAndGuardBuilder.
 func newTransitionAndGuardBuilder(transitionDef *TransitionDef, lastGuardType string) TransitionAndGuardBuilder {
@@ -166,9 +238,14 @@ type transitionAndGuardBuilder struct {
 var _ TransitionAndGuardBuilder = (*transitionAndGuardBuilder)(nil)
 
 func (builder *transitionAndGuardBuilder) Label(label string) TransitionAndGuardBuilder {
-	if builder.lastGuardType == "if" {
+	switch builder.lastGuardType {
+	case "if":
 		builder.transitionDef.IfGuards[len(builder.transitionDef.IfGuards)-1].Label = label
-	} else {
+	case "assign":
+		builder.transitionDef.Assigns[len(builder.transitionDef.Assigns)-1].Label = label
+	case "do":
+		builder.transitionDef.Do[len(builder.transitionDef.Do)-1].Label = label
+	default:
 		builder.transitionDef.UnlessGuards[len(builder.transitionDef.UnlessGuards)-1].Label = label
 	}
 	return builder
@@ -185,3 +262,15 @@ func (builder *transitionAndGuardBuilder) AndUnless(guard ...TransitionGuard) Tr
 	builder.lastGuardType = "unless"
 	return builder
 }
+
+func (builder *transitionAndGuardBuilder) Assign(assigns ...ContextAssign) TransitionAndGuardBuilder {
+	builder.transitionDef.AddAssign(assigns...)
+	builder.lastGuardType = "assign"
+	return builder
+}
+
+func (builder *transitionAndGuardBuilder) Do(actions ...TransitionAction) TransitionAndGuardBuilder {
+	builder.transitionDef.AddAction(actions...)
+	builder.lastGuardType = "do"
+	return builder
+}
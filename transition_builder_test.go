@@ -0,0 +1,171 @@
+package statemachine_test
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+func ExampleTransitionToBuilder_Do() {
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("stopped", "running", "unmonitored")
+		m.InitialState("running")
+		m.Context(&ProcessContext{})
+
+		m.Event("stop", func(e statemachine.EventBuilder) {
+			e.Transition().From("running").To("stopped").
+				Assign(statemachine.AssignExpr("auto_start", "false")).
+				Do(func(event statemachine.Event, c *ProcessContext) {
+					fmt.Printf("stopping on %s, auto start %t\n", event.Event(), c.AutoStart)
+				})
+		})
+
+		m.Event("unmonitor", func(e statemachine.EventBuilder) {
+			e.Transition().From("running").To("unmonitored").
+				Do(func(t statemachine.Transition) {
+					fmt.Printf("unmonitoring %s -> %s\n", t.From(), t.To())
+				}).Label("unmonitor()")
+		})
+
+		m.BeforeTransition().Any().Do(func(m statemachine.Machine) {
+			fmt.Println("before, in", m.GetState())
+		})
+		m.AfterTransition().Any().Do(func(m statemachine.Machine) {
+			fmt.Println("after, in", m.GetState())
+		})
+	})
+
+	fmt.Println(machine.Fire("unmonitor"))
+	machine.SetCurrentState("running")
+	fmt.Println(machine.Fire("stop"))
+
+	// Output:
+	// before, in running
+	// unmonitoring running -> unmonitored
+	// after, in unmonitored
+	// <nil>
+	// before, in running
+	// stopping on stop, auto start false
+	// after, in stopped
+	// <nil>
+}
+
+func ExampleTransitionToBuilder_WithHistory() {
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("paused")
+		m.InitialState("running")
+
+		m.Submachine("running", func(sm statemachine.MachineBuilder) {
+			sm.ID("job")
+			sm.States("pending")
+			sm.InitialState("pending")
+			sm.Event("process", func(e statemachine.EventBuilder) {
+				e.Transition().From("pending").To("processing")
+			})
+
+			sm.Submachine("processing", func(sm statemachine.MachineBuilder) {
+				sm.ID("step")
+				sm.States("fetch", "store")
+				sm.InitialState("fetch")
+				sm.Event("next", func(e statemachine.EventBuilder) {
+					e.Transition().From("fetch").To("store")
+				})
+			})
+		})
+
+		m.Event("pause", func(e statemachine.EventBuilder) {
+			e.Transition().From("running").To("paused")
+		})
+		m.Event("resume", func(e statemachine.EventBuilder) {
+			e.Transition().From("paused").To("running").WithHistory(statemachine.Deep)
+		})
+		m.Event("retry", func(e statemachine.EventBuilder) {
+			e.Transition().From("paused").To("running").WithHistory(statemachine.Shallow)
+		})
+		m.Event("restart", func(e statemachine.EventBuilder) {
+			e.Transition().From("paused").To("running")
+		})
+	})
+
+	job, _ := machine.Submachine("job")
+	_ = job.Fire("process")
+	step, _ := machine.Submachine("job", "step")
+	_ = step.Fire("next")
+	fmt.Println(machine.GetStateMap())
+
+	_ = machine.Fire("pause")
+	snapshot, _ := json.Marshal(machine.Snapshot())
+	fmt.Println(string(snapshot))
+
+	_ = machine.Fire("restart")
+	restored := &statemachine.Snapshot{}
+	_ = json.Unmarshal(snapshot, restored)
+	_ = machine.Restore(restored)
+	_ = machine.Fire("resume")
+	fmt.Println(machine.GetStateMap())
+
+	_ = machine.Fire("pause")
+	_ = machine.Fire("retry")
+	fmt.Println(machine.GetStateMap())
+
+	_ = machine.Fire("pause")
+	_ = machine.Fire("restart")
+	fmt.Println(machine.GetStateMap())
+
+	// Output:
+	// map[running:map[job:map[processing:map[step:store]]]]
+	// {"State":"paused","History":{"running":{"job":{"State":"processing","Submachines":{"step":{"State":"store"}}}}}}
+	// map[running:map[job:map[processing:map[step:store]]]]
+	// map[running:map[job:map[processing:map[step:fetch]]]]
+	// map[running:map[job:pending]]
+}
+
+func ExampleTransitionToBuilder_Fork() {
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("draft", "released")
+		m.InitialState("draft")
+
+		m.Submachine("releasing", func(sm statemachine.MachineBuilder) {
+			sm.ID("review")
+			sm.States("pending", "approved")
+			sm.InitialState("pending")
+			sm.Event("approve", func(e statemachine.EventBuilder) {
+				e.Transition().From("pending").To("approved")
+			})
+		})
+		m.Submachine("releasing", func(sm statemachine.MachineBuilder) {
+			sm.ID("build")
+			sm.States("running", "passed")
+			sm.InitialState("running")
+			sm.Event("pass", func(e statemachine.EventBuilder) {
+				e.Transition().From("running").To("passed")
+			})
+		})
+
+		m.Event("hotfix", func(e statemachine.EventBuilder) {
+			e.Transition().From("draft").To("releasing").Fork("review", "approved")
+		})
+		m.Event("release", func(e statemachine.EventBuilder) {
+			e.Transition().From("releasing").To("released").
+				Join("review", "approved").
+				Join("build", "passed")
+		})
+	})
+
+	fmt.Println(machine.Fire("hotfix"))
+	fmt.Println(machine.GetStateMap())
+	fmt.Println(machine.Fire("release"))
+
+	build, _ := machine.Submachine("build")
+	_ = build.Fire("pass")
+	fmt.Println(machine.Fire("release"))
+	fmt.Println(machine.GetState())
+
+	// Output:
+	// <nil>
+	// map[releasing:map[build:running review:approved]]
+	// no matching transition
+	// <nil>
+	// released
+}
@@ -6,20 +6,20 @@ import (
 )
 
 type TransitionCallbackFuncDef struct {
-	Label          string                 `json:",omitempty" hcl:"label" hcle:"omitempty"`
-	RegisteredFunc string                 `json:",omitempty" hcl:"registered_func" hcle:"omitempty"`
-	Func           TransitionCallbackFunc `json:"-" hcle:"omit"`
+	Label          string                 `json:",omitempty"`
+	RegisteredFunc string                 `json:",omitempty"`
+	Func           TransitionCallbackFunc `json:"-"`
 }
 
 type TransitionCallbackDef struct {
-	From        []string                     `json:",omitempty" hcl:"from" hcle:"omitempty"`
-	ExceptFrom  []string                     `json:",omitempty" hcl:"except_from" hcle:"omitempty"`
-	To          []string                     `json:",omitempty" hcl:"to" hcle:"omitempty"`
-	ExceptTo    []string                     `json:",omitempty" hcl:"except_to" hcle:"omitempty"`
-	Do          []*TransitionCallbackFuncDef `json:",omitempty" hcl:"do" hcle:"omitempty"`
-	ExitToState string                       `json:",omitempty" hcl:"exit_to_state" hcle:"omitempty"`
-
-	validateFor string `json:"-" hcle:"omit"`
+	From        []string                     `json:",omitempty"`
+	ExceptFrom  []string                     `json:",omitempty"`
+	To          []string                     `json:",omitempty"`
+	ExceptTo    []string                     `json:",omitempty"`
+	Do          []*TransitionCallbackFuncDef `json:",omitempty"`
+	ExitToState string                       `json:",omitempty"`
+
+	validateFor string `json:"-"`
 }
 
 func (s *TransitionCallbackDef) Matches(from, to string) bool {
@@ -133,6 +133,11 @@ func (s *TransitionCallbackDef) assertCallbackKind(callbackFunc TransitionCallba
 			if _, ok := optionalArgs[reflect.PtrTo(argType)]; ok {
 				continue
 			}
+			// the context of the machine, whose type is checked along with
+			// the definition.
+			if isContextType(argType) {
+				continue
+			}
 			if _, ok := requiredArgs[reflect.PtrTo(argType)]; ok {
 				continue
 			}
@@ -1,37 +1,60 @@
 package statemachine
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 
 	"github.com/Gurpartap/statemachine-go/internal/dynafunc"
 )
 
-type TransitionGuardDef struct {
-	Label          string          `json:",omitempty" hcl:"label" hcle:"omitempty"`
-	RegisteredFunc string          `json:",omitempty" hcl:"registered_func" hcle:"omitempty"`
-	Guard          TransitionGuard `json:"-" hcle:"omit"`
-}
-
 type TransitionDef struct {
-	From         []string              `json:",omitempty" hcl:"from" hcle:"omitempty"`
-	ExceptFrom   []string              `json:",omitempty" hcl:"except_from" hcle:"omitempty"`
-	To           string                `hcl:"to"`
-	IfGuards     []*TransitionGuardDef `json:",omitempty" hcl:"if_guard" hcle:"omitempty"`
-	UnlessGuards []*TransitionGuardDef `json:",omitempty" hcl:"unless_guard" hcle:"omitempty"`
+	From         []string `json:",omitempty"`
+	ExceptFrom   []string `json:",omitempty"`
+	To           string
+	History      History               `json:",omitempty"`
+	IfGuards     []*TransitionGuardDef `json:",omitempty"`
+	UnlessGuards []*TransitionGuardDef `json:",omitempty"`
+	Assigns      []*ContextAssignDef   `json:",omitempty"`
+
+	// Do lists the actions of the transition (see TransitionToBuilder.Do).
+	Do []*TransitionCallbackFuncDef `json:",omitempty"`
+
+	// Fork and Join map the IDs of parallel submachines to their states
+	// (see TransitionToBuilder.Fork and TransitionToBuilder.Join).
+	Fork map[string]string `json:",omitempty"`
+	Join map[string]string `json:",omitempty"`
 }
 
-func execGuard(guard TransitionGuard, args map[reflect.Type]interface{}) bool {
+// TransitionAction is run when its transition is taken. It may accept any of
+// Machine, Transition, Event and context.Context, and the context of the
+// machine (see MachineBuilder.Context) by its type. It may also accept the
+// error which the event was fired with as its payload (see
+// InvokeErrorEvent), which is nil for other events. It must not return
+// anything.
+//
+// Valid TransitionAction types:
+//
+//	func()
+//	func(event statemachine.Event, transition statemachine.Transition)
+//	func(ctx context.Context, c *ProcessContext)
+type TransitionAction interface{}
+
+func execGuard(guard TransitionGuard, args map[reflect.Type]interface{}) (bool, error) {
 	switch reflect.TypeOf(guard).Kind() {
 	case reflect.Func:
+		if err := assertGuardArgs(guard, args); err != nil {
+			return false, err
+		}
 		fn := dynafunc.NewDynamicFunc(guard, args)
 		if err := fn.Call(); err != nil {
 			panic(err)
 		}
 		// guard func must return a bool
-		return fn.Out[0].Bool()
+		return fn.Out[0].Bool(), nil
 	case reflect.Ptr:
 		if reflect.ValueOf(guard).Elem().Kind() == reflect.Bool {
-			return reflect.ValueOf(guard).Elem().Bool()
+			return reflect.ValueOf(guard).Elem().Bool(), nil
 		}
 		fallthrough
 	default:
@@ -39,10 +62,38 @@ func execGuard(guard TransitionGuard, args map[reflect.Type]interface{}) bool {
 	}
 }
 
+// assertGuardArgs returns ErrMissingPayload if the guard func takes an arg
+// which the event was not fired with.
+func assertGuardArgs(guard TransitionGuard, args map[reflect.Type]interface{}) error {
+	t := reflect.TypeOf(guard)
+	for i := 0; i < t.NumIn(); i++ {
+		if _, ok := args[reflect.PtrTo(t.In(i))]; !ok {
+			return fmt.Errorf("%w with type '%s'", ErrMissingPayload, t.In(i))
+		}
+	}
+	return nil
+}
+
+// IsAllowed reports whether the guards of the transition allow it from
+// fromState. Guards which take the payload of an event don't allow it.
 func (def *TransitionDef) IsAllowed(fromState string, machine Machine) bool {
+	args := make(map[reflect.Type]interface{})
+	args[reflect.TypeOf(new(Machine))] = machine
+	allowed, err := def.isAllowed(fromState, args)
+	return allowed && err == nil
+}
+
+// isAllowed is like IsAllowed, and passes args, along with the Transition,
+// to the guards.
+func (def *TransitionDef) isAllowed(fromState string, args map[reflect.Type]interface{}) (bool, error) {
+	if len(def.Join) != 0 {
+		machine, _ := args[reflect.TypeOf(new(Machine))].(Machine)
+		if machine == nil || !def.isJoined(machine) {
+			return false, nil
+		}
+	}
+
 	if len(def.IfGuards) != 0 || len(def.UnlessGuards) != 0 {
-		args := make(map[reflect.Type]interface{})
-		args[reflect.TypeOf(new(Machine))] = machine
 		args[reflect.TypeOf(new(Transition))] = newTransitionImpl(
 			fromState,
 			def.To,
@@ -50,24 +101,30 @@ func (def *TransitionDef) IsAllowed(fromState string, machine Machine) bool {
 
 		for _, guard := range def.IfGuards {
 			// if !ok { dont allow }
-			if ok := execGuard(guard.Guard, args); !ok {
+			if ok, err := guard.exec(args); err != nil || !ok {
 				// fmt.Printf("❌1 from: %def to: %def\n", fromState, def.To.State())
-				return false
+				return false, err
 			}
 		}
 
 		for _, guard := range def.UnlessGuards {
 			// if ok { dont allow }
-			if ok := execGuard(guard.Guard, args); ok {
+			if ok, err := guard.exec(args); err != nil || ok {
 				// fmt.Printf("❌2 from: %def to: %def\n", fromState, def.To.State())
-				return false
+				return false, err
 			}
 		}
 	}
 
 	// fmt.Printf("✅  transitioning from %def to %def\n", fromState, def.To.State())
 
-	return true
+	return true, nil
+}
+
+// IsGuarded reports whether the transition may be rejected from a state it
+// matches, by its guards or by the states of the regions it joins.
+func (def *TransitionDef) IsGuarded() bool {
+	return len(def.IfGuards) != 0 || len(def.UnlessGuards) != 0 || len(def.Join) != 0
 }
 
 func (def *TransitionDef) Matches(matchFrom string) bool {
@@ -107,29 +164,105 @@ func (def *TransitionDef) SetTo(state string) {
 	def.To = state
 }
 
+func (def *TransitionDef) SetHistory(history History) {
+	def.History = history
+}
+
+func (def *TransitionDef) SetFork(region string, state string) {
+	if def.Fork == nil {
+		def.Fork = map[string]string{}
+	}
+	def.Fork[region] = state
+}
+
+func (def *TransitionDef) SetJoin(region string, state string) {
+	if def.Join == nil {
+		def.Join = map[string]string{}
+	}
+	def.Join[region] = state
+}
+
 func (def *TransitionDef) AddIfGuard(guards ...TransitionGuard) {
 	for _, guard := range guards {
-		assertGuardKind(guard)
-		def.IfGuards = append(def.IfGuards, &TransitionGuardDef{Guard: guard})
+		def.IfGuards = append(def.IfGuards, newTransitionGuardDef(guard))
 	}
 }
 
 func (def *TransitionDef) AddUnlessGuard(guards ...TransitionGuard) {
 	for _, guard := range guards {
-		assertGuardKind(guard)
-		def.UnlessGuards = append(def.UnlessGuards, &TransitionGuardDef{Guard: guard})
+		def.UnlessGuards = append(def.UnlessGuards, newTransitionGuardDef(guard))
+	}
+}
+
+func (def *TransitionDef) AddAssign(assigns ...ContextAssign) {
+	for _, assign := range assigns {
+		def.Assigns = append(def.Assigns, newContextAssignDef(assign))
+	}
+}
+
+// AddAction adds actions to the transition, each either a TransitionAction
+// func or the name of a registered func.
+func (def *TransitionDef) AddAction(actions ...TransitionAction) {
+	for _, action := range actions {
+		if name, ok := action.(string); ok {
+			def.Do = append(def.Do, &TransitionCallbackFuncDef{RegisteredFunc: name})
+			continue
+		}
+		assertActionKind(action)
+		def.Do = append(def.Do, &TransitionCallbackFuncDef{Func: action})
 	}
 }
 
+func assertActionKind(action TransitionAction) {
+	t := reflect.TypeOf(action)
+	if t == nil || t.Kind() != reflect.Func {
+		panic("action must be a compatible func")
+	}
+	if t.NumOut() != 0 {
+		panic("action func must not return anything")
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		argType := t.In(i)
+		if _, ok := guardArgs[reflect.PtrTo(argType)]; ok || argType == errorType || isContextType(argType) {
+			continue
+		}
+		panic(fmt.Sprintf("unexpected argument with type '%s' in action func", argType))
+	}
+}
+
+// guardArgs are the args which guards and choice conditions may accept,
+// besides the payload of the event.
+var guardArgs = map[reflect.Type]struct{}{
+	reflect.TypeOf(new(Machine)):         {},
+	reflect.TypeOf(new(Transition)):      {},
+	reflect.TypeOf(new(Event)):           {},
+	reflect.TypeOf(new(context.Context)): {},
+}
+
+// errorType is the type of the args which are passed a payload which is an
+// error.
+var errorType = reflect.TypeOf(new(error)).Elem()
+
 func assertGuardKind(guard TransitionGuard) {
 	t := reflect.TypeOf(guard)
 	switch t.Kind() {
 	case reflect.Func:
-		if t.NumIn() > 1 {
-			panic("too many args in guard func")
-		}
-		if t.NumIn() == 1 && t.In(0).Implements(reflect.TypeOf(new(Transition)).Elem()) == false {
-			panic("guard func arg must be statemachine.Transition")
+		seen := make(map[reflect.Type]struct{})
+		for i := 0; i < t.NumIn(); i++ {
+			argType := t.In(i)
+			if _, ok := seen[argType]; ok {
+				panic(fmt.Sprintf("duplicate argument with type '%s' in guard func", argType))
+			}
+			seen[argType] = struct{}{}
+
+			if _, ok := guardArgs[reflect.PtrTo(argType)]; ok || argType == errorType {
+				continue
+			}
+			// any other arg is a payload, which is passed by its exact type.
+			switch argType.Kind() {
+			case reflect.Interface, reflect.Func:
+				panic(fmt.Sprintf("unexpected argument with type '%s' in guard func", argType))
+			}
 		}
 		if t.NumOut() != 1 {
 			panic("guard func must return a single type")
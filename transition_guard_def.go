@@ -0,0 +1,184 @@
+package statemachine
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/Gurpartap/statemachine-go/internal/expr"
+)
+
+// TransitionGuardDef is a guard func, either set directly or referred to by
+// its RegisteredFunc name, a guard expression (see Expr), or a combination
+// of guards: All of them, Any of them, or Not a guard. Only one of these is
+// set.
+type TransitionGuardDef struct {
+	Label          string                `json:",omitempty"`
+	RegisteredFunc string                `json:",omitempty"`
+	Guard          TransitionGuard       `json:"-"`
+	Expr           string                `json:",omitempty"`
+	All            []*TransitionGuardDef `json:",omitempty"`
+	Any            []*TransitionGuardDef `json:",omitempty"`
+	Not            *TransitionGuardDef   `json:",omitempty"`
+
+	program *expr.Program
+}
+
+// All returns a guard which passes when all of the guards pass. Guards are
+// evaluated in order, until one fails.
+//
+// Each guard is either a TransitionGuard, the name of a func registered
+// with RegisterFunc, or a *TransitionGuardDef, such as one returned by All,
+// Any, Not, Labeled or Expr.
+func All(guards ...TransitionGuard) *TransitionGuardDef {
+	def := &TransitionGuardDef{}
+	for _, guard := range guards {
+		def.All = append(def.All, newTransitionGuardDef(guard))
+	}
+	return def
+}
+
+// Any returns a guard which passes when any of the guards pass. Guards are
+// evaluated in order, until one passes. Guards are given as with All.
+func Any(guards ...TransitionGuard) *TransitionGuardDef {
+	def := &TransitionGuardDef{}
+	for _, guard := range guards {
+		def.Any = append(def.Any, newTransitionGuardDef(guard))
+	}
+	return def
+}
+
+// Not returns a guard which passes when guard fails. The guard is given as
+// with All.
+func Not(guard TransitionGuard) *TransitionGuardDef {
+	return &TransitionGuardDef{Not: newTransitionGuardDef(guard)}
+}
+
+// Labeled returns the guard with a label, which names it in diagrams. The
+// guard is given as with All.
+func Labeled(label string, guard TransitionGuard) *TransitionGuardDef {
+	def := newTransitionGuardDef(guard)
+	def.Label = label
+	return def
+}
+
+// newTransitionGuardDef returns the definition of guard, which is either a
+// TransitionGuard, the name of a registered func, or a *TransitionGuardDef.
+func newTransitionGuardDef(guard TransitionGuard) *TransitionGuardDef {
+	switch guard := guard.(type) {
+	case *TransitionGuardDef:
+		return guard
+	case string:
+		return &TransitionGuardDef{RegisteredFunc: guard}
+	}
+	assertGuardKind(guard)
+	return &TransitionGuardDef{Guard: guard}
+}
+
+// IsCombined reports whether the guard combines other guards.
+func (def *TransitionGuardDef) IsCombined() bool {
+	return len(def.All) != 0 || len(def.Any) != 0 || def.Not != nil
+}
+
+// Leaves returns the guards which the guard combines, down to the guards
+// which don't combine others, in order. A guard which doesn't combine
+// others is its own single leaf.
+func (def *TransitionGuardDef) Leaves() []*TransitionGuardDef {
+	if !def.IsCombined() {
+		return []*TransitionGuardDef{def}
+	}
+
+	var leaves []*TransitionGuardDef
+	for _, guardDef := range def.children() {
+		leaves = append(leaves, guardDef.Leaves()...)
+	}
+	return leaves
+}
+
+func (def *TransitionGuardDef) children() []*TransitionGuardDef {
+	switch {
+	case len(def.All) != 0:
+		return def.All
+	case len(def.Any) != 0:
+		return def.Any
+	case def.Not != nil:
+		return []*TransitionGuardDef{def.Not}
+	}
+	return nil
+}
+
+// String returns the guard as an expression, such as
+// `isRunning && !(isPaused || isStopping)`. Guards are named by their label,
+// or else their expression or RegisteredFunc name.
+func (def *TransitionGuardDef) String() string {
+	cond, _ := def.cond(true)
+	return cond
+}
+
+// Cond is like String, but it names guards by their RegisteredFunc name,
+// ignoring labels. It returns false if a guard has no RegisteredFunc name.
+func (def *TransitionGuardDef) Cond() (string, bool) {
+	return def.cond(false)
+}
+
+func (def *TransitionGuardDef) cond(labels bool) (string, bool) {
+	switch {
+	case labels && def.Label != "":
+		return def.Label, true
+	case !def.IsCombined() && def.Expr != "":
+		return def.Expr, labels
+	case !def.IsCombined() && def.RegisteredFunc != "":
+		return def.RegisteredFunc, true
+	case !def.IsCombined():
+		return "guard", labels
+	}
+
+	ok := true
+	var operands []string
+	for _, guardDef := range def.children() {
+		operand, operandOK := guardDef.cond(labels)
+		ok = ok && operandOK
+		compound := len(guardDef.children()) > 1 || guardDef.Expr != "" && !isFuncName(guardDef.Expr)
+		if compound && !(labels && guardDef.Label != "") {
+			operand = "(" + operand + ")"
+		}
+		operands = append(operands, operand)
+	}
+
+	switch {
+	case def.Not != nil:
+		return "!" + operands[0], ok
+	case len(def.Any) != 0:
+		return strings.Join(operands, " || "), ok
+	}
+	return strings.Join(operands, " && "), ok
+}
+
+// exec evaluates the guard with args.
+func (def *TransitionGuardDef) exec(args map[reflect.Type]interface{}) (bool, error) {
+	switch {
+	case len(def.All) != 0:
+		for _, guardDef := range def.All {
+			if ok, err := guardDef.exec(args); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case len(def.Any) != 0:
+		for _, guardDef := range def.Any {
+			if ok, err := guardDef.exec(args); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case def.Not != nil:
+		ok, err := def.Not.exec(args)
+		return !ok, err
+
+	case def.Expr != "":
+		return execExpr(def.Expr, def.program, args)
+	}
+
+	return execGuard(def.Guard, args)
+}
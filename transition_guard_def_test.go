@@ -0,0 +1,88 @@
+package statemachine_test
+
+import (
+	"fmt"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+func ExampleAll() {
+	isPaused, isStopping := false, true
+
+	statemachine.RegisterFunc("is-process-running", func() bool { return true })
+
+	guardDef := statemachine.All(
+		"is-process-running",
+		statemachine.Not(statemachine.Any(
+			statemachine.Labeled("isPaused", &isPaused),
+			statemachine.Labeled("isStopping", &isStopping),
+		)),
+	)
+
+	machine := statemachine.BuildNewMachine(func(m statemachine.MachineBuilder) {
+		m.States("starting", "running", "stopped")
+		m.InitialState("starting")
+
+		m.Event("tick", func(e statemachine.EventBuilder) {
+			e.Transition().From("starting").To("running").If(guardDef)
+			e.Transition().From("starting").To("stopped")
+		})
+	})
+
+	fmt.Println(guardDef)
+
+	fmt.Println(machine.Fire("tick"), machine.GetState())
+
+	// Output:
+	// is-process-running && !(isPaused || isStopping)
+	// <nil> stopped
+}
+
+func ExampleTransitionGuardDef_Cond() {
+	guardDef := statemachine.Any(
+		statemachine.Labeled("isFlapping", "is-flapping"),
+		statemachine.Not("is-restart-allowed"),
+	)
+	fmt.Println(guardDef.String())
+	fmt.Println(guardDef.Cond())
+
+	guardDef = statemachine.All("is-process-running", func() bool { return true })
+	fmt.Println(guardDef.String())
+	fmt.Println(guardDef.Cond())
+
+	// Output:
+	// isFlapping || !is-restart-allowed
+	// is-flapping || !is-restart-allowed true
+	// is-process-running && guard
+	// is-process-running && guard false
+}
+
+func ExampleTransitionGuardDef_Leaves() {
+	machineDef := &statemachine.MachineDef{
+		States:       []string{"stopped", "starting"},
+		InitialState: "stopped",
+		Events: map[string]*statemachine.EventDef{
+			"start": {
+				Transitions: []*statemachine.TransitionDef{
+					{
+						To: "starting",
+						IfGuards: []*statemachine.TransitionGuardDef{
+							{All: []*statemachine.TransitionGuardDef{{RegisteredFunc: "is-enabled"}, {}}},
+							{Not: &statemachine.TransitionGuardDef{RegisteredFunc: "is-paused"}, RegisteredFunc: "is-ready"},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, guardDef := range machineDef.Events["start"].Transitions[0].IfGuards[0].Leaves() {
+		fmt.Printf("%q\n", guardDef.RegisteredFunc)
+	}
+	fmt.Println(machineDef.Validate())
+
+	// Output:
+	// "is-enabled"
+	// ""
+	// event.start.transitions[0].if_guard[0].all[1]: neither func, registered func nor expr is set
+	// event.start.transitions[0].if_guard[1]: func, registered func or expr is set along with all, any or not
+}
@@ -3,6 +3,9 @@ package statemachine
 type transitionImpl struct {
 	from string
 	to   string
+
+	// def is the definition of the matched transition, if any.
+	def *TransitionDef
 }
 
 func newTransitionImpl(from, to string) *transitionImpl {
@@ -0,0 +1,125 @@
+package xstate_test
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/xstate"
+)
+
+func ExampleImport() {
+	machineDef, warnings, err := xstate.Import([]byte(`{
+	  "id": "checkout",
+	  "initial": "cart",
+	  "on": { "RESET": "cart" },
+	  "states": {
+	    "cart": {
+	      "on": { "CHECKOUT": { "target": "payment", "guard": "hasItems" } }
+	    },
+	    "payment": {
+	      "entry": ["startPaymentTimer"],
+	      "after": { "30000": "cart" },
+	      "on": {
+	        "PAY": [
+	          { "target": "confirmed", "guard": { "type": "isCardValid" }, "actions": "chargeCard" },
+	          { "target": ".error" }
+	        ]
+	      }
+	    },
+	    "confirmed": { "type": "final", "invoke": { "src": "sendReceipt", "data": { "copy": true } } }
+	  }
+	}`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, warning := range warnings {
+		fmt.Println(warning)
+	}
+
+	pay := machineDef.Events["PAY"].Transitions[0]
+	fmt.Println(machineDef.States, machineDef.FinalStates, machineDef.Events["RESET"].Transitions[0].To)
+	fmt.Println(pay.From, pay.To, pay.IfGuards[0].RegisteredFunc)
+	fmt.Println(machineDef.Events["xstate.after(30000)"].TimedEvery)
+	fmt.Println(pay.Do[0].RegisteredFunc)
+	fmt.Println(machineDef.Invokes[0].ID, machineDef.Invokes[0].RegisteredFunc)
+
+	// Output:
+	// states.payment.on.PAY[1]: target '.error' is not a sibling state
+	// states.payment.after.30000: delay '30000' is imported as a timed event, which fires every 30s rather than once after entering the state
+	// states.confirmed.invoke.data: key 'data' is not supported
+	// [cart payment confirmed] [confirmed] cart
+	// [payment] confirmed isCardValid
+	// 30s
+	// chargeCard
+	// confirmed sendReceipt
+}
+
+func ExampleExport() {
+	machineDef := &statemachine.MachineDef{
+		States:       []string{"locked", "unlocked"},
+		InitialState: "locked",
+		Events: map[string]*statemachine.EventDef{
+			"coin": {
+				Transitions: []*statemachine.TransitionDef{{From: []string{"locked"}, To: "unlocked"}},
+			},
+			"push": {
+				Transitions: []*statemachine.TransitionDef{
+					{
+						From:     []string{"unlocked"},
+						To:       "locked",
+						IfGuards: []*statemachine.TransitionGuardDef{{RegisteredFunc: "isClear"}},
+					},
+				},
+			},
+		},
+		AfterCallbacks: []*statemachine.TransitionCallbackDef{
+			{
+				To: []string{"unlocked"},
+				Do: []*statemachine.TransitionCallbackFuncDef{{RegisteredFunc: "unlockGate"}},
+			},
+		},
+		AroundCallbacks: []*statemachine.TransitionCallbackDef{
+			{
+				Do: []*statemachine.TransitionCallbackFuncDef{{RegisteredFunc: "recordTransition"}},
+			},
+		},
+	}
+
+	config, warnings, err := xstate.Export(machineDef)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	os.Stdout.Write(config)
+	for _, warning := range warnings {
+		fmt.Println(warning)
+	}
+
+	// Output:
+	// {
+	//   "initial": "locked",
+	//   "states": {
+	//     "locked": {
+	//       "on": {
+	//         "coin": "unlocked"
+	//       }
+	//     },
+	//     "unlocked": {
+	//       "entry": [
+	//         "unlockGate"
+	//       ],
+	//       "on": {
+	//         "push": {
+	//           "target": "locked",
+	//           "guard": "isClear"
+	//         }
+	//       }
+	//     }
+	//   }
+	// }
+	// around_transition callbacks are not supported
+}
@@ -0,0 +1,529 @@
+package xstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// Export encodes the definition as an XState JSON machine config.
+//
+// The returned warnings list the parts of the definition which were left out
+// because they have no equivalent in XState, such as unless guards, multiple
+// or combined guards on a transition, guard expressions, the context and
+// assign actions, history, fork and join, around, event and failure
+// callbacks, and guards, callbacks or invoked services without a
+// RegisteredFunc name.
+func Export(def *statemachine.MachineDef) ([]byte, []Warning, error) {
+	ex := &exporter{}
+
+	config := object{}
+	if def.ID != "" {
+		config.set("id", def.ID)
+	}
+	config = append(config, ex.machine("", def)...)
+
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, ex.warnings, err
+	}
+	return append(b, '\n'), ex.warnings, nil
+}
+
+type exporter struct {
+	warnings []Warning
+}
+
+func (ex *exporter) warnf(path string, format string, args ...interface{}) {
+	ex.warnings = append(ex.warnings, Warning{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// exportState collects the config of a state node.
+type exportState struct {
+	id     string
+	entry  []string
+	exit   []string
+	events []string
+	on     map[string][]object
+	delays []string
+	after  map[string][]object
+	always []object
+
+	invokes []*statemachine.InvokeDef
+}
+
+func (state *exportState) addTransition(event string, timedEvery time.Duration, config object) {
+	if timedEvery != 0 {
+		delay := strconv.FormatInt(int64(timedEvery/time.Millisecond), 10)
+		if _, ok := state.after[delay]; !ok {
+			state.delays = append(state.delays, delay)
+		}
+		state.after[delay] = append(state.after[delay], config)
+		return
+	}
+
+	if _, ok := state.on[event]; !ok {
+		state.events = append(state.events, event)
+	}
+	state.on[event] = append(state.on[event], config)
+}
+
+// machine returns the initial and states keys of a machine config. The
+// transitions of the root machine from any state are set on the machine.
+func (ex *exporter) machine(path string, def *statemachine.MachineDef) object {
+	var states []*exportState
+	for _, state := range def.KnownStates() {
+		states = append(states, &exportState{
+			id:    state,
+			on:    map[string][]object{},
+			after: map[string][]object{},
+		})
+	}
+	root := &exportState{on: map[string][]object{}, after: map[string][]object{}}
+	if def.Context != nil {
+		ex.warnf(path, "context is not supported")
+	}
+
+	deferred := make([]string, 0, len(def.Deferred))
+	for event := range def.Deferred {
+		deferred = append(deferred, event)
+	}
+	sort.Strings(deferred)
+	for _, event := range deferred {
+		ex.warnf(path, "deferral of event '%s' in %v is not supported", event, def.Deferred[event])
+	}
+
+	actions := ex.callbacks(states, path, def)
+
+	events := make([]string, 0, len(def.Events))
+	for event := range def.Events {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	for _, event := range events {
+		eventDef := def.Events[event]
+		if eventDef == nil {
+			continue
+		}
+		if eventDef.TimedEvery != 0 {
+			if eventDef.TimedEvery%time.Millisecond != 0 {
+				ex.warnf(path, "timed_every of event '%s' is rounded down to milliseconds", event)
+			}
+			ex.warnf(path, "timed event '%s' is exported as an after delay, which fires once after entering the state rather than every %s", event, eventDef.TimedEvery)
+		}
+		ex.event(states, root, path, event, eventDef, actions)
+	}
+	ex.always(states, path, def.Always, actions)
+	ex.invokes(states, path, def.Invokes)
+
+	var config object
+	config.set("initial", def.InitialState)
+
+	if path == "" && len(root.events) > 0 {
+		config.set("on", root.onConfig())
+	}
+
+	stateConfigs := object{}
+	for _, state := range states {
+		stateConfig := object{}
+
+		submachineDefs := def.Submachines[state.id]
+		if len(submachineDefs) > 1 {
+			stateConfig.set("type", "parallel")
+		} else if def.IsFinalState(state.id) {
+			stateConfig.set("type", "final")
+		}
+		if len(state.entry) > 0 {
+			stateConfig.set("entry", state.entry)
+		}
+		if len(state.exit) > 0 {
+			stateConfig.set("exit", state.exit)
+		}
+		if len(state.invokes) > 0 {
+			stateConfig.set("invoke", state.invokeConfig())
+		}
+		var onDone []object
+		if len(submachineDefs) > 0 {
+			onDone = state.removeEvent(statemachine.DoneEvent(state.id))
+		}
+		if len(state.events) > 0 {
+			stateConfig.set("on", state.onConfig())
+		}
+		if len(onDone) > 0 {
+			stateConfig.set("onDone", transitionsConfig(onDone))
+		}
+		if len(state.always) > 0 {
+			stateConfig.set("always", transitionsConfig(state.always))
+		}
+		if len(state.delays) > 0 {
+			after := object{}
+			for _, delay := range state.delays {
+				after.set(delay, transitionsConfig(state.after[delay]))
+			}
+			stateConfig.set("after", after)
+		}
+
+		switch statePath := joinPath(path, state.id); {
+		case len(submachineDefs) == 1:
+			if submachineDefs[0].ID != "" {
+				ex.warnf(statePath, "id '%s' of the submachine is not exported", submachineDefs[0].ID)
+			}
+			stateConfig = append(stateConfig, ex.machine(statePath, submachineDefs[0])...)
+		case len(submachineDefs) > 1:
+			regions := object{}
+			for i, submachineDef := range submachineDefs {
+				regionID := submachineDef.ID
+				if regionID == "" {
+					regionID = state.id + "-region" + strconv.Itoa(i)
+				}
+				regions.set(ex.region(joinPath(statePath, regionID), regionID, submachineDef))
+			}
+			stateConfig.set("states", regions)
+		}
+
+		stateConfigs.set(state.id, stateConfig)
+	}
+	config.set("states", stateConfigs)
+
+	return config
+}
+
+// region returns the config of a parallel submachine.
+func (ex *exporter) region(path, id string, def *statemachine.MachineDef) (string, interface{}) {
+	config := ex.machine(path, def)
+
+	// a submachine of a single state named after it is an atomic region.
+	if knownStates := def.KnownStates(); len(knownStates) == 1 && knownStates[0] == id {
+		states := config[len(config)-1].value.(object)
+		return id, states[0].value
+	}
+	return id, config
+}
+
+// removeEvent removes the transitions on event from the state, and returns
+// them.
+func (state *exportState) removeEvent(event string) []object {
+	configs, ok := state.on[event]
+	if !ok {
+		return nil
+	}
+	delete(state.on, event)
+	for i, e := range state.events {
+		if e == event {
+			state.events = append(state.events[:i], state.events[i+1:]...)
+			break
+		}
+	}
+	return configs
+}
+
+func (state *exportState) onConfig() object {
+	on := object{}
+	for _, event := range state.events {
+		on.set(event, transitionsConfig(state.on[event]))
+	}
+	return on
+}
+
+// transitionsConfig returns a single target, a transition config, or an
+// array of transition configs.
+func transitionsConfig(configs []object) interface{} {
+	if len(configs) > 1 {
+		return configs
+	}
+	if len(configs[0]) == 1 {
+		return configs[0][0].value
+	}
+	return configs[0]
+}
+
+// event adds the transitions of eventDef to the states they are from, or to
+// the root state for transitions of the root machine from any state.
+func (ex *exporter) event(states []*exportState, root *exportState, path, event string, eventDef *statemachine.EventDef, actions map[[2]string][]string) {
+	for _, transitionDef := range eventDef.Transitions {
+		guard, ok := ex.guard(path, event, transitionDef, "")
+		if !ok {
+			continue
+		}
+		transitionActions := ex.transitionActions(path, event, transitionDef)
+
+		if path == "" && len(transitionDef.From) == 0 && len(transitionDef.ExceptFrom) == 0 && eventDef.TimedEvery == 0 {
+			root.addTransition(event, eventDef.TimedEvery, newTransitionConfig(transitionDef.To, guard, transitionActions))
+			continue
+		}
+
+		for _, state := range states {
+			if transitionDef.Matches(state.id) {
+				config := newTransitionConfig(transitionDef.To, guard, joinActions(actions[[2]string{state.id, transitionDef.To}], transitionActions))
+				state.addTransition(event, eventDef.TimedEvery, config)
+			}
+		}
+	}
+
+	choiceDef := eventDef.Choice
+	if choiceDef == nil {
+		return
+	}
+	if choiceDef.Condition == nil || choiceDef.Condition.RegisteredFunc == "" {
+		ex.warnf(path, "choice on '%s' has a condition without a registered func", event)
+		return
+	}
+	if choiceDef.UnlessGuard != nil {
+		ex.warnf(path, "choice on '%s' with an unless guard is not supported", event)
+		return
+	}
+	condition := choiceDef.Condition.RegisteredFunc
+
+	// the transitions on false follow those on true, and are only taken when
+	// the condition fails, as long as the state has an unguarded transition
+	// on true.
+	onTrue := map[string]bool{}
+	if choiceDef.OnTrue != nil {
+		for _, transitionDef := range choiceDef.OnTrue.Transitions {
+			if _, ok := ex.guard(path, event, transitionDef, condition); !ok {
+				continue
+			}
+			transitionActions := ex.transitionActions(path, event, transitionDef)
+			for _, state := range states {
+				if transitionDef.Matches(state.id) {
+					config := newTransitionConfig(transitionDef.To, condition, joinActions(actions[[2]string{state.id, transitionDef.To}], transitionActions))
+					state.addTransition(event, eventDef.TimedEvery, config)
+					onTrue[state.id] = true
+				}
+			}
+		}
+	}
+	if choiceDef.OnFalse != nil {
+		for _, transitionDef := range choiceDef.OnFalse.Transitions {
+			guard, ok := ex.guard(path, event, transitionDef, "")
+			if !ok {
+				continue
+			}
+			transitionActions := ex.transitionActions(path, event, transitionDef)
+			for _, state := range states {
+				if !transitionDef.Matches(state.id) {
+					continue
+				}
+				if !onTrue[state.id] {
+					ex.warnf(path, "transition on '%s' from '%s' to '%s' when '%s' is false is not supported without a transition when it is true",
+						event, state.id, transitionDef.To, condition)
+					continue
+				}
+				config := newTransitionConfig(transitionDef.To, guard, joinActions(actions[[2]string{state.id, transitionDef.To}], transitionActions))
+				state.addTransition(event, eventDef.TimedEvery, config)
+			}
+		}
+	}
+}
+
+// always adds the eventless transitions to the states they are from.
+func (ex *exporter) always(states []*exportState, path string, transitionDefs []*statemachine.TransitionDef, actions map[[2]string][]string) {
+	for _, transitionDef := range transitionDefs {
+		guard, ok := ex.guard(path, "", transitionDef, "")
+		if !ok {
+			continue
+		}
+		transitionActions := ex.transitionActions(path, "", transitionDef)
+		for _, state := range states {
+			if transitionDef.Matches(state.id) {
+				config := newTransitionConfig(transitionDef.To, guard, joinActions(actions[[2]string{state.id, transitionDef.To}], transitionActions))
+				state.always = append(state.always, config)
+			}
+		}
+	}
+}
+
+// invokes adds the services to the states which invoke them.
+func (ex *exporter) invokes(states []*exportState, path string, invokeDefs []*statemachine.InvokeDef) {
+	for _, invokeDef := range invokeDefs {
+		if invokeDef.RegisteredFunc == "" {
+			ex.warnf(path, "invoked service '%s' without a registered func is not supported", invokeDef.ID)
+			continue
+		}
+		for _, state := range states {
+			if state.id == invokeDef.State {
+				state.invokes = append(state.invokes, invokeDef)
+			}
+		}
+	}
+}
+
+// invokeConfig returns the config of the services invoked by the state, or
+// of its single service. The transitions on the completion events of the
+// services are moved to their onDone and onError keys.
+func (state *exportState) invokeConfig() interface{} {
+	var configs []object
+	for _, invokeDef := range state.invokes {
+		config := object{}
+		config.set("id", invokeDef.ID)
+		config.set("src", invokeDef.RegisteredFunc)
+		if onDone := state.removeEvent(statemachine.InvokeDoneEvent(invokeDef.ID)); len(onDone) > 0 {
+			config.set("onDone", transitionsConfig(onDone))
+		}
+		if onError := state.removeEvent(statemachine.InvokeErrorEvent(invokeDef.ID)); len(onError) > 0 {
+			config.set("onError", transitionsConfig(onError))
+		}
+		configs = append(configs, config)
+	}
+	if len(configs) == 1 {
+		return configs[0]
+	}
+	return configs
+}
+
+// describeTransition names the transition on event, or the eventless
+// transition if event is empty, to the state, for warnings.
+func describeTransition(event, to string) string {
+	if event == "" {
+		return fmt.Sprintf("eventless transition to '%s'", to)
+	}
+	return fmt.Sprintf("transition on '%s' to '%s'", event, to)
+}
+
+// guard returns the name of the single guard of the transition, which must
+// be condition if it's set.
+func (ex *exporter) guard(path, event string, transitionDef *statemachine.TransitionDef, condition string) (string, bool) {
+	if len(transitionDef.Assigns) > 0 {
+		ex.warnf(path, "%s is exported without its assign actions", describeTransition(event, transitionDef.To))
+	}
+	if transitionDef.History != "" {
+		ex.warnf(path, "%s is exported without its %s history", describeTransition(event, transitionDef.To), transitionDef.History)
+	}
+	if len(transitionDef.Fork) != 0 || len(transitionDef.Join) != 0 {
+		ex.warnf(path, "%s is exported without its fork and join", describeTransition(event, transitionDef.To))
+	}
+	switch {
+	case len(transitionDef.UnlessGuards) > 0:
+		ex.warnf(path, "%s with an unless guard is not supported", describeTransition(event, transitionDef.To))
+		return "", false
+	case len(transitionDef.IfGuards) > 1 || len(transitionDef.IfGuards) == 1 && condition != "":
+		ex.warnf(path, "%s with multiple guards is not supported", describeTransition(event, transitionDef.To))
+		return "", false
+	case len(transitionDef.IfGuards) == 1 && transitionDef.IfGuards[0].IsCombined():
+		ex.warnf(path, "%s with a combined guard is not supported", describeTransition(event, transitionDef.To))
+		return "", false
+	case len(transitionDef.IfGuards) == 1 && transitionDef.IfGuards[0].Expr != "":
+		ex.warnf(path, "%s with a guard expression is not supported", describeTransition(event, transitionDef.To))
+		return "", false
+	case len(transitionDef.IfGuards) == 1 && transitionDef.IfGuards[0].RegisteredFunc == "":
+		ex.warnf(path, "%s has a guard without a registered func", describeTransition(event, transitionDef.To))
+		return "", false
+	case len(transitionDef.IfGuards) == 1:
+		return transitionDef.IfGuards[0].RegisteredFunc, true
+	}
+	return condition, true
+}
+
+// transitionActions returns the names of the actions of the transition,
+// which XState runs after the exit actions of the before callbacks.
+func (ex *exporter) transitionActions(path, event string, transitionDef *statemachine.TransitionDef) []string {
+	var names []string
+	for _, funcDef := range transitionDef.Do {
+		if funcDef.RegisteredFunc == "" {
+			ex.warnf(path, "action of %s without a registered func is not supported", describeTransition(event, transitionDef.To))
+			continue
+		}
+		names = append(names, funcDef.RegisteredFunc)
+	}
+	return names
+}
+
+func joinActions(callbackActions, transitionActions []string) []string {
+	if len(transitionActions) == 0 {
+		return callbackActions
+	}
+	return append(append([]string{}, callbackActions...), transitionActions...)
+}
+
+func newTransitionConfig(target, guard string, actions []string) object {
+	config := object{}
+	config.set("target", target)
+	if guard != "" {
+		config.set("guard", guard)
+	}
+	if len(actions) > 0 {
+		config.set("actions", actions)
+	}
+	return config
+}
+
+// callbacks maps after callbacks to states to entry actions, before
+// callbacks from states to exit actions, and before callbacks from states to
+// states to transition actions, which are returned by their from and to
+// states.
+func (ex *exporter) callbacks(states []*exportState, path string, def *statemachine.MachineDef) map[[2]string][]string {
+	actions := map[[2]string][]string{}
+
+	for i, callbackDefs := range [][]*statemachine.TransitionCallbackDef{def.BeforeCallbacks, def.AfterCallbacks} {
+		kind := []string{"before_transition", "after_transition"}[i]
+		for _, callbackDef := range callbackDefs {
+			if callbackDef.ExitToState != "" {
+				ex.warnf(path, "%s callback exiting to state '%s' is not supported", kind, callbackDef.ExitToState)
+			}
+
+			var names []string
+			for _, funcDef := range callbackDef.Do {
+				if funcDef.RegisteredFunc == "" {
+					ex.warnf(path, "%s callback func without a registered func is not supported", kind)
+					continue
+				}
+				names = append(names, funcDef.RegisteredFunc)
+			}
+			if len(names) == 0 {
+				continue
+			}
+
+			if len(callbackDef.ExceptFrom) > 0 || len(callbackDef.ExceptTo) > 0 {
+				ex.warnf(path, "%s callback %v with except filters is not supported", kind, names)
+				continue
+			}
+
+			switch {
+			case kind == "after_transition" && len(callbackDef.From) == 0:
+				for _, state := range states {
+					if len(callbackDef.To) == 0 || contains(callbackDef.To, state.id) {
+						state.entry = append(state.entry, names...)
+					}
+				}
+			case kind == "before_transition" && len(callbackDef.To) == 0:
+				for _, state := range states {
+					if len(callbackDef.From) == 0 || contains(callbackDef.From, state.id) {
+						state.exit = append(state.exit, names...)
+					}
+				}
+			case kind == "before_transition" && len(callbackDef.From) > 0:
+				for _, from := range callbackDef.From {
+					for _, to := range callbackDef.To {
+						key := [2]string{from, to}
+						actions[key] = append(actions[key], names...)
+					}
+				}
+			default:
+				ex.warnf(path, "%s callback %v filtered by both from and to states is not supported", kind, names)
+			}
+		}
+	}
+
+	for range def.AroundCallbacks {
+		ex.warnf(path, "around_transition callbacks are not supported")
+	}
+	for range def.BeforeEventCallbacks {
+		ex.warnf(path, "before_event callbacks are not supported")
+	}
+	for range def.AfterEventCallbacks {
+		ex.warnf(path, "after_event callbacks are not supported")
+	}
+	for range def.FailureCallbacks {
+		ex.warnf(path, "after_failure callbacks are not supported")
+	}
+
+	return actions
+}
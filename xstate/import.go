@@ -0,0 +1,620 @@
+package xstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Gurpartap/statemachine-go"
+)
+
+// Import decodes an XState JSON machine config into a MachineDef, and
+// validates it.
+//
+// The returned warnings list the config keys which were left out because
+// they have no equivalent in a MachineDef.
+func Import(data []byte) (*statemachine.MachineDef, []Warning, error) {
+	im := &importer{}
+
+	root, err := im.node("", data, "id", "initial", "type", "states", "on")
+	if err != nil {
+		return nil, nil, err
+	}
+	if root.Type == "parallel" {
+		im.warnf("type", "parallel machines are imported as compound machines")
+	}
+
+	def, err := im.machine("", root)
+	if err != nil {
+		return nil, im.warnings, err
+	}
+	def.ID = root.ID
+
+	if err := def.Validate(); err != nil {
+		return nil, im.warnings, err
+	}
+	return def, im.warnings, nil
+}
+
+// stateNode is a decoded XState state node config.
+type stateNode struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Initial string          `json:"initial"`
+	States  json.RawMessage `json:"states"`
+	On      json.RawMessage `json:"on"`
+	After   json.RawMessage `json:"after"`
+	Entry   json.RawMessage `json:"entry"`
+	Exit    json.RawMessage `json:"exit"`
+	OnDone  json.RawMessage `json:"onDone"`
+	Always  json.RawMessage `json:"always"`
+	Invoke  json.RawMessage `json:"invoke"`
+}
+
+// invokeConfig is a decoded XState invoke config.
+type invokeConfig struct {
+	ID      string          `json:"id"`
+	Src     json.RawMessage `json:"src"`
+	OnDone  json.RawMessage `json:"onDone"`
+	OnError json.RawMessage `json:"onError"`
+}
+
+// transitionConfig is a decoded XState transition config.
+type transitionConfig struct {
+	Target  json.RawMessage `json:"target"`
+	Guard   json.RawMessage `json:"guard"`
+	Cond    json.RawMessage `json:"cond"`
+	Actions json.RawMessage `json:"actions"`
+}
+
+type importer struct {
+	warnings []Warning
+}
+
+func (im *importer) warnf(path string, format string, args ...interface{}) {
+	im.warnings = append(im.warnings, Warning{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// pendingTransition is an event transition, or an eventless one, held back
+// until all states at its level are known.
+type pendingTransition struct {
+	path       string
+	event      string
+	always     bool
+	timedEvery time.Duration
+	def        *statemachine.TransitionDef
+}
+
+// node decodes a state node, and warns about its keys which aren't listed as
+// known.
+func (im *importer) node(path string, raw json.RawMessage, known ...string) (*stateNode, error) {
+	keys, _, err := decodeObject(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", pathOrRoot(path), err)
+	}
+	for _, key := range keys {
+		if !contains(known, key) {
+			im.warnf(joinPath(path, key), "key '%s' is not supported", key)
+		}
+	}
+
+	node := &stateNode{}
+	if err := json.Unmarshal(raw, node); err != nil {
+		return nil, fmt.Errorf("%s: %s", pathOrRoot(path), err)
+	}
+	return node, nil
+}
+
+// machine maps the child states of node into a MachineDef. Transitions of
+// the root node are from any state.
+func (im *importer) machine(path string, node *stateNode) (*statemachine.MachineDef, error) {
+	def := statemachine.NewMachineDef()
+
+	var transitions []*pendingTransition
+	if len(node.States) > 0 {
+		keys, values, err := decodeObject(node.States)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", joinPath(path, "states"), err)
+		}
+		for _, key := range keys {
+			stateTransitions, err := im.state(def, joinPath(path, "states."+key), key, values[key])
+			if err != nil {
+				return nil, err
+			}
+			transitions = append(transitions, stateTransitions...)
+		}
+	}
+
+	if path == "" && len(node.On) > 0 {
+		rootTransitions, err := im.on(path, "", node.On)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, rootTransitions...)
+	}
+
+	def.InitialState = node.Initial
+	if def.InitialState == "" && len(def.States) > 0 {
+		def.InitialState = def.States[0]
+	}
+
+	im.addTransitions(def, transitions)
+	return def, nil
+}
+
+// addTransitions adds the transitions which target states of def.
+func (im *importer) addTransitions(def *statemachine.MachineDef, transitions []*pendingTransition) {
+	for _, transition := range transitions {
+		if !isKnownState(def, transition.def.To) {
+			im.warnf(transition.path, "target '%s' is not a sibling state", transition.def.To)
+			continue
+		}
+		if transition.always {
+			def.AddAlways(transition.def)
+			continue
+		}
+
+		eventDef, ok := def.Events[transition.event]
+		if !ok {
+			eventDef = &statemachine.EventDef{TimedEvery: transition.timedEvery}
+			def.AddEvent(transition.event, eventDef)
+		}
+		eventDef.AddTransition(transition.def)
+	}
+}
+
+// state adds the state to def, and returns its event transitions.
+func (im *importer) state(def *statemachine.MachineDef, path, id string, raw json.RawMessage) ([]*pendingTransition, error) {
+	node, err := im.node(path, raw, "id", "type", "initial", "states", "on", "after", "entry", "exit", "onDone", "always", "invoke")
+	if err != nil {
+		return nil, err
+	}
+
+	switch node.Type {
+	case "", "atomic", "compound", "parallel":
+	case "final":
+		def.SetFinalStates(id)
+	default:
+		im.warnf(path, "state type '%s' is not supported", node.Type)
+		return nil, nil
+	}
+	if node.ID != "" {
+		im.warnf(joinPath(path, "id"), "state ids are not supported")
+	}
+
+	def.SetStates(id)
+
+	transitions, err := im.on(path, id, node.On)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(node.After) > 0 {
+		delays, values, err := decodeObject(node.After)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", joinPath(path, "after"), err)
+		}
+		for _, delay := range delays {
+			delayPath := joinPath(path, "after."+delay)
+			ms, err := strconv.Atoi(delay)
+			if err != nil || ms <= 0 {
+				im.warnf(delayPath, "delay '%s' is not a number of milliseconds", delay)
+				continue
+			}
+			delayTransitions, err := im.transitions(delayPath, id, values[delay])
+			if err != nil {
+				return nil, err
+			}
+			if len(delayTransitions) > 0 {
+				im.warnf(delayPath, "delay '%s' is imported as a timed event, which fires every %s rather than once after entering the state", delay, time.Duration(ms)*time.Millisecond)
+			}
+			for _, transition := range delayTransitions {
+				transition.event = afterEvent(ms)
+				transition.timedEvery = time.Duration(ms) * time.Millisecond
+			}
+			transitions = append(transitions, delayTransitions...)
+		}
+	}
+
+	if len(node.OnDone) > 0 {
+		donePath := joinPath(path, "onDone")
+		if len(node.States) == 0 {
+			im.warnf(donePath, "'onDone' of atomic state '%s' is not supported", id)
+		} else {
+			doneTransitions, err := im.transitions(donePath, id, node.OnDone)
+			if err != nil {
+				return nil, err
+			}
+			for _, transition := range doneTransitions {
+				transition.event = statemachine.DoneEvent(id)
+			}
+			transitions = append(transitions, doneTransitions...)
+		}
+	}
+
+	if len(node.Always) > 0 {
+		alwaysTransitions, err := im.transitions(joinPath(path, "always"), id, node.Always)
+		if err != nil {
+			return nil, err
+		}
+		for _, transition := range alwaysTransitions {
+			transition.always = true
+		}
+		transitions = append(transitions, alwaysTransitions...)
+	}
+
+	if len(node.Invoke) > 0 {
+		invokeTransitions, err := im.invokes(def, joinPath(path, "invoke"), id, node.Invoke)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, invokeTransitions...)
+	}
+
+	if funcDefs, err := im.actions(joinPath(path, "entry"), node.Entry); err != nil {
+		return nil, err
+	} else if len(funcDefs) > 0 {
+		def.AddAfterCallback(&statemachine.TransitionCallbackDef{To: []string{id}, Do: funcDefs})
+	}
+	if funcDefs, err := im.actions(joinPath(path, "exit"), node.Exit); err != nil {
+		return nil, err
+	} else if len(funcDefs) > 0 {
+		def.AddBeforeCallback(&statemachine.TransitionCallbackDef{From: []string{id}, Do: funcDefs})
+	}
+
+	if len(node.States) == 0 {
+		return transitions, nil
+	}
+
+	if node.Type != "parallel" {
+		submachineDef, err := im.machine(path, node)
+		if err != nil {
+			return nil, err
+		}
+		def.SetSubmachine(id, submachineDef)
+		return transitions, nil
+	}
+
+	regions, values, err := decodeObject(node.States)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", joinPath(path, "states"), err)
+	}
+	for _, region := range regions {
+		submachineDef, err := im.region(joinPath(path, "states."+region), region, values[region])
+		if err != nil {
+			return nil, err
+		}
+		def.SetSubmachine(id, submachineDef)
+	}
+
+	return transitions, nil
+}
+
+// invokes adds the services invoked by the state to def, and returns the
+// transitions on their completion events. Services without an id are named
+// after the state.
+func (im *importer) invokes(def *statemachine.MachineDef, path, state string, raw json.RawMessage) ([]*pendingTransition, error) {
+	var configs []json.RawMessage
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		configs = []json.RawMessage{raw}
+	}
+
+	var transitions []*pendingTransition
+	for i, raw := range configs {
+		configPath := path
+		if len(configs) > 1 {
+			configPath = fmt.Sprintf("%s[%d]", path, i)
+		}
+
+		keys, _, err := decodeObject(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", configPath, err)
+		}
+		for _, key := range keys {
+			if !contains([]string{"id", "src", "onDone", "onError"}, key) {
+				im.warnf(joinPath(configPath, key), "key '%s' is not supported", key)
+			}
+		}
+		config := &invokeConfig{}
+		if err := json.Unmarshal(raw, config); err != nil {
+			return nil, fmt.Errorf("%s: %s", configPath, err)
+		}
+
+		if len(config.Src) == 0 {
+			im.warnf(configPath, "invoke without a src is not supported")
+			continue
+		}
+		name, err := im.funcName(joinPath(configPath, "src"), config.Src)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			continue
+		}
+		id := config.ID
+		if id == "" {
+			id = state
+		}
+		def.AddInvoke(&statemachine.InvokeDef{ID: id, State: state, RegisteredFunc: name})
+
+		completions := []struct {
+			key   string
+			event string
+			raw   json.RawMessage
+		}{
+			{"onDone", statemachine.InvokeDoneEvent(id), config.OnDone},
+			{"onError", statemachine.InvokeErrorEvent(id), config.OnError},
+		}
+		for _, completion := range completions {
+			if len(completion.raw) == 0 {
+				continue
+			}
+			eventTransitions, err := im.transitions(joinPath(configPath, completion.key), state, completion.raw)
+			if err != nil {
+				return nil, err
+			}
+			for _, transition := range eventTransitions {
+				transition.event = completion.event
+			}
+			transitions = append(transitions, eventTransitions...)
+		}
+	}
+	return transitions, nil
+}
+
+// region maps a child of a parallel state node into a submachine.
+func (im *importer) region(path, id string, raw json.RawMessage) (*statemachine.MachineDef, error) {
+	node := &stateNode{}
+	if err := json.Unmarshal(raw, node); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if len(node.States) == 0 {
+		// an atomic region is a submachine of its single state.
+		def := statemachine.NewMachineDef()
+		def.ID = id
+		transitions, err := im.state(def, path, id, raw)
+		if err != nil {
+			return nil, err
+		}
+		def.InitialState = id
+		im.addTransitions(def, transitions)
+		return def, nil
+	}
+
+	node, err := im.node(path, raw, "id", "type", "initial", "states", "on", "after", "entry", "exit")
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range []json.RawMessage{node.On, node.After, node.Entry, node.Exit} {
+		if key := []string{"on", "after", "entry", "exit"}[i]; len(value) > 0 {
+			im.warnf(joinPath(path, key), "'%s' of parallel region '%s' is not supported", key, id)
+		}
+	}
+	if node.Type == "parallel" {
+		im.warnf(path, "nested parallel region '%s' is imported as a compound state", id)
+	}
+
+	def, err := im.machine(path, node)
+	if err != nil {
+		return nil, err
+	}
+	def.ID = id
+	return def, nil
+}
+
+// on decodes the event transitions of a state node, from the state.
+func (im *importer) on(path, from string, raw json.RawMessage) ([]*pendingTransition, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	events, values, err := decodeObject(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", joinPath(path, "on"), err)
+	}
+
+	var transitions []*pendingTransition
+	for _, event := range events {
+		eventPath := joinPath(path, "on."+event)
+		if event == "" || strings.Contains(event, "*") {
+			im.warnf(eventPath, "event descriptor '%s' is not supported", event)
+			continue
+		}
+		eventTransitions, err := im.transitions(eventPath, from, values[event])
+		if err != nil {
+			return nil, err
+		}
+		for _, transition := range eventTransitions {
+			transition.event = event
+		}
+		transitions = append(transitions, eventTransitions...)
+	}
+	return transitions, nil
+}
+
+// transitions decodes a target, a transition config, or an array of either.
+func (im *importer) transitions(path, from string, raw json.RawMessage) ([]*pendingTransition, error) {
+	var configs []json.RawMessage
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		configs = []json.RawMessage{raw}
+	}
+
+	var transitions []*pendingTransition
+	for i, raw := range configs {
+		configPath := path
+		if len(configs) > 1 {
+			configPath = fmt.Sprintf("%s[%d]", path, i)
+		}
+
+		config := &transitionConfig{}
+		var target string
+		if err := json.Unmarshal(raw, &target); err == nil {
+			config.Target = raw
+		} else {
+			keys, _, err := decodeObject(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", configPath, err)
+			}
+			for _, key := range keys {
+				if !contains([]string{"target", "guard", "cond", "actions"}, key) {
+					im.warnf(joinPath(configPath, key), "key '%s' is not supported", key)
+				}
+			}
+			if err := json.Unmarshal(raw, config); err != nil {
+				return nil, fmt.Errorf("%s: %s", configPath, err)
+			}
+		}
+
+		transition, err := im.transition(configPath, from, config)
+		if err != nil {
+			return nil, err
+		}
+		if transition != nil {
+			transitions = append(transitions, transition)
+		}
+	}
+	return transitions, nil
+}
+
+func (im *importer) transition(path, from string, config *transitionConfig) (*pendingTransition, error) {
+	var targets []string
+	if len(config.Target) > 0 {
+		var target string
+		if err := json.Unmarshal(config.Target, &target); err == nil {
+			targets = []string{target}
+		} else if err := json.Unmarshal(config.Target, &targets); err != nil {
+			return nil, fmt.Errorf("%s: target must be a string or an array of strings", path)
+		}
+	}
+
+	switch {
+	case len(targets) == 0 || targets[0] == "":
+		im.warnf(path, "targetless transitions are not supported")
+		return nil, nil
+	case len(targets) > 1:
+		im.warnf(path, "transitions to multiple targets are not supported")
+		return nil, nil
+	case strings.HasPrefix(targets[0], ".") || strings.HasPrefix(targets[0], "#"):
+		im.warnf(path, "target '%s' is not a sibling state", targets[0])
+		return nil, nil
+	}
+
+	transitionDef := &statemachine.TransitionDef{To: targets[0]}
+	if from != "" {
+		transitionDef.From = []string{from}
+	}
+
+	guard := config.Guard
+	if len(guard) == 0 {
+		guard = config.Cond
+	}
+	if len(guard) > 0 {
+		name, err := im.funcName(joinPath(path, "guard"), guard)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			return nil, nil
+		}
+		transitionDef.IfGuards = []*statemachine.TransitionGuardDef{{RegisteredFunc: name}}
+	}
+
+	actions, err := im.actions(joinPath(path, "actions"), config.Actions)
+	if err != nil {
+		return nil, err
+	}
+
+	transitionDef.Do = actions
+	return &pendingTransition{path: path, def: transitionDef}, nil
+}
+
+// actions decodes a named action, or an array of them.
+func (im *importer) actions(path string, raw json.RawMessage) ([]*statemachine.TransitionCallbackFuncDef, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var actions []json.RawMessage
+	if err := json.Unmarshal(raw, &actions); err != nil {
+		actions = []json.RawMessage{raw}
+	}
+
+	var funcDefs []*statemachine.TransitionCallbackFuncDef
+	for i, action := range actions {
+		actionPath := path
+		if len(actions) > 1 {
+			actionPath = fmt.Sprintf("%s[%d]", path, i)
+		}
+		name, err := im.funcName(actionPath, action)
+		if err != nil {
+			return nil, err
+		}
+		if name != "" {
+			funcDefs = append(funcDefs, &statemachine.TransitionCallbackFuncDef{RegisteredFunc: name})
+		}
+	}
+	return funcDefs, nil
+}
+
+// funcName decodes a named guard or action, either as a string or as an
+// object with a type key. Parameterized guards and actions are not
+// supported, and have an empty name.
+func (im *importer) funcName(path string, raw json.RawMessage) (string, error) {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return name, nil
+	}
+
+	keys, values, err := decodeObject(raw)
+	if err != nil {
+		return "", fmt.Errorf("%s: must be a name or an object with a type", path)
+	}
+	for _, key := range keys {
+		if key != "type" {
+			im.warnf(path, "parameterized guards and actions are not supported")
+			return "", nil
+		}
+	}
+	if err := json.Unmarshal(values["type"], &name); err != nil || name == "" {
+		return "", fmt.Errorf("%s: type must be a name", path)
+	}
+	return name, nil
+}
+
+// afterEvent returns the name of the timed event for a delay.
+func afterEvent(ms int) string {
+	return fmt.Sprintf("xstate.after(%d)", ms)
+}
+
+func isKnownState(def *statemachine.MachineDef, state string) bool {
+	return contains(def.KnownStates(), state)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "machine"
+	}
+	return path
+}
@@ -0,0 +1,123 @@
+// Package xstate converts between XState JSON machine configs and state
+// machine definitions, so that the same definition file can drive both an
+// XState frontend and a Go backend.
+//
+// XState config keys are mapped to a MachineDef as follows:
+//
+//	states                        states
+//	initial                       initial state
+//	states with child states      state with a submachine
+//	type: "parallel"              state with a submachine per child region
+//	on: { event: target }         event transition from the state
+//	on (of the machine)           event transition from any state
+//	after: { 1000: target }       transition on a timed event "xstate.after(1000)"
+//	type: "final"                 final state
+//	onDone                        transition on the completion event "done.<state>"
+//	always                        eventless transition from the state
+//	invoke: { id, src }           service invoked by the state, by RegisteredFunc name
+//	onDone, onError (of invoke)   transition on "done.invoke.<id>", "error.invoke.<id>"
+//	guard (or cond)               if guard, by RegisteredFunc name
+//	entry                         after callback, to the state
+//	exit                          before callback, from the state
+//	actions (of a transition)     transition actions
+//
+// Guards and actions are named, as strings or as objects with a `type` key,
+// and refer to funcs registered with statemachine.RegisterFunc.
+//
+// Note that the timed events which after delays map to don't behave the
+// same: a timed event fires every TimedEvery interval from the time the
+// machine is built, whatever its state, while an after delay fires once,
+// after the state has been entered for the delay. Both conversions are
+// reported as a Warning.
+//
+// Anything that can't be mapped, in either direction, is left out and
+// reported as a Warning.
+package xstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Warning describes a part of a config or definition which was left out of the
+// result because it can't be mapped.
+type Warning struct {
+	// Path locates the config key, such as `states.running.on.stop`, or
+	// the submachine state path when exporting.
+	Path    string
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Path == "" {
+		return w.Message
+	}
+	return fmt.Sprintf("%s: %s", w.Path, w.Message)
+}
+
+// object is a JSON object which keeps the order of its members.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func (o *object) set(key string, value interface{}) {
+	*o = append(*o, member{key: key, value: value})
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeObject decodes a JSON object into its members, in order.
+func decodeObject(raw json.RawMessage) ([]string, map[string]json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if token != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected an object")
+	}
+
+	var keys []string
+	values := map[string]json.RawMessage{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+	return keys, values, nil
+}
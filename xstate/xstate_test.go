@@ -0,0 +1,130 @@
+package xstate_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Gurpartap/statemachine-go"
+	"github.com/Gurpartap/statemachine-go/xstate"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	machineDef, err := statemachine.LoadYAML([]byte(`
+id: player
+states: [idle, playing]
+initial_state: idle
+events:
+  play:
+    transitions:
+      - from: [idle]
+        to: playing
+        if: [hasMedia]
+  stop:
+    transitions:
+      - to: idle
+  xstate.after(5000):
+    timed_every: 5s
+    transitions:
+      - from: [playing]
+        to: idle
+  toggle:
+    choice:
+      condition: isMuted
+      on_true:
+        transitions:
+          - from: [idle]
+            to: playing
+      on_false:
+        transitions:
+          - from: [idle]
+            to: idle
+            if: [isLooping]
+  done.playing:
+    transitions:
+      - from: [playing]
+        to: idle
+  done.invoke.loader:
+    transitions:
+      - from: [idle]
+        to: playing
+  error.invoke.loader:
+    transitions:
+      - from: [idle]
+        to: idle
+always:
+  - from: [idle]
+    to: playing
+    if: [isAutoplay]
+invoke:
+  - state: idle
+    id: loader
+    src: fetchMedia
+submachines:
+  playing:
+    - id: video
+      states: [buffering, rendering]
+      initial_state: buffering
+      final_states: [rendering]
+      events:
+        buffered:
+          transitions:
+            - from: [buffering]
+              to: rendering
+    - id: audio
+      states: [audio]
+      initial_state: audio
+      final_states: [audio]
+before_transition:
+  - from: [playing]
+    do: [releaseMedia]
+  - from: [idle]
+    to: [playing]
+    do: [loadMedia]
+after_transition:
+  - to: [playing]
+    do: [acquireMedia]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, warnings, err := xstate.Export(machineDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the timed event fires every 5s, which an after delay can't express.
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, "exported as an after delay") {
+		t.Errorf("unexpected export warnings: %v", warnings)
+	}
+
+	importedDef, warnings, err := xstate.Import(config)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, config)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, "imported as a timed event") {
+		t.Errorf("unexpected import warnings: %v", warnings)
+	}
+
+	// the choice is flattened into guarded transitions, callbacks are
+	// ordered by state, and the before callback from idle to playing is
+	// imported as actions of the transitions.
+	reexported, _, err := xstate.Export(importedDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reexported, config) {
+		t.Errorf("round trip changed the config:\n got: %s\nwant: %s", reexported, config)
+	}
+
+	events, _ := json.Marshal(importedDef.Events["play"])
+	if want := `{"Transitions":[{"From":["idle"],"To":"playing","IfGuards":[{"RegisteredFunc":"hasMedia"}],"Do":[{"RegisteredFunc":"loadMedia"}]}]}`; string(events) != want {
+		t.Errorf("unexpected play event:\n got: %s\nwant: %s", events, want)
+	}
+
+	invokes, _ := json.Marshal(importedDef.Invokes)
+	if want := `[{"ID":"loader","State":"idle","RegisteredFunc":"fetchMedia"}]`; string(invokes) != want {
+		t.Errorf("unexpected invokes:\n got: %s\nwant: %s", invokes, want)
+	}
+}